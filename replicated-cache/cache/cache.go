@@ -0,0 +1,279 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+Package cache embeds a replicated cache node in a Go program, so a service can hold the cache
+in-process instead of running cache-node beside it. New starts a node configured by functional
+options; its Get, Set and Delete work on the node's memory directly, and writes replicate to the
+peers as they would from cache-node:
+
+	c, err := cache.New(
+		cache.WithAddr(":8081"),
+		cache.WithPeers("http://10.0.0.2:8081", "http://10.0.0.3:8081"),
+		cache.WithTTLDefault(10*time.Minute),
+	)
+	defer c.Close()
+	err = c.Set(ctx, "user:1", []byte("ann"), &cache.WriteOptions{Min: 1})
+	v, err := c.Get(ctx, "user:1") // cache.ErrNotFound when missing
+
+Embedded nodes, cache-node processes and Go clients (package client) can share a cluster: with
+WithAddr the node serves the same HTTP API, peers included, and programs that already run an HTTP
+server can mount Handler on it instead. Calls made through a Cache are trusted and skip
+authentication, ACLs and rate limits, which apply to network callers only.
+
+Functions:
+- New(opts ...Option): (*Cache, error)
+- (*Cache) Get(ctx context.Context, key string): ([]byte, error)
+- (*Cache) Set(ctx context.Context, key string, value []byte, o *WriteOptions): error
+- (*Cache) Delete(ctx context.Context, key string, o *WriteOptions): error
+- (*Cache) OnSet(fn func(key string, value []byte))
+- (*Cache) OnDelete(fn func(key string))
+- (*Cache) OnExpire(fn func(key string))
+- (*Cache) OnEvict(fn func(key string))
+- (*Cache) ExpireNow()
+- (*Cache) Handler(): http.Handler
+- (*Cache) Addr(): string
+- (*Cache) Close(): error
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	icache "github.com/you/replicated-cache/internal/cache"
+)
+
+// Errors returned by a Cache; test for them with errors.Is.
+var (
+	ErrNotFound   = icache.ErrNotFound   // Get of a key the cache does not hold
+	ErrWriteLost  = icache.ErrWriteLost  // a newer version of the key already exists
+	ErrOverloaded = icache.ErrOverloaded // the node is shedding writes; retry later
+	ErrTooLarge   = icache.ErrTooLarge   // the value exceeds the node's size limit
+	ErrClosed     = errors.New("cache: closed")
+)
+
+// WriteOptions tune Set and Delete; nil means the defaults, as in package
+// client.
+type WriteOptions struct {
+	TTL  time.Duration // expire after this long; 0 uses WithTTLDefault (Set only)
+	Min  int           // wait for this many peer acknowledgements
+	Full bool          // wait for every peer to acknowledge
+}
+
+// Cache is an embedded cache node. Its methods are safe for concurrent use.
+type Cache struct {
+	node    *icache.Node
+	handler http.Handler
+	ttl     time.Duration
+	srv     *http.Server
+	ln      net.Listener
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// New starts a node: it replays WithWAL's log, listens on WithAddr and
+// starts heartbeats to the peers, expiry and hinted handoff. Close stops it.
+func New(opts ...Option) (*Cache, error) {
+	var cfg config
+	for _, o := range opts {
+		if err := o(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	var ln net.Listener
+	if cfg.addr != "" {
+		var err error
+		if ln, err = net.Listen("tcp", cfg.addr); err != nil {
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+	}
+	if cfg.id == "" {
+		addr := cfg.addr
+		if ln != nil {
+			addr = ln.Addr().String()
+		}
+		cfg.id = fmt.Sprintf("%s#%04x", addr, rand.Uint32())
+	}
+
+	n := icache.NewNode(cfg.id, cfg.addr, cfg.peers)
+	log := slog.Default()
+	if cfg.log != nil {
+		log = cfg.log
+		n.SetLogger(log)
+	}
+	n.Store().MaxKeys = cfg.maxKeys
+	n.Store().MaxBytes = cfg.maxMemory
+	if err := n.Store().SetEviction(cfg.eviction); err != nil {
+		closeListener(ln)
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	n.CompressAbove = cfg.compress
+	n.Loader = cfg.loader
+	n.SyncSecrets = cfg.syncSecrets
+	n.Clock = cfg.clock
+	if cfg.tls != nil || cfg.transport != nil {
+		tr := icache.DefaultTransportOptions()
+		tr.TLS = cfg.tls
+		tr.RoundTripper = cfg.transport
+		n.SetTransport(tr)
+	}
+	if cfg.wal != "" {
+		if err := n.OpenWAL(cfg.wal, 0); err != nil {
+			closeListener(ln)
+			return nil, fmt.Errorf("cache: %w", err)
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	c := &Cache{node: n, handler: n.Routes(), ttl: cfg.ttl, ln: ln, stop: stop, closed: make(chan struct{})}
+	for _, loop := range []func(context.Context){n.HeartbeatLoop, n.JanitorLoop, n.HintLoop} {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			loop(ctx)
+		}()
+	}
+	if ln != nil {
+		c.srv = &http.Server{
+			Handler:           c.handler,
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		}
+		if cfg.tls != nil {
+			c.ln = tls.NewListener(ln, cfg.tls)
+		}
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			if err := c.srv.Serve(c.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("embedded cache stopped serving", "node_id", n.ID, "err", err)
+			}
+		}()
+	}
+	return c, nil
+}
+
+func closeListener(ln net.Listener) {
+	if ln != nil {
+		ln.Close()
+	}
+}
+
+// Get returns key's value, or ErrNotFound. The value is the caller's to
+// keep and change.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	return c.node.Get(ctx, key)
+}
+
+// Set writes key and replicates it to the peers, waiting for o.Min (or, with
+// o.Full, all) of them to acknowledge.
+func (c *Cache) Set(ctx context.Context, key string, value []byte, o *WriteOptions) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if o == nil {
+		o = &WriteOptions{}
+	}
+	ttl := o.TTL
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	return c.node.Set(ctx, key, value, ttl, o.Min, o.Full)
+}
+
+// Delete removes key and replicates the deletion like Set.
+func (c *Cache) Delete(ctx context.Context, key string, o *WriteOptions) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	if o == nil {
+		o = &WriteOptions{}
+	}
+	return c.node.Delete(ctx, key, o.Min, o.Full)
+}
+
+// OnSet registers fn to run after each write the node applies, whether made
+// through this Cache, over the network or by a peer, for keeping derived state
+// such as local indexes. Hooks run synchronously on the goroutine making the
+// change, possibly concurrently, so fn must be quick and must not write to the
+// cache. Writes replayed from WithWAL during New come before any hook.
+func (c *Cache) OnSet(fn func(key string, value []byte)) {
+	c.node.OnSet(func(key string, it icache.Item) { fn(key, bytes.Clone(it.Value)) })
+}
+
+// OnDelete registers fn to run after each delete the node applies, like OnSet.
+func (c *Cache) OnDelete(fn func(key string)) { c.node.OnDelete(fn) }
+
+// OnExpire registers fn to run after a key's TTL runs out on this node.
+func (c *Cache) OnExpire(fn func(key string)) { c.node.OnExpire(fn) }
+
+// OnEvict registers fn to run after a key is evicted from this node to stay
+// within WithMaxKeys or WithMaxMemory.
+func (c *Cache) OnEvict(fn func(key string)) { c.node.OnEvict(fn) }
+
+// ExpireNow removes expired keys at once rather than at the node's next
+// periodic pass, e.g. after moving a WithClock clock forward. Expired keys
+// are never returned either way; ExpireNow frees their memory and runs
+// OnExpire hooks.
+func (c *Cache) ExpireNow() { c.node.ExpireNow() }
+
+// Handler returns the node's HTTP API, for programs that serve it from their
+// own server instead of WithAddr. Peers must be able to reach it at the URL
+// they were given for this node.
+func (c *Cache) Handler() http.Handler { return c.handler }
+
+// Addr returns the address WithAddr listens on, with the port chosen when it
+// asked for port 0, or "" without WithAddr.
+func (c *Cache) Addr() string {
+	if c.ln == nil {
+		return ""
+	}
+	return c.ln.Addr().String()
+}
+
+func (c *Cache) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the node: it stops serving, waiting up to five seconds for
+// requests in flight, stops its background work and closes the WAL.
+func (c *Cache) Close() error {
+	var err error
+	c.once.Do(func() {
+		close(c.closed)
+		if c.srv != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err = c.srv.Shutdown(ctx)
+			cancel()
+		}
+		c.stop()
+		c.wg.Wait()
+		if werr := c.node.CloseWAL(); werr != nil && err == nil {
+			err = werr
+		}
+	})
+	return err
+}
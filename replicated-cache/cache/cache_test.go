@@ -0,0 +1,163 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the embedding API.
+
+List of functions:
+	- TestEmbeddedCluster: Tests two embedded nodes replicating writes and deletes.
+	- TestEmbeddedStandalone: Tests the default TTL, value copies and Close.
+	- TestOptionErrors: Tests that New rejects bad options.
+	- TestHooks: Tests that set, delete, expire and evict hooks see the node's changes.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmbeddedCluster(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(WithID("a"), WithAddr("127.0.0.1:0"))
+	if err != nil { t.Fatal(err) }
+	defer a.Close()
+	b, err := New(WithID("b"), WithAddr("127.0.0.1:0"), WithPeers("http://"+a.Addr()))
+	if err != nil { t.Fatal(err) }
+	defer b.Close()
+
+	if err := b.Set(ctx, "user:1", []byte("ann"), &WriteOptions{Min: 1}); err != nil { t.Fatal(err) }
+	v, err := a.Get(ctx, "user:1")
+	if err != nil || string(v) != "ann" {
+		t.Fatalf("replicated Get = %q, %v", v, err)
+	}
+
+	// The embedded node serves the HTTP API too.
+	resp, err := http.Get("http://" + a.Addr() + "/kv/user:1")
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("HTTP GET: %d", resp.StatusCode)
+	}
+
+	if err := b.Delete(ctx, "user:1", &WriteOptions{Full: true}); err != nil { t.Fatal(err) }
+	if _, err := a.Get(ctx, "user:1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after replicated Delete: %v", err)
+	}
+}
+
+func TestEmbeddedStandalone(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(WithTTLDefault(50 * time.Millisecond))
+	if err != nil { t.Fatal(err) }
+	if c.Addr() != "" {
+		t.Fatalf("Addr without WithAddr: %q", c.Addr())
+	}
+
+	value := []byte("v1")
+	if err := c.Set(ctx, "short", value, nil); err != nil { t.Fatal(err) }
+	if err := c.Set(ctx, "long", value, &WriteOptions{TTL: time.Hour}); err != nil { t.Fatal(err) }
+	value[1] = '2'
+	got, err := c.Get(ctx, "long")
+	if err != nil || string(got) != "v1" {
+		t.Fatalf("Get = %q, %v; the cache should keep its own copy", got, err)
+	}
+	got[1] = '3'
+	if again, _ := c.Get(ctx, "long"); string(again) != "v1" {
+		t.Fatalf("changing a returned value changed the cache: %q", again)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Get(ctx, "short"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("key past the default TTL: %v", err)
+	}
+	if _, err := c.Get(ctx, "long"); err != nil {
+		t.Fatalf("key with its own TTL: %v", err)
+	}
+
+	if err := c.Close(); err != nil { t.Fatal(err) }
+	if err := c.Set(ctx, "k", value, nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Set after Close: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"peer scheme":   WithPeers("ftp://x:21"),
+		"short secret":  WithSyncSecrets("short"),
+		"negative TTL":  WithTTLDefault(-time.Second),
+		"eviction":      WithEviction("fifo"),
+		"listen":        WithAddr("256.0.0.1:0"),
+	} {
+		if c, err := New(opt); err == nil {
+			c.Close()
+			t.Errorf("%s: New succeeded", name)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(WithMaxKeys(3), WithCompressAbove(16))
+	if err != nil { t.Fatal(err) }
+	defer c.Close()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(ev string) func(string) {
+		return func(key string) {
+			mu.Lock()
+			events = append(events, ev+" "+key)
+			mu.Unlock()
+		}
+	}
+	long := bytes.Repeat([]byte("abcd"), 64)
+	c.OnSet(func(key string, value []byte) {
+		if key == "big" && !bytes.Equal(value, long) {
+			t.Errorf("OnSet got a %d-byte value, want the plain %d bytes", len(value), len(long))
+		}
+		record("set")(key)
+	})
+	c.OnDelete(record("del"))
+	c.OnExpire(record("expire"))
+	c.OnEvict(record("evict"))
+
+	if err := c.Set(ctx, "big", long, nil); err != nil { t.Fatal(err) }
+	if err := c.Set(ctx, "brief", []byte("x"), &WriteOptions{TTL: 20 * time.Millisecond}); err != nil { t.Fatal(err) }
+	if err := c.Delete(ctx, "big", nil); err != nil { t.Fatal(err) }
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.Get(ctx, "brief"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expired key: %v", err)
+	}
+	// The tombstone left by Delete does not count against WithMaxKeys.
+	for _, k := range []string{"k1", "k2", "k3", "k4"} {
+		if err := c.Set(ctx, k, []byte("v"), nil); err != nil { t.Fatal(err) }
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"set big", "set brief", "del big", "expire brief", "set k1", "set k2", "set k3"}
+	if len(events) < len(want)+2 {
+		t.Fatalf("events = %q", events)
+	}
+	for i, ev := range want {
+		if events[i] != ev {
+			t.Fatalf("events = %q, want them to start %q", events, want)
+		}
+	}
+	rest := events[len(want):]
+	if rest[len(rest)-1] != "set k4" || rest[0][:6] != "evict " {
+		t.Fatalf("writing past WithMaxKeys: events = %q", events)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file holds the functional options New takes. Each sets one part of the node, matching a
+cache-node flag (named in its comment) and that flag's default when it is not given.
+
+Functions:
+- WithID(id string): Option
+- WithAddr(addr string): Option
+- WithPeers(urls ...string): Option
+- WithTTLDefault(ttl time.Duration): Option
+- WithLogger(l *slog.Logger): Option
+- WithMaxKeys(n int64): Option
+- WithMaxMemory(bytes int64): Option
+- WithEviction(policy string): Option
+- WithCompressAbove(bytes int): Option
+- WithLoader(fn func(ctx context.Context, key string) ([]byte, time.Duration, error)): Option
+- WithWAL(path string): Option
+- WithTLS(cfg *tls.Config): Option
+- WithSyncSecrets(secrets ...string): Option
+- WithClock(c Clock): Option
+- WithPeerTransport(rt http.RoundTripper): Option
+*/
+
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	icache "github.com/you/replicated-cache/internal/cache"
+)
+
+// An Option configures a Cache made by New.
+type Option func(*config) error
+
+type config struct {
+	id          string
+	addr        string
+	peers       []string
+	ttl         time.Duration
+	log         *slog.Logger
+	maxKeys     int64
+	maxMemory   int64
+	eviction    string
+	compress    int
+	loader      icache.LoaderFunc
+	wal         string
+	tls         *tls.Config
+	syncSecrets [][]byte
+	clock       Clock
+	transport   http.RoundTripper
+}
+
+// A Clock tells the time; see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// WithID names the node in versions and among its peers (-id). The default
+// is the listen address with a random suffix.
+func WithID(id string) Option {
+	return func(c *config) error {
+		if id == "" {
+			return errors.New("cache: empty ID")
+		}
+		c.id = id
+		return nil
+	}
+}
+
+// WithAddr serves the node's HTTP API, including replication from peers, on
+// addr (-addr), e.g. ":8081" or "127.0.0.1:0". Without it the node does not
+// listen: it sends writes to its peers but receives none, unless the program
+// serves Cache.Handler itself.
+func WithAddr(addr string) Option {
+	return func(c *config) error {
+		c.addr = addr
+		return nil
+	}
+}
+
+// WithPeers sets the base URLs of the other nodes (-peers), e.g.
+// "http://10.0.0.2:8081".
+func WithPeers(urls ...string) Option {
+	return func(c *config) error {
+		policy := icache.DefaultPeerPolicy()
+		for _, u := range urls {
+			if strings.TrimSpace(u) == "" {
+				continue
+			}
+			u, err := policy.CheckURL(u)
+			if err != nil {
+				return fmt.Errorf("cache: %w", err)
+			}
+			c.peers = append(c.peers, u)
+		}
+		return nil
+	}
+}
+
+// WithTTLDefault makes Set calls that give no TTL expire after ttl. Writes
+// arriving over the network keep the TTL their sender chose.
+func WithTTLDefault(ttl time.Duration) Option {
+	return func(c *config) error {
+		if ttl < 0 {
+			return errors.New("cache: negative default TTL")
+		}
+		c.ttl = ttl
+		return nil
+	}
+}
+
+// WithLogger sets the node's structured logger; the default is slog.Default.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) error {
+		c.log = l
+		return nil
+	}
+}
+
+// WithMaxKeys evicts live keys beyond n (-max-keys), not counting tombstones;
+// 0 means no limit.
+func WithMaxKeys(n int64) Option {
+	return func(c *config) error {
+		c.maxKeys = n
+		return nil
+	}
+}
+
+// WithMaxMemory evicts keys once values take more than bytes
+// (-max-memory); 0 means no limit.
+func WithMaxMemory(bytes int64) Option {
+	return func(c *config) error {
+		c.maxMemory = bytes
+		return nil
+	}
+}
+
+// WithEviction chooses which keys go when a limit is reached (-eviction):
+// "random", "lru" or "lfu".
+func WithEviction(policy string) Option {
+	return func(c *config) error {
+		c.eviction = policy
+		return nil
+	}
+}
+
+// WithCompressAbove stores values of at least bytes DEFLATE-compressed
+// (-compress-above).
+func WithCompressAbove(bytes int) Option {
+	return func(c *config) error {
+		c.compress = bytes
+		return nil
+	}
+}
+
+// WithLoader fills misses from a backing store (-loader-url): fn returns a
+// key's value and TTL, or ErrNotFound.
+func WithLoader(fn func(ctx context.Context, key string) ([]byte, time.Duration, error)) Option {
+	return func(c *config) error {
+		c.loader = fn
+		return nil
+	}
+}
+
+// WithWAL persists every write to the log at path and replays it on New
+// (-wal).
+func WithWAL(path string) Option {
+	return func(c *config) error {
+		c.wal = path
+		return nil
+	}
+}
+
+// WithTLS serves WithAddr over HTTPS with cfg's certificates and trusts
+// cfg.RootCAs (the system roots when nil) for https peers (-tls-cert,
+// -tls-key and -tls-ca).
+func WithTLS(cfg *tls.Config) Option {
+	return func(c *config) error {
+		c.tls = cfg
+		return nil
+	}
+}
+
+// WithSyncSecrets requires replication between nodes to be signed with one
+// of secrets, at least 16 bytes each; the first signs (-sync-secret-file).
+func WithSyncSecrets(secrets ...string) Option {
+	return func(c *config) error {
+		s, err := icache.ParseSyncSecrets(strings.NewReader(strings.Join(secrets, "\n")), "WithSyncSecrets")
+		if err != nil {
+			return fmt.Errorf("cache: %w", err)
+		}
+		c.syncSecrets = s
+		return nil
+	}
+}
+
+// WithClock makes the node read c instead of the system clock when it stamps
+// writes and decides whether they have expired, so tests can expire keys by
+// moving c forward (see package cachetest).
+func WithClock(c Clock) Option {
+	return func(cfg *config) error {
+		cfg.clock = c
+		return nil
+	}
+}
+
+// WithPeerTransport sends the node's requests to its peers through rt instead
+// of dialing them, e.g. over cachetest's in-memory network.
+func WithPeerTransport(rt http.RoundTripper) Option {
+	return func(c *config) error {
+		c.transport = rt
+		return nil
+	}
+}
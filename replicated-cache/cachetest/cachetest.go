@@ -0,0 +1,261 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+Package cachetest runs a cluster of embedded cache nodes inside one test process, for integration
+tests of code that uses the cache, without sockets, ports or sleeping. The nodes replicate to each
+other over an in-memory network, which the test can partition and heal, and they all read a fake
+clock the test moves forward to expire keys:
+
+	cl := cachetest.New(t, 3, cache.WithTTLDefault(time.Minute))
+	err := cl.Node(0).Set(ctx, "user:1", []byte("ann"), &cache.WriteOptions{Full: true})
+	v, err := cl.Node(2).Get(ctx, "user:1") // replicated
+	cl.Advance(2 * time.Minute)
+	_, err = cl.Node(2).Get(ctx, "user:1") // cache.ErrNotFound
+
+Nodes are named node0, node1, ... and reachable at http://node0.cachetest and so on, but only
+through the cluster's network: HTTPClient returns a client for it, so code under test that speaks
+HTTP, such as package client, can be pointed at URLs. Requests on the network are served by the
+node's handler directly and answered once it returns, so streaming endpoints (/watch, /changes)
+are not supported.
+
+Functions:
+- New(tb testing.TB, n int, opts ...cache.Option): *Cluster
+- (*Cluster) Len(): int
+- (*Cluster) Node(i int): *cache.Cache
+- (*Cluster) URL(i int): string
+- (*Cluster) URLs(): []string
+- (*Cluster) HTTPClient(): *http.Client
+- (*Cluster) Advance(d time.Duration)
+- (*Cluster) Cut(a, b int)
+- (*Cluster) Isolate(i int)
+- (*Cluster) Heal()
+- (*Cluster) Close()
+- NewClock(t time.Time): *Clock
+- (*Clock) Now(): time.Time
+- (*Clock) Advance(d time.Duration)
+- (*Clock) Set(t time.Time)
+- (*network) route(from, host string): (http.Handler, error)
+- (*transport) RoundTrip(req *http.Request): (*http.Response, error)
+*/
+
+package cachetest
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/you/replicated-cache/cache"
+)
+
+const maxNodes = 250
+
+// Cluster is a set of embedded nodes replicating to each other in memory.
+type Cluster struct {
+	// Clock is the time every node reads; it starts at the real time.
+	Clock *Clock
+
+	nodes []*cache.Cache
+	hosts []string
+	net   *network
+	once  sync.Once
+}
+
+// New starts n nodes, each a peer of all the others, and closes them when
+// the test ends. opts apply to every node, after the cluster's own; the
+// nodes log nowhere unless they include WithLogger.
+func New(tb testing.TB, n int, opts ...cache.Option) *Cluster {
+	tb.Helper()
+	if n < 1 || n > maxNodes {
+		tb.Fatalf("cachetest: %d nodes; want 1 to %d", n, maxNodes)
+	}
+	c := &Cluster{Clock: NewClock(time.Now()), net: &network{handlers: make(map[string]http.Handler), cut: make(map[[2]string]bool)}}
+	for i := range n {
+		c.hosts = append(c.hosts, fmt.Sprintf("node%d.cachetest", i))
+	}
+	for i := range n {
+		var peers []string
+		for j := range n {
+			if j != i {
+				peers = append(peers, c.URL(j))
+			}
+		}
+		own := []cache.Option{
+			cache.WithID(fmt.Sprintf("node%d", i)),
+			cache.WithPeers(peers...),
+			cache.WithClock(c.Clock),
+			cache.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			cache.WithPeerTransport(&transport{net: c.net, from: c.hosts[i], addr: fmt.Sprintf("192.0.2.%d:80", i+1)}),
+		}
+		node, err := cache.New(append(own, opts...)...)
+		if err != nil {
+			c.Close()
+			tb.Fatalf("cachetest: starting node%d: %v", i, err)
+		}
+		c.nodes = append(c.nodes, node)
+		c.net.mu.Lock()
+		c.net.handlers[c.hosts[i]] = node.Handler()
+		c.net.mu.Unlock()
+	}
+	tb.Cleanup(c.Close)
+	return c
+}
+
+// Len returns the number of nodes.
+func (c *Cluster) Len() int { return len(c.nodes) }
+
+// Node returns node i.
+func (c *Cluster) Node(i int) *cache.Cache { return c.nodes[i] }
+
+// URL returns node i's base URL on the cluster's network.
+func (c *Cluster) URL(i int) string { return "http://" + c.hosts[i] }
+
+// URLs returns every node's base URL, in order.
+func (c *Cluster) URLs() []string {
+	urls := make([]string, len(c.hosts))
+	for i := range c.hosts {
+		urls[i] = c.URL(i)
+	}
+	return urls
+}
+
+// HTTPClient returns a client that reaches the nodes over the cluster's
+// network, e.g. for client.Options.HTTPClient. Cuts between nodes do not
+// apply to it.
+func (c *Cluster) HTTPClient() *http.Client {
+	return &http.Client{Transport: &transport{net: c.net, addr: "192.0.2.254:80"}}
+}
+
+// Advance moves the clock forward by d and then has every node remove what
+// expired, so OnExpire hooks have run by the time it returns.
+func (c *Cluster) Advance(d time.Duration) {
+	c.Clock.Advance(d)
+	for _, n := range c.nodes {
+		n.ExpireNow()
+	}
+}
+
+// Cut stops nodes a and b from reaching each other, in both directions,
+// until Heal. Their requests fail as if the peer were down, so writes are
+// queued as hints and delivered after Heal.
+func (c *Cluster) Cut(a, b int) {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+	c.net.cut[[2]string{c.hosts[a], c.hosts[b]}] = true
+	c.net.cut[[2]string{c.hosts[b], c.hosts[a]}] = true
+}
+
+// Isolate cuts node i off from every other node.
+func (c *Cluster) Isolate(i int) {
+	for j := range c.nodes {
+		if j != i {
+			c.Cut(i, j)
+		}
+	}
+}
+
+// Heal restores every link Cut or Isolate removed.
+func (c *Cluster) Heal() {
+	c.net.mu.Lock()
+	defer c.net.mu.Unlock()
+	clear(c.net.cut)
+}
+
+// Close stops every node. It is called when the test ends.
+func (c *Cluster) Close() {
+	c.once.Do(func() {
+		for _, n := range c.nodes {
+			n.Close()
+		}
+	})
+}
+
+// Clock is a fake clock that moves only when told to. It is safe for
+// concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at t.
+func NewClock(t time.Time) *Clock { return &Clock{now: t} }
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t, which may be in its past.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// network routes requests by host name to the nodes' handlers.
+type network struct {
+	mu       sync.RWMutex
+	handlers map[string]http.Handler
+	cut      map[[2]string]bool // from, to
+}
+
+func (nw *network) route(from, host string) (http.Handler, error) {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	h, ok := nw.handlers[host]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("cachetest: no node at %s", host)
+	case nw.cut[[2]string{from, host}]:
+		return nil, fmt.Errorf("cachetest: %s cannot reach %s", from, host)
+	}
+	return h, nil
+}
+
+// transport carries one node's (or a test client's, with from empty)
+// requests over the network. addr is the RemoteAddr its requests arrive
+// with.
+type transport struct {
+	net  *network
+	from string
+	addr string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h, err := t.net.route(t.from, req.URL.Host)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	in := req.Clone(req.Context())
+	if in.Body == nil {
+		in.Body = http.NoBody
+	}
+	in.RequestURI = req.URL.RequestURI()
+	in.RemoteAddr = t.addr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, in)
+	in.Body.Close()
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
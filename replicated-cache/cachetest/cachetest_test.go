@@ -0,0 +1,116 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the in-process test cluster.
+
+List of functions:
+	- TestClusterReplicates: Tests writes replicating between nodes and reaching them over HTTPClient.
+	- TestClockExpiry: Tests keys expiring, and expiry hooks running, when the cluster's clock moves forward.
+	- TestCut: Tests that a cut link keeps a write from a peer until Heal.
+	- TestSessionAfterAdvance: Tests read-your-writes sessions once the cluster's clock is ahead of the real one.
+*/
+
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/you/replicated-cache/cache"
+	"github.com/you/replicated-cache/client"
+)
+
+func TestClusterReplicates(t *testing.T) {
+	ctx := context.Background()
+	cl := New(t, 3)
+	if err := cl.Node(0).Set(ctx, "user:1", []byte("ann"), &cache.WriteOptions{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range cl.Len() {
+		if v, err := cl.Node(i).Get(ctx, "user:1"); err != nil || string(v) != "ann" {
+			t.Fatalf("node%d: Get = %q, %v", i, v, err)
+		}
+	}
+
+	c, err := client.New(client.Options{Nodes: cl.URLs()[1:], HTTPClient: cl.HTTPClient()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Set(ctx, "user:2", []byte("bo"), &client.WriteOptions{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := cl.Node(0).Get(ctx, "user:2"); err != nil || string(v) != "bo" {
+		t.Fatalf("write through the client: Get = %q, %v", v, err)
+	}
+}
+
+func TestClockExpiry(t *testing.T) {
+	ctx := context.Background()
+	cl := New(t, 2, cache.WithTTLDefault(time.Minute))
+	if err := cl.Node(0).Set(ctx, "k", []byte("v"), &cache.WriteOptions{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+	cl.Clock.Advance(59 * time.Second)
+	if _, err := cl.Node(1).Get(ctx, "k"); err != nil {
+		t.Fatalf("before the TTL: %v", err)
+	}
+	var expired []string
+	cl.Node(1).OnExpire(func(key string) { expired = append(expired, key) })
+	cl.Advance(2 * time.Second)
+	if len(expired) != 1 || expired[0] != "k" {
+		t.Fatalf("OnExpire after Advance: %q", expired)
+	}
+	for i := range cl.Len() {
+		if _, err := cl.Node(i).Get(ctx, "k"); !errors.Is(err, cache.ErrNotFound) {
+			t.Fatalf("node%d after the TTL: %v", i, err)
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	ctx := context.Background()
+	cl := New(t, 2)
+	cl.Cut(0, 1)
+	if err := cl.Node(0).Set(ctx, "k", []byte("v"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.Node(1).Get(ctx, "k"); !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("write crossed a cut link: %v", err)
+	}
+
+	cl.Heal()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, err := cl.Node(1).Get(ctx, "k")
+		if err == nil && string(v) == "v" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hinted write not delivered after Heal: %q, %v", v, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSessionAfterAdvance(t *testing.T) {
+	ctx := context.Background()
+	cl := New(t, 2)
+	cl.Advance(2 * time.Minute) // past the allowed session token skew
+	c, err := client.New(client.Options{Nodes: cl.URLs(), HTTPClient: cl.HTTPClient(), ReadYourWrites: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Set(ctx, "user:1", []byte("ann"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(ctx, "user:1"); err != nil || string(v) != "ann" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+}
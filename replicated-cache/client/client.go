@@ -0,0 +1,453 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+Package client is the Go client for the cache's HTTP API, so that applications do not hand-roll
+requests to /kv. A Client holds a list of node URLs and a pooled keep-alive transport:
+
+	c, err := client.New(client.Options{Nodes: []string{"http://n1:8081", "http://n2:8081"}, Token: key})
+	err = c.Set(ctx, "user:1", []byte("ann"), &client.WriteOptions{TTL: time.Hour, Min: 1})
+	v, err := c.Get(ctx, "user:1") // client.ErrNotFound when missing
+
+Requests go to one node at a time and stick to it while it answers. On a connection error, a
+timeout or a 429, 502, 503 or 504 the node is set aside for NodeCooldown and the request is retried
+on the next one, with doubling backoff, up to Retries times; other answers (including 409 for a
+write lost to a newer version) are returned as an *Error right away. Sets and deletes are safe to
+retry: the cache keeps the newest write. With ReadYourWrites the client carries the session token
+the nodes return (see session.go in the cache), so its reads see its own writes whichever node
+serves them. MGet reads keys concurrently over the pooled connections.
+
+With Discover, Nodes are only seeds: the client learns the cluster from GET /cluster, sends the
+topology epoch it knows in X-Cache-Topology, and refetches /cluster in the background whenever a
+node answers with another epoch. Replication is full, so every node owns every key and requests
+go to any live node of the topology; the seeds are kept behind the discovered nodes as a fallback.
+
+Functions:
+- New(opts Options): (*Client, error)
+- (*Client) Get(ctx context.Context, key string): ([]byte, error)
+- (*Client) MGet(ctx context.Context, keys ...string): (map[string][]byte, error)
+- (*Client) Set(ctx context.Context, key string, value []byte, o *WriteOptions): error
+- (*Client) Delete(ctx context.Context, key string, o *WriteOptions): error
+- (*Client) Close()
+- (*Client) Refresh(ctx context.Context): error
+- (*Client) refreshFrom(node string)
+- (*Client) fetchTopology(ctx context.Context, node string): error
+- (*Client) do(ctx context.Context, method, key string, q url.Values, body []byte): ([]byte, error)
+- (*Client) attempt(ctx context.Context, node, method, key string, q url.Values, body []byte): ([]byte, error)
+- (*Client) pick(): string
+- (*Client) markDown(node string)
+- (*Error) Error(): string
+- retryable(err error): bool
+- (*WriteOptions) query(): url.Values
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sessionHeader  = "X-Cache-Session"
+	topologyHeader = "X-Cache-Topology"
+)
+
+// ErrNotFound is returned by Get for a key the cache does not hold.
+var ErrNotFound = errors.New("client: key not found")
+
+// Options configures a Client. Only Nodes is required.
+type Options struct {
+	Nodes []string // base URLs, e.g. "https://cache-1:8081"; tried in order
+	// Token is sent as "Authorization: Bearer TOKEN": an API key or a JWT.
+	Token string
+	// TLS configures https nodes, e.g. RootCAs for a private CA; nil uses
+	// the system roots.
+	TLS *tls.Config
+	// HTTPClient replaces the client's own pooled one (TLS and MaxConnsPerNode
+	// are then ignored).
+	HTTPClient *http.Client
+
+	Timeout         time.Duration // per attempt; default 5s
+	Retries         int           // attempts after the first; default 2, negative for none
+	Backoff         time.Duration // before the first retry, doubling; default 50ms
+	NodeCooldown    time.Duration // how long a failed node is skipped; default 5s
+	MaxConnsPerNode int           // idle keep-alive connections kept per node; default 32
+	MGetConcurrency int           // concurrent GETs per MGet; default 8
+	// ReadYourWrites sends back the session token of the client's latest
+	// write, so that its reads see its writes on every node.
+	ReadYourWrites bool
+	// Discover treats Nodes as seeds and follows the cluster's topology.
+	Discover bool
+}
+
+// WriteOptions tune Set and Delete; nil means no TTL and no waiting for
+// replication.
+type WriteOptions struct {
+	TTL  time.Duration // Set only; zero keeps the key until deleted
+	Min  int           // wait for this many peers to acknowledge
+	Full bool          // wait for every peer to acknowledge
+}
+
+// Error is an answer the cache refused a request with.
+type Error struct {
+	Node    string
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %s: %d %s", e.Node, e.Status, e.Message)
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	opts  Options
+	seeds []string
+	http  *http.Client
+
+	mu         sync.Mutex
+	nodes      []string // topology nodes, then the seeds not among them
+	current    int
+	down       map[string]time.Time // node -> skipped until
+	session    string
+	epoch      string // topology epoch of nodes; "" before discovery
+	refreshing atomic.Bool
+}
+
+// New returns a client for opts.Nodes.
+func New(opts Options) (*Client, error) {
+	if len(opts.Nodes) == 0 {
+		return nil, errors.New("client: no nodes")
+	}
+	nodes := make([]string, len(opts.Nodes))
+	for i, n := range opts.Nodes {
+		u, err := url.Parse(n)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("client: bad node URL %q", n)
+		}
+		nodes[i] = strings.TrimSuffix(n, "/")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 2
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 50 * time.Millisecond
+	}
+	if opts.NodeCooldown <= 0 {
+		opts.NodeCooldown = 5 * time.Second
+	}
+	if opts.MaxConnsPerNode <= 0 {
+		opts.MaxConnsPerNode = 32
+	}
+	if opts.MGetConcurrency <= 0 {
+		opts.MGetConcurrency = 8
+	}
+	hc := opts.HTTPClient
+	if hc == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = (&net.Dialer{Timeout: opts.Timeout, KeepAlive: 30 * time.Second}).DialContext
+		t.MaxIdleConns = 0
+		t.MaxIdleConnsPerHost = opts.MaxConnsPerNode
+		if opts.TLS != nil {
+			t.TLSClientConfig = opts.TLS.Clone()
+		}
+		hc = &http.Client{Transport: t}
+	}
+	return &Client{opts: opts, seeds: nodes, nodes: nodes, http: hc, down: make(map[string]time.Time)}, nil
+}
+
+// Get returns key's value, or ErrNotFound.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, key, nil, nil)
+}
+
+// MGet returns the values of the keys that exist; missing keys are left out.
+func (c *Client) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	var (
+		mu       sync.Mutex
+		out      = make(map[string][]byte, len(keys))
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, c.opts.MGetConcurrency)
+	)
+	for _, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			v, err := c.Get(ctx, key)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				out[key] = v
+			case !errors.Is(err, ErrNotFound) && firstErr == nil:
+				firstErr = err
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// Set stores value under key.
+func (c *Client) Set(ctx context.Context, key string, value []byte, o *WriteOptions) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := c.do(ctx, http.MethodPut, key, o.query(), value)
+	return err
+}
+
+// Delete removes key; deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string, o *WriteOptions) error {
+	q := o.query()
+	q.Del("ttl")
+	_, err := c.do(ctx, http.MethodDelete, key, q, nil)
+	return err
+}
+
+// Close releases the client's idle connections.
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Refresh fetches the topology from the first node that answers and routes
+// by it from then on. Discover does this by itself; call Refresh to learn
+// the cluster before the first request.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	tries := len(c.nodes)
+	c.mu.Unlock()
+	var err error
+	for range tries {
+		node := c.pick()
+		if err = c.fetchTopology(ctx, node); err == nil {
+			return nil
+		}
+		c.markDown(node)
+	}
+	return err
+}
+
+// refreshFrom refetches the topology from node in the background, once at a
+// time.
+func (c *Client) refreshFrom(node string) {
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.refreshing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+		defer cancel()
+		c.fetchTopology(ctx, node)
+	}()
+}
+
+type topology struct {
+	Epoch string `json:"epoch"`
+	Nodes []struct {
+		URL  string `json:"url"`
+		Self bool   `json:"self"`
+	} `json:"nodes"`
+}
+
+func (c *Client) fetchTopology(ctx context.Context, node string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, node+"/cluster", nil)
+	if err != nil {
+		return err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return &Error{Node: node, Status: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	var t topology
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return fmt.Errorf("client: %s: topology: %w", node, err)
+	}
+	// The node knows itself by the URL it was reached at.
+	nodes := []string{node}
+	for _, tn := range t.Nodes {
+		u := strings.TrimSuffix(tn.URL, "/")
+		if !tn.Self && !slices.Contains(nodes, u) {
+			nodes = append(nodes, u)
+		}
+	}
+	for _, s := range c.seeds {
+		if !slices.Contains(nodes, s) {
+			nodes = append(nodes, s)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.nodes[c.current]
+	c.nodes, c.epoch = nodes, t.Epoch
+	c.current = max(slices.Index(nodes, cur), 0)
+	return nil
+}
+
+// do sends the request to the current node, failing over and retrying as
+// described above.
+func (c *Client) do(ctx context.Context, method, key string, q url.Values, body []byte) ([]byte, error) {
+	if key == "" || strings.Contains(key, "/") {
+		return nil, fmt.Errorf("client: invalid key %q", key)
+	}
+	backoff := c.opts.Backoff
+	var err error
+	for try := 0; try <= max(c.opts.Retries, 0); try++ {
+		if try > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+				backoff = min(backoff*2, 2*time.Second)
+			}
+		}
+		node := c.pick()
+		var v []byte
+		if v, err = c.attempt(ctx, node, method, key, q, body); err == nil || !retryable(err) || ctx.Err() != nil {
+			return v, err
+		}
+		c.markDown(node)
+	}
+	return nil, err
+}
+
+func (c *Client) attempt(ctx context.Context, node, method, key string, q url.Values, body []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	u := node + "/kv/" + url.PathEscape(key)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	c.mu.Lock()
+	if c.opts.ReadYourWrites && c.session != "" {
+		req.Header.Set(sessionHeader, c.session)
+	}
+	if c.opts.Discover {
+		req.Header.Set(topologyHeader, c.epoch)
+	}
+	c.mu.Unlock()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if c.opts.Discover && resp.Header.Get(topologyHeader) != "" {
+		c.refreshFrom(node)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		return nil, &Error{Node: node, Status: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	if s := resp.Header.Get(sessionHeader); s != "" && c.opts.ReadYourWrites {
+		c.mu.Lock()
+		c.session = s
+		c.mu.Unlock()
+	}
+	return b, nil
+}
+
+// pick returns the node to try: the current one unless it is cooling down,
+// else the next that is not, else the current one anyway.
+func (c *Client) pick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k := range c.nodes {
+		i := (c.current + k) % len(c.nodes)
+		if now.After(c.down[c.nodes[i]]) {
+			c.current = i
+			return c.nodes[i]
+		}
+	}
+	return c.nodes[c.current]
+}
+
+// markDown sets node aside and moves on to the next.
+func (c *Client) markDown(node string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down[node] = time.Now().Add(c.opts.NodeCooldown)
+	if c.nodes[c.current] == node {
+		c.current = (c.current + 1) % len(c.nodes)
+	}
+}
+
+// retryable reports whether another node might succeed where this one failed.
+func retryable(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.Status {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return !errors.Is(err, ErrNotFound)
+}
+
+func (o *WriteOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.TTL > 0 {
+		q.Set("ttl", o.TTL.String())
+	}
+	if o.Min > 0 {
+		q.Set("min", strconv.Itoa(o.Min))
+	}
+	if o.Full {
+		q.Set("full", "true")
+	}
+	return q
+}
@@ -0,0 +1,146 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the Go client, against real nodes served with httptest.
+
+List of functions:
+	- TestClient: Tests Get/Set/Delete/MGet, TTLs, API keys and failing over past a dead node.
+	- TestClientRetries: Tests retrying refused requests and not retrying conflicts.
+	- TestClientDiscover: Tests learning the cluster from /cluster and refreshing it on a new epoch.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/you/replicated-cache/internal/cache"
+)
+
+func TestClient(t *testing.T) {
+	n := cache.NewNode("N1", ":x", nil)
+	keys := cache.NewAPIKeys()
+	keys.Add("secret-key", "app")
+	n.Auth = keys
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	c, err := New(Options{Nodes: []string{dead.URL, srv.URL}, Token: "secret-key", ReadYourWrites: true})
+	if err != nil { t.Fatal(err) }
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.Set(ctx, "user:1 a&b", []byte("ann"), nil); err != nil { t.Fatal(err) }
+	if err := c.Set(ctx, "user:2", []byte("bob"), &WriteOptions{TTL: 50 * time.Millisecond}); err != nil { t.Fatal(err) }
+	if v, err := c.Get(ctx, "user:1 a&b"); err != nil || string(v) != "ann" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if c.session == "" {
+		t.Fatal("no session token kept")
+	}
+	m, err := c.MGet(ctx, "user:1 a&b", "user:2", "user:3")
+	if err != nil || len(m) != 2 || string(m["user:2"]) != "bob" {
+		t.Fatalf("MGet = %q, %v", m, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := c.Get(ctx, "user:2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an expired key: %v", err)
+	}
+	if err := c.Delete(ctx, "user:1 a&b", nil); err != nil { t.Fatal(err) }
+	if _, err := c.Get(ctx, "user:1 a&b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a deleted key: %v", err)
+	}
+	if _, err := c.Get(ctx, "a/b"); err == nil {
+		t.Fatal("accepted a key with a slash")
+	}
+
+	bad, _ := New(Options{Nodes: []string{srv.URL}, Token: "wrong"})
+	var e *Error
+	if _, err := bad.Get(ctx, "user:1"); !errors.As(err, &e) || e.Status != http.StatusUnauthorized {
+		t.Fatalf("Get with a bad key: %v", err)
+	}
+	if _, err := New(Options{Nodes: []string{"localhost:8081"}}); err == nil {
+		t.Fatal("accepted a node URL without a scheme")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.Error(w, "write lost to newer version", http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+	c, err := New(Options{Nodes: []string{srv.URL}, Backoff: time.Millisecond})
+	if err != nil { t.Fatal(err) }
+	ctx := context.Background()
+	if err := c.Set(ctx, "k", []byte("v"), &WriteOptions{Min: 1}); err != nil || calls.Load() != 2 {
+		t.Fatalf("Set after a 503: %v, %d calls", err, calls.Load())
+	}
+	var e *Error
+	if err := c.Set(ctx, "k", []byte("v"), nil); !errors.As(err, &e) || e.Status != http.StatusConflict || calls.Load() != 3 {
+		t.Fatalf("Set on conflict: %v, %d calls", err, calls.Load())
+	}
+}
+
+func TestClientDiscover(t *testing.T) {
+	n2 := cache.NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := cache.NewNode("N1", ":x", []string{srv2.URL})
+	srv1 := httptest.NewServer(n1.Routes())
+
+	c, err := New(Options{Nodes: []string{srv1.URL}, Discover: true, Backoff: time.Millisecond})
+	if err != nil { t.Fatal(err) }
+	ctx := context.Background()
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrNotFound) { t.Fatal(err) }
+	// The first answer carries N1's epoch, and the client fetches /cluster.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.mu.Lock()
+		nodes, epoch := c.nodes, c.epoch
+		c.mu.Unlock()
+		if epoch != "" {
+			if len(nodes) != 2 || nodes[0] != srv1.URL || nodes[1] != srv2.URL {
+				t.Fatalf("nodes %q", nodes)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("topology not fetched")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Known epochs are not answered again.
+	req, _ := http.NewRequest(http.MethodGet, srv1.URL+"/kv/k", nil)
+	req.Header.Set(topologyHeader, c.epoch)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.Header.Get(topologyHeader) != "" {
+		t.Fatalf("current epoch answered with %q", resp.Header.Get(topologyHeader))
+	}
+
+	// With the seed gone, the client carries on with the node it discovered.
+	srv1.Close()
+	if err := c.Set(ctx, "k", []byte("v"), nil); err != nil { t.Fatal(err) }
+	if it, ok := n2.Store().Get("k"); !ok || string(it.Value) != "v" {
+		t.Fatalf("N2 has %+v, %v", it, ok)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file turns a Client into a stateless gateway: Handler forwards any HTTP request to the node
+the client would use, so applications that cannot pick or fail over between nodes themselves get
+one stable endpoint (see cmd/cache-gateway). The gateway stores nothing. Every node holds every
+key, so any live node can answer any request, and the gateway follows the same rules as the
+client's own calls: it sticks to a node while it answers, sets failed nodes aside for NodeCooldown,
+and with Discover follows the cluster's topology as the nodes change.
+
+GET, HEAD, PUT and DELETE are retried on the next node after a connection error or a 429, 502, 503
+or 504, like Client.Set and Delete, when their body is at most gatewayReplayBody bytes; POST
+(publishing) and upgrades (WebSockets, sync streams) are sent once. Streams such as /changes and
+long polls are passed through as they arrive. Callers' credentials, session tokens and request IDs
+go to the node untouched, and the caller's address is added to X-Forwarded-For. Unless the nodes
+list the gateway in -trusted-proxies they ignore it, and every anonymous caller shares the gateway's
+rate limit and failed-authentication lockouts (see internal/cache/auththrottle.go), so one caller
+guessing keys locks every caller of the gateway out. The gateway answers /healthz itself and refuses the
+peer-only endpoints (/sync and /health); everything else, including /readyz, /cluster and the
+cluster-wide /cluster/stats, comes from a node.
+
+Functions:
+- (*Client) Handler(): http.Handler
+- (*Client) gatewayError(w http.ResponseWriter, r *http.Request, err error)
+- (*gatewayTransport) RoundTrip(req *http.Request): (*http.Response, error)
+- replayable(req *http.Request): bool
+*/
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// gatewayReplayBody is the largest request body the gateway keeps to retry
+// the request on another node.
+const gatewayReplayBody = 1 << 20
+
+// Handler returns a handler forwarding requests to the cluster. Options.Token,
+// ReadYourWrites and Timeout do not apply: callers authenticate themselves and
+// streams may stay open for as long as they like.
+func (c *Client) Handler() http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetXForwarded()
+			// The node is chosen per attempt by gatewayTransport.
+			pr.Out.URL.Scheme, pr.Out.URL.Host, pr.Out.Host = "http", "cache", ""
+		},
+		Transport:     &gatewayTransport{c: c},
+		FlushInterval: -1,
+		ErrorHandler:  c.gatewayError,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	notServed := func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "peer-only endpoint, not served by the gateway", http.StatusNotFound)
+	}
+	mux.HandleFunc("/sync", notServed)
+	mux.HandleFunc("/sync/", notServed)
+	mux.HandleFunc("/health", notServed)
+	mux.Handle("/", proxy)
+	return mux
+}
+
+func (c *Client) gatewayError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, r.Context().Err()) {
+		return // the caller went away
+	}
+	http.Error(w, "gateway: "+err.Error(), http.StatusBadGateway)
+}
+
+type gatewayTransport struct {
+	c *Client
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.c
+	rt := c.http.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	var body []byte
+	retries := max(c.opts.Retries, 0)
+	if !replayable(req) {
+		retries = 0
+	} else if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	backoff := c.opts.Backoff
+	var resp *http.Response
+	var err error
+	for try := 0; try <= retries; try++ {
+		if try > 0 {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(backoff):
+				backoff = min(backoff*2, 2*time.Second)
+			}
+		}
+		node := c.pick()
+		u, perr := url.Parse(node)
+		if perr != nil {
+			return nil, perr
+		}
+		out := req.Clone(req.Context())
+		out.URL.Scheme, out.URL.Host = u.Scheme, u.Host
+		out.URL.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+		if req.URL.RawPath != "" {
+			out.URL.RawPath = strings.TrimSuffix(u.Path, "/") + req.URL.RawPath
+		}
+		if body != nil {
+			out.Body, out.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+		}
+		if c.opts.Discover {
+			c.mu.Lock()
+			out.Header.Set(topologyHeader, c.epoch)
+			c.mu.Unlock()
+		} else {
+			out.Header.Del(topologyHeader)
+		}
+		resp, err = rt.RoundTrip(out)
+		if err == nil {
+			if resp.Header.Get(topologyHeader) != "" {
+				if c.opts.Discover {
+					c.refreshFrom(node)
+				}
+				resp.Header.Del(topologyHeader)
+			}
+			switch resp.StatusCode {
+			case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			default:
+				return resp, nil
+			}
+		}
+		if req.Context().Err() != nil {
+			return resp, err
+		}
+		c.markDown(node)
+		if try < retries && resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// replayable reports whether req may be sent to another node after a failure.
+func replayable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return req.ContentLength >= 0 && req.ContentLength <= gatewayReplayBody
+}
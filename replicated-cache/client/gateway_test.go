@@ -0,0 +1,102 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the gateway handler, against real nodes served with httptest.
+
+List of functions:
+	- TestGateway: Tests forwarding with callers' credentials, failing over, refusing peer-only paths and streaming.
+*/
+
+package client
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/you/replicated-cache/internal/cache"
+)
+
+func TestGateway(t *testing.T) {
+	n := cache.NewNode("N1", ":x", nil)
+	n.AccessLog = false
+	keys := cache.NewAPIKeys()
+	keys.Add("secret-key", "app")
+	n.Auth = keys
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	var refused atomic.Int32
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refused.Add(1)
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer busy.Close()
+
+	c, err := New(Options{Nodes: []string{dead.URL, busy.URL, srv.URL}, Backoff: 1})
+	if err != nil { t.Fatal(err) }
+	defer c.Close()
+	gw := httptest.NewServer(c.Handler())
+	defer gw.Close()
+
+	do := func(method, path, token, body string) (int, string) {
+		req, _ := http.NewRequest(method, gw.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	if code, body := do("PUT", "/kv/greeting", "secret-key", "hello"); code != 201 {
+		t.Fatalf("PUT = %d %s", code, body)
+	}
+	if refused.Load() != 1 {
+		t.Fatalf("busy node asked %d times, want 1", refused.Load())
+	}
+	if code, body := do("GET", "/kv/greeting", "secret-key", ""); code != 200 || body != "hello" {
+		t.Fatalf("GET = %d %q", code, body)
+	}
+	if code, _ := do("GET", "/kv/greeting", "", ""); code != http.StatusUnauthorized {
+		t.Fatalf("GET without a key = %d, want 401", code)
+	}
+	for _, path := range []string{"/sync", "/sync/item/greeting", "/health"} {
+		if code, _ := do("GET", path, "", ""); code != http.StatusNotFound {
+			t.Fatalf("%s = %d, want 404", path, code)
+		}
+	}
+	if code, body := do("GET", "/healthz", "", ""); code != 200 || body != "ok" {
+		t.Fatalf("/healthz = %d %q", code, body)
+	}
+
+	req, _ := http.NewRequest("GET", gw.URL+"/changes?key=greeting", nil)
+	req.Header.Set("Authorization", "Bearer secret-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("/changes = %d", resp.StatusCode)
+	}
+	do("PUT", "/kv/greeting", "secret-key", "again")
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil { t.Fatal(err) }
+		if strings.HasPrefix(line, "data:") {
+			if !strings.Contains(line, `"key":"greeting"`) {
+				t.Fatalf("event %q", line)
+			}
+			break
+		}
+	}
+}
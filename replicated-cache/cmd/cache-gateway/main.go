@@ -0,0 +1,114 @@
+/*
+Author: Phyu Lwin
+Date: 2025 Aug 10th
+Project: Replicated In-Memory Cache (Golang)
+
+This file implements the main entry point for cache-gateway, a stateless HTTP front for the cluster.
+It stores nothing: it forwards each client request to a live node, fails over between nodes and
+follows the cluster's topology (see client/gateway.go), so clients only need the gateway's address.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/you/replicated-cache/client"
+	"github.com/you/replicated-cache/internal/cache"
+)
+
+func main() {
+	var (
+		addr     = flag.String("addr", ":8080", "listen address")
+		nodes    = flag.String("nodes", "", "comma-separated node base URLs to forward to (e.g. http://localhost:8081,http://localhost:8082)")
+		discover = flag.Bool("discover", true, "treat -nodes as seeds and follow the cluster topology from GET /cluster")
+		retries  = flag.Int("retries", 2, "retry idempotent requests on this many other nodes after a failure (negative for none)")
+		cooldown = flag.Duration("node-cooldown", 5*time.Second, "how long a failed node is skipped")
+		dialTO   = flag.Duration("dial-timeout", 5*time.Second, "timeout for connecting to a node")
+		maxConns = flag.Int("max-conns-per-node", 64, "idle keep-alive connections kept per node")
+		tlsCert  = flag.String("tls-cert", "", "serve HTTPS with this PEM certificate chain (requires -tls-key)")
+		tlsKey   = flag.String("tls-key", "", "PEM private key for -tls-cert")
+		tlsCA    = flag.String("tls-ca", "", "PEM CA bundle to trust for https nodes instead of the system roots")
+	)
+	flag.Parse()
+
+	opts := client.Options{
+		Discover:        *discover,
+		Retries:         *retries,
+		NodeCooldown:    *cooldown,
+		Timeout:         *dialTO,
+		MaxConnsPerNode: *maxConns,
+	}
+	for _, n := range strings.Split(*nodes, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			opts.Nodes = append(opts.Nodes, n)
+		}
+	}
+	if *retries == 0 {
+		opts.Retries = -1 // Options treats 0 as the default
+	}
+	if *tlsCA != "" {
+		pool, err := cache.LoadCertPool(*tlsCA)
+		if err != nil {
+			fatal("bad -tls-ca", "err", err)
+		}
+		opts.TLS = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	c, err := client.New(opts)
+	if err != nil {
+		fatal("bad -nodes", "err", err)
+	}
+	defer c.Close()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           c.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		if srv.TLSConfig, err = cache.ServerTLSConfig(*tlsCert, *tlsKey); err != nil {
+			fatal("bad -tls-cert/-tls-key", "err", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *discover {
+		rctx, cancel := context.WithTimeout(ctx, *dialTO)
+		if err := c.Refresh(rctx); err != nil {
+			slog.Warn("cannot fetch the cluster topology yet; forwarding to -nodes", "err", err)
+		}
+		cancel()
+	}
+	go func() {
+		<-ctx.Done()
+		shCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shCtx)
+	}()
+
+	slog.Info("gateway listening", "addr", *addr, "tls", srv.TLSConfig != nil, "nodes", opts.Nodes, "discover", *discover)
+	serve := srv.ListenAndServe
+	if srv.TLSConfig != nil {
+		serve = func() error { return srv.ListenAndServeTLS("", "") }
+	}
+	if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal("server error", "err", err)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
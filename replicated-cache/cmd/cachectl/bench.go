@@ -0,0 +1,172 @@
+/*
+Author: Phyu Lwin
+Date: 2026 Oct 16th
+Project: Replicated In-Memory Cache (Golang)
+
+This file implements `cachectl bench`, a load generator for sizing deployments. It runs a
+configurable number of workers against one or more nodes for a fixed duration, mixing GETs and
+PUTs over a uniform or zipfian key space, and reports throughput and latency percentiles per
+operation.
+*/
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type benchResult struct {
+	lat  []time.Duration
+	errs int
+}
+
+func runBench(base string, args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	servers := fs.String("servers", base, "comma-separated node URLs to spread requests over")
+	dur := fs.Duration("d", 10*time.Second, "test duration")
+	conc := fs.Int("c", 16, "concurrent workers")
+	reads := fs.Float64("reads", 0.9, "fraction of requests that are GETs (0..1)")
+	keys := fs.Int("keys", 10000, "number of distinct keys")
+	dist := fs.String("dist", "uniform", "key distribution: uniform or zipf")
+	zipfS := fs.Float64("zipf-s", 1.1, "zipf skew (> 1)")
+	size := fs.Int("value-size", 256, "value size in bytes for PUTs")
+	prefill := fs.Bool("prefill", true, "write every key once before measuring")
+	min := fs.Int("min", 0, "min replication count for PUTs")
+	fs.Parse(args)
+
+	targets := strings.Split(*servers, ",")
+	if *keys <= 0 || *conc <= 0 || *reads < 0 || *reads > 1 || (*dist == "zipf" && *zipfS <= 1) {
+		fatal(fmt.Errorf("bench: bad parameters"))
+	}
+	value := bytes.Repeat([]byte("x"), *size)
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: withAuth(&http.Transport{MaxIdleConnsPerHost: *conc, TLSClientConfig: tlsConfig}),
+	}
+	put := func(target, key string) error {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("%s/kv/%s?min=%d", target, key, *min), bytes.NewReader(value))
+		return doBench(client, req, 201)
+	}
+	get := func(target, key string) error {
+		req, _ := http.NewRequest("GET", target+"/kv/"+key, nil)
+		return doBench(client, req, 200)
+	}
+
+	if *prefill {
+		fmt.Fprintf(os.Stderr, "prefilling %d keys...\n", *keys)
+		var wg sync.WaitGroup
+		next := make(chan int)
+		for w := 0; w < *conc; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					put(targets[i%len(targets)], benchKey(i))
+				}
+			}()
+		}
+		for i := 0; i < *keys; i++ {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+	}
+
+	fmt.Fprintf(os.Stderr, "running %d workers for %s (%.0f%% reads, %s keys)...\n", *conc, *dur, *reads*100, *dist)
+	var (
+		mu     sync.Mutex
+		getRes benchResult
+		putRes benchResult
+		wg     sync.WaitGroup
+	)
+	deadline := time.Now().Add(*dur)
+	for w := 0; w < *conc; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(w), uint64(time.Now().UnixNano())))
+			var zipf *rand.Zipf
+			if *dist == "zipf" {
+				zipf = rand.NewZipf(rng, *zipfS, 1, uint64(*keys-1))
+			}
+			var g, p benchResult
+			for time.Now().Before(deadline) {
+				i := rng.IntN(*keys)
+				if zipf != nil {
+					i = int(zipf.Uint64())
+				}
+				target := targets[rng.IntN(len(targets))]
+				isGet := rng.Float64() < *reads
+				start := time.Now()
+				var err error
+				if isGet {
+					err = get(target, benchKey(i))
+				} else {
+					err = put(target, benchKey(i))
+				}
+				res := &p
+				if isGet {
+					res = &g
+				}
+				if err != nil {
+					res.errs++
+					continue
+				}
+				res.lat = append(res.lat, time.Since(start))
+			}
+			mu.Lock()
+			getRes.lat = append(getRes.lat, g.lat...)
+			getRes.errs += g.errs
+			putRes.lat = append(putRes.lat, p.lat...)
+			putRes.errs += p.errs
+			mu.Unlock()
+		}(w)
+	}
+	wg.Wait()
+
+	fmt.Printf("%-4s %10s %10s %8s %10s %10s %10s %10s\n", "op", "requests", "req/s", "errors", "p50", "p90", "p99", "max")
+	getRes.print("GET", *dur)
+	putRes.print("PUT", *dur)
+}
+
+func benchKey(i int) string { return fmt.Sprintf("bench-%d", i) }
+
+func doBench(client *http.Client, req *http.Request, want int) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != want && !(want == 200 && resp.StatusCode == 404) {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (r benchResult) print(op string, d time.Duration) {
+	n := len(r.lat)
+	if n == 0 && r.errs == 0 {
+		return
+	}
+	sort.Slice(r.lat, func(i, j int) bool { return r.lat[i] < r.lat[j] })
+	pct := func(p float64) time.Duration {
+		if n == 0 {
+			return 0
+		}
+		return r.lat[int(p*float64(n-1))]
+	}
+	fmt.Printf("%-4s %10d %10.0f %8d %10s %10s %10s %10s\n", op, n, float64(n)/d.Seconds(), r.errs,
+		pct(0.50).Round(time.Microsecond), pct(0.90).Round(time.Microsecond),
+		pct(0.99).Round(time.Microsecond), pct(1).Round(time.Microsecond))
+}
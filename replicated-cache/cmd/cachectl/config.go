@@ -0,0 +1,222 @@
+/*
+Author: Phyu Lwin
+Date: 2026 Oct 16th
+Project: Replicated In-Memory Cache (Golang)
+
+This file implements cachectl's config file, so the server URL, token and CA bundle need not be
+passed on every command line. The file (~/.cachectl.yaml, or $CACHECTL_CONFIG) holds named
+profiles; one is picked with -profile, $CACHECTL_PROFILE or the file's "current" entry, and
+settings at the top level apply to every profile that does not set its own:
+
+	current: prod
+	ca: ~/certs/ca.pem
+	profiles:
+	  prod:
+	    server: https://cache.example.com:8081
+	    token_file: ~/.cachectl/prod.token
+	  local:
+	    server: http://localhost:8081
+
+Flags win over environment variables (CACHE_SERVER, CACHE_TOKEN, CACHE_CA), which win over the
+profile. Only the small part of YAML shown above is understood: nested "key: value" maps,
+comments and quoted strings. A file holding a plain token that others can read draws a warning.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// profile is one set of connection settings; empty fields are unset.
+type profile struct {
+	Server, Token, TokenFile, CA string
+}
+
+type config struct {
+	path     string
+	current  string
+	defaults profile
+	profiles map[string]*profile
+	readable bool // group or world can read the file
+}
+
+// configPath returns $CACHECTL_CONFIG, else ~/.cachectl.yaml.
+func configPath() string {
+	if p := os.Getenv("CACHECTL_CONFIG"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".cachectl.yaml")
+}
+
+// loadConfig reads the config file; a missing file is an empty config.
+func loadConfig(path string) (*config, error) {
+	c := &config{path: path, profiles: make(map[string]*profile)}
+	if path == "" {
+		return c, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil {
+		c.readable = fi.Mode().Perm()&0o077 != 0
+	}
+	values, err := parseYAMLMap(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for k, v := range values {
+		parts := strings.Split(k, ".")
+		switch {
+		case len(parts) == 1 && parts[0] == "current":
+			c.current = v
+		case len(parts) == 1:
+			err = c.defaults.set(parts[0], v)
+		case len(parts) == 3 && parts[0] == "profiles":
+			p := c.profiles[parts[1]]
+			if p == nil {
+				p = &profile{}
+				c.profiles[parts[1]] = p
+			}
+			err = p.set(parts[2], v)
+		default:
+			err = fmt.Errorf("unexpected setting %q", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+func (p *profile) set(field, v string) error {
+	switch field {
+	case "server":
+		p.Server = v
+	case "token":
+		p.Token = v
+	case "token_file":
+		p.TokenFile = expandHome(v)
+	case "ca":
+		p.CA = expandHome(v)
+	default:
+		return fmt.Errorf("unknown setting %q (want server, token, token_file or ca)", field)
+	}
+	return nil
+}
+
+// profile returns the named profile (or the current one for ""), with the
+// top-level settings filled in.
+func (c *config) profile(name string) (profile, error) {
+	if name == "" {
+		name = c.current
+	}
+	p := c.defaults
+	if name == "" {
+		return p, nil
+	}
+	named, ok := c.profiles[name]
+	if !ok {
+		var names []string
+		for n := range c.profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return p, fmt.Errorf("no profile %q in %s (have: %s)", name, c.path, strings.Join(names, ", "))
+	}
+	if named.Server != "" {
+		p.Server = named.Server
+	}
+	if named.CA != "" {
+		p.CA = named.CA
+	}
+	if named.Token != "" || named.TokenFile != "" {
+		p.Token, p.TokenFile = named.Token, named.TokenFile
+	}
+	return p, nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// parseYAMLMap reads nested "key: value" maps, returning leaves by their
+// dotted path ("profiles.prod.server").
+func parseYAMLMap(r io.Reader) (map[string]string, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	out := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := stripYAMLComment(sc.Text())
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if strings.Contains(text, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", line)
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		key, value, ok := strings.Cut(strings.TrimSpace(text), ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: want key: value", line)
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		path := key
+		if len(stack) > 0 {
+			path = stack[len(stack)-1].key + "." + key
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			stack = append(stack, level{indent, path})
+			continue
+		}
+		if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+			value = value[1 : n-1]
+		}
+		out[path] = value
+	}
+	return out, sc.Err()
+}
+
+// stripYAMLComment drops a "#" comment that is not inside quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
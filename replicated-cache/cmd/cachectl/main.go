@@ -11,28 +11,67 @@ the node's lifecycle including heartbeat and janitor routines.
 package main
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+
+	"github.com/you/replicated-cache/internal/cache"
+)
+
+// tlsConfig (from -ca) and authToken (from -token, -token-file, $CACHE_TOKEN or the profile) apply to every request cachectl makes.
+var (
+	tlsConfig *tls.Config
+	authToken string
 )
 
+type authTransport struct{ next http.RoundTripper }
+
+// withAuth adds the -token bearer token to requests sent through next.
+func withAuth(next http.RoundTripper) http.RoundTripper {
+	if authToken == "" { return next }
+	return authTransport{next}
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	return t.next.RoundTrip(req)
+}
+
 func fatal(err error) {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 }
 
 func main() {
-	base := flag.String("server", "http://localhost:8081", "server base URL")
+	base := flag.String("server", "http://localhost:8081", "server base URL (default: $CACHE_SERVER, then the profile's server)")
+	token := flag.String("token", "", "API key or bearer token sent with every request (prefer -token-file, $CACHE_TOKEN or a profile, which stay out of process listings)")
+	tokenFile := flag.String("token-file", "", "read the -token value from this file (default: $CACHE_TOKEN, then the profile's token)")
+	caFile := flag.String("ca", "", "PEM CA bundle to trust for an https server instead of the system roots (default: $CACHE_CA, then the profile's ca)")
+	profileName := flag.String("profile", "", "settings profile from ~/.cachectl.yaml or $CACHECTL_CONFIG (default: $CACHECTL_PROFILE, then the file's current profile)")
 	ttl := flag.String("ttl", "", "TTL for set (e.g. 30s or 60)")
 	min := flag.Int("min", 0, "min replication count to wait for")
 	full := flag.Bool("full", false, "full replication (wait for all)")
+	raw := flag.Bool("raw", false, "take set's VALUE literally, even - or @FILE")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage:
   cachectl -server URL get KEY
-  cachectl -server URL set KEY VALUE [-ttl=30s] [-min=1] [-full]
+  cachectl -server URL set KEY VALUE [-ttl=30s] [-min=1] [-full] [-raw]
+                                      (VALUE - reads stdin, @FILE reads FILE, @@... is a literal @...)
   cachectl -server URL del KEY [-min=1] [-full]
+  cachectl -server URL restore TIME   (RFC 3339 time or version; requires -wal on the node)
+  cachectl -server URL hotkeys [N]    (most frequently read keys)
+  cachectl -server URL recent [KEY]   (last mutations the node saw, from clients and peers)
+  cachectl -server URL maintenance on|off   (take the node out of /readyz rotation)
+  cachectl -server URL version        (client and node build versions)
+  cachectl -server URL bench [-c=16] [-d=10s] [-reads=0.9] [-keys=10000] [-dist=uniform|zipf] [-value-size=256] [-servers=URL,...]
+  cachectl -server URL migrate-redis [-from=redis://host:6379/0] [-match=PATTERN] [-batch=500] [-c=8] [-min=0] [-dry-run]
 `)
 		flag.PrintDefaults()
 	}
@@ -40,8 +79,67 @@ func main() {
 	
 
 	flag.Parse()
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	cfg, err := loadConfig(configPath())
+	if err != nil { fatal(err) }
+	if *profileName == "" {
+		*profileName = os.Getenv("CACHECTL_PROFILE")
+	}
+	prof, err := cfg.profile(*profileName)
+	if err != nil { fatal(err) }
+	if prof.Token != "" && cfg.readable {
+		fmt.Fprintf(os.Stderr, "Warning: %s holds a token and is readable by others; chmod 600 it or use token_file\n", cfg.path)
+	}
+	if !set["server"] {
+		if v := os.Getenv("CACHE_SERVER"); v != "" {
+			*base = v
+		} else if prof.Server != "" {
+			*base = prof.Server
+		}
+	}
+	if !set["ca"] {
+		if v := os.Getenv("CACHE_CA"); v != "" {
+			*caFile = v
+		} else {
+			*caFile = prof.CA
+		}
+	}
+	if *caFile != "" {
+		pool, err := cache.LoadCertPool(*caFile)
+		if err != nil { fatal(err) }
+		tlsConfig = &tls.Config{RootCAs: pool}
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = tlsConfig
+	}
+	authToken = *token
+	if authToken == "" {
+		b, _, err := cache.LoadSecret(*tokenFile, "CACHE_TOKEN")
+		if err != nil { fatal(err) }
+		authToken = strings.TrimSpace(string(b))
+	}
+	if authToken == "" && prof.TokenFile != "" {
+		b, err := os.ReadFile(prof.TokenFile)
+		if err != nil { fatal(err) }
+		authToken = strings.TrimSpace(string(b))
+	}
+	if authToken == "" {
+		authToken = prof.Token
+	}
+	http.DefaultClient.Transport = withAuth(http.DefaultTransport)
 
-	if flag.NArg() < 2 {
+	if flag.Arg(0) == "bench" {
+		runBench(*base, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "migrate-redis" {
+		runMigrateRedis(*base, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "version" {
+		printVersion(*base)
+		return
+	}
+	if flag.NArg() < 2 && !(flag.NArg() == 1 && (flag.Arg(0) == "hotkeys" || flag.Arg(0) == "recent")) {
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -61,12 +159,14 @@ func main() {
 		io.Copy(os.Stdout, resp.Body)
 	case "set":
 		if flag.NArg() < 3 {
-			fatal(fmt.Errorf("set requires KEY and VALUE"))
+			fatal(fmt.Errorf("set requires KEY and VALUE (- for stdin, @FILE for a file)"))
 		}
-		val := flag.Arg(2)
+		body, size, err := openValue(flag.Arg(2), *raw)
+		if err != nil { fatal(err) }
 		url := fmt.Sprintf("%s/kv/%s?min=%d&full=%t", *base, key, *min, *full)
 		if *ttl != "" { url += "&ttl=" + *ttl }
-		req, _ := http.NewRequest("PUT", url, io.NopCloser(stringsReader(val)))
+		req, _ := http.NewRequest("PUT", url, body)
+		req.ContentLength = size
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil { fatal(err) }
 		defer resp.Body.Close()
@@ -86,12 +186,84 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Println("OK")
+	case "restore":
+		resp, err := http.Post(fmt.Sprintf("%s/admin/restore?to=%s", *base, url.QueryEscape(key)), "", nil)
+		if err != nil { fatal(err) }
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			io.Copy(os.Stderr, resp.Body)
+			os.Exit(1)
+		}
+		fmt.Println("OK")
+	case "maintenance":
+		on := map[string]string{"on": "true", "off": "false"}[key]
+		if on == "" { fatal(fmt.Errorf("maintenance takes on or off")) }
+		resp, err := http.Post(fmt.Sprintf("%s/admin/maintenance?on=%s", *base, on), "", nil)
+		if err != nil { fatal(err) }
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			io.Copy(os.Stderr, resp.Body)
+			os.Exit(1)
+		}
+		fmt.Println("OK")
+	case "hotkeys":
+		n := key
+		if n == "" { n = "20" }
+		resp, err := http.Get(fmt.Sprintf("%s/admin/hotkeys?n=%s", *base, url.QueryEscape(n)))
+		if err != nil { fatal(err) }
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			io.Copy(os.Stderr, resp.Body)
+			os.Exit(1)
+		}
+		var keys []struct {
+			Key   string `json:"key"`
+			Count uint64 `json:"count"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil { fatal(err) }
+		for _, k := range keys {
+			fmt.Printf("%10d  %s\n", k.Count, k.Key)
+		}
+	case "recent":
+		resp, err := http.Get(fmt.Sprintf("%s/admin/recent?key=%s", *base, url.QueryEscape(key)))
+		if err != nil { fatal(err) }
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			io.Copy(os.Stderr, resp.Body)
+			os.Exit(1)
+		}
+		var ops []cache.OpRecord
+		if err := json.NewDecoder(resp.Body).Decode(&ops); err != nil { fatal(err) }
+		for _, op := range ops {
+			fmt.Printf("%s  %-6s %-5s %-8s v%d from %s  %s\n", op.Time.Format("15:04:05.000"), op.Source, op.Op, op.Outcome, op.Version, op.Origin, op.Key)
+		}
 	default:
 		flag.Usage()
 		os.Exit(2)
 	}
 }
 
+func printVersion(base string) {
+	fmt.Printf("client: %s, %s\n", cache.Build(), cache.Build().GoVersion)
+	resp, err := http.Get(base + "/version")
+	if err != nil { fatal(err) }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		io.Copy(os.Stderr, resp.Body)
+		os.Exit(1)
+	}
+	var v struct {
+		NodeID string `json:"node_id"`
+		cache.BuildInfo
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil { fatal(err) }
+	fmt.Printf("node %s: %s, %s", v.NodeID, v.BuildInfo, v.GoVersion)
+	if v.BuildDate != "" {
+		fmt.Printf(", built %s", v.BuildDate)
+	}
+	fmt.Println()
+}
+
 func stringsReader(s string) io.ReadCloser { return io.NopCloser(stringsNewReader(s)) }
 
 // tiny local replacements to keep imports minimal
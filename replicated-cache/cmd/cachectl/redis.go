@@ -0,0 +1,312 @@
+/*
+Author: Phyu Lwin
+Date: 2026 Oct 16th
+Project: Replicated In-Memory Cache (Golang)
+
+This file implements `cachectl migrate-redis`, which copies an existing Redis dataset into the
+cluster to ease migration. It walks the Redis keyspace with SCAN (optionally filtered by a MATCH
+pattern), fetches each batch's values and remaining TTLs with a pipelined GET and PTTL, and loads
+them with concurrent PUTs, each key keeping its remaining TTL. Only string keys can be copied;
+keys holding lists, hashes and other types, and keys containing '/' (which the HTTP API cannot
+address), are skipped and counted. Redis is only read, so the command can be rerun: keys are
+simply written again.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type migrateStats struct {
+	copied, expired, wrongType, badKey, failed atomic.Int64
+}
+
+func runMigrateRedis(base string, args []string) {
+	fs := flag.NewFlagSet("migrate-redis", flag.ExitOnError)
+	from := fs.String("from", "redis://localhost:6379", "source Redis: host:port or redis[s]://[user:password@]host:port[/db]")
+	match := fs.String("match", "*", "copy only keys matching this SCAN MATCH pattern")
+	batch := fs.Int("batch", 500, "keys per SCAN call and pipelined fetch")
+	conc := fs.Int("c", 8, "concurrent PUTs to the cluster")
+	min := fs.Int("min", 0, "min replication count for PUTs")
+	dryRun := fs.Bool("dry-run", false, "scan and fetch, but write nothing")
+	fs.Parse(args)
+	if *batch <= 0 || *conc <= 0 {
+		fatal(fmt.Errorf("migrate-redis: bad parameters"))
+	}
+
+	rc, err := dialRedis(*from)
+	if err != nil {
+		fatal(fmt.Errorf("migrate-redis: %w", err))
+	}
+	defer rc.close()
+
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: withAuth(&http.Transport{MaxIdleConnsPerHost: *conc, TLSClientConfig: tlsConfig}),
+	}
+	type entry struct {
+		key   string
+		value []byte
+		ttl   time.Duration
+	}
+	var st migrateStats
+	var wg sync.WaitGroup
+	work := make(chan entry, *batch)
+	for w := 0; w < *conc; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range work {
+				u := fmt.Sprintf("%s/kv/%s?min=%d", base, url.PathEscape(e.key), *min)
+				if e.ttl > 0 {
+					u += "&ttl=" + e.ttl.String()
+				}
+				if err := migratePut(client, u, e.value); err != nil {
+					st.failed.Add(1)
+					fmt.Fprintf(os.Stderr, "%s: %v\n", e.key, err)
+					continue
+				}
+				st.copied.Add(1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	cursor := "0"
+	for {
+		reply, err := rc.do("SCAN", cursor, "MATCH", *match, "COUNT", strconv.Itoa(*batch))
+		if err != nil {
+			fatal(fmt.Errorf("migrate-redis: SCAN: %w", err))
+		}
+		scan, _ := reply.([]any)
+		if len(scan) != 2 {
+			fatal(fmt.Errorf("migrate-redis: unexpected SCAN reply %v", reply))
+		}
+		cursor = string(scan[0].([]byte))
+		keys, _ := scan[1].([]any)
+
+		var fetch []string
+		for _, k := range keys {
+			key := string(k.([]byte))
+			if key == "" || strings.Contains(key, "/") {
+				st.badKey.Add(1)
+				continue
+			}
+			fetch = append(fetch, key)
+		}
+		for _, key := range fetch {
+			rc.send("GET", key)
+			rc.send("PTTL", key)
+		}
+		if err := rc.w.Flush(); err != nil {
+			fatal(fmt.Errorf("migrate-redis: %w", err))
+		}
+		for _, key := range fetch {
+			val, gerr := rc.read()
+			ttl, terr := rc.read()
+			if terr != nil && !errors.As(terr, new(redisError)) {
+				fatal(fmt.Errorf("migrate-redis: %w", terr))
+			}
+			if gerr != nil {
+				if !errors.As(gerr, new(redisError)) {
+					fatal(fmt.Errorf("migrate-redis: %w", gerr))
+				}
+				st.wrongType.Add(1) // WRONGTYPE: not a string key
+				continue
+			}
+			b, ok := val.([]byte)
+			ms, _ := ttl.(int64)
+			if !ok || ms == -2 {
+				st.expired.Add(1) // deleted or expired since SCAN saw it
+				continue
+			}
+			e := entry{key: key, value: b}
+			if ms > 0 {
+				e.ttl = time.Duration(ms) * time.Millisecond
+			}
+			if *dryRun {
+				st.copied.Add(1)
+				continue
+			}
+			work <- e
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	verb := "copied"
+	if *dryRun {
+		verb = "would copy"
+	}
+	fmt.Printf("%s %d keys in %s\n", verb, st.copied.Load(), time.Since(start).Round(time.Millisecond))
+	fmt.Printf("skipped: %d not strings, %d with '/' in the key, %d expired during the copy\n",
+		st.wrongType.Load(), st.badKey.Load(), st.expired.Load())
+	if n := st.failed.Load(); n > 0 {
+		fmt.Printf("failed: %d\n", n)
+		os.Exit(1)
+	}
+}
+
+// migratePut writes one key, returning the node's error text on failure.
+func migratePut(client *http.Client, u string, value []byte) error {
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// redisError is an error reply from Redis, such as WRONGTYPE.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisConn is a minimal RESP client, enough for SCAN, GET and PTTL.
+type redisConn struct {
+	c net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// dialRedis connects to addr, authenticating and selecting the database given
+// in a redis:// URL.
+func dialRedis(addr string) (*redisConn, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "redis://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	var c net.Conn
+	d := &net.Dialer{Timeout: 10 * time.Second}
+	switch u.Scheme {
+	case "redis":
+		c, err = d.Dial("tcp", host)
+	case "rediss":
+		cfg := &tls.Config{ServerName: u.Hostname()}
+		if tlsConfig != nil {
+			cfg.RootCAs = tlsConfig.RootCAs
+		}
+		c, err = tls.DialWithDialer(d, "tcp", host, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{c: c, r: bufio.NewReaderSize(c, 64<<10), w: bufio.NewWriterSize(c, 64<<10)}
+	if pw, ok := u.User.Password(); ok {
+		args := []string{"AUTH", pw}
+		if user := u.User.Username(); user != "" {
+			args = []string{"AUTH", user, pw}
+		}
+		if _, err := rc.do(args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("AUTH: %w", err)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := rc.do("SELECT", db); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SELECT: %w", err)
+		}
+	}
+	return rc, nil
+}
+
+func (rc *redisConn) close() { rc.c.Close() }
+
+// send buffers a command; the caller flushes rc.w.
+func (rc *redisConn) send(args ...string) {
+	fmt.Fprintf(rc.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(rc.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+}
+
+func (rc *redisConn) do(args ...string) (any, error) {
+	rc.send(args...)
+	if err := rc.w.Flush(); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// read parses one reply: simple strings and bulk strings as []byte (nil for a
+// null bulk string), integers as int64, arrays as []any and errors as
+// redisError.
+func (rc *redisConn) read() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]any, n)
+		for i := range out {
+			if out[i], err = rc.read(); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("bad reply %q", line)
+}
@@ -0,0 +1,62 @@
+/*
+Author: Phyu Lwin
+Date: 2026 Oct 16th
+Project: Replicated In-Memory Cache (Golang)
+
+This file reads the VALUE argument of `cachectl set`. Besides a literal value, "-" sends standard
+input and "@FILE" sends the file's contents, so binary and multi-line values can be set. Both are
+streamed into the request body rather than read into memory, with a Content-Length when the size
+is known (a regular file, or standard input redirected from one) and chunked otherwise. A value
+that really starts with "@" is written with it doubled ("@@alice" sets "@alice"), and -raw takes
+VALUE exactly as given, for "-" itself or anything else.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// openValue returns the request body for VALUE and its length, or -1 when it
+// is not known in advance. With raw set, arg is the value itself.
+func openValue(arg string, raw bool) (io.ReadCloser, int64, error) {
+	switch {
+	case raw:
+	case strings.HasPrefix(arg, "@@"):
+		arg = arg[1:]
+	case arg == "-":
+		return io.NopCloser(os.Stdin), sizeOf(os.Stdin), nil
+	case strings.HasPrefix(arg, "@"):
+		if arg == "@" {
+			return nil, 0, fmt.Errorf("set: @ needs a file name, as in @value.bin")
+		}
+		f, err := os.Open(arg[1:])
+		if err != nil {
+			return nil, 0, err
+		}
+		if fi, err := f.Stat(); err == nil && fi.IsDir() {
+			f.Close()
+			return nil, 0, fmt.Errorf("set: %s is a directory", arg[1:])
+		}
+		return f, sizeOf(f), nil
+	}
+	return stringsReader(arg), int64(len(arg)), nil
+}
+
+// sizeOf returns how much of f is left to read if it is a regular file, or -1
+// for a pipe, terminal or anything else whose length is only known at EOF.
+// Standard input may be a file a parent process has already read from.
+func sizeOf(f *os.File) int64 {
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return -1
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil || off > fi.Size() {
+		return -1
+	}
+	return fi.Size() - off
+}
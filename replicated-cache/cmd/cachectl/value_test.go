@@ -0,0 +1,75 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for reading the VALUE argument of cachectl set.
+
+List of functions:
+	- readValue: Opens a VALUE argument and reads it whole.
+	- TestOpenValue: Tests literal values, the @@ and -raw escapes, @FILE and its errors.
+	- TestOpenValueStdin: Tests the length sent for standard input that has been partly read.
+*/
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readValue(t *testing.T, arg string, raw bool) (string, int64) {
+	t.Helper()
+	body, size, err := openValue(arg, raw)
+	if err != nil { t.Fatal(err) }
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil { t.Fatal(err) }
+	return string(b), size
+}
+
+func TestOpenValue(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "v.bin")
+	if err := os.WriteFile(file, []byte("from\nfile"), 0o600); err != nil { t.Fatal(err) }
+	for _, tc := range []struct {
+		arg  string
+		raw  bool
+		want string
+		size int64
+	}{
+		{"hello", false, "hello", 5},
+		{"@" + file, false, "from\nfile", 9},
+		{"@@alice", false, "@alice", 6},
+		{"@@", false, "@", 1},
+		{"-", true, "-", 1},
+		{"@" + file, true, "@" + file, int64(len(file) + 1)},
+		{"@@alice", true, "@@alice", 7},
+	} {
+		got, size := readValue(t, tc.arg, tc.raw)
+		if got != tc.want || size != tc.size {
+			t.Fatalf("openValue(%q, %v) = %q (%d bytes), want %q (%d)", tc.arg, tc.raw, got, size, tc.want, tc.size)
+		}
+	}
+	for _, bad := range []string{"@", "@" + dir, "@" + filepath.Join(dir, "missing")} {
+		if _, _, err := openValue(bad, false); err == nil {
+			t.Fatalf("openValue(%q) should fail", bad)
+		}
+	}
+}
+
+func TestOpenValueStdin(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil { t.Fatal(err) }
+	defer f.Close()
+	if _, err := f.WriteString("skipvalue"); err != nil { t.Fatal(err) }
+	if _, err := f.Seek(4, io.SeekStart); err != nil { t.Fatal(err) }
+	defer func(old *os.File) { os.Stdin = old }(os.Stdin)
+	os.Stdin = f
+	if got, size := readValue(t, "-", false); got != "value" || size != 5 {
+		t.Fatalf("stdin = %q (%d bytes), want %q (5)", got, size, "value")
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file formats the per-request access log written by the logging middleware. By default
+each request becomes a structured record on the node's slog logger. For existing log ingestion
+pipelines, Node.AccessLogFormat can instead select the Apache "combined" format or one JSON
+object per line, written to Node.AccessLogOutput. Every format carries the client IP, user agent,
+status, response bytes and duration; the slog and JSON formats also carry the request ID (the
+combined format is kept exactly as Apache writes it, so stock parsers accept it).
+
+Functions:
+- (*Node) accessLog(r *http.Request, rr *respRecorder, start time.Time, d time.Duration)
+- appendCombined(b []byte, r *http.Request, rr *respRecorder, start time.Time): []byte
+- appendAccessJSON(b []byte, r *http.Request, rr *respRecorder, start time.Time, d time.Duration): []byte
+*/
+
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+func (n *Node) accessLog(r *http.Request, rr *respRecorder, start time.Time, d time.Duration) {
+	var out io.Writer = os.Stdout
+	if n.AccessLogOutput != nil {
+		out = n.AccessLogOutput
+	}
+	switch n.AccessLogFormat {
+	case "combined", "json":
+		buf := getBuf()
+		if n.AccessLogFormat == "combined" {
+			buf.Write(appendCombined(buf.AvailableBuffer(), r, rr, start))
+		} else {
+			buf.Write(appendAccessJSON(buf.AvailableBuffer(), r, rr, start, d))
+		}
+		n.accessLogMu.Lock()
+		out.Write(buf.Bytes())
+		n.accessLogMu.Unlock()
+		putBuf(buf)
+	default:
+		n.log.Info("http request", "method", r.Method, "path", r.URL.Path, "status", rr.status, "bytes", rr.bytes,
+			"duration", d, "remote", remoteIP(r), "user_agent", r.UserAgent(), "request_id", requestIDFrom(r.Context()))
+	}
+}
+
+// appendCombined writes an Apache combined log line:
+// host ident user [time] "request" status bytes "referer" "user-agent"
+func appendCombined(b []byte, r *http.Request, rr *respRecorder, start time.Time) []byte {
+	b = append(b, remoteIP(r)...)
+	b = append(b, " - - ["...)
+	b = start.AppendFormat(b, clfTime)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, r.Method+" "+r.URL.RequestURI()+" "+r.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(rr.status), 10)
+	b = append(b, ' ')
+	if rr.bytes == 0 {
+		b = append(b, '-')
+	} else {
+		b = strconv.AppendInt(b, rr.bytes, 10)
+	}
+	b = append(b, ' ')
+	b = appendCLFQuoted(b, r.Referer())
+	b = append(b, ' ')
+	b = appendCLFQuoted(b, r.UserAgent())
+	return append(b, '\n')
+}
+
+// appendCLFQuoted quotes s the way Apache does, with "-" for empty values.
+func appendCLFQuoted(b []byte, s string) []byte {
+	if s == "" {
+		return append(b, `"-"`...)
+	}
+	return strconv.AppendQuote(b, s)
+}
+
+func appendAccessJSON(b []byte, r *http.Request, rr *respRecorder, start time.Time, d time.Duration) []byte {
+	rec := struct {
+		Time       time.Time `json:"time"`
+		Remote     string    `json:"remote"`
+		Method     string    `json:"method"`
+		URI        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Status     int       `json:"status"`
+		Bytes      int64     `json:"bytes"`
+		DurationUS int64     `json:"duration_us"`
+		Referer    string    `json:"referer,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		RequestID  string    `json:"request_id,omitempty"`
+	}{start, remoteIP(r), r.Method, r.URL.RequestURI(), r.Proto, rr.status, rr.bytes, d.Microseconds(), r.Referer(), r.UserAgent(), requestIDFrom(r.Context())}
+	out, _ := json.Marshal(rec)
+	b = append(b, out...)
+	return append(b, '\n')
+}
@@ -0,0 +1,150 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements per-namespace access control lists, so several tenants can share a cluster
+without touching each other's keys. With Node.ACL set (it needs Node.Auth), a /kv request is
+allowed only if a rule for the caller covers the key and grants the role the request needs (see
+auth.go). Rules are loaded from a file, one "SUBJECT PATTERN ROLE" per line:
+
+	tenant-a  a:*        write    # the principal named tenant-a may read and write a:...
+	@support  *          read     # anyone whose roles include "support" may read everything
+	*         public:*   read     # every authenticated caller may read public:...
+
+A pattern ending in "*" matches keys with that prefix; any other pattern matches one key. When
+several of a caller's rules match, the longest pattern wins, so "a:* write" with "a:ro:* read"
+makes a:ro:... read-only. Callers holding the admin role are not restricted. The pattern that
+allowed a write is recorded as the namespace in its audit record.
+
+Functions:
+- LoadACL(path string): (*ACL, error)
+- (*ACL) Add(subject, pattern, role string) error
+- (*ACL) match(p *Principal, key string): (*aclRule, bool)
+- (*aclRule) covers(key string): bool
+- (*aclRule) appliesTo(p *Principal): bool
+- (*Node) authorizeKey(p *Principal, r *http.Request, role string): error
+- (*Node) namespaceOf(r *http.Request, key string): string
+*/
+
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ACL holds namespace access rules.
+type ACL struct {
+	rules []aclRule
+}
+
+type aclRule struct {
+	subject string // principal name, "@role", or "*"
+	pattern string
+	role    string // RoleRead or RoleWrite
+}
+
+// LoadACL reads rules from path: one "SUBJECT PATTERN ROLE" per line.
+func LoadACL(path string) (*ACL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &ACL{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want SUBJECT PATTERN ROLE", path, line)
+		}
+		if err := a.Add(fields[0], fields[1], fields[2]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Add lets subject (a principal name, "@role" or "*") use keys matching
+// pattern with role, which is read or write.
+func (a *ACL) Add(subject, pattern, role string) error {
+	if role != RoleRead && role != RoleWrite {
+		return fmt.Errorf("rule role %q must be read or write", role)
+	}
+	if subject == "" || pattern == "" {
+		return fmt.Errorf("empty subject or pattern")
+	}
+	a.rules = append(a.rules, aclRule{subject: subject, pattern: pattern, role: role})
+	return nil
+}
+
+func (r *aclRule) covers(key string) bool {
+	if prefix, ok := strings.CutSuffix(r.pattern, "*"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+	return key == r.pattern
+}
+
+func (r *aclRule) appliesTo(p *Principal) bool {
+	if r.subject == "*" || r.subject == p.Name {
+		return true
+	}
+	role, ok := strings.CutPrefix(r.subject, "@")
+	return ok && slices.Contains(p.Roles, role)
+}
+
+// match returns p's most specific rule covering key.
+func (a *ACL) match(p *Principal, key string) (*aclRule, bool) {
+	var best *aclRule
+	for i := range a.rules {
+		r := &a.rules[i]
+		if r.appliesTo(p) && r.covers(key) && (best == nil || len(r.pattern) > len(best.pattern)) {
+			best = r
+		}
+	}
+	return best, best != nil
+}
+
+// authorizeKey checks the ACL for p's access to the key in r's path.
+func (n *Node) authorizeKey(p *Principal, r *http.Request, role string) error {
+	if n.ACL == nil || p.has(RoleAdmin, n.DefaultRole) {
+		return nil
+	}
+	key, err := keyFromPath(r.URL.Path)
+	if err != nil {
+		return nil // the handler rejects it
+	}
+	rule, ok := n.ACL.match(p, key)
+	if !ok {
+		return fmt.Errorf("%s has no access to key %q", p.Name, key)
+	}
+	if roleRank[rule.role] < roleRank[role] {
+		return fmt.Errorf("%s has only %s access to %s", p.Name, rule.role, rule.pattern)
+	}
+	return nil
+}
+
+// namespaceOf names the ACL pattern that let r's caller use key, or "".
+func (n *Node) namespaceOf(r *http.Request, key string) string {
+	p := principalFrom(r.Context())
+	if n.ACL == nil || p == nil {
+		return ""
+	}
+	if rule, ok := n.ACL.match(p, key); ok {
+		return rule.pattern
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the admin listener: AdminRoutes serves the operational endpoints (/admin/*:
+maintenance, restore, hot keys, recent operations, the audit trail, webhook status, the dashboard) together with the debug
+endpoints (pprof and expvar, see debug.go) on their own port, apart from the public /kv surface.
+With AdminSeparate set, Routes stops serving /admin/* altogether, so it is reachable only there.
+AdminAllow restricts the admin listener to clients in the listed networks; everyone else gets 403
+before authentication or any handler runs. Role checks (see auth.go) still apply when Auth is set.
+
+Destructive operations are registered through dangerous. With DisableDangerous set, as it should
+be on production clusters, they answer 403 on every listener, whatever the caller's role; the
+refusal is still audited. Today that is the point-in-time restore, which discards every write
+after the restore point; operations that wipe or bulk-overwrite the store, or list the whole key
+space, must be registered the same way.
+
+Functions:
+- (*Node) adminHandlers(mux *http.ServeMux)
+- (*Node) AdminRoutes(): http.Handler
+- (*Node) allowAdmin(next http.Handler): http.Handler
+- (*Node) dangerous(op string, h http.HandlerFunc): http.HandlerFunc
+- ParseCIDRs(list string): ([]*net.IPNet, error)
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// adminHandlers registers the /admin/* endpoints on mux.
+func (n *Node) adminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /admin/maintenance", n.auditAdmin("maintenance", n.handleMaintenance))
+	mux.HandleFunc("POST /admin/restore", n.auditAdmin("restore", n.dangerous("restore", n.handleRestore)))
+	mux.HandleFunc("GET /admin/hotkeys", n.handleHotKeys)
+	mux.HandleFunc("GET /admin/dashboard", n.handleDashboard)
+	mux.HandleFunc("GET /admin/recent", n.handleRecent)
+	mux.HandleFunc("GET /admin/audit", n.handleAudit)
+	mux.HandleFunc("GET /admin/webhooks", n.handleWebhooks)
+}
+
+// AdminRoutes returns the handler for the admin listener: /admin/* and
+// /debug/*, limited to AdminAllow.
+func (n *Node) AdminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	n.adminHandlers(mux)
+	mux.Handle("/debug/", n.DebugRoutes())
+	var h http.Handler = mux
+	if n.Auth != nil {
+		h = n.authenticate(h)
+	}
+	h = n.limitRequests(h)
+	h = n.harden(h)
+	h = n.logging(h)
+	return n.allowAdmin(n.requestIDs(h))
+}
+
+// allowAdmin rejects clients outside AdminAllow; an empty list allows all.
+func (n *Node) allowAdmin(next http.Handler) http.Handler {
+	if len(n.AdminAllow) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := net.ParseIP(remoteIP(r)); ip != nil {
+			for _, network := range n.AdminAllow {
+				if network.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		n.log.Warn("admin request from outside allowlist", "component", "admin", "remote", r.RemoteAddr, "path", r.URL.Path)
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+}
+
+// dangerous refuses op with 403 when DisableDangerous is set.
+func (n *Node) dangerous(op string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n.DisableDangerous {
+			n.log.Warn("refused dangerous operation", "component", "admin", "op", op, "remote", r.RemoteAddr)
+			http.Error(w, op+" is disabled on this node", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// ParseCIDRs parses a comma-separated list of networks ("10.0.0.0/8") and
+// single addresses ("127.0.0.1", "::1").
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("bad address %q", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, network)
+	}
+	return out, nil
+}
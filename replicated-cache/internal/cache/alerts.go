@@ -0,0 +1,203 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements threshold alerts for small deployments without a monitoring stack. Every
+interval the node checks its own figures against the configured rules: hit ratio over the last
+interval below MinHitRatio, a peer unreachable for longer than PeerDownFor, and the store's
+memory estimate above MaxBytes. When a rule starts or stops firing the node POSTs a notification
+to the webhook. The body carries a Slack-compatible "text" field, so a Slack (or Mattermost,
+Rocket.Chat, ...) incoming webhook URL works as is, next to structured fields for other receivers.
+Notifications are only sent on transitions, never repeated while an alert stays firing.
+
+Functions:
+- (*Node) AlertLoop(ctx context.Context, opts AlertOptions)
+- newAlerter(n *Node, opts AlertOptions): *alerter
+- (*alerter) check(now time.Time): []Alert
+- (*alerter) notify(ctx context.Context, a Alert)
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertOptions configures AlertLoop. A zero threshold disables its rule.
+type AlertOptions struct {
+	Webhook  string
+	Client   *http.Client  // default: a client with a 5s timeout
+	Interval time.Duration // default 30s
+
+	MinHitRatio float64       // fire when hits/(hits+misses) over an interval drops below this
+	MinGets     uint64        // GETs an interval needs before its hit ratio is judged; default 100
+	PeerDownFor time.Duration // fire when a peer has been unreachable this long
+	MaxBytes    int64         // fire when the store's memory estimate exceeds this
+}
+
+// Alert is one notification: a rule that started or stopped firing.
+type Alert struct {
+	Text   string    `json:"text"` // human-readable summary; the field Slack displays
+	Name   string    `json:"alert"`
+	Status string    `json:"status"` // AlertFiring or AlertResolved
+	NodeID string    `json:"node_id"`
+	Detail string    `json:"detail"`
+	Time   time.Time `json:"time"`
+}
+
+type alerter struct {
+	n    *Node
+	opts AlertOptions
+
+	firing    map[string]bool
+	downSince map[string]time.Time // peer -> first check that saw it unreachable
+
+	prevHits, prevMisses uint64
+}
+
+// AlertLoop checks the alert rules every opts.Interval until ctx is done.
+func (n *Node) AlertLoop(ctx context.Context, opts AlertOptions) {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	a := newAlerter(n, opts)
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, al := range a.check(now) {
+				a.notify(ctx, al)
+			}
+		}
+	}
+}
+
+func newAlerter(n *Node, opts AlertOptions) *alerter {
+	if opts.MinGets == 0 {
+		opts.MinGets = 100
+	}
+	return &alerter{
+		n: n, opts: opts,
+		firing:    make(map[string]bool),
+		downSince: make(map[string]time.Time),
+		prevHits:  n.metrics.hits.Load(), prevMisses: n.metrics.misses.Load(),
+	}
+}
+
+// check evaluates every rule and returns the alerts whose state changed.
+func (a *alerter) check(now time.Time) []Alert {
+	var out []Alert
+	set := func(name string, firing bool, detail string) {
+		if a.firing[name] == firing {
+			return
+		}
+		status := AlertResolved
+		if firing {
+			status = AlertFiring
+			a.firing[name] = true
+		} else {
+			delete(a.firing, name)
+		}
+		out = append(out, Alert{
+			Text:   fmt.Sprintf("[%s] %s on %s: %s", status, name, a.n.ID, detail),
+			Name:   name,
+			Status: status,
+			NodeID: a.n.ID,
+			Detail: detail,
+			Time:   now.UTC(),
+		})
+	}
+
+	if a.opts.MinHitRatio > 0 {
+		hits, misses := a.n.metrics.hits.Load(), a.n.metrics.misses.Load()
+		dh, dm := hits-a.prevHits, misses-a.prevMisses
+		a.prevHits, a.prevMisses = hits, misses
+		if gets := dh + dm; gets >= a.opts.MinGets {
+			ratio := float64(dh) / float64(gets)
+			set("hit_ratio_low", ratio < a.opts.MinHitRatio,
+				fmt.Sprintf("hit ratio %.3f over %d GETs (threshold %.3f)", ratio, gets, a.opts.MinHitRatio))
+		}
+	}
+
+	if a.opts.PeerDownFor > 0 {
+		peers, _ := a.n.peerReachability()
+		seen := make(map[string]bool, len(peers))
+		for _, p := range peers {
+			seen[p.Peer] = true
+			name := "peer_down:" + p.Peer
+			if p.Reachable {
+				delete(a.downSince, p.Peer)
+				set(name, false, p.Peer+" reachable again")
+				continue
+			}
+			since, ok := a.downSince[p.Peer]
+			if !ok {
+				since = now
+				a.downSince[p.Peer] = now
+			}
+			if down := now.Sub(since); down >= a.opts.PeerDownFor {
+				set(name, true, fmt.Sprintf("%s unreachable for %s (%d consecutive failures)", p.Peer, down.Round(time.Second), p.ConsecutiveFailures))
+			}
+		}
+		// A peer that left the peer set entirely no longer needs paging.
+		var gone []string
+		for name := range a.firing {
+			if peer, ok := strings.CutPrefix(name, "peer_down:"); ok && !seen[peer] {
+				gone = append(gone, peer)
+			}
+		}
+		sort.Strings(gone)
+		for _, peer := range gone {
+			delete(a.downSince, peer)
+			set("peer_down:"+peer, false, peer+" removed from the peer set")
+		}
+	}
+
+	if a.opts.MaxBytes > 0 {
+		b := a.n.store.Stats().Bytes
+		set("memory_high", b > a.opts.MaxBytes, fmt.Sprintf("store at %d bytes (threshold %d)", b, a.opts.MaxBytes))
+	}
+	return out
+}
+
+func (a *alerter) notify(ctx context.Context, al Alert) {
+	body, _ := json.Marshal(al)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.opts.Webhook, bytes.NewReader(body))
+	if err != nil {
+		a.n.log.Warn("alert webhook", "component", "alerts", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.opts.Client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+	}
+	if err != nil {
+		a.n.log.Warn("alert webhook failed", "component", "alerts", "alert", al.Name, "status", al.Status, "err", err)
+		return
+	}
+	a.n.log.Info("alert sent", "component", "alerts", "alert", al.Name, "status", al.Status)
+}
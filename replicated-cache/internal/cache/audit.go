@@ -0,0 +1,364 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the optional mutation audit log. With Node.Audit set, every client PUT and
+DELETE that the node applies is recorded with its time, key, origin node, client identity,
+resulting version and request ID, plus the ACL namespace that allowed it when ACLs are in use.
+Writes arriving from peers are not audited again; each write is recorded once, by the node the
+client talked to. Two sinks are provided: JSON lines to a writer
+(a file), and a webhook that POSTs batches of records in the background. The webhook never blocks
+client writes: when it falls behind, records are dropped and counted. Audited writes also go to
+the recent-operations buffer (see recent.go), with or without a sink.
+
+Admin actions that change the node (maintenance mode, restore) are audited too, with their query
+and response status. When the caller authenticated, records name the principal and its roles
+separately from the client identity. The node keeps the last records in memory (10000 by
+default), with or without a sink, and GET /admin/audit queries them by time range, client, op and
+key; the sink remains the durable copy.
+
+Functions:
+- NewJSONAuditSink(w io.Writer): AuditSink
+- NewWebhookAuditSink(url string, client *http.Client): AuditSink
+- (*Node) clientIdentity(r *http.Request): string
+- clientAddr(r *http.Request, trusted []*net.IPNet): string
+- inNetworks(ip string, networks []*net.IPNet): bool
+- remoteIP(r *http.Request): string
+- (*Node) newAuditRecord(r *http.Request, op string): AuditRecord
+- (*Node) emitAudit(rec AuditRecord)
+- (*Node) audit(r *http.Request, op, key string, version int64)
+- (*Node) auditAdmin(op string, next http.HandlerFunc): http.HandlerFunc
+- (*auditHistory) resize(size int)
+- (*auditHistory) add(rec AuditRecord)
+- (*auditHistory) query(q AuditQuery): []AuditRecord
+- (*Node) SetAuditRetention(size int)
+- (*Node) AuditRecords(q AuditQuery): []AuditRecord
+- parseAuditTime(s string, now time.Time): (time.Time, error)
+- (*Node) handleAudit(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AuditRecord describes one client mutation or admin action.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Op        string    `json:"op"` // "set", "del", or an admin action ("maintenance", "restore")
+	Key       string    `json:"key,omitempty"`
+	Origin    string    `json:"origin"`
+	Client    string    `json:"client"`
+	Principal string    `json:"principal,omitempty"` // authenticated caller
+	Roles     []string  `json:"roles,omitempty"`
+	Namespace string    `json:"namespace,omitempty"` // ACL pattern that allowed the write
+	Version   int64     `json:"version,omitempty"`
+	Detail    string    `json:"detail,omitempty"` // admin actions: the request query
+	Status    int       `json:"status,omitempty"` // admin actions: the response status
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// AuditSink receives audit records. Audit is called on the request path and
+// must not block for long.
+type AuditSink interface {
+	Audit(rec AuditRecord)
+}
+
+type jsonAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditSink writes one JSON object per record to w.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonAuditSink) Audit(rec AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(rec); err != nil {
+		slog.Warn("audit write failed", "component", "audit", "err", err)
+	}
+}
+
+const (
+	auditQueueSize = 4096
+	auditBatchSize = 256
+)
+
+type webhookAuditSink struct {
+	url     string
+	client  *http.Client
+	queue   chan AuditRecord
+	dropped atomic.Uint64
+}
+
+// NewWebhookAuditSink POSTs records to url as JSON arrays of up to 256
+// records, from a background goroutine.
+func NewWebhookAuditSink(url string, client *http.Client) AuditSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s := &webhookAuditSink{url: url, client: client, queue: make(chan AuditRecord, auditQueueSize)}
+	go s.run()
+	return s
+}
+
+func (s *webhookAuditSink) Audit(rec AuditRecord) {
+	select {
+	case s.queue <- rec:
+	default:
+		if s.dropped.Add(1)%1000 == 1 {
+			slog.Warn("audit webhook queue full; dropping records", "component", "audit", "dropped", s.dropped.Load())
+		}
+	}
+}
+
+func (s *webhookAuditSink) run() {
+	batch := make([]AuditRecord, 0, auditBatchSize)
+	for rec := range s.queue {
+		batch = append(batch[:0], rec)
+	fill:
+		for len(batch) < auditBatchSize {
+			select {
+			case rec := <-s.queue:
+				batch = append(batch, rec)
+			default:
+				break fill
+			}
+		}
+		body, _ := json.Marshal(batch)
+		resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		if err != nil {
+			s.dropped.Add(uint64(len(batch)))
+			slog.Warn("audit webhook failed; dropping records", "component", "audit", "records", len(batch), "err", err)
+		}
+	}
+}
+
+// clientIdentity names the caller: its authenticated principal, else the
+// subject of its TLS client certificate, else its address (see clientAddr).
+func (n *Node) clientIdentity(r *http.Request) string {
+	if p := principalFrom(r.Context()); p != nil {
+		return p.Name
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return clientAddr(r, n.TrustedProxies)
+}
+
+// clientAddr returns the address of the client that sent r. Behind trusted
+// proxies that is the rightmost X-Forwarded-For entry not itself a trusted
+// proxy; from any other address the header could be forged and is ignored.
+func clientAddr(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(r)
+	if len(trusted) == 0 {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && inNetworks(ip, trusted); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+func inNetworks(ip string, networks []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	for _, n := range networks {
+		if addr != nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (n *Node) newAuditRecord(r *http.Request, op string) AuditRecord {
+	rec := AuditRecord{
+		Time:      time.Now().UTC(),
+		Op:        op,
+		Origin:    n.ID,
+		Client:    n.clientIdentity(r),
+		RequestID: requestIDFrom(r.Context()),
+	}
+	if p := principalFrom(r.Context()); p != nil {
+		rec.Principal, rec.Roles = p.Name, p.Roles
+	}
+	return rec
+}
+
+func (n *Node) emitAudit(rec AuditRecord) {
+	n.auditLog.add(rec)
+	if n.Audit != nil {
+		n.Audit.Audit(rec)
+	}
+}
+
+func (n *Node) audit(r *http.Request, op, key string, version int64) {
+	rec := n.newAuditRecord(r, op)
+	rec.Key, rec.Version = key, version
+	rec.Namespace = n.namespaceOf(r, key)
+	n.recent.add(OpRecord{
+		Time: rec.Time, Source: "client", Op: op, Key: key, Version: version, Origin: n.ID,
+		Outcome: OutcomeApplied, Client: rec.Client, RequestID: rec.RequestID,
+	})
+	n.emitAudit(rec)
+}
+
+// auditAdmin wraps an admin handler that changes the node, recording each
+// call with its query and response status, whether or not it succeeded.
+func (n *Node) auditAdmin(op string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rr := &respRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rr, r)
+		rec := n.newAuditRecord(r, op)
+		rec.Detail, rec.Status = r.URL.RawQuery, rr.status
+		n.emitAudit(rec)
+	}
+}
+
+// defaultAuditRetention is how many audit records NewNode keeps in memory.
+const defaultAuditRetention = 10000
+
+// auditHistory is a ring of the latest audit records, for GET /admin/audit.
+type auditHistory struct {
+	mu  sync.Mutex
+	buf []AuditRecord
+	n   int // total added
+}
+
+// AuditQuery selects audit records; zero fields match everything.
+type AuditQuery struct {
+	Since, Until time.Time // Since inclusive, Until exclusive
+	Client       string    // client identity or principal
+	Op           string
+	Key          string
+	Limit        int // default 1000
+}
+
+func (h *auditHistory) resize(size int) {
+	var keep []AuditRecord
+	if size > 0 {
+		keep = h.query(AuditQuery{Limit: size})
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.buf, h.n = make([]AuditRecord, max(size, 0)), 0
+	for i := len(keep) - 1; i >= 0; i-- {
+		h.buf[h.n] = keep[i]
+		h.n++
+	}
+}
+
+func (h *auditHistory) add(rec AuditRecord) {
+	h.mu.Lock()
+	if len(h.buf) > 0 {
+		h.buf[h.n%len(h.buf)] = rec
+		h.n++
+	}
+	h.mu.Unlock()
+}
+
+// query returns matching records, newest first.
+func (h *auditHistory) query(q AuditQuery) []AuditRecord {
+	if q.Limit <= 0 {
+		q.Limit = 1000
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []AuditRecord
+	for i := h.n - 1; i >= 0 && i >= h.n-len(h.buf) && len(out) < q.Limit; i-- {
+		rec := &h.buf[i%len(h.buf)]
+		switch {
+		case !q.Since.IsZero() && rec.Time.Before(q.Since):
+			return out // records are in time order
+		case !q.Until.IsZero() && !rec.Time.Before(q.Until),
+			q.Client != "" && rec.Client != q.Client && rec.Principal != q.Client,
+			q.Op != "" && rec.Op != q.Op,
+			q.Key != "" && rec.Key != q.Key:
+			continue
+		}
+		out = append(out, *rec)
+	}
+	return out
+}
+
+// SetAuditRetention sets how many audit records the node keeps in memory for
+// GET /admin/audit (default 10000); 0 turns the history off.
+func (n *Node) SetAuditRetention(size int) { n.auditLog.resize(size) }
+
+// AuditRecords returns the retained audit records matching q, newest first.
+func (n *Node) AuditRecords(q AuditQuery) []AuditRecord { return n.auditLog.query(q) }
+
+// parseAuditTime accepts an RFC 3339 time or a duration before now ("1h").
+func parseAuditTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// handleAudit serves GET /admin/audit?since=T&until=T&client=C&op=O&key=K&n=N,
+// where T is an RFC 3339 time or a duration ago.
+func (n *Node) handleAudit(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	q := AuditQuery{Client: qs.Get("client"), Op: qs.Get("op"), Key: qs.Get("key")}
+	now := time.Now()
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if s := qs.Get(name); s != "" {
+			v, err := parseAuditTime(s, now)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 time or a duration", 400)
+				return
+			}
+			*t = v
+		}
+	}
+	if s := qs.Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			http.Error(w, "n must be a positive integer", 400)
+			return
+		}
+		q.Limit = v
+	}
+	recs := n.auditLog.query(q)
+	if recs == nil {
+		recs = []AuditRecord{}
+	}
+	writeEncoded(w, r, http.StatusOK, recs)
+}
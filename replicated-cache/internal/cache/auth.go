@@ -0,0 +1,244 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements authentication and role checks for the client and admin APIs. With
+Node.Auth set, every /kv and /admin request must carry credentials the Authenticator accepts,
+either as "Authorization: Bearer <token>" or as an "X-API-Key" header; other requests get 401.
+The authenticated Principal travels in the request context, and its name is what the audit log
+and recent operations record as the client.
+
+Roles are ordered read < write < admin, each including the ones before it: GET on /kv needs read,
+PUT and DELETE need write, and anything under /admin needs admin. A caller without the role gets
+403. Callers whose credentials carry none of these roles get Node.DefaultRole. Node.ACL further
+limits /kv requests to the key namespaces each caller may use (see acl.go), Node.KeyPolicy lets an
+embedding program veto them (see policy.go), and Node.AuthThrottle locks out addresses that keep
+failing to authenticate (see auththrottle.go). Monitoring paths (/stats, /metrics, /healthz, ...)
+stay open, and the peer paths have their own checks (see tls.go).
+
+The bundled Authenticator is a set of static API keys, loaded from a file with one key per line,
+optionally followed by a name for the key's owner and its role ("#" starts a comment). Keys are compared by
+their SHA-256 digest, so lookups take the same time whatever prefix of a key an attacker guesses.
+JWTs from an OIDC provider are handled by JWTAuth (see jwt.go), and AnyOf accepts either.
+
+Functions:
+- ValidRole(role string): bool
+- NewAPIKeys(): *APIKeys
+- LoadAPIKeys(path string): (*APIKeys, error)
+- ParseAPIKeys(r io.Reader, source string): (*APIKeys, error)
+- (*APIKeys) Add(key, name string, roles ...string)
+- (*APIKeys) Authenticate(r *http.Request): (*Principal, error)
+- bearerToken(r *http.Request): string
+- principalFrom(ctx context.Context): *Principal
+- requiredRole(r *http.Request): string
+- (*Principal) has(role, fallback string): bool
+- (*Node) authenticate(next http.Handler): http.Handler
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNoCredentials  = errors.New("missing credentials")
+	errBadCredentials = errors.New("invalid credentials")
+)
+
+// Roles, from least to most privileged; each includes the ones before it.
+const (
+	RoleRead  = "read"
+	RoleWrite = "write"
+	RoleAdmin = "admin"
+)
+
+var roleRank = map[string]int{RoleRead: 1, RoleWrite: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of RoleRead, RoleWrite or RoleAdmin.
+func ValidRole(role string) bool { return roleRank[role] > 0 }
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name  string
+	Roles []string // from the credential: an API key's role or a JWT roles claim
+}
+
+// Authenticator identifies the caller of a request. It returns an error when
+// the request carries no acceptable credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// APIKeys authenticates requests by static API key.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]*Principal
+}
+
+func NewAPIKeys() *APIKeys {
+	return &APIKeys{keys: make(map[[sha256.Size]byte]*Principal)}
+}
+
+// LoadAPIKeys reads keys from path: one "KEY [NAME [ROLE]]" per line.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAPIKeys(f, path)
+}
+
+// ParseAPIKeys reads keys in the LoadAPIKeys format from r; source names r
+// in errors.
+func ParseAPIKeys(r io.Reader, source string) (*APIKeys, error) {
+	k := NewAPIKeys()
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			k.Add(fields[0], fmt.Sprintf("key-%d", line))
+		case 2:
+			k.Add(fields[0], fields[1])
+		case 3:
+			if !ValidRole(fields[2]) {
+				return nil, fmt.Errorf("%s:%d: unknown role %q (want read, write or admin)", source, line, fields[2])
+			}
+			k.Add(fields[0], fields[1], fields[2])
+		default:
+			return nil, fmt.Errorf("%s:%d: want KEY [NAME [ROLE]]", source, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(k.keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", source)
+	}
+	return k, nil
+}
+
+// Add accepts key on behalf of name, with the given roles.
+func (k *APIKeys) Add(key, name string, roles ...string) {
+	k.keys[sha256.Sum256([]byte(key))] = &Principal{Name: name, Roles: roles}
+}
+
+func (k *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	tok := bearerToken(r)
+	if tok == "" {
+		return nil, errNoCredentials
+	}
+	if p, ok := k.keys[sha256.Sum256([]byte(tok))]; ok {
+		return p, nil
+	}
+	return nil, errBadCredentials
+}
+
+// bearerToken returns the request's bearer token or API key, or "".
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+type principalKey struct{}
+
+// principalFrom returns the authenticated caller, or nil.
+func principalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// requiredRole returns the role r needs, or "" for paths that are not
+// guarded here.
+func requiredRole(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/kv/"):
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return RoleRead
+		}
+		return RoleWrite
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		return RoleAdmin
+	}
+	return ""
+}
+
+// has reports whether p holds role or a higher one. Roles the cache does not
+// know, such as unmapped provider groups, are ignored, and a principal with no
+// known role is treated as holding fallback.
+func (p *Principal) has(role, fallback string) bool {
+	rank := 0
+	for _, have := range p.Roles {
+		rank = max(rank, roleRank[have])
+	}
+	if rank == 0 {
+		rank = roleRank[fallback]
+	}
+	return rank >= roleRank[role]
+}
+
+// authenticate rejects /kv and /admin requests that Auth does not accept or
+// whose caller lacks the role the request needs. Other paths are left to
+// their own checks (e.g. peerOnly).
+func (n *Node) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := requiredRole(r)
+		if role == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t := n.AuthThrottle
+		var ip string
+		if t != nil {
+			ip = clientAddr(r, n.TrustedProxies)
+			if wait := n.authFails.check(ip, time.Now()); wait > 0 {
+				n.metrics.authThrottled.Add(1)
+				w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+				http.Error(w, "too many failed authentications", http.StatusTooManyRequests)
+				return
+			}
+		}
+		p, err := n.Auth.Authenticate(r)
+		if err != nil {
+			if t != nil {
+				n.authFailed(t, ip)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cache"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if t != nil {
+			n.authFails.succeed(ip)
+		}
+		if !p.has(role, n.DefaultRole) {
+			http.Error(w, fmt.Sprintf("%s needs the %s role", p.Name, role), http.StatusForbidden)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/kv/") {
+			if err := n.authorizeKey(p, r, role); err != nil {
+				n.log.Warn("request denied by acl", "component", "auth", "client", p.Name, "method", r.Method, "path", r.URL.Path)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
@@ -0,0 +1,398 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for client API authentication.
+
+List of functions:
+	- TestLoadAPIKeys: Tests parsing of the API key file.
+	- TestAPIKeyAuth: Tests that /kv requires a valid key while other paths stay open, and that the key's name is recorded.
+	- TestRoles: Tests that reads, writes and admin endpoints need the read, write and admin roles.
+	- TestACL: Tests namespace rules, their precedence, and that the namespace is audited.
+	- TestAuditTrail: Tests that writes and admin actions are audited with their principal and can be queried by time range.
+	- TestAuthThrottle: Tests lockout delays and bans after repeated authentication failures, and sources behind trusted proxies.
+	- TestKeyPolicy: Tests that the key policy hook sees the caller, operation and key, and that denials and failures get 403 and 503.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("# team keys\ns3cret-a alice\n\ns3cret-b   # unnamed\ns3cret-c ops admin\n"), 0o600)
+	k, err := LoadAPIKeys(path)
+	if err != nil { t.Fatal(err) }
+	for tok, want := range map[string]string{"s3cret-a": "alice", "s3cret-b": "key-4", "s3cret-c": "ops"} {
+		r := httptest.NewRequest("GET", "/kv/x", nil)
+		r.Header.Set("X-API-Key", tok)
+		p, err := k.Authenticate(r)
+		if err != nil || p.Name != want {
+			t.Fatalf("%s: principal %+v, err %v", tok, p, err)
+		}
+	}
+	os.WriteFile(path, []byte("a b c\n"), 0o600)
+	if _, err := LoadAPIKeys(path); err == nil {
+		t.Fatal("accepted an unknown role")
+	}
+	os.WriteFile(path, []byte("a b read d\n"), 0o600)
+	if _, err := LoadAPIKeys(path); err == nil {
+		t.Fatal("accepted a line with four fields")
+	}
+	os.WriteFile(path, []byte("# nothing\n"), 0o600)
+	if _, err := LoadAPIKeys(path); err == nil {
+		t.Fatal("accepted a file without keys")
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("s3cret", "alice")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, path, auth string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader("v"))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		method, path, auth string
+		want               int
+	}{
+		{"PUT", "/kv/k", "", 401},
+		{"PUT", "/kv/k", "Bearer wrong", 401},
+		{"PUT", "/kv/k", "Bearer s3cret", 201},
+		{"GET", "/kv/k", "", 401},
+		{"GET", "/kv/k", "bearer s3cret", 200},
+		{"GET", "/healthz", "", 200},
+	} {
+		if got := do(tc.method, tc.path, tc.auth); got != tc.want {
+			t.Fatalf("%s %s with %q: status %d, want %d", tc.method, tc.path, tc.auth, got, tc.want)
+		}
+	}
+	if ops := n.RecentOps("k", 1); len(ops) != 1 || ops[0].Client != "alice" {
+		t.Fatalf("recorded client = %+v", ops)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("r", "reader", RoleRead)
+	keys.Add("w", "writer", RoleWrite)
+	keys.Add("a", "admin", RoleAdmin)
+	keys.Add("d", "default")
+	keys.Add("x", "stranger", "ops")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.DefaultRole = RoleRead
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, path, key string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader("v"))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		method, path, key string
+		want              int
+	}{
+		{"PUT", "/kv/k", "r", 403},
+		{"PUT", "/kv/k", "w", 201},
+		{"GET", "/kv/k", "r", 200},
+		{"GET", "/kv/k", "d", 200},
+		{"DELETE", "/kv/k", "d", 403},
+		{"GET", "/kv/k", "x", 200}, // only unknown roles: the default applies
+		{"GET", "/admin/recent", "w", 403},
+		{"GET", "/admin/recent", "a", 200},
+		{"PUT", "/kv/k", "a", 201},
+		{"GET", "/admin/recent", "", 401},
+		{"GET", "/stats", "", 200},
+	} {
+		if got := do(tc.method, tc.path, tc.key); got != tc.want {
+			t.Fatalf("%s %s with key %q: status %d, want %d", tc.method, tc.path, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestACL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl")
+	os.WriteFile(path, []byte("tenant-a a:* write\ntenant-a a:ro:* read\n@support * read\n* public:* read\n"), 0o600)
+	acl, err := LoadACL(path)
+	if err != nil { t.Fatal(err) }
+	os.WriteFile(path, []byte("x a:* admin\n"), 0o600)
+	if _, err := LoadACL(path); err == nil {
+		t.Fatal("accepted an admin rule")
+	}
+
+	keys := NewAPIKeys()
+	keys.Add("ka", "tenant-a")
+	keys.Add("kb", "tenant-b")
+	keys.Add("ks", "sam", "support")
+	keys.Add("kr", "root", RoleAdmin)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.ACL = acl
+	audit := &auditRecorder{}
+	n.Audit = audit
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, path, key string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader("v"))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		method, path, key string
+		want              int
+	}{
+		{"PUT", "/kv/a:1", "ka", 201},
+		{"GET", "/kv/a:1", "ka", 200},
+		{"PUT", "/kv/a:1", "kb", 403},
+		{"GET", "/kv/a:1", "kb", 403},
+		{"PUT", "/kv/a:ro:1", "ka", 403},
+		{"PUT", "/kv/a:ro:1", "kr", 201},
+		{"GET", "/kv/a:ro:1", "ka", 200},
+		{"GET", "/kv/a:1", "ks", 200},
+		{"DELETE", "/kv/a:1", "ks", 403},
+		{"PUT", "/kv/public:x", "kr", 201},
+		{"GET", "/kv/public:x", "kb", 200},
+		{"PUT", "/kv/public:x", "kb", 403},
+	} {
+		if got := do(tc.method, tc.path, tc.key); got != tc.want {
+			t.Fatalf("%s %s with key %q: status %d, want %d", tc.method, tc.path, tc.key, got, tc.want)
+		}
+	}
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if len(audit.recs) != 3 || audit.recs[0].Namespace != "a:*" || audit.recs[1].Namespace != "" {
+		t.Fatalf("audit records = %+v", audit.recs)
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("w", "writer", RoleWrite)
+	keys.Add("a", "ops", RoleAdmin)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	audit := &auditRecorder{}
+	n.Audit = audit
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, path, key string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader("v"))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		return resp
+	}
+	do("PUT", "/kv/k", "w").Body.Close()
+	do("POST", "/admin/maintenance?on=true", "a").Body.Close()
+	do("POST", "/admin/maintenance?on=maybe", "a").Body.Close()
+	do("POST", "/admin/maintenance?on=false", "w").Body.Close() // 403: never reaches the handler
+
+	audit.mu.Lock()
+	recs := append([]AuditRecord(nil), audit.recs...)
+	audit.mu.Unlock()
+	if len(recs) != 3 {
+		t.Fatalf("audit records = %+v", recs)
+	}
+	if r := recs[0]; r.Op != "set" || r.Principal != "writer" || r.Client != "writer" || len(r.Roles) != 1 || r.Roles[0] != RoleWrite {
+		t.Fatalf("set record = %+v", r)
+	}
+	if r := recs[1]; r.Op != "maintenance" || r.Principal != "ops" || r.Detail != "on=true" || r.Status != 204 {
+		t.Fatalf("maintenance record = %+v", r)
+	}
+	if r := recs[2]; r.Status != 400 {
+		t.Fatalf("failed maintenance record = %+v", r)
+	}
+
+	query := func(q string) []AuditRecord {
+		resp := do("GET", "/admin/audit?"+q, "a")
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET /admin/audit?%s: status %d", q, resp.StatusCode)
+		}
+		var out []AuditRecord
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { t.Fatal(err) }
+		return out
+	}
+	if got := query("op=maintenance&since=1h"); len(got) != 2 || got[0].Detail != "on=maybe" {
+		t.Fatalf("maintenance records = %+v", got)
+	}
+	if got := query("client=writer"); len(got) != 1 || got[0].Key != "k" {
+		t.Fatalf("writer records = %+v", got)
+	}
+	if got := query("until=" + recs[0].Time.Format(time.RFC3339Nano)); len(got) != 0 {
+		t.Fatalf("records before the first = %+v", got)
+	}
+	if got := query("since=" + time.Now().Add(time.Minute).Format(time.RFC3339)); len(got) != 0 {
+		t.Fatalf("future records = %+v", got)
+	}
+	resp := do("GET", "/admin/audit?since=yesterday", "a")
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("bad since: status %d", resp.StatusCode)
+	}
+}
+
+func TestAuthThrottle(t *testing.T) {
+	cfg := AuthThrottle{After: 1, BaseDelay: time.Second, MaxDelay: 4 * time.Second, BanAfter: 6, BanFor: time.Hour, Window: 15 * time.Minute}
+	var a authFailures
+	now := time.Now()
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, time.Hour} {
+		d, ban := a.fail(&cfg, "1.2.3.4", now)
+		if d != want || ban != (i == 5) {
+			t.Fatalf("failure %d: lockout %v (ban %v), want %v", i+1, d, ban, want)
+		}
+	}
+	if a.check("1.2.3.4", now.Add(59*time.Minute)) == 0 || a.banned(now) != 1 {
+		t.Fatal("ban not in force")
+	}
+	if a.check("1.2.3.4", now.Add(61*time.Minute)) != 0 {
+		t.Fatal("ban outlived BanFor")
+	}
+	if d, _ := a.fail(&cfg, "1.2.3.4", now.Add(2*time.Hour)); d != 0 {
+		t.Fatalf("failures not forgotten after Window: lockout %v", d)
+	}
+	a.fail(&cfg, "5.6.7.8", now)
+	a.succeed("5.6.7.8")
+	if d, _ := a.fail(&cfg, "5.6.7.8", now); d != 0 {
+		t.Fatalf("success did not clear failures: lockout %v", d)
+	}
+
+	keys := NewAPIKeys()
+	keys.Add("good", "app")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.AuthThrottle = &AuthThrottle{After: 2, BaseDelay: time.Hour, MaxDelay: time.Hour, Window: time.Hour}
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	get := func(key string) *http.Response {
+		req, _ := http.NewRequest("GET", srv.URL+"/kv/k", nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < 3; i++ {
+		if resp := get("guess"); resp.StatusCode != 401 {
+			t.Fatalf("guess %d: status %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	resp := get("good")
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "3600" {
+		t.Fatalf("locked out source: status %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if got := n.metrics.authFailures.Load(); got != 3 {
+		t.Fatalf("authFailures = %d, want 3", got)
+	}
+	if got := n.metrics.authThrottled.Load(); got != 1 {
+		t.Fatalf("authThrottled = %d, want 1", got)
+	}
+
+	// Behind a trusted proxy, callers are told apart by X-Forwarded-For;
+	// from anyone else the header is ignored.
+	proxies, _ := ParseCIDRs("10.0.0.0/8")
+	from := func(remote, xff string) string {
+		r := httptest.NewRequest("GET", "/kv/k", nil)
+		r.RemoteAddr = remote + ":4000"
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		return clientAddr(r, proxies)
+	}
+	for _, tc := range []struct{ remote, xff, want string }{
+		{"10.0.0.5", "203.0.113.7", "203.0.113.7"},
+		{"10.0.0.5", "198.51.100.1, 203.0.113.7, 10.0.0.9", "203.0.113.7"},
+		{"10.0.0.5", "", "10.0.0.5"},
+		{"10.0.0.5", "junk", "10.0.0.5"},
+		{"192.0.2.1", "203.0.113.7", "192.0.2.1"},
+	} {
+		if got := from(tc.remote, tc.xff); got != tc.want {
+			t.Errorf("clientAddr(%s, X-Forwarded-For %q) = %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("w", "writer", RoleWrite)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	var seen []string
+	n.KeyPolicy = KeyPolicyFunc(func(ctx context.Context, a KeyAccess) (bool, error) {
+		seen = append(seen, a.Principal.Name+" "+a.Op+" "+a.Key)
+		if a.Key == "down" {
+			return false, errors.New("policy engine unreachable")
+		}
+		return !strings.HasPrefix(a.Key, "secret") || a.Op == "get", nil
+	})
+	h := n.Routes()
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader("v"))
+		req.Header.Set("X-API-Key", "w")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"PUT", "/kv/k", 201},
+		{"PUT", "/kv/secret1", 403},
+		{"GET", "/kv/secret1", 404},
+		{"DELETE", "/kv/k", 204},
+		{"GET", "/kv/down", 503},
+		{"GET", "/stats", 200},
+	} {
+		if got := do(tc.method, tc.path); got != tc.want {
+			t.Fatalf("%s %s: status %d, want %d", tc.method, tc.path, got, tc.want)
+		}
+	}
+	want := "writer set k,writer set secret1,writer get secret1,writer del k,writer get down"
+	if got := strings.Join(seen, ","); got != want {
+		t.Fatalf("policy saw %s, want %s", got, want)
+	}
+	if n.metrics.policyDenied.Load() != 1 || n.metrics.policyErrors.Load() != 1 {
+		t.Fatalf("denied %d, errors %d", n.metrics.policyDenied.Load(), n.metrics.policyErrors.Load())
+	}
+}
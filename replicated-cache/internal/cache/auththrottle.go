@@ -0,0 +1,151 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file slows down credential scanning against the API. With Node.AuthThrottle set, failed
+authentications (401s) are counted per remote IP. Past After failures, each further failure
+locks the source out for an exponentially growing delay, from BaseDelay doubling up to MaxDelay;
+at BanAfter failures it is banned for BanFor. While locked out or banned, the source's requests
+on authenticated paths get 429 with Retry-After before its credentials are even checked, so
+guesses cannot be made faster than the delays allow. A successful authentication clears the
+source's record, and records with no failures for Window are forgotten.
+
+Behind a reverse proxy such as cache-gateway every caller shares the proxy's address, so one
+client guessing keys would lock out all of them. Requests from Node.TrustedProxies are therefore
+counted against the address the proxy put in X-Forwarded-For (see clientAddr).
+
+Failures, throttled requests and bans are counted in /metrics, and the first request of each
+lockout and every ban are logged with the source address.
+
+Functions:
+- DefaultAuthThrottle(): AuthThrottle
+- (*authFailures) check(ip string, now time.Time): time.Duration
+- (*authFailures) fail(t *AuthThrottle, ip string, now time.Time): (time.Duration, bool)
+- (*authFailures) succeed(ip string)
+- (*authFailures) banned(now time.Time): int
+- (*Node) authFailed(t *AuthThrottle, ip string)
+*/
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// AuthThrottle configures lockouts after failed authentications.
+type AuthThrottle struct {
+	After     int           // failures allowed before lockouts start
+	BaseDelay time.Duration // first lockout; doubles with each further failure
+	MaxDelay  time.Duration
+	BanAfter  int // failures that get a source banned (0 = never)
+	BanFor    time.Duration
+	Window    time.Duration // forget a source after this long without failures
+}
+
+// DefaultAuthThrottle returns the settings cache-node uses.
+func DefaultAuthThrottle() AuthThrottle {
+	return AuthThrottle{
+		After:     5,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+		BanAfter:  100,
+		BanFor:    time.Hour,
+		Window:    15 * time.Minute,
+	}
+}
+
+type authFailures struct {
+	mu      sync.Mutex
+	sources map[string]*authSource
+	swept   time.Time
+}
+
+type authSource struct {
+	failures int
+	last     time.Time // last failure
+	until    time.Time // locked out until
+	banned   bool
+}
+
+// check returns how much longer ip is locked out, or zero.
+func (a *authFailures) check(ip string, now time.Time) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if s, ok := a.sources[ip]; ok && now.Before(s.until) {
+		return s.until.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failure from ip, returning the lockout it starts (zero for
+// none) and whether it is a ban.
+func (a *authFailures) fail(t *AuthThrottle, ip string, now time.Time) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sources == nil {
+		a.sources = make(map[string]*authSource)
+	}
+	if now.Sub(a.swept) >= rateSweepEvery {
+		for k, s := range a.sources {
+			if now.Sub(s.last) > t.Window && now.After(s.until) {
+				delete(a.sources, k)
+			}
+		}
+		a.swept = now
+	}
+	s, ok := a.sources[ip]
+	if !ok || now.Sub(s.last) > t.Window && now.After(s.until) {
+		s = &authSource{}
+		a.sources[ip] = s
+	}
+	s.failures++
+	s.last = now
+	switch {
+	case t.BanAfter > 0 && s.failures >= t.BanAfter:
+		s.until, s.banned = now.Add(t.BanFor), true
+		return t.BanFor, true
+	case s.failures > t.After:
+		d := t.BaseDelay << min(s.failures-t.After-1, 30)
+		if d <= 0 || d > t.MaxDelay {
+			d = t.MaxDelay
+		}
+		s.until = now.Add(d)
+		return d, false
+	}
+	return 0, false
+}
+
+// succeed clears ip's failures.
+func (a *authFailures) succeed(ip string) {
+	a.mu.Lock()
+	delete(a.sources, ip)
+	a.mu.Unlock()
+}
+
+// banned counts sources currently banned.
+func (a *authFailures) banned(now time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for _, s := range a.sources {
+		if s.banned && now.Before(s.until) {
+			n++
+		}
+	}
+	return n
+}
+
+// authFailed records a failed authentication from ip, logging any lockout or
+// ban it starts.
+func (n *Node) authFailed(t *AuthThrottle, ip string) {
+	n.metrics.authFailures.Add(1)
+	if lock, ban := n.authFails.fail(t, ip, time.Now()); ban {
+		n.metrics.authBans.Add(1)
+		n.log.Warn("source banned after repeated authentication failures", "component", "auth", "remote", ip, "for", lock)
+	} else if lock > 0 {
+		n.log.Warn("authentication failures; locking out source", "component", "auth", "remote", ip, "for", lock)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements asynchronous replication between clusters, typically in two regions, so that
+a second region can serve reads locally and converge with the first. BridgeLoop follows the
+remote cluster's GET /changes feed (see changefeed.go), filtered by namespace or prefix, and
+applies each set and delete here as if a local peer had sent it: the newer version wins, with the
+origin breaking ties, and the winners are replicated to this cluster's peers. Running a bridge in
+each direction links the clusters both ways. Versions come from each node's hybrid logical clock
+(versionClock in node.go), which every applied write moves forward, so a write made after the
+other region's write reached this one wins even when the other region's clocks run ahead.
+
+Writes keep the origin and version they were made with. Events whose origin is this node or one of
+its peers are not applied again, so a pair of bridges does not echo writes back and forth. Expiry
+is not bridged, since each item carries its expiry time; evictions are local and not bridged
+either. Replayed sets that were overwritten since ("superseded") are skipped, as the newer write
+follows in the feed.
+
+The bridge resumes from the last event id it saw, rewound by BridgeOptions.Rewind because ids
+are only comparable on the node that issued them and the bridge may reconnect to another one;
+events seen twice are harmless, as an older or equal version is not applied. A remote answering
+"reset" lost events the bridge had not seen (it was away longer than the remote's changefeed
+ring); those keys converge on their next write. The bridge starts with live events, so keys
+written before it first connected are not copied.
+
+Per-origin signatures (see msgsign.go) cannot cover bridged writes, whose origin is a remote node,
+so BridgeLoop refuses to run on nodes with PeerKeys or a SigningKey.
+
+Functions:
+- (*Node) BridgeLoop(ctx context.Context, opts BridgeOptions)
+- (*Node) followRemote(ctx context.Context, client *http.Client, base string, opts BridgeOptions, cursor *int64): error
+- (*Node) bridgeApply(ctx context.Context, ev changeEvent)
+- (*Node) localOrigin(id string): bool
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bridgeRewind     = 5 * time.Second
+	bridgeBackoff    = time.Second
+	bridgeMaxBackoff = 30 * time.Second
+)
+
+// BridgeOptions configures BridgeLoop.
+type BridgeOptions struct {
+	URLs       []string // base URLs of remote nodes, tried in turn
+	Namespaces []string // bridge only keys in these namespaces ("ns:..."); with Prefixes empty too, all keys
+	Prefixes   []string
+	Token      string        // bearer token for the remote cluster, which needs the read role
+	TLS        *tls.Config   // for https URLs; nil uses the system roots
+	Rewind     time.Duration // how far before its cursor the bridge resumes; default 5s
+}
+
+// BridgeLoop applies the remote cluster's changes here until ctx is done,
+// reconnecting with backoff when the feed fails.
+func (n *Node) BridgeLoop(ctx context.Context, opts BridgeOptions) {
+	if len(opts.URLs) == 0 {
+		return
+	}
+	if n.PeerKeys != nil || n.SigningKey != nil {
+		n.log.Error("cross-cluster bridge disabled: per-origin signatures cannot cover bridged writes", "component", "bridge")
+		return
+	}
+	if opts.Rewind <= 0 {
+		opts.Rewind = bridgeRewind
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		t.TLSClientConfig = opts.TLS.Clone()
+	}
+	client := &http.Client{Transport: t}
+	var cursor int64
+	backoff := bridgeBackoff
+	for i := 0; ; i++ {
+		base := strings.TrimSuffix(opts.URLs[i%len(opts.URLs)], "/")
+		before := cursor
+		err := n.followRemote(ctx, client, base, opts, &cursor)
+		if ctx.Err() != nil {
+			return
+		}
+		if cursor != before {
+			backoff = bridgeBackoff
+		}
+		n.log.Warn("cross-cluster feed lost; reconnecting", "component", "bridge", "remote", base, "retry_in", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+			backoff = min(backoff*2, bridgeMaxBackoff)
+		}
+	}
+}
+
+// followRemote applies base's /changes stream until it ends, keeping cursor
+// at the id of the last event.
+func (n *Node) followRemote(ctx context.Context, client *http.Client, base string, opts BridgeOptions, cursor *int64) error {
+	q := url.Values{"namespace": opts.Namespaces, "prefix": opts.Prefixes}
+	if *cursor > 0 {
+		q.Set("since", strconv.FormatInt(max(*cursor-opts.Rewind.Nanoseconds(), 1), 10))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/changes?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	n.metrics.bridgeConnected.Add(1)
+	defer n.metrics.bridgeConnected.Add(-1)
+	n.log.Info("following cross-cluster feed", "component", "bridge", "remote", base, "since", q.Get("since"))
+
+	r := bufio.NewReaderSize(resp.Body, 64<<10)
+	var id int64
+	var event string
+	var data []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("stream closed")
+			}
+			return err
+		}
+		field, value, _ := strings.Cut(strings.TrimRight(string(line), "\r\n"), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id, _ = strconv.ParseInt(value, 10, 64)
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value...)
+		case "":
+			if len(line) > 1 && line[0] == ':' {
+				continue // a comment, such as a ping
+			}
+			switch event {
+			case "set", "del":
+				var ev changeEvent
+				if err := json.Unmarshal(data, &ev); err != nil {
+					return fmt.Errorf("bad event: %w", err)
+				}
+				n.bridgeApply(ctx, ev)
+			case "reset":
+				n.metrics.bridgeGaps.Add(1)
+				n.log.Warn("cross-cluster feed lost events; their keys converge on their next write", "component", "bridge", "remote", base)
+			case "error":
+				return fmt.Errorf("remote error: %s", data)
+			}
+			if id > 0 {
+				*cursor = id
+			}
+			id, event, data = 0, "", data[:0]
+		}
+	}
+}
+
+// bridgeApply applies a remote set or delete and replicates it to the peers
+// when it wins.
+func (n *Node) bridgeApply(ctx context.Context, ev changeEvent) {
+	if ev.Superseded || n.localOrigin(ev.Origin) {
+		return
+	}
+	it := Item{Version: ev.Version, Origin: ev.Origin, Tombstone: ev.Type == "del"}
+	if !it.Tombstone {
+		if n.KeyRules != nil && n.KeyRules.Check(ev.Key) != nil {
+			n.metrics.keysRejected.Add(1)
+			return
+		}
+		it.Value, it.Flags = ev.Value, ev.Flags
+		if ev.ExpiresAt != nil {
+			it.ExpiresAt = *ev.ExpiresAt
+		}
+		it = n.sealItem(ev.Key, it)
+	}
+	n.metrics.bridgeLag.Store(time.Now().UnixNano() - ev.Version)
+	if !n.apply(ev.Key, it) {
+		n.metrics.bridgeStale.Add(1)
+		return
+	}
+	n.metrics.bridgeApplied.Add(1)
+	n.Replicate(ctx, syncMsgFor(ev.Key, it), 0, false)
+}
+
+// localOrigin reports whether id is this node or one of its peers.
+func (n *Node) localOrigin(id string) bool {
+	if id == n.ID {
+		return true
+	}
+	_, ok := n.peerIDs.Load(id)
+	return ok
+}
@@ -0,0 +1,114 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the cross-cluster bridge and the hybrid logical clock behind versions.
+
+List of functions:
+	- waitFor: Polls a condition until it holds or a deadline passes.
+	- TestBridge: Tests bridging sets and deletes both ways, namespace filtering, no echoes and last-writer-wins.
+	- TestVersionClock: Tests that versions increase and follow observed versions within the drift bound.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	a, b := NewNode("A", ":x", nil), NewNode("B", ":y", nil)
+	a.AccessLog, b.AccessLog = false, false
+	srvA, srvB := httptest.NewServer(a.Routes()), httptest.NewServer(b.Routes())
+	defer srvA.Close()
+	defer srvB.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.BridgeLoop(ctx, BridgeOptions{URLs: []string{srvA.URL}, Namespaces: []string{"eu"}})
+	go a.BridgeLoop(ctx, BridgeOptions{URLs: []string{srvB.URL}, Namespaces: []string{"eu"}})
+	waitFor(t, "both bridges", func() bool { return a.metrics.bridgeConnected.Load() == 1 && b.metrics.bridgeConnected.Load() == 1 })
+
+	put := func(srv *httptest.Server, key, value string) {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key, strings.NewReader(value))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		if resp.StatusCode != 201 {
+			t.Fatalf("PUT %s = %d", key, resp.StatusCode)
+		}
+	}
+	value := func(n *Node, key string) string {
+		it, ok := n.store.GetLive(key, time.Now())
+		if !ok {
+			return ""
+		}
+		return string(it.Value)
+	}
+
+	put(srvA, "us:1", "not bridged")
+	put(srvA, "eu:1", "hello")
+	waitFor(t, "eu:1 on B", func() bool { return value(b, "eu:1") == "hello" })
+	if it, _ := b.store.Get("eu:1"); it.Origin != "A" {
+		t.Fatalf("bridged origin %q, want A", it.Origin)
+	}
+	if _, ok := b.store.Get("us:1"); ok {
+		t.Fatal("us:1 bridged outside the namespace")
+	}
+	put(srvB, "eu:2", "back")
+	waitFor(t, "eu:2 on A", func() bool { return value(a, "eu:2") == "back" })
+	if a.metrics.bridgeStale.Load() != 0 || b.metrics.bridgeStale.Load() != 0 {
+		t.Fatalf("writes echoed back: stale %d on A, %d on B", a.metrics.bridgeStale.Load(), b.metrics.bridgeStale.Load())
+	}
+
+	req, _ := http.NewRequest("DELETE", srvA.URL+"/kv/eu:1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	waitFor(t, "eu:1 deleted on B", func() bool { it, _ := b.store.Get("eu:1"); return it.Tombstone })
+
+	// A write from a clock running ahead reaches B; B's next write still wins.
+	ahead := time.Now().Add(10 * time.Second).UnixNano()
+	a.apply("eu:3", Item{Value: []byte("ahead"), Version: ahead, Origin: "A"})
+	waitFor(t, "eu:3 on B", func() bool { return value(b, "eu:3") == "ahead" })
+	put(srvB, "eu:3", "after")
+	if it, _ := b.store.Get("eu:3"); string(it.Value) != "after" || it.Version <= ahead {
+		t.Fatalf("B's later write lost: %q version %d <= %d", it.Value, it.Version, ahead)
+	}
+	waitFor(t, "eu:3 back on A", func() bool { return value(a, "eu:3") == "after" })
+}
+
+func TestVersionClock(t *testing.T) {
+	var c versionClock
+	now := time.Now()
+	v1, v2 := c.next(now), c.next(now)
+	if v2 <= v1 {
+		t.Fatalf("versions %d then %d", v1, v2)
+	}
+	c.observe(now.Add(time.Second).UnixNano(), now)
+	if v := c.next(now); v <= now.Add(time.Second).UnixNano() {
+		t.Fatalf("version %d does not follow the observed one", v)
+	}
+	far := time.Now().Add(2 * maxVersionDrift).UnixNano()
+	c.observe(far, time.Now())
+	if v := c.next(time.Now()); v >= far {
+		t.Fatal("followed a version beyond the drift bound")
+	}
+}
@@ -0,0 +1,487 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements change data capture (CDC) to Kafka: CDCLoop publishes every set, del and
+expire this node originated to a topic, so that search indexes, analytics pipelines and other
+consumers can follow the cache's state. Each record's key is the cache key, so the default
+partitioner (murmur2, as in the Java client) keeps a key's changes in order on one partition, and
+its value is the JSON change event
+
+	{"id":1760572800000000001,"type":"set","key":"user:1","value":"YW5u","version":1760572800000000000,"origin":"N1"}
+
+with "type" and "origin" also as record headers. Values are sent in the clear (decrypted when
+ValueKeys is set) unless OmitValues is set; a set whose value was overwritten before it could be
+published has none, since a later event carries the newer one. A delete is a regular record, not a
+null-valued tombstone. As with webhooks, only the node that took a write publishes it, so the
+cluster as a whole produces each change once.
+
+The client is a small producer speaking the Kafka protocol directly (Metadata v1, Produce v3 with
+v2 record batches, uncompressed, acks=all), with optional TLS and no SASL. Failed batches are
+retried with backoff until they succeed, so records are published at least once and in order;
+consumers can drop duplicates by id. While the brokers are unreachable changes queue and then
+catch up from the changefeed ring (see followChanges in changefeed.go); changes older than the
+ring are lost and counted.
+
+Functions:
+- (*Node) CDCLoop(ctx context.Context, opts CDCOptions)
+- (*Node) cdcMessages(batch []watchEvent, omitValues bool): []kafkaMessage
+- newKafkaProducer(opts CDCOptions): *kafkaProducer
+- (*kafkaProducer) produce(ctx context.Context, msgs []kafkaMessage): error
+- (*kafkaProducer) refresh(ctx context.Context): error
+- (*kafkaProducer) conn(ctx context.Context, id int32): (*kafkaConn, error)
+- (*kafkaProducer) close()
+- dialKafka(ctx context.Context, addr string, opts CDCOptions): (*kafkaConn, error)
+- (*kafkaConn) roundTrip(ctx context.Context, api, version int16, body []byte): (*kafkaReader, error)
+- kafkaRecordBatch(msgs []kafkaMessage): []byte
+- kafkaPartition(key []byte, partitions int): int32
+- murmur2(data []byte): uint32
+- appendKafkaString(b []byte, s string): []byte
+- appendKafkaVarBytes(b []byte, v []byte): []byte
+- (*kafkaReader) next(n int): []byte
+- (*kafkaReader) int8(), int16(), int32(), int64(), string()
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	cdcBatch      = 500
+	cdcBackoff    = time.Second
+	cdcMaxBackoff = 30 * time.Second
+
+	kafkaProduce  = 0
+	kafkaMetadata = 3
+)
+
+// CDCOptions configures CDCLoop.
+type CDCOptions struct {
+	Brokers    []string // bootstrap "host:port" addresses
+	Topic      string
+	Prefixes   []string // publish only keys under these; all keys when empty
+	OmitValues bool
+	TLS        *tls.Config   // nil: plaintext
+	ClientID   string        // default "replicated-cache"
+	Timeout    time.Duration // per request; default 10s
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli) // CRC-32C, for record batches
+
+// kafkaError is a non-zero error code from a broker.
+type kafkaError int16
+
+func (e kafkaError) Error() string { return "kafka error code " + strconv.Itoa(int(e)) }
+
+type kafkaMessage struct {
+	key, value []byte
+	headers    [][2]string
+	time       time.Time
+}
+
+type kafkaConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	corr    int32
+	client  string
+	timeout time.Duration
+}
+
+type kafkaProducer struct {
+	opts    CDCOptions
+	addrs   map[int32]string // broker id -> address
+	conns   map[int32]*kafkaConn
+	leaders []int32 // partition -> broker id; nil until refreshed
+}
+
+// CDCLoop publishes the changes this node originates to opts.Topic until ctx
+// is done.
+func (n *Node) CDCLoop(ctx context.Context, opts CDCOptions) {
+	p := newKafkaProducer(opts)
+	defer p.close()
+	gap := func() {
+		n.metrics.cdcGaps.Add(1)
+		n.log.Warn("CDC fell behind; changes were not published", "component", "cdc", "topic", opts.Topic)
+	}
+	n.followChanges(ctx, opts.Prefixes, cdcBatch, gap, func(batch []watchEvent) {
+		msgs := n.cdcMessages(batch, opts.OmitValues)
+		backoff := cdcBackoff
+		for {
+			err := p.produce(ctx, msgs)
+			if err == nil {
+				n.metrics.cdcPublished.Add(int64(len(msgs)))
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			n.metrics.cdcErrors.Add(1)
+			n.log.Warn("CDC publish failed; retrying", "component", "cdc", "topic", opts.Topic, "records", len(msgs), "retry_in", backoff, "err", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+				backoff = min(backoff*2, cdcMaxBackoff)
+			}
+		}
+	})
+}
+
+func (n *Node) cdcMessages(batch []watchEvent, omitValues bool) []kafkaMessage {
+	msgs := make([]kafkaMessage, 0, len(batch))
+	for _, ev := range batch {
+		var msg changeEvent
+		var err error
+		if omitValues {
+			msg = changeEvent{Type: ev.op, Key: ev.key, Version: ev.it.Version, Origin: ev.it.Origin, Flags: ev.it.Flags}
+		} else if msg, err = n.changeEventFor(ev, true); err != nil {
+			n.log.Error("CDC value", "component", "cdc", "key", ev.key, "err", err)
+		}
+		value, _ := json.Marshal(webhookEvent{ev.id, msg})
+		msgs = append(msgs, kafkaMessage{
+			key:     []byte(ev.key),
+			value:   value,
+			headers: [][2]string{{"type", ev.op}, {"origin", ev.it.Origin}},
+			time:    time.Unix(0, ev.id),
+		})
+	}
+	return msgs
+}
+
+func newKafkaProducer(opts CDCOptions) *kafkaProducer {
+	if opts.ClientID == "" {
+		opts.ClientID = "replicated-cache"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &kafkaProducer{opts: opts, conns: make(map[int32]*kafkaConn)}
+}
+
+// produce writes msgs to their partitions, at least once. On an error the
+// connections and leaders are dropped so that the next call starts afresh.
+func (p *kafkaProducer) produce(ctx context.Context, msgs []kafkaMessage) (err error) {
+	defer func() {
+		if err != nil {
+			p.close()
+		}
+	}()
+	if p.leaders == nil {
+		if err := p.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	byLeader := make(map[int32]map[int32][]kafkaMessage)
+	for _, m := range msgs {
+		part := kafkaPartition(m.key, len(p.leaders))
+		leader := p.leaders[part]
+		if byLeader[leader] == nil {
+			byLeader[leader] = make(map[int32][]kafkaMessage)
+		}
+		byLeader[leader][part] = append(byLeader[leader][part], m)
+	}
+	for leader, parts := range byLeader {
+		c, err := p.conn(ctx, leader)
+		if err != nil {
+			return err
+		}
+		body := binary.BigEndian.AppendUint16(nil, 0xffff) // no transactional id
+		body = binary.BigEndian.AppendUint16(body, 0xffff) // acks=-1: all in-sync replicas
+		body = binary.BigEndian.AppendUint32(body, uint32(p.opts.Timeout.Milliseconds()))
+		body = binary.BigEndian.AppendUint32(body, 1)
+		body = appendKafkaString(body, p.opts.Topic)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(parts)))
+		for part, pm := range parts {
+			batch := kafkaRecordBatch(pm)
+			body = binary.BigEndian.AppendUint32(body, uint32(part))
+			body = binary.BigEndian.AppendUint32(body, uint32(len(batch)))
+			body = append(body, batch...)
+		}
+		r, err := c.roundTrip(ctx, kafkaProduce, 3, body)
+		if err != nil {
+			return err
+		}
+		for topics := r.int32(); topics > 0; topics-- {
+			r.string()
+			for n := r.int32(); n > 0; n-- {
+				part, code := r.int32(), r.int16()
+				r.int64() // base offset
+				r.int64() // log append time
+				if code != 0 && r.err == nil {
+					return fmt.Errorf("partition %d: %w", part, kafkaError(code))
+				}
+			}
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// refresh asks the bootstrap brokers, in turn, for the topic's partition
+// leaders and the brokers' addresses.
+func (p *kafkaProducer) refresh(ctx context.Context) error {
+	body := binary.BigEndian.AppendUint32(nil, 1)
+	body = appendKafkaString(body, p.opts.Topic)
+	var errs []error
+	for _, addr := range p.opts.Brokers {
+		c, err := dialKafka(ctx, addr, p.opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r, err := c.roundTrip(ctx, kafkaMetadata, 1, body)
+		c.conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+			continue
+		}
+		addrs := make(map[int32]string)
+		for n := r.int32(); n > 0; n-- {
+			id, host, port := r.int32(), r.string(), r.int32()
+			r.string() // rack
+			addrs[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		r.int32() // controller id
+		var leaders []int32
+		for topics := r.int32(); topics > 0; topics-- {
+			code, name := r.int16(), r.string()
+			r.int8() // is_internal
+			if code != 0 && r.err == nil {
+				return fmt.Errorf("topic %q: %w", name, kafkaError(code))
+			}
+			for n := r.int32(); n > 0; n-- {
+				r.int16() // partition error; a missing leader fails on produce
+				part, leader := r.int32(), r.int32()
+				for range 2 { // replicas, then in-sync replicas
+					for k := r.int32(); k > 0; k-- {
+						r.int32()
+					}
+				}
+				if part >= 0 && part < 1<<16 && r.err == nil {
+					for int(part) >= len(leaders) {
+						leaders = append(leaders, -1)
+					}
+					leaders[part] = leader
+				}
+			}
+		}
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", addr, r.err))
+			continue
+		}
+		if len(leaders) == 0 {
+			return fmt.Errorf("topic %q has no partitions", p.opts.Topic)
+		}
+		p.addrs, p.leaders = addrs, leaders
+		return nil
+	}
+	return fmt.Errorf("no Kafka broker answered: %w", errors.Join(errs...))
+}
+
+// conn returns a connection to broker id, dialing it if needed.
+func (p *kafkaProducer) conn(ctx context.Context, id int32) (*kafkaConn, error) {
+	if c := p.conns[id]; c != nil {
+		return c, nil
+	}
+	addr, ok := p.addrs[id]
+	if !ok {
+		return nil, fmt.Errorf("no address for broker %d", id)
+	}
+	c, err := dialKafka(ctx, addr, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[id] = c
+	return c, nil
+}
+
+func (p *kafkaProducer) close() {
+	for id, c := range p.conns {
+		c.conn.Close()
+		delete(p.conns, id)
+	}
+	p.leaders = nil
+}
+
+func dialKafka(ctx context.Context, addr string, opts CDCOptions) (*kafkaConn, error) {
+	d := &net.Dialer{Timeout: opts.Timeout}
+	var conn net.Conn
+	var err error
+	if opts.TLS != nil {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: opts.TLS}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{conn: conn, r: bufio.NewReader(conn), client: opts.ClientID, timeout: opts.Timeout}, nil
+}
+
+// roundTrip sends a request and returns a reader over the response body.
+func (c *kafkaConn) roundTrip(ctx context.Context, api, version int16, body []byte) (*kafkaReader, error) {
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	c.corr++
+	hdr := binary.BigEndian.AppendUint16(make([]byte, 4, 64+len(body)), uint16(api))
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(version))
+	hdr = binary.BigEndian.AppendUint32(hdr, uint32(c.corr))
+	hdr = appendKafkaString(hdr, c.client)
+	req := append(hdr, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > 64<<20 {
+		return nil, fmt.Errorf("kafka response of %d bytes", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	r := &kafkaReader{b: resp}
+	if corr := r.int32(); corr != c.corr {
+		return nil, fmt.Errorf("kafka response for request %d, want %d", corr, c.corr)
+	}
+	return r, nil
+}
+
+// kafkaRecordBatch encodes msgs as an uncompressed v2 record batch.
+func kafkaRecordBatch(msgs []kafkaMessage) []byte {
+	first := msgs[0].time.UnixMilli()
+	last := first
+	var recs []byte
+	for i, m := range msgs {
+		ts := m.time.UnixMilli()
+		last = max(last, ts)
+		rec := []byte{0} // attributes
+		rec = binary.AppendVarint(rec, ts-first)
+		rec = binary.AppendVarint(rec, int64(i))
+		rec = appendKafkaVarBytes(rec, m.key)
+		rec = appendKafkaVarBytes(rec, m.value)
+		rec = binary.AppendVarint(rec, int64(len(m.headers)))
+		for _, h := range m.headers {
+			rec = appendKafkaVarBytes(rec, []byte(h[0]))
+			rec = appendKafkaVarBytes(rec, []byte(h[1]))
+		}
+		recs = binary.AppendVarint(recs, int64(len(rec)))
+		recs = append(recs, rec...)
+	}
+	// The CRC covers everything from the attributes on.
+	tail := binary.BigEndian.AppendUint16(nil, 0) // attributes
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(msgs)-1))
+	tail = binary.BigEndian.AppendUint64(tail, uint64(first))
+	tail = binary.BigEndian.AppendUint64(tail, uint64(last))
+	tail = binary.BigEndian.AppendUint64(tail, ^uint64(0)) // no producer id
+	tail = binary.BigEndian.AppendUint16(tail, 0xffff)     // or epoch
+	tail = binary.BigEndian.AppendUint32(tail, ^uint32(0)) // or sequence
+	tail = binary.BigEndian.AppendUint32(tail, uint32(len(msgs)))
+	tail = append(tail, recs...)
+
+	b := binary.BigEndian.AppendUint64(nil, 0) // base offset, set by the broker
+	b = binary.BigEndian.AppendUint32(b, uint32(4+1+4+len(tail)))
+	b = binary.BigEndian.AppendUint32(b, ^uint32(0)) // partition leader epoch
+	b = append(b, 2)                                 // magic
+	b = binary.BigEndian.AppendUint32(b, crc32.Checksum(tail, castagnoli))
+	return append(b, tail...)
+}
+
+// kafkaPartition picks key's partition as the Java client's default
+// partitioner does.
+func kafkaPartition(key []byte, partitions int) int32 {
+	return int32((murmur2(key) & 0x7fffffff) % uint32(partitions))
+}
+
+func murmur2(data []byte) uint32 {
+	const m, r = 0x5bd1e995, 24
+	h := uint32(0x9747b28c) ^ uint32(len(data))
+	n := len(data) &^ 3
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h = h*m ^ k
+	}
+	switch len(data) & 3 {
+	case 3:
+		h ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[n])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendKafkaVarBytes(b []byte, v []byte) []byte {
+	b = binary.AppendVarint(b, int64(len(v)))
+	return append(b, v...)
+}
+
+// kafkaReader decodes big-endian fields; after the first short read every
+// field is zero and err is set.
+type kafkaReader struct {
+	b   []byte
+	err error
+}
+
+func (r *kafkaReader) next(n int) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		if r.err == nil {
+			r.err = io.ErrUnexpectedEOF
+		}
+		return make([]byte, max(n, 0))
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *kafkaReader) int8() int8   { return int8(r.next(1)[0]) }
+func (r *kafkaReader) int16() int16 { return int16(binary.BigEndian.Uint16(r.next(2))) }
+func (r *kafkaReader) int32() int32 { return int32(binary.BigEndian.Uint32(r.next(4))) }
+func (r *kafkaReader) int64() int64 { return int64(binary.BigEndian.Uint64(r.next(8))) }
+
+// string reads a (nullable) string; null reads as "".
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.next(int(n)))
+}
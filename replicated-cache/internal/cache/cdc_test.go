@@ -0,0 +1,216 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for change data capture to Kafka, against a fake broker.
+
+List of functions:
+	- startFakeKafka: Starts a broker that answers Metadata and Produce requests and reports the records it receives.
+	- TestCDCPublish: Tests records, partitioning, origin filtering and retrying after a broker error.
+	- TestMurmur2: Tests the partitioner against values from the Java client.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeRecord struct {
+	partition  int32
+	key, value string
+	headers    map[string]string
+}
+
+// startFakeKafka serves one topic with partitions partitions; the first
+// produce request fails with NOT_LEADER_OR_FOLLOWER when failFirst is set.
+func startFakeKafka(t *testing.T, partitions int32, failFirst bool) (string, chan fakeRecord) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { ln.Close() })
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	records := make(chan fakeRecord, 100)
+	failed := !failFirst
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(br, size[:]); err != nil {
+				return
+			}
+			req := make([]byte, binary.BigEndian.Uint32(size[:]))
+			io.ReadFull(br, req)
+			r := &kafkaReader{b: req}
+			api, _, corr := r.int16(), r.int16(), r.int32()
+			r.string() // client id
+			resp := binary.BigEndian.AppendUint32(nil, uint32(corr))
+			switch api {
+			case kafkaMetadata:
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = binary.BigEndian.AppendUint32(resp, 7) // broker id
+				resp = appendKafkaString(resp, host)
+				resp = binary.BigEndian.AppendUint32(resp, uint32(port))
+				resp = binary.BigEndian.AppendUint16(resp, 0xffff) // no rack
+				resp = binary.BigEndian.AppendUint32(resp, 7)
+				r.int32()
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = binary.BigEndian.AppendUint16(resp, 0)
+				resp = appendKafkaString(resp, r.string())
+				resp = append(resp, 0)
+				resp = binary.BigEndian.AppendUint32(resp, uint32(partitions))
+				for p := int32(0); p < partitions; p++ {
+					resp = binary.BigEndian.AppendUint16(resp, 0)
+					resp = binary.BigEndian.AppendUint32(resp, uint32(p))
+					resp = binary.BigEndian.AppendUint32(resp, 7)
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = binary.BigEndian.AppendUint32(resp, 7)
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = binary.BigEndian.AppendUint32(resp, 7)
+				}
+			case kafkaProduce:
+				r.string()
+				if acks := r.int16(); acks != -1 { t.Errorf("acks = %d", acks) }
+				r.int32()
+				r.int32()
+				topic := r.string()
+				code := uint16(0)
+				if !failed {
+					code, failed = 6, true
+				}
+				resp = binary.BigEndian.AppendUint32(resp, 1)
+				resp = appendKafkaString(resp, topic)
+				n := r.int32()
+				resp = binary.BigEndian.AppendUint32(resp, uint32(n))
+				for ; n > 0; n-- {
+					part := r.int32()
+					batch := r.next(int(r.int32()))
+					if code == 0 {
+						decodeFakeBatch(t, part, batch, records)
+					}
+					resp = binary.BigEndian.AppendUint32(resp, uint32(part))
+					resp = binary.BigEndian.AppendUint16(resp, code)
+					resp = binary.BigEndian.AppendUint64(resp, 0)
+					resp = binary.BigEndian.AppendUint64(resp, ^uint64(0))
+				}
+				resp = binary.BigEndian.AppendUint32(resp, 0)
+			}
+			conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String(), records
+}
+
+func decodeFakeBatch(t *testing.T, part int32, b []byte, out chan fakeRecord) {
+	r := &kafkaReader{b: b}
+	r.int64()
+	r.int32()
+	r.int32()
+	if magic := r.int8(); magic != 2 { t.Errorf("magic %d", magic) }
+	crc := uint32(r.int32())
+	if crc32.Checksum(r.b, crc32.MakeTable(crc32.Castagnoli)) != crc { t.Error("bad CRC") }
+	r.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	count := r.int32()
+	varint := func() int64 {
+		v, n := binary.Varint(r.b)
+		r.b = r.b[n:]
+		return v
+	}
+	for i := int32(0); i < count; i++ {
+		varint() // length
+		r.int8()
+		varint()
+		if delta := varint(); delta != int64(i) { t.Errorf("offset delta %d, want %d", delta, i) }
+		rec := fakeRecord{partition: part, headers: map[string]string{}}
+		rec.key = string(r.next(int(varint())))
+		rec.value = string(r.next(int(varint())))
+		for h := varint(); h > 0; h-- {
+			k := string(r.next(int(varint())))
+			rec.headers[k] = string(r.next(int(varint())))
+		}
+		out <- rec
+	}
+}
+
+func TestCDCPublish(t *testing.T) {
+	addr, records := startFakeKafka(t, 3, true)
+	n := NewNode("N", ":x", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.CDCLoop(ctx, CDCOptions{Brokers: []string{"127.0.0.1:1", addr}, Topic: "cache", Timeout: time.Second})
+	for n.watches.count.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	now := time.Now().UnixNano()
+	n.apply("user:1", Item{Value: []byte("ann"), Version: now, Origin: "N"})
+	n.apply("user:2", Item{Value: []byte("bob"), Version: now, Origin: "P"}) // published by P
+	var got []fakeRecord
+	next := func() {
+		select {
+		case rec := <-records:
+			got = append(got, rec)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("records so far %+v", got)
+		}
+	}
+	next()
+	// Deleted only now, so that the set is published with its value.
+	n.apply("user:1", Item{Version: now + 1, Origin: "N", Tombstone: true})
+	next()
+	var set, del webhookEvent
+	json.Unmarshal([]byte(got[0].value), &set)
+	json.Unmarshal([]byte(got[1].value), &del)
+	want := kafkaPartition([]byte("user:1"), 3)
+	if got[0].key != "user:1" || got[0].partition != want || got[1].partition != want || got[0].headers["type"] != "set" || got[0].headers["origin"] != "N" {
+		t.Fatalf("records %+v", got)
+	}
+	if set.Type != "set" || string(set.Value) != "ann" || set.Version != now || del.Type != "del" || del.ID <= set.ID {
+		t.Fatalf("events %+v, %+v", set, del)
+	}
+	if n.metrics.cdcErrors.Load() != 1 {
+		t.Fatalf("%d publish errors, want 1", n.metrics.cdcErrors.Load())
+	}
+	select {
+	case rec := <-records:
+		t.Fatalf("unexpected record %+v", rec)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMurmur2(t *testing.T) {
+	// From the Java client's UtilsTest.testMurmur2.
+	for in, want := range map[string]int32{
+		"21": -973932308,
+		"foobar": -790332482,
+		"a-little-bit-long-string": -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		if got := int32(murmur2([]byte(in))); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements hot reloading of the node's TLS certificate, so rotating it does not need
+a rolling restart of the cluster. A CertReloader holds the current certificate and hands it to
+every new TLS handshake, both when serving (GetCertificate) and when presenting it to peers
+under mutual TLS (GetClientCertificate). Reload re-reads the certificate and key files; Watch
+polls their modification times and reloads when either changes, and the node also reloads on
+SIGHUP. A pair that fails to load (a key that does not match, or files caught halfway through
+being replaced) is logged and the previous certificate stays in use, so a bad rotation never
+takes the node off the network. Existing connections keep the certificate they started with.
+
+Functions:
+- NewCertReloader(certFile, keyFile string): (*CertReloader, error)
+- (*CertReloader) Reload(): error
+- (*CertReloader) GetCertificate(*tls.ClientHelloInfo): (*tls.Certificate, error)
+- (*CertReloader) GetClientCertificate(*tls.CertificateRequestInfo): (*tls.Certificate, error)
+- (*CertReloader) TLSConfig(): *tls.Config
+- (*CertReloader) changed(): bool
+- (*CertReloader) Watch(ctx context.Context, interval time.Duration)
+*/
+
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair that can be replaced while
+// the node runs.
+type CertReloader struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+
+	mu    sync.Mutex   // serializes Reload
+	stamp [2]time.Time // modification times of the loaded files
+}
+
+// NewCertReloader loads the pair once; it fails if the files are unusable.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Reload re-reads the certificate and key, keeping the current pair if the
+// new one does not load.
+func (c *CertReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stamp := [2]time.Time{modTime(c.certFile), modTime(c.keyFile)}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	c.cert.Store(&cert)
+	c.stamp = stamp
+	if cert.Leaf != nil {
+		slog.Info("loaded TLS certificate", "component", "tls", "subject", cert.Leaf.Subject.String(), "not_after", cert.Leaf.NotAfter)
+	}
+	return nil
+}
+
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+func (c *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// TLSConfig returns a TLS 1.2+ server config that always presents the
+// current certificate.
+func (c *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{GetCertificate: c.GetCertificate, MinVersion: tls.VersionTLS12}
+}
+
+// changed reports whether either file was modified since the last load.
+func (c *CertReloader) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !modTime(c.certFile).Equal(c.stamp[0]) || !modTime(c.keyFile).Equal(c.stamp[1])
+}
+
+// Watch reloads the pair whenever its files change, checking every interval
+// until ctx is done.
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if !c.changed() {
+			continue
+		}
+		if err := c.Reload(); err != nil {
+			slog.Warn("TLS certificate reload failed; keeping the current one", "component", "tls", "err", err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /changes, the node's mutation feed as Server-Sent Events, for browser
+dashboards (EventSource) and simple consumers such as curl that cannot speak WebSocket. It takes
+the same key=, prefix= and namespace= filters as /watch and sends each change as
+
+	id: 1760572800000000001
+	event: set
+	data: {"type":"set","key":"user:1","value":"YW5u","version":1760572800000000000,"origin":"N1"}
+
+Event ids are hybrid logical clock (HLC) timestamps: nanoseconds since the epoch, at least the
+wall clock, the item's version and one more than the previous id, so they strictly increase on a
+node and never precede the write they announce. An id is a cursor: a client reconnecting with
+Last-Event-ID (as EventSource does by itself), or ?since=ID, first gets the retained events after
+it, then live ones. The hub keeps the last SetChangefeed events (default defaultChangefeed)
+without their values; a replayed set carries its value only while it is still the stored
+version, and is marked "superseded":true otherwise. The ring starts with the first /changes
+stream or follower, so a node nobody follows keeps its writes off the hub's lock. A cursor older
+than the retained events gets an "event: reset" first, meaning changes were missed and the
+client should re-read the keys it cares about. Cursors belong to the node
+that issued them: on another node, events within the clocks' skew of the cursor may be repeated
+or missed.
+
+followChanges is the same feed for the node's own consumers (webhooks.go, cdc.go): batches of the
+changes this node originated, resumed from the ring when the consumer falls behind.
+
+Events are checked as reads by the caller like /watch events. A client that falls watchBuffer
+events behind has its stream ended and resumes from its cursor when it reconnects. A comment line
+is sent every wsPingEvery so that proxies keep idle streams open.
+
+Functions:
+- (*hlc) stamp(version int64): int64
+- (*feedRing) resize(size int)
+- (*feedRing) add(ev watchEvent)
+- (*watchHub) startFeed()
+- (*watchHub) subscribeSince(keys, prefixes []string, since int64): (*watcher, []watchEvent, bool)
+- (*Node) SetChangefeed(size int)
+- (*Node) handleChanges(w http.ResponseWriter, r *http.Request)
+- writeSSE(w io.Writer, id int64, event string, v any): error
+- (*Node) followChanges(ctx context.Context, prefixes []string, size int, gap func(), deliver func([]watchEvent))
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// defaultChangefeed is the number of events NewNode keeps for resuming, once
+// the feed has started.
+const defaultChangefeed = 10000
+
+// hlc is a hybrid logical clock packed into nanoseconds; the hub's mutex
+// guards it.
+type hlc struct {
+	last int64
+}
+
+// stamp returns the timestamp for an event about a write with version.
+func (c *hlc) stamp(version int64) int64 {
+	t := max(time.Now().UnixNano(), version, c.last+1)
+	c.last = t
+	return t
+}
+
+// feedRing keeps the newest events, without values; the hub's mutex guards
+// all but size and skipped.
+type feedRing struct {
+	buf     []watchEvent
+	n       int          // total added
+	lost    int64        // id of the newest event no longer kept
+	want    int          // retention to start with (see startFeed)
+	size    atomic.Int64 // len(buf), read without the lock
+	skipped atomic.Bool  // a change was published before the ring started
+}
+
+// resize sets the ring to size events, keeping the newest; 0 disables it.
+func (f *feedRing) resize(size int) {
+	size = max(size, 0)
+	var keep []watchEvent
+	for i := max(f.n-len(f.buf), 0); i < f.n; i++ {
+		keep = append(keep, f.buf[i%len(f.buf)])
+	}
+	if len(keep) > size {
+		f.lost = max(f.lost, keep[len(keep)-size-1].id)
+		keep = keep[len(keep)-size:]
+	}
+	f.buf, f.n = make([]watchEvent, size), 0
+	for _, ev := range keep {
+		f.buf[f.n] = ev
+		f.n++
+	}
+	f.size.Store(int64(size))
+}
+
+func (f *feedRing) add(ev watchEvent) {
+	ev.it.Value = nil
+	if len(f.buf) == 0 {
+		f.lost = ev.id
+		return
+	}
+	i := f.n % len(f.buf)
+	if f.n >= len(f.buf) {
+		f.lost = f.buf[i].id
+	}
+	f.buf[i] = ev
+	f.n++
+}
+
+// startFeed sizes the ring to the configured retention if it has not started
+// yet. Changes published before then were not stamped, so cursors from before
+// now are marked lost.
+func (h *watchHub) startFeed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := &h.feed
+	if len(f.buf) > 0 || f.want == 0 {
+		return
+	}
+	if f.skipped.Load() {
+		f.lost = max(f.lost, h.clock.stamp(0))
+	}
+	f.resize(f.want)
+}
+
+// subscribeSince subscribes to keys and prefixes and returns the retained
+// events after since that match, oldest first, and whether they are all the
+// events after since.
+func (h *watchHub) subscribeSince(keys, prefixes []string, since int64) (*watcher, []watchEvent, bool) {
+	w := h.subscribe(keys, prefixes)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := &h.feed
+	var backlog []watchEvent
+	for i := max(f.n-len(f.buf), 0); i < f.n; i++ {
+		if ev := f.buf[i%len(f.buf)]; ev.id > since && w.matches(ev.key) {
+			backlog = append(backlog, ev)
+		}
+	}
+	// Events published between subscribe and here are in both; the stream
+	// skips what it has already sent. Without a ring nothing can be resumed.
+	return w, backlog, len(f.buf) > 0 && since >= f.lost
+}
+
+// SetChangefeed sets how many events the node keeps for resuming /changes
+// (default 10000); 0 keeps none, so streams can only be followed live. A ring
+// that has not started yet starts with the first stream or follower.
+func (n *Node) SetChangefeed(size int) {
+	n.watches.mu.Lock()
+	defer n.watches.mu.Unlock()
+	f := &n.watches.feed
+	f.want = max(size, 0)
+	if len(f.buf) > 0 || f.want == 0 {
+		f.resize(size)
+	}
+}
+
+// handleChanges serves GET /changes?key=K&prefix=P&namespace=NS&since=ID.
+func (n *Node) handleChanges(w http.ResponseWriter, r *http.Request) {
+	keys, prefixes, err := watchFilters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("since")
+	}
+	var since int64
+	if cursor != "" {
+		if since, err = strconv.ParseInt(cursor, 10, 64); err != nil || since < 0 {
+			http.Error(w, "bad Last-Event-ID or since", http.StatusBadRequest)
+			return
+		}
+	}
+	if rej := n.mayWatch(n.wireChain(true), r, ""); rej != nil {
+		for k, v := range rej.header {
+			w.Header()[k] = v
+		}
+		http.Error(w, rej.message(), rej.status)
+		return
+	}
+	n.watches.startFeed()
+	var watch *watcher
+	var backlog []watchEvent
+	complete := true
+	if cursor != "" {
+		watch, backlog, complete = n.watches.subscribeSince(keys, prefixes, since)
+	} else {
+		watch = n.watches.subscribe(keys, prefixes)
+	}
+	defer n.watches.unsubscribe(watch)
+	n.metrics.sseStreams.Add(1)
+	defer n.metrics.sseStreams.Add(-1)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // for nginx
+	rc := http.NewResponseController(w)
+	io.WriteString(w, "retry: 2000\n\n")
+	if !complete {
+		writeSSE(w, 0, "reset", map[string]string{"type": "reset"})
+	}
+	events := n.wireChain(false)
+	last := since
+	// send writes ev unless it was already sent or the caller may not read
+	// it; false ends the stream.
+	send := func(ev watchEvent, replayed bool) bool {
+		if ev.id <= last {
+			return true
+		}
+		last = ev.id
+		if rej := n.mayWatch(events, r, ev.key); rej != nil {
+			if rej.status == http.StatusForbidden {
+				return true // a key the caller may not read
+			}
+			writeSSE(w, 0, "error", map[string]string{"type": "error", "error": rej.message()})
+			return false
+		}
+		msg, err := n.changeEventFor(ev, replayed)
+		if err != nil {
+			writeSSE(w, 0, "error", map[string]string{"type": "error", "error": err.Error()})
+			return false
+		}
+		return writeSSE(w, ev.id, ev.op, msg) == nil
+	}
+	for _, ev := range backlog {
+		if !send(ev, true) {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			io.WriteString(w, ": ping\n\n")
+		case ev, ok := <-watch.events:
+			if !ok || !send(ev, false) {
+				return // a lagging client resumes from its cursor
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes one event; id 0 leaves the client's cursor unchanged.
+func writeSSE(w io.Writer, id int64, event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// followChanges calls deliver with batches of up to size events, oldest
+// first, about keys under prefixes (all keys when empty) whose writes this
+// node originated, so that a cluster reports each change once. It returns
+// when ctx is done. Events queue while deliver runs; when they overflow, the
+// follower catches up from the ring, and gap is called if some of the missed
+// events are no longer retained.
+func (n *Node) followChanges(ctx context.Context, prefixes []string, size int, gap func(), deliver func([]watchEvent)) {
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	n.watches.startFeed()
+	watch := n.watches.subscribe(nil, prefixes)
+	var last int64
+	for {
+		var batch []watchEvent
+		select {
+		case <-ctx.Done():
+			n.watches.unsubscribe(watch)
+			return
+		case ev, ok := <-watch.events:
+			if ok {
+				batch = append(batch, ev)
+				break
+			}
+			var complete bool
+			watch, batch, complete = n.watches.subscribeSince(nil, prefixes, last)
+			if !complete {
+				gap()
+			}
+		}
+	fill:
+		for len(batch) < size {
+			select {
+			case ev, ok := <-watch.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+		for len(batch) > 0 {
+			k := min(len(batch), size)
+			var mine []watchEvent
+			for _, ev := range batch[:k] {
+				// Events published between subscribing again and reading the
+				// ring arrive twice.
+				if ev.id > last && ev.it.Origin == n.ID {
+					mine = append(mine, ev)
+				}
+				last = max(last, ev.id)
+			}
+			batch = batch[k:]
+			if len(mine) > 0 {
+				deliver(mine)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the /changes Server-Sent Events feed.
+
+List of functions:
+	- openChanges: Opens /changes with an optional Last-Event-ID and returns a reader for its events.
+	- TestChangefeed: Tests live events, resuming from a cursor, replayed values and the reset after lost events.
+	- TestChangefeedStartsOnFirstStream: Tests that the ring is only kept once a stream opens.
+	- TestHLCStamp: Tests that event ids strictly increase and never precede the write's version.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    int64
+	event string
+	data  changeEvent
+}
+
+type sseReader struct {
+	t    *testing.T
+	resp *http.Response
+	r    *bufio.Reader
+}
+
+func openChanges(t *testing.T, srv *httptest.Server, query, lastID string) *sseReader {
+	req, _ := http.NewRequest("GET", srv.URL+"/changes?"+query, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("/changes: %s %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	return &sseReader{t: t, resp: resp, r: bufio.NewReader(resp.Body)}
+}
+
+// next returns the next event, skipping retry fields and comments.
+func (s *sseReader) next() sseEvent {
+	var ev sseEvent
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil { s.t.Fatal(err) }
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id, _ = strconv.ParseInt(value, 10, 64)
+		case "event":
+			ev.event = value
+		case "data":
+			if err := json.Unmarshal([]byte(value), &ev.data); err != nil { s.t.Fatal(err) }
+		case "":
+			if ev.event != "" {
+				return ev
+			}
+		}
+	}
+}
+
+func TestChangefeed(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	t.Cleanup(srv.Close) // after the streams are closed
+	put := func(key, value string) {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key, strings.NewReader(value))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+	}
+
+	live := openChanges(t, srv, "namespace=user", "")
+	put("other", "x")
+	put("user:1", "a")
+	put("user:2", "b")
+	first, second := live.next(), live.next()
+	if first.event != "set" || first.data.Key != "user:1" || string(first.data.Value) != "a" || first.id < first.data.Version {
+		t.Fatalf("first event %+v", first)
+	}
+	if second.data.Key != "user:2" || second.id <= first.id {
+		t.Fatalf("second event %+v after id %d", second, first.id)
+	}
+
+	// Resuming after the first event replays the rest; user:1's value was
+	// overwritten since, so its replayed set has none.
+	put("user:1", "c")
+	resumed := openChanges(t, srv, "namespace=user", strconv.FormatInt(first.id, 10))
+	if ev := resumed.next(); ev.id != second.id || string(ev.data.Value) != "b" {
+		t.Fatalf("first replayed event %+v", ev)
+	}
+	if ev := resumed.next(); ev.data.Key != "user:1" || string(ev.data.Value) != "c" {
+		t.Fatalf("second replayed event %+v", ev)
+	}
+	put("user:3", "d")
+	if ev := resumed.next(); ev.data.Key != "user:3" {
+		t.Fatalf("live event after replay %+v", ev)
+	}
+
+	replay := openChanges(t, srv, "key=user:1&since=0", "")
+	if ev := replay.next(); ev.id != first.id || ev.data.Value != nil {
+		t.Fatalf("superseded replayed set %+v", ev)
+	}
+
+	n.SetChangefeed(1)
+	put("user:4", "e")
+	put("user:5", "f")
+	gap := openChanges(t, srv, "namespace=user", strconv.FormatInt(second.id, 10))
+	if ev := gap.next(); ev.event != "reset" {
+		t.Fatalf("expected a reset, got %+v", ev)
+	}
+	if ev := gap.next(); ev.data.Key != "user:5" {
+		t.Fatalf("event after reset %+v", ev)
+	}
+
+	resp, err := http.Get(srv.URL + "/changes?since=nope")
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad cursor: %d", resp.StatusCode)
+	}
+}
+
+func TestHLCStamp(t *testing.T) {
+	var c hlc
+	future := time.Now().Add(time.Hour).UnixNano()
+	a := c.stamp(0)
+	b := c.stamp(future)
+	d := c.stamp(0)
+	if a <= 0 || b != future || d != future+1 {
+		t.Fatalf("stamps %d, %d, %d with version %d", a, b, d, future)
+	}
+}
+
+func TestChangefeedStartsOnFirstStream(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	t.Cleanup(srv.Close)
+	n.apply("before", Item{Value: []byte("x"), Version: 1, Origin: "N"})
+	if size := n.watches.feed.size.Load(); size != 0 {
+		t.Fatalf("ring of %d events before anyone followed the node", size)
+	}
+
+	// The write before the ring started was not kept, so a cursor from
+	// before it is reset.
+	s := openChanges(t, srv, "key=after", "1")
+	if ev := s.next(); ev.event != "reset" {
+		t.Fatalf("expected a reset, got %+v", ev)
+	}
+	if size := n.watches.feed.size.Load(); size != defaultChangefeed {
+		t.Fatalf("ring of %d events after the first stream, want %d", size, defaultChangefeed)
+	}
+	n.apply("after", Item{Value: []byte("y"), Version: 2, Origin: "N"})
+	if ev := s.next(); ev.data.Key != "after" {
+		t.Fatalf("event after reset %+v", ev)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file lets tests and embedding programs decide what time it is for a node. Node.Clock, when
+set, is read instead of the system clock everywhere the node's data depends on the time: stamping
+a write's version and expiry, following the versions of other nodes, checking expiry on reads
+over every protocol, the janitor's passes over expired items and old tombstones, and the ages
+reported for them. The Store never reads a clock for these decisions; it is handed the node's
+time. Tests can then expire items and tombstones by advancing a fake clock instead of sleeping
+(see package cachetest), and ExpireNow runs the janitor at once rather than on its ticker.
+
+Timeouts, deadlines, rate limits, authentication, the janitor's time budget and latency metrics
+measure real time and keep using the system clock.
+
+Functions:
+- (*Node) now(): time.Time
+- (*Node) ExpireNow()
+*/
+
+package cache
+
+import "time"
+
+// A Clock tells the time. Now must be safe for concurrent use.
+type Clock interface {
+	Now() time.Time
+}
+
+// now reads n.Clock, or the system clock when it is nil.
+func (n *Node) now() time.Time {
+	if n.Clock != nil {
+		return n.Clock.Now()
+	}
+	return time.Now()
+}
+
+// ExpireNow makes a janitor pass at once instead of waiting for JanitorEvery,
+// removing the items and tombstones that are due by the node's clock.
+func (n *Node) ExpireNow() { n.runJanitor() }
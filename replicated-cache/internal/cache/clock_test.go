@@ -0,0 +1,115 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for running a node on an injected clock.
+
+List of functions:
+	- TestClockTTL: Tests that reads and the janitor expire items by the node's clock alone.
+	- TestClockTombstones: Tests that tombstones are reaped after TombstoneTTL by the node's clock.
+	- TestClockVersions: Tests that versions keep increasing when the clock goes back.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestClockTTL(t *testing.T) {
+	ctx := context.Background()
+	clk := &testClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	n := NewNode("N1", ":x", nil)
+	n.Clock = clk
+	var expired []string
+	n.OnExpire(func(key string) { expired = append(expired, key) })
+
+	if err := n.Set(ctx, "read", []byte("v"), 10*time.Second, 0, false); err != nil { t.Fatal(err) }
+	if err := n.Set(ctx, "swept", []byte("v"), time.Minute, 0, false); err != nil { t.Fatal(err) }
+	if err := n.Set(ctx, "kept", []byte("v"), 0, 0, false); err != nil { t.Fatal(err) }
+
+	clk.advance(10 * time.Second)
+	if _, err := n.Get(ctx, "read"); err != nil {
+		t.Fatalf("at its expiry time: %v", err)
+	}
+	clk.advance(time.Nanosecond)
+	if _, err := n.Get(ctx, "read"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("past its expiry time: %v", err)
+	}
+
+	clk.advance(time.Minute)
+	n.ExpireNow()
+	if len(expired) != 2 || expired[0] != "read" || expired[1] != "swept" {
+		t.Fatalf("expired = %q", expired)
+	}
+	if st := n.Store().Stats(); st.Keys != 1 {
+		t.Fatalf("keys after the janitor: %d", st.Keys)
+	}
+	if _, err := n.Get(ctx, "kept"); err != nil {
+		t.Fatalf("key without a TTL: %v", err)
+	}
+}
+
+func TestClockTombstones(t *testing.T) {
+	ctx := context.Background()
+	clk := &testClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	n := NewNode("N1", ":x", nil)
+	n.Clock = clk
+	if err := n.Set(ctx, "k", []byte("v"), 0, 0, false); err != nil { t.Fatal(err) }
+	if err := n.Delete(ctx, "k", 0, false); err != nil { t.Fatal(err) }
+
+	clk.advance(n.TombstoneTTL - time.Second)
+	n.ExpireNow()
+	if st := n.Store().Stats(); st.Tombstones != 1 {
+		t.Fatalf("tombstone reaped before TombstoneTTL: %+v", st)
+	}
+	// The delete's version is a nanosecond past the set's.
+	if age, want := n.Stats().Janitor.OldestTombstoneAge, (n.TombstoneTTL - time.Second).Seconds(); age > want || age < want-1e-6 {
+		t.Fatalf("oldest tombstone age = %vs", age)
+	}
+	clk.advance(2 * time.Second)
+	n.ExpireNow()
+	if st := n.Store().Stats(); st.Tombstones != 0 || st.TombstonesReaped != 1 {
+		t.Fatalf("after TombstoneTTL: %+v", st)
+	}
+}
+
+func TestClockVersions(t *testing.T) {
+	ctx := context.Background()
+	clk := &testClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	n := NewNode("N1", ":x", nil)
+	n.Clock = clk
+	if err := n.Set(ctx, "k", []byte("first"), 0, 0, false); err != nil { t.Fatal(err) }
+	first, _ := n.Store().Get("k")
+	if first.Version != clk.Now().UnixNano() {
+		t.Fatalf("version %d, want the clock's %d", first.Version, clk.Now().UnixNano())
+	}
+	clk.advance(-time.Hour)
+	if err := n.Set(ctx, "k", []byte("second"), 0, 0, false); err != nil { t.Fatal(err) }
+	if v, err := n.Get(ctx, "k"); err != nil || string(v) != "second" {
+		t.Fatalf("write after the clock went back: %q, %v", v, err)
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /cluster/stats. The queried node fetches /stats from every active peer
+in parallel, adds its own, and returns a merged cluster view: totals, per-node hit ratios and
+divergence indicators. With full replication every node should hold about the same number of
+live keys, so a wide spread in live key counts, or undelivered hints piling up, means some
+nodes are missing writes. Nodes are also counted by build version, flagging mixed-version
+clusters. Peers that do not answer within the request timeout are listed with
+their error instead of failing the whole call.
+
+GET /cluster serves the topology smart clients route by: this node and its active peers, with their
+node IDs and URLs, and an epoch that changes whenever the peer set does. Replication is full, so
+every node owns every key and the document says so; a client may send to any node. A client that
+sends its epoch in X-Cache-Topology on /kv requests is answered with the current one in the same
+header when they differ, its cue to fetch /cluster again.
+
+Functions:
+- (*Node) ClusterStats(ctx context.Context): ClusterStats
+- (*Node) fetchStats(ctx context.Context, peer string): (NodeStats, error)
+- (*Node) handleClusterStats(w http.ResponseWriter, r *http.Request)
+- (*Node) Topology(self string): Topology
+- (*Node) setTopology(set map[string]struct{})
+- (*Node) topologyEpoch(): string
+- (*Node) topologyHint(w http.ResponseWriter, r *http.Request)
+- (*Node) handleCluster(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+const topologyHeader = "X-Cache-Topology"
+
+type ClusterNodeStats struct {
+	Addr     string     `json:"addr"` // peer URL, or "self"
+	NodeID   string     `json:"node_id,omitempty"`
+	Version  string     `json:"version,omitempty"`
+	LiveKeys int64      `json:"live_keys"`
+	HitRatio float64    `json:"hit_ratio"`
+	Error    string     `json:"error,omitempty"`
+	Stats    *NodeStats `json:"stats,omitempty"`
+}
+
+type ClusterStats struct {
+	Nodes       int `json:"nodes"`
+	Unreachable int `json:"unreachable"`
+
+	TotalKeys       int64   `json:"total_keys"` // summed over reachable nodes, so replicated keys count once per copy
+	TotalTombstones int64   `json:"total_tombstones"`
+	TotalBytes      int64   `json:"total_bytes"`
+	HitRatio        float64 `json:"hit_ratio"` // over all GETs in the cluster
+
+	// Divergence indicators: the spread of live key counts across reachable
+	// nodes, and replication backlog that has not reached its peers yet.
+	MinLiveKeys  int64   `json:"min_live_keys"`
+	MaxLiveKeys  int64   `json:"max_live_keys"`
+	KeySpread    float64 `json:"key_spread"` // (max-min)/max; 0 when every node holds the same count
+	HintsPending int     `json:"hints_pending"`
+	QueueDepth   int     `json:"queue_depth"`
+
+	// Versions counts reachable nodes by build; more than one entry means a
+	// rolling upgrade is in progress (or stalled).
+	Versions      map[string]int `json:"versions"`
+	MixedVersions bool           `json:"mixed_versions"`
+
+	PerNode []ClusterNodeStats `json:"per_node"`
+}
+
+// ClusterStats merges this node's stats with those of its active peers.
+func (n *Node) ClusterStats(ctx context.Context) ClusterStats {
+	peers := n.activePeers()
+	per := make([]ClusterNodeStats, len(peers)+1)
+	self := n.Stats()
+	per[0] = ClusterNodeStats{Addr: "self", Stats: &self}
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			per[i+1].Addr = p
+			st, err := n.fetchStats(ctx, p)
+			if err != nil {
+				per[i+1].Error = err.Error()
+				return
+			}
+			per[i+1].Stats = &st
+		}(i, p)
+	}
+	wg.Wait()
+
+	cs := ClusterStats{Nodes: len(per), PerNode: per, Versions: make(map[string]int)}
+	var hits, gets uint64
+	first := true
+	for i := range per {
+		st := per[i].Stats
+		if st == nil {
+			cs.Unreachable++
+			continue
+		}
+		live := st.Store.Keys - st.Store.Tombstones
+		per[i].NodeID, per[i].LiveKeys, per[i].HitRatio = st.NodeID, live, st.HitRatio
+		per[i].Version = st.Build.String()
+		cs.Versions[per[i].Version]++
+		cs.TotalKeys += st.Store.Keys
+		cs.TotalTombstones += st.Store.Tombstones
+		cs.TotalBytes += st.Store.Bytes
+		cs.HintsPending += st.Replication.HintsPending
+		cs.QueueDepth += st.Replication.QueueDepth
+		hits += st.Hits
+		gets += st.Hits + st.Misses
+		if first || live < cs.MinLiveKeys {
+			cs.MinLiveKeys = live
+		}
+		if first || live > cs.MaxLiveKeys {
+			cs.MaxLiveKeys = live
+		}
+		first = false
+	}
+	cs.MixedVersions = len(cs.Versions) > 1
+	if gets > 0 {
+		cs.HitRatio = float64(hits) / float64(gets)
+	}
+	if cs.MaxLiveKeys > 0 {
+		cs.KeySpread = float64(cs.MaxLiveKeys-cs.MinLiveKeys) / float64(cs.MaxLiveKeys)
+	}
+	return cs
+}
+
+func (n *Node) fetchStats(ctx context.Context, peer string) (NodeStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.ReqTimeout)
+	defer cancel()
+	var st NodeStats
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/stats", nil)
+	if err != nil {
+		return st, err
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return st, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&st)
+	return st, err
+}
+
+// handleClusterStats serves the merged view; ?detail=true also includes
+// every node's full /stats document.
+func (n *Node) handleClusterStats(w http.ResponseWriter, r *http.Request) {
+	cs := n.ClusterStats(r.Context())
+	if r.URL.Query().Get("detail") != "true" {
+		for i := range cs.PerNode {
+			cs.PerNode[i].Stats = nil
+		}
+	}
+	writeEncoded(w, r, http.StatusOK, cs)
+}
+
+// Topology is the cluster as one node sees it.
+type Topology struct {
+	Epoch string `json:"epoch"`
+	// Replication is "full": every node holds every key.
+	Replication string         `json:"replication"`
+	Nodes       []TopologyNode `json:"nodes"`
+}
+
+type TopologyNode struct {
+	ID   string `json:"id,omitempty"` // "" until a heartbeat has reported it
+	URL  string `json:"url"`
+	Self bool   `json:"self,omitempty"`
+}
+
+// Topology lists this node, reachable at self, and its active peers.
+func (n *Node) Topology(self string) Topology {
+	t := Topology{Epoch: n.topologyEpoch(), Replication: "full", Nodes: []TopologyNode{{ID: n.ID, URL: self, Self: true}}}
+	peers := n.activePeers()
+	slices.Sort(peers)
+	for _, p := range peers {
+		t.Nodes = append(t.Nodes, TopologyNode{ID: n.peerIDFor(p), URL: p})
+	}
+	return t
+}
+
+// setTopology derives the epoch from the node ID and peer set; call it,
+// holding peersMu, whenever the peer set changes.
+func (n *Node) setTopology(set map[string]struct{}) {
+	peers := make([]string, 0, len(set))
+	for p := range set {
+		peers = append(peers, p)
+	}
+	slices.Sort(peers)
+	h := fnv.New64a()
+	h.Write([]byte(n.ID))
+	for _, p := range peers {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	epoch := strconv.FormatUint(h.Sum64(), 36)
+	n.topology.Store(&epoch)
+}
+
+func (n *Node) topologyEpoch() string {
+	if e := n.topology.Load(); e != nil {
+		return *e
+	}
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+	n.setTopology(n.peers)
+	return *n.topology.Load()
+}
+
+// topologyHint answers a stale X-Cache-Topology with the current epoch.
+func (n *Node) topologyHint(w http.ResponseWriter, r *http.Request) {
+	if v, ok := r.Header[topologyHeader]; ok {
+		if epoch := n.topologyEpoch(); len(v) != 1 || v[0] != epoch {
+			w.Header()[topologyHeader] = []string{epoch}
+		}
+	}
+}
+
+func (n *Node) handleCluster(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	writeEncoded(w, r, http.StatusOK, n.Topology(scheme+"://"+r.Host))
+}
@@ -0,0 +1,105 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements optional value compression. When a Node has CompressAbove set, values
+of at least that many bytes are DEFLATE-compressed on PUT and stored, logged and replicated
+in compressed form (Item.Compressed / SyncMsg "compressed"); GET inflates them transparently.
+Values that do not shrink are kept as-is, so already-compressed payloads cost nothing extra.
+Separately, clients may negotiate gzip: GET responses are gzipped for clients that send
+Accept-Encoding: gzip, and PUT bodies may be sent with Content-Encoding: gzip, deflate (zlib) or
+zstd (see zstd.go).
+
+Functions:
+- compressValue(v []byte): ([]byte, bool)
+- (Item) plainValue(): ([]byte, error)
+- acceptsGzip(r *http.Request): bool
+- writeGzip(w io.Writer, it Item)
+- requestBody(r *http.Request): (io.Reader, error)
+*/
+
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// gzipResponseAbove is the smallest stored value that is gzipped for clients;
+// below it the gzip framing costs more than it saves.
+const gzipResponseAbove = 1024
+
+// compressValue returns the DEFLATE form of v and true if that is smaller.
+func compressValue(v []byte) ([]byte, bool) {
+	buf := getBuf()
+	defer putBuf(buf)
+	zw := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(zw)
+	zw.Reset(buf)
+	zw.Write(v)
+	if err := zw.Close(); err != nil || buf.Len() >= len(v) {
+		return v, false
+	}
+	return bytes.Clone(buf.Bytes()), true
+}
+
+// plainValue returns the item's value, inflating it if it was stored compressed.
+func (it Item) plainValue() ([]byte, error) {
+	if !it.Compressed {
+		return it.Value, nil
+	}
+	return io.ReadAll(flate.NewReader(bytes.NewReader(it.Value)))
+}
+
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// acceptsGzip reports whether the client listed gzip (with a non-zero q) in Accept-Encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+// writeGzip streams the item's plain value to w through a pooled gzip writer.
+func writeGzip(w io.Writer, it Item) {
+	src := io.Reader(bytes.NewReader(it.Value))
+	if it.Compressed {
+		src = flate.NewReader(src)
+	}
+	gw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gw)
+	gw.Reset(w)
+	io.Copy(gw, src)
+	gw.Close()
+}
+
+// requestBody returns r's body decoded according to its Content-Encoding.
+func requestBody(r *http.Request) (io.Reader, error) {
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r.Body)
+	case "deflate":
+		return zlib.NewReader(r.Body)
+	case "zstd":
+		return newZstdReader(r.Body), nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnsupportedEncoding, enc)
+	}
+}
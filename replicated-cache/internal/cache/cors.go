@@ -0,0 +1,116 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements CORS, so browser applications can call the cache API directly. With
+Node.CORS set, requests from an allowed Origin get Access-Control-Allow-Origin (and the other
+response headers browsers need), and preflight OPTIONS requests are answered here, before
+authentication, since browsers send them without credentials. Preflights from other origins get
+403; other requests from them are served as usual but without CORS headers, so the browser hides
+the response from the page.
+
+Origins are listed exactly ("https://app.example.com"), with a leading wildcard label
+("https://*.example.com") or as "*" for any origin. Credentialed requests (cookies, client
+certificates) are only allowed with AllowCredentials, which cannot be combined with "*" in
+browsers, so the caller's origin is echoed back instead.
+
+Functions:
+- (*CORSOptions) allowOrigin(origin string): bool
+- (*Node) cors(next http.Handler): http.Handler
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configure cross-origin access; empty lists use the defaults.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string // default GET, HEAD, PUT, DELETE
+	AllowedHeaders   []string // default Authorization, Content-Type, Content-Encoding, X-API-Key, X-Request-ID, X-Cache-Session
+	ExposedHeaders   []string // default X-Request-ID, X-Replicated-Acked, X-Replicated-Total, X-Cache-Session, Retry-After
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+var (
+	corsMethods = []string{"GET", "HEAD", "PUT", "DELETE"}
+	corsHeaders = []string{"Authorization", "Content-Type", "Content-Encoding", "X-API-Key", requestIDHeader, sessionHeader}
+	corsExposed = []string{requestIDHeader, "X-Replicated-Acked", "X-Replicated-Total", sessionHeader, "Retry-After"}
+)
+
+func (c *CORSOptions) allowOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(o, "://*."); ok {
+			rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if found && strings.HasSuffix(rest, "."+strings.ToLower(host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func orDefault(list, def []string) string {
+	if len(list) == 0 {
+		list = def
+	}
+	return strings.Join(list, ", ")
+}
+
+// cors adds CORS headers for allowed origins and answers preflights.
+func (n *Node) cors(next http.Handler) http.Handler {
+	c := n.CORS
+	methods := orDefault(c.AllowedMethods, corsMethods)
+	headers := orDefault(c.AllowedHeaders, corsHeaders)
+	exposed := orDefault(c.ExposedHeaders, corsExposed)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !c.allowOrigin(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" && !c.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", exposed)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		h.Set("Access-Control-Allow-Headers", headers)
+		if c.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
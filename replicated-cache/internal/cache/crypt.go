@@ -0,0 +1,93 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file holds the AES-GCM helpers used to encrypt data at rest. Keys are 16, 24 or 32
+bytes (AES-128/192/256) and may be supplied hex-encoded, base64-encoded or raw, either
+from a file or from an environment variable, so they never have to appear on a command line.
+
+Functions:
+- LoadKey(file, env string): ([]byte, error)
+- parseKey(b []byte): ([]byte, error)
+- validKeyLen(n int): bool
+- newAEAD(key []byte): (cipher.AEAD, error)
+- encrypt(aead cipher.AEAD, plain []byte): []byte
+- decrypt(aead cipher.AEAD, sealed []byte): ([]byte, error)
+*/
+
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// LoadKey reads an encryption key from file if set, otherwise from the named
+// environment variable. It returns a nil key when neither is configured.
+func LoadKey(file, env string) ([]byte, error) {
+	b, _, err := LoadSecret(file, env)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return parseKey(b)
+}
+
+// parseKey decodes a key file or variable. Surrounding whitespace is ignored
+// and hex is tried before base64, so a 32-character hex AES-128 key is not
+// taken for 32 raw bytes. Raw bytes are used only when neither decodes to a
+// valid length, or when prefixed with "raw:", which keeps them exactly as
+// written.
+func parseKey(b []byte) ([]byte, error) {
+	if raw, ok := bytes.CutPrefix(b, []byte("raw:")); ok {
+		if !validKeyLen(len(raw)) {
+			return nil, fmt.Errorf("raw: key is %d bytes; must be 16, 24 or 32", len(raw))
+		}
+		return raw, nil
+	}
+	s := string(bytes.TrimSpace(b))
+	if k, err := hex.DecodeString(s); err == nil && validKeyLen(len(k)) {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && validKeyLen(len(k)) {
+		return k, nil
+	}
+	if validKeyLen(len(b)) {
+		return b, nil
+	}
+	return nil, fmt.Errorf("key must be 16, 24 or 32 bytes (hex, base64, or raw with a raw: prefix)")
+}
+
+func validKeyLen(n int) bool { return n == 16 || n == 24 || n == 32 }
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals plain and returns nonce||ciphertext.
+func encrypt(aead cipher.AEAD, plain []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return aead.Seal(nonce, nonce, plain, nil)
+}
+
+func decrypt(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	ns := aead.NonceSize()
+	if len(sealed) < ns {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:ns], sealed[ns:], nil)
+}
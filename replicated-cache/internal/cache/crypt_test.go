@@ -0,0 +1,50 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for loading at-rest encryption keys.
+
+List of functions:
+	- TestParseKey: Tests that hex, base64 and raw keys decode to the intended bytes.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	k16 := []byte("0123456789abcdef")
+	k32 := bytes.Repeat([]byte{0xa5}, 32)
+	hex16 := hex.EncodeToString(k16) // 32 characters, a valid raw length too
+	for _, tc := range []struct {
+		name string
+		in   string
+		want []byte
+	}{
+		{"hex AES-128", hex16, k16},
+		{"hex AES-128 with newline", hex16 + "\n", k16},
+		{"hex AES-256", hex.EncodeToString(k32), k32},
+		{"base64 AES-128", base64.StdEncoding.EncodeToString(k16), k16},
+		{"base64 with newline", base64.StdEncoding.EncodeToString(k32) + "\n", k32},
+		{"raw", string(k16), k16},
+		{"raw: prefix", "raw:" + hex16, []byte(hex16)},
+	} {
+		k, err := parseKey([]byte(tc.in))
+		if err != nil { t.Fatalf("%s: %v", tc.name, err) }
+		if !bytes.Equal(k, tc.want) {
+			t.Fatalf("%s: key %x, want %x", tc.name, k, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "short", "raw:" + hex16 + "\n", hex16[:30]} {
+		if _, err := parseKey([]byte(bad)); err == nil {
+			t.Fatalf("parseKey(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /admin/dashboard, a small built-in web UI for quick diagnosis without
+a monitoring stack. The page (dashboard.html, embedded in the binary) polls the same handler with
+?format=json every few seconds and renders the cluster topology, per-node key counts and hit
+ratios, peer health and the most recent mutations (see recent.go). The JSON is built from the same
+sources as /stats, /cluster/stats and PeerHealth, so the dashboard never disagrees with metrics.
+
+Functions:
+- (*Node) Dashboard(ctx context.Context): DashboardData
+- (*Node) handleDashboard(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// dashboardRecent is how many recent operations the dashboard lists.
+const dashboardRecent = 50
+
+// DashboardData is everything the dashboard page shows.
+type DashboardData struct {
+	Node    NodeStats    `json:"node"`
+	Cluster ClusterStats `json:"cluster"`
+	Peers   []PeerHealth `json:"peers"`
+	Recent  []OpRecord   `json:"recent"`
+}
+
+func (n *Node) Dashboard(ctx context.Context) DashboardData {
+	return DashboardData{
+		Node:    n.Stats(),
+		Cluster: n.ClusterStats(ctx),
+		Peers:   n.PeerHealth(),
+		Recent:  n.recent.list("", "", dashboardRecent),
+	}
+}
+
+// handleDashboard serves the page, or its data with ?format=json.
+func (n *Node) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "json" {
+		d := n.Dashboard(r.Context())
+		for i := range d.Cluster.PerNode {
+			d.Cluster.PerNode[i].Stats = nil
+		}
+		writeEncoded(w, r, http.StatusOK, d)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(dashboardHTML)
+}
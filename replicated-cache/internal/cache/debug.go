@@ -0,0 +1,50 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the opt-in debug endpoints: net/http/pprof profiles under /debug/pprof/ and
+expvar variables under /debug/vars. They are served from DebugRoutes, a handler meant for a
+separate admin listener bound to a private address, never from the client-facing Routes.
+DebugVars is a snapshot of the node's replication state, suitable for expvar.Func.
+
+Functions:
+- (*Node) DebugRoutes(): http.Handler
+- (*Node) DebugVars(): map[string]any
+*/
+
+package cache
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// DebugRoutes returns a handler serving pprof and expvar. Profiles can be
+// taken on a live node with e.g.
+// go tool pprof http://localhost:6060/debug/pprof/profile?seconds=30
+func (n *Node) DebugRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// DebugVars reports store size and replication backlog.
+func (n *Node) DebugVars() map[string]any {
+	st := n.store.Stats()
+	return map[string]any{
+		"node_id":       n.ID,
+		"keys":          st.Keys,
+		"bytes":         st.Bytes,
+		"queue_depth":   n.totalQueueDepth(),
+		"hints_pending": n.outbox.Len(),
+		"peers_active":  len(n.activePeers()),
+	}
+}
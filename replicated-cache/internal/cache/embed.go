@@ -0,0 +1,90 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file lets a Go program holding a Node read and write it directly, without going through
+HTTP, for the public embedding API (package cache at the module root). Get, Set and Delete mirror
+GET, PUT and DELETE on /kv: reads record hot keys, use the Loader on a miss and return plain
+values, copied so callers may keep and change them; writes check KeyRules and the value size
+limit, are refused while the node is shedding load, and are applied, audited and replicated
+through wireWrite like the other protocols'. Calls are trusted: authentication, roles, ACLs and
+rate limits, which guard network callers, do not apply, and the audit log names the caller
+"in-process".
+
+Functions:
+- (*Node) Get(ctx context.Context, key string): ([]byte, error)
+- (*Node) Set(ctx context.Context, key string, value []byte, ttl time.Duration, min int, full bool): error
+- (*Node) Delete(ctx context.Context, key string, min int, full bool): error
+- inProcessRequest(ctx context.Context, method, key string): *http.Request
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Errors returned by Node.Set and Node.Delete.
+var (
+	ErrWriteLost  = errWriteLost  // a newer version of the key already exists
+	ErrOverloaded = errOverloaded // the node is shedding writes; retry later
+	ErrTooLarge   = errTooLarge   // the value exceeds Limits.MaxValueBytes
+)
+
+// Get returns key's value, or ErrNotFound.
+func (n *Node) Get(ctx context.Context, key string) ([]byte, error) {
+	it, ok, err := n.wireGet(inProcessRequest(ctx, http.MethodGet, key), key)
+	switch {
+	case err != nil:
+		return nil, err
+	case !ok:
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(it.Value), nil
+}
+
+// Set writes key, expiring after ttl unless it is 0, and replicates it,
+// waiting for min acknowledgements (or all, with full) like
+// PUT /kv/KEY?ttl=TTL&min=N&full=true.
+func (n *Node) Set(ctx context.Context, key string, value []byte, ttl time.Duration, min int, full bool) error {
+	if key == "" {
+		return errMissingKey
+	}
+	if n.KeyRules != nil {
+		if err := n.KeyRules.Check(key); err != nil {
+			return err
+		}
+	}
+	if max := n.Limits.MaxValueBytes; max > 0 && int64(len(value)) > max {
+		return fmt.Errorf("%w (limit %d bytes)", ErrTooLarge, max)
+	}
+	it := n.newItem(key, bytes.Clone(value), ttl)
+	_, _, err := n.wireWrite(inProcessRequest(ctx, http.MethodPut, key), key, "set", it, min, full)
+	return err
+}
+
+// Delete removes key and replicates the deletion like Set.
+func (n *Node) Delete(ctx context.Context, key string, min int, full bool) error {
+	if key == "" {
+		return errMissingKey
+	}
+	it := Item{Version: n.versions.next(n.now()), Origin: n.ID, Tombstone: true}
+	_, _, err := n.wireWrite(inProcessRequest(ctx, http.MethodDelete, key), key, "del", it, min, full)
+	return err
+}
+
+// inProcessRequest stands in for the HTTP request the /kv helpers expect.
+func inProcessRequest(ctx context.Context, method, key string) *http.Request {
+	r := &http.Request{
+		Method: method, URL: &url.URL{Path: "/kv/" + key}, Header: http.Header{},
+		Body: http.NoBody, RemoteAddr: "in-process",
+	}
+	return r.WithContext(ctx)
+}
@@ -0,0 +1,290 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements eviction for the Store when it grows past MaxKeys or MaxBytes.
+After each insert the writer checks the size accounting and, while over a limit, removes
+a victim chosen by the configured policy: a uniformly random live key by default,
+least-recently-used, or TinyLFU (see lfu.go), which may refuse the new key itself. Tombstones
+are never evicted.
+Policies implement the exported EvictionPolicy interface and can be set per namespace, so
+custom policies plug in without touching the Store. Eviction is a local removal, not a delete: no tombstone is written, so other nodes keep their
+copy unless the Node is configured to replicate evictions.
+
+Functions:
+- (*Store) overLimit(d *storeData): bool
+- (*Store) evictIfNeeded(d *storeData, keep string): []evictedEntry
+- (*Store) notifyEvicted(evicted []evictedEntry)
+- (*Store) pickVictim(d *storeData, keep string): (string, any, bool)
+- (*Store) sampleVictim(d *storeData, keep string): (string, any, bool)
+- (*Store) Evict(key string, version int64, origin string): bool
+- NewEvictionPolicy(name string): (EvictionPolicy, error)
+- NewLRUPolicy(): EvictionPolicy
+- (*lruPolicy) OnInsert/OnAccess/OnRemove/Victim: LRU bookkeeping
+- NewRandomPolicy(): EvictionPolicy
+- (*randomPolicy) OnInsert/OnAccess/OnRemove/Victim: random bookkeeping
+*/
+
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+)
+
+// evictSampleSize is how many live entries sampleVictim picks one victim from.
+const evictSampleSize = 8
+
+// EvictionPolicy tracks live (non-tombstone) keys and nominates eviction
+// victims. The Store calls OnInsert when a key is written, OnAccess on every
+// read hit and OnRemove when a key is deleted, expires or is evicted.
+// OnAccess is on the read path and must never block. Victim may return a key
+// that has since been removed; the Store drops it and asks again. Victim is
+// passed the key just written as exclude; returning it anyway refuses to
+// admit that key, which is then evicted in place of an older one.
+type EvictionPolicy interface {
+	OnInsert(key string)
+	OnAccess(key string)
+	OnRemove(key string)
+	Victim(exclude string) (key string, ok bool)
+}
+
+// NewEvictionPolicy returns a built-in policy by name: "random" (the default),
+// "lru", or "lfu"/"tinylfu".
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "", "random":
+		return NewRandomPolicy(), nil
+	case "lru":
+		return NewLRUPolicy(), nil
+	case "lfu", "tinylfu":
+		return NewLFUPolicy(), nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %q", name)
+}
+
+// overLimit reports whether d is over MaxKeys or MaxBytes. Tombstones are not
+// counted against MaxKeys: they cannot be evicted, so a store of them would
+// otherwise stay over the limit and evict every live key written to it.
+func (s *Store) overLimit(d *storeData) bool {
+	return (s.MaxKeys > 0 && d.keys.Load()-d.tombstones.Load() > s.MaxKeys) ||
+		(s.MaxBytes > 0 && d.bytes.Load() > s.MaxBytes)
+}
+
+// evictedEntry is an entry evictIfNeeded removed, for OnEvict.
+type evictedEntry struct {
+	key string
+	it  Item
+}
+
+// evictIfNeeded removes entries until the store is within its limits again
+// and returns them. keep is the key just written, which is only chosen when
+// its policy does not admit it.
+func (s *Store) evictIfNeeded(d *storeData, keep string) (evicted []evictedEntry) {
+	for s.overLimit(d) {
+		key, v, ok := s.pickVictim(d, keep)
+		if !ok {
+			return evicted
+		}
+		if s.remove(d, key, v) {
+			s.evictions.Add(1)
+			if c := s.nsCounters(key); c != nil {
+				c.evictions.Add(1)
+			}
+			evicted = append(evicted, evictedEntry{key, *v.(*Item)})
+		}
+	}
+	return evicted
+}
+
+// notifyEvicted calls OnEvict for each entry evictIfNeeded returned.
+func (s *Store) notifyEvicted(evicted []evictedEntry) {
+	if s.OnEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		s.OnEvict(e.key, e.it)
+	}
+}
+
+// pickVictim asks the policy of the namespace being written to first, so a
+// tenant that fills the cache pays with its own keys, then the default
+// policy, and finally falls back to sampling the map.
+func (s *Store) pickVictim(d *storeData, keep string) (string, any, bool) {
+	first := s.policyFor(keep)
+	for i, p := range [2]EvictionPolicy{first, s.policy} {
+		if p == nil || i == 1 && p == first {
+			continue
+		}
+		for {
+			key, ok := p.Victim(keep)
+			if !ok {
+				break
+			}
+			if v, ok := d.m.Load(key); ok && !v.(*Item).Tombstone {
+				return key, v, true
+			}
+			// The policy raced with a removal or tombstone; drop it and try the next one.
+			p.OnRemove(key)
+		}
+	}
+	return s.sampleVictim(d, keep)
+}
+
+// sampleVictim picks a random live entry, for stores without a policy. It
+// reservoir samples the first evictSampleSize live entries of a map range,
+// which starts at a random point, rather than the whole map. Tombstones are
+// never chosen: evicting one early could let a delayed older write resurrect
+// the key, so with only tombstones left it reports false and the store stays
+// over its limit until the janitor reaps them.
+func (s *Store) sampleVictim(d *storeData, keep string) (string, any, bool) {
+	var (
+		victim  string
+		victimV any
+		seen    int
+	)
+	d.m.Range(func(k, v any) bool {
+		key := k.(string)
+		if key == keep || v.(*Item).Tombstone {
+			return true
+		}
+		seen++
+		if rand.IntN(seen) == 0 {
+			victim, victimV = key, v
+		}
+		return seen < evictSampleSize
+	})
+	return victim, victimV, victimV != nil
+}
+
+// Evict drops key locally if it still holds the given version from origin,
+// as requested by a peer that evicted the same item. A newer local value is kept.
+func (s *Store) Evict(key string, version int64, origin string) bool {
+	d := s.data.Load()
+	v, ok := d.m.Load(key)
+	if !ok {
+		return false
+	}
+	it := v.(*Item)
+	if it.Tombstone || it.Version != version || it.Origin != origin {
+		return false
+	}
+	if !s.remove(d, key, v) {
+		return false
+	}
+	s.evictions.Add(1)
+	if c := s.nsCounters(key); c != nil {
+		c.evictions.Add(1)
+	}
+	return true
+}
+
+// lruPolicy is a classic list+map LRU. Reads only try the lock, so under heavy
+// contention some recency updates are skipped rather than stalling GETs; the
+// result is an approximate but never-blocking LRU.
+type lruPolicy struct {
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	elems map[string]*list.Element
+}
+
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{order: list.New(), elems: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) OnInsert(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elems[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) OnAccess(key string) {
+	if !p.mu.TryLock() {
+		return
+	}
+	defer p.mu.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) OnRemove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Victim(exclude string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for e := p.order.Back(); e != nil; e = e.Prev() {
+		if k := e.Value.(string); k != exclude {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// randomPolicy evicts a uniformly random tracked key. Keys are kept in a
+// slice for picking by index, with their positions in a map so removal can
+// swap the last key into the gap.
+type randomPolicy struct {
+	mu   sync.Mutex
+	keys []string
+	pos  map[string]int
+}
+
+func NewRandomPolicy() EvictionPolicy {
+	return &randomPolicy{pos: make(map[string]int)}
+}
+
+func (p *randomPolicy) OnInsert(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pos[key]; !ok {
+		p.pos[key] = len(p.keys)
+		p.keys = append(p.keys, key)
+	}
+}
+
+func (p *randomPolicy) OnAccess(string) {}
+
+func (p *randomPolicy) OnRemove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	i, ok := p.pos[key]
+	if !ok {
+		return
+	}
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.pos[p.keys[i]] = i
+	p.keys[last] = ""
+	p.keys = p.keys[:last]
+	delete(p.pos, key)
+}
+
+func (p *randomPolicy) Victim(exclude string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.keys)
+	if n == 0 || n == 1 && p.keys[0] == exclude {
+		return "", false
+	}
+	i := rand.IntN(n)
+	if p.keys[i] == exclude {
+		i = (i + 1) % n
+	}
+	return p.keys[i], true
+}
@@ -0,0 +1,474 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file serves the gRPC API of proto/cache.proto (Get, Set, Delete, MGet, Watch and Sync) on the
+node's HTTP port, for typed clients and service-to-service calls without HTTP's per-request text
+overhead. gRPC is HTTP/2 with length-prefixed protobuf messages and the status in trailers, which
+net/http provides, so the calls are plain handlers under /cache.v1.Cache/ and need no dependencies.
+net/http only speaks HTTP/2 over TLS, so gRPC clients must connect with TLS; requests that arrive
+over HTTP/1.1 are still answered, with the status in chunked trailers.
+
+Every key goes through the /kv checks (see wireproto.go) with the call's own metadata, so
+"authorization: Bearer TOKEN" or "x-api-key" grant exactly what they would over HTTP; Get and MGet
+count as GETs, Set as a PUT and Delete as a DELETE. Refused keys end the call with the matching gRPC
+status (UNAUTHENTICATED, PERMISSION_DENIED, RESOURCE_EXHAUSTED, ...). Set and Delete take
+min_replicas and full like ?min= and ?full= and report the acknowledgements.
+
+Watch streams the node's writes, deletes and expirations under a prefix (see watch.go), each checked as a read
+by the caller, so events for keys it may not read are left out. Sync accepts a stream of replication
+messages from a peer, checked like POST /sync. Unary calls are bounded by Limits.Timeout, or by a
+shorter grpc-timeout; messages by the largest value plus wireMaxAnonymous. Compressed messages are
+not supported.
+
+Functions:
+- (*Node) grpcHandler(): http.HandlerFunc
+- (*grpcCall) dispatch(method string): error
+- (*grpcCall) unary(handle func(req []byte) ([]byte, error)): error
+- (*grpcCall) readMsg(): ([]byte, error)
+- (*grpcCall) writeMsg(b []byte): error
+- (*grpcCall) check(h http.Handler, method, key string, run func(r *http.Request) error): error
+- (*grpcCall) get(key string): (pbEntry, error)
+- (*grpcCall) set(req []byte): ([]byte, error)
+- (*grpcCall) del(req []byte): ([]byte, error)
+- (*grpcCall) mget(req []byte): ([]byte, error)
+- (*grpcCall) watch(): error
+- (*grpcCall) sync(): error
+- writeResult(acked, total int, version int64, err error): ([]byte, error)
+- grpcErrorf(code int, format string, args ...any): error
+- grpcCodeFor(status int): int
+- grpcStatusOf(ctx context.Context, err error): (int, string)
+- parseGRPCTimeout(v string): (time.Duration, bool)
+- grpcEscape(msg string): string
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const grpcPrefix = "/cache.v1.Cache/"
+
+// gRPC status codes.
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcAborted           = 10
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code, fmt.Sprintf(format, args...)}
+}
+
+// grpcCall is one call being served.
+type grpcCall struct {
+	n      *Node
+	w      http.ResponseWriter
+	r      *http.Request
+	ctx    context.Context
+	kv     http.Handler // wireChain for keys the caller names
+	events http.Handler // wireChain, without rate limiting, for watch events
+	max    int64        // largest message accepted
+}
+
+// grpcHandler serves POST /cache.v1.Cache/{method}.
+func (n *Node) grpcHandler() http.HandlerFunc {
+	kv, events := n.wireChain(true), n.wireChain(false)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if ct != "application/grpc" && !strings.HasPrefix(ct, "application/grpc+proto") && !strings.HasPrefix(ct, "application/grpc;") {
+			http.Error(w, "expected Content-Type: application/grpc", http.StatusUnsupportedMediaType)
+			return
+		}
+		n.metrics.grpcCalls.Add(1)
+		ctx := r.Context()
+		if d, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		h := w.Header()
+		h.Set("Content-Type", "application/grpc")
+		h.Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		c := &grpcCall{n: n, w: w, r: r, ctx: ctx, kv: kv, events: events, max: n.wireMaxValue() + wireMaxAnonymous}
+		var err error
+		if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+			err = grpcErrorf(grpcUnimplemented, "grpc-encoding %s is not supported", enc)
+		} else {
+			err = c.dispatch(strings.TrimPrefix(r.URL.Path, grpcPrefix))
+		}
+		code, msg := grpcStatusOf(ctx, err)
+		if code != grpcOK {
+			n.metrics.grpcErrors.Add(1)
+		}
+		h.Set("Grpc-Status", strconv.Itoa(code))
+		if msg != "" {
+			h.Set("Grpc-Message", grpcEscape(msg))
+		}
+	}
+}
+
+func (c *grpcCall) dispatch(method string) error {
+	switch method {
+	case "Get":
+		return c.unary(func(req []byte) ([]byte, error) {
+			key, err := unmarshalKey(req)
+			if err != nil {
+				return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+			}
+			e, err := c.get(key)
+			return e.appendProto(nil), err
+		})
+	case "Set":
+		return c.unary(c.set)
+	case "Delete":
+		return c.unary(c.del)
+	case "MGet":
+		return c.unary(c.mget)
+	case "Watch":
+		return c.watch()
+	case "Sync":
+		return c.sync()
+	}
+	return grpcErrorf(grpcUnimplemented, "unknown method %q", method)
+}
+
+// unary reads the request message, answers it with handle and bounds the call
+// by Limits.Timeout.
+func (c *grpcCall) unary(handle func(req []byte) ([]byte, error)) error {
+	if t := c.n.Limits.Timeout; t > 0 {
+		var cancel context.CancelFunc
+		c.ctx, cancel = context.WithTimeout(c.ctx, t)
+		defer cancel()
+	}
+	req, err := c.readMsg()
+	if errors.Is(err, io.EOF) {
+		return grpcErrorf(grpcInvalidArgument, "missing request message")
+	}
+	if err != nil {
+		return err
+	}
+	resp, err := handle(req)
+	if err != nil {
+		return err
+	}
+	return c.writeMsg(resp)
+}
+
+// readMsg reads one length-prefixed message; io.EOF means the client has
+// sent all of its messages.
+func (c *grpcCall) readMsg() ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r.Body, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if int64(size) > c.max {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes exceeds the limit of %d", size, c.max)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(c.r.Body, b); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c *grpcCall) writeMsg(b []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(b)))
+	if _, err := c.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(b); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
+// check runs a command on key through the checks in h as the caller, whose
+// credentials are in the call's metadata.
+func (c *grpcCall) check(h http.Handler, method, key string, run func(r *http.Request) error) error {
+	if key == "" || strings.Contains(key, "/") {
+		return grpcErrorf(grpcInvalidArgument, "keys may not be empty or contain '/'")
+	}
+	kr := c.r.Clone(c.ctx)
+	kr.Method, kr.URL, kr.RequestURI = method, &url.URL{Path: "/kv/" + key}, ""
+	kr.Body, kr.ContentLength = http.NoBody, 0
+	var err error
+	if rej := checkedCall(h, kr, func(r *http.Request) { err = run(r) }); rej != nil {
+		return grpcErrorf(grpcCodeFor(rej.status), "%s", rej.message())
+	}
+	return err
+}
+
+func (c *grpcCall) get(key string) (pbEntry, error) {
+	e := pbEntry{Key: key}
+	err := c.check(c.kv, http.MethodGet, key, func(r *http.Request) error {
+		it, ok, err := c.n.wireGet(r, key)
+		if err != nil {
+			return grpcErrorf(grpcInternal, "%v", err)
+		}
+		if ok {
+			e.Found, e.Value, e.Version, e.Flags = true, it.Value, it.Version, it.Flags
+			if !it.ExpiresAt.IsZero() {
+				e.ExpiresAt = it.ExpiresAt.UnixNano()
+			}
+		}
+		return nil
+	})
+	return e, err
+}
+
+func (c *grpcCall) set(req []byte) ([]byte, error) {
+	var m pbSetRequest
+	if err := m.unmarshal(req); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	if m.TTLMillis < 0 {
+		return nil, grpcErrorf(grpcInvalidArgument, "negative ttl_ms")
+	}
+	if int64(len(m.Value)) > c.n.wireMaxValue() {
+		return nil, grpcErrorf(grpcResourceExhausted, "value exceeds the limit of %d bytes", c.n.wireMaxValue())
+	}
+	var resp []byte
+	err := c.check(c.kv, http.MethodPut, m.Key, func(r *http.Request) error {
+		if err := c.n.checkKey(r, m.Key); err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		it := c.n.newItem(m.Key, m.Value, time.Duration(m.TTLMillis)*time.Millisecond)
+		acked, total, err := c.n.wireWrite(r, m.Key, "set", it, int(m.MinReplicas), m.Full)
+		var werr error
+		resp, werr = writeResult(acked, total, it.Version, err)
+		return werr
+	})
+	return resp, err
+}
+
+func (c *grpcCall) del(req []byte) ([]byte, error) {
+	var m pbDeleteRequest
+	if err := m.unmarshal(req); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	var resp []byte
+	err := c.check(c.kv, http.MethodDelete, m.Key, func(r *http.Request) error {
+		it := Item{Version: c.n.versions.next(c.n.now()), Origin: c.n.ID, Tombstone: true}
+		acked, total, err := c.n.wireWrite(r, m.Key, "del", it, int(m.MinReplicas), m.Full)
+		var werr error
+		resp, werr = writeResult(acked, total, it.Version, err)
+		return werr
+	})
+	return resp, err
+}
+
+// writeResult encodes a WriteResponse, or maps wireWrite's error to a status.
+func writeResult(acked, total int, version int64, err error) ([]byte, error) {
+	switch {
+	case errors.Is(err, errWriteLost):
+		return nil, grpcErrorf(grpcAborted, "%v", err)
+	case err != nil:
+		return nil, grpcErrorf(grpcUnavailable, "%v", err)
+	}
+	return pbWriteResponse{Version: version, Acked: acked, Total: total}.appendProto(nil), nil
+}
+
+func (c *grpcCall) mget(req []byte) ([]byte, error) {
+	var m pbMGetRequest
+	if err := m.unmarshal(req); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	var resp []byte
+	for _, key := range m.Keys {
+		e, err := c.get(key)
+		if err != nil {
+			return nil, err
+		}
+		resp = pbAppendBytes(resp, 1, e.appendProto(nil))
+	}
+	return resp, nil
+}
+
+// watch streams changes under the requested prefix until the client goes
+// away or falls behind.
+func (c *grpcCall) watch() error {
+	req, err := c.readMsg()
+	if errors.Is(err, io.EOF) {
+		return grpcErrorf(grpcInvalidArgument, "missing request message")
+	}
+	if err != nil {
+		return err
+	}
+	prefix, err := unmarshalKey(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	// Authenticate and check the read role up front; keys are checked as
+	// their events arrive.
+	if rej := c.n.mayWatch(c.kv, c.r.WithContext(c.ctx), ""); rej != nil {
+		return grpcErrorf(grpcCodeFor(rej.status), "%s", rej.message())
+	}
+	w := c.n.watches.subscribe(nil, []string{prefix})
+	defer c.n.watches.unsubscribe(w)
+	c.n.metrics.grpcWatchers.Add(1)
+	defer c.n.metrics.grpcWatchers.Add(-1)
+	if err := http.NewResponseController(c.w).Flush(); err != nil {
+		return err
+	}
+	for {
+		var ev watchEvent
+		var ok bool
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case ev, ok = <-w.events:
+		}
+		if !ok {
+			return grpcErrorf(grpcResourceExhausted, "watcher fell behind; resubscribe")
+		}
+		err := c.check(c.events, http.MethodGet, ev.key, func(*http.Request) error {
+			e := pbWatchEvent{Op: ev.op, Key: ev.key, Version: ev.it.Version, Origin: ev.it.Origin, Flags: ev.it.Flags}
+			if ev.op == "set" {
+				it, err := c.n.plainItem(ev.key, ev.it)
+				if err != nil {
+					return grpcErrorf(grpcInternal, "%s: %v", ev.key, err)
+				}
+				e.Value = it.Value
+				if !it.ExpiresAt.IsZero() {
+					e.ExpiresAt = it.ExpiresAt.UnixNano()
+				}
+			}
+			return c.writeMsg(e.appendProto(nil))
+		})
+		var ge *grpcError
+		if errors.As(err, &ge) && ge.code == grpcPermissionDenied {
+			continue // a key the caller may not read
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sync applies a peer's stream of replication messages.
+func (c *grpcCall) sync() error {
+	if err := c.n.verifySync(c.r); err != nil {
+		c.n.log.Warn("sync request rejected", "component", "sync", "remote", remoteIP(c.r), "path", c.r.URL.Path, "err", err)
+		return grpcErrorf(grpcUnauthenticated, "%v", err)
+	}
+	var received uint64
+	for {
+		b, err := c.readMsg()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		msg, err := decodeSyncProto(b)
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		if err := c.n.applySync(msg); err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		received++
+	}
+	return c.writeMsg(pbAppendVarint(nil, 1, received))
+}
+
+// grpcCodeFor maps the HTTP status of a refused check to a gRPC code.
+func grpcCodeFor(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return grpcInvalidArgument
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return grpcResourceExhausted
+	case http.StatusServiceUnavailable:
+		return grpcUnavailable
+	}
+	return grpcInternal
+}
+
+// grpcStatusOf returns the status a call ends with.
+func grpcStatusOf(ctx context.Context, err error) (int, string) {
+	var ge *grpcError
+	switch {
+	case err == nil:
+		return grpcOK, ""
+	case errors.As(err, &ge):
+		return ge.code, ge.msg
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return grpcDeadlineExceeded, "deadline exceeded"
+	case ctx.Err() != nil:
+		return grpcCanceled, "canceled"
+	}
+	return grpcInternal, err.Error()
+}
+
+// parseGRPCTimeout parses a grpc-timeout header: up to eight digits and a
+// unit (H, M, S, m, u or n).
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[v[len(v)-1]]
+	return time.Duration(n) * unit, ok
+}
+
+// grpcEscape percent-encodes a grpc-message value.
+func grpcEscape(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
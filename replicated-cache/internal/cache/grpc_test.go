@@ -0,0 +1,310 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the gRPC API and its protobuf encoding.
+
+List of functions:
+	- startGRPC: Serves a node with gRPC enabled over TLS and HTTP/2 and returns a client for it.
+	- TestGRPCUnary: Tests Set, Get, MGet and Delete, their statuses in trailers, and replication.
+	- TestGRPCAuth: Tests that call metadata authenticates and that roles map to gRPC statuses.
+	- TestGRPCWatch: Tests that Watch streams writes and deletes under its prefix.
+	- TestGRPCSync: Tests that a streamed Sync call applies a peer's messages.
+	- TestSyncProtoRoundTrip: Tests that SyncMessage encoding round-trips every field.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type grpcClient struct {
+	t    *testing.T
+	url  string
+	hc   *http.Client
+	auth string
+}
+
+func startGRPC(t *testing.T, n *Node) *grpcClient {
+	n.GRPC = true
+	srv := httptest.NewUnstartedServer(n.Routes())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return &grpcClient{t: t, url: srv.URL, hc: srv.Client()}
+}
+
+func grpcFrame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+func (c *grpcClient) open(method string, body io.Reader) *http.Response {
+	req, err := http.NewRequest("POST", c.url+grpcPrefix+method, body)
+	if err != nil { c.t.Fatal(err) }
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if c.auth != "" {
+		req.Header.Set("Authorization", "Bearer "+c.auth)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil { c.t.Fatal(err) }
+	if resp.ProtoMajor != 2 || resp.StatusCode != 200 {
+		c.t.Fatalf("%s: %s %s", method, resp.Proto, resp.Status)
+	}
+	return resp
+}
+
+// readFrame reads one response message; ok is false at the end of the stream.
+func readFrame(t *testing.T, r io.Reader) ([]byte, bool) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err == io.EOF {
+		return nil, false
+	} else if err != nil { t.Fatal(err) }
+	b := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+	if _, err := io.ReadFull(r, b); err != nil { t.Fatal(err) }
+	return b, true
+}
+
+// call makes a unary call, returning the response message and gRPC status.
+func (c *grpcClient) call(method string, req []byte) ([]byte, int) {
+	resp := c.open(method, bytes.NewReader(grpcFrame(req)))
+	defer resp.Body.Close()
+	msg, _ := readFrame(c.t, resp.Body)
+	io.Copy(io.Discard, resp.Body)
+	code, err := strconv.Atoi(resp.Trailer.Get("Grpc-Status"))
+	if err != nil { c.t.Fatalf("%s: grpc-status trailer %q", method, resp.Trailer.Get("Grpc-Status")) }
+	return msg, code
+}
+
+func decodeEntry(t *testing.T, b []byte) pbEntry {
+	var e pbEntry
+	err := pbFields(b, func(r *pbReader, num, wt int) error {
+		switch num {
+		case 1:
+			return pbString(r, wt, &e.Key)
+		case 2:
+			return pbBool(r, wt, &e.Found)
+		case 3:
+			return pbBytesField(r, wt, &e.Value)
+		case 4:
+			return pbInt64(r, wt, &e.Version)
+		case 5:
+			return pbInt64(r, wt, &e.ExpiresAt)
+		case 6:
+			return pbUint32(r, wt, &e.Flags)
+		}
+		return r.skip(wt)
+	})
+	if err != nil { t.Fatal(err) }
+	return e
+}
+
+func TestGRPCUnary(t *testing.T) {
+	peer := NewNode("N2", ":y", nil)
+	peer.AccessLog = false
+	psrv := httptest.NewServer(peer.Routes())
+	defer psrv.Close()
+	n := NewNode("N1", ":x", []string{psrv.URL})
+	n.AccessLog = false
+	c := startGRPC(t, n)
+
+	set := pbAppendString(nil, 1, "k")
+	set = pbAppendBytes(set, 2, []byte("hello"))
+	set = pbAppendInt(set, 3, 60_000)
+	set = pbAppendVarint(set, 4, 1)
+	msg, code := c.call("Set", set)
+	if code != grpcOK { t.Fatalf("Set: status %d", code) }
+	var version int64
+	var acked uint64
+	pbFields(msg, func(r *pbReader, num, wt int) error {
+		switch num {
+		case 1:
+			return pbInt64(r, wt, &version)
+		case 2:
+			return pbUint(r, wt, &acked)
+		}
+		return r.skip(wt)
+	})
+	if version == 0 || acked != 1 {
+		t.Fatalf("Set response: version %d, acked %d", version, acked)
+	}
+	if it, ok := peer.Store().GetLive("k", time.Now()); !ok || string(it.Value) != "hello" {
+		t.Fatalf("Set with min_replicas 1 not on the peer: %+v", it)
+	}
+
+	msg, code = c.call("Get", pbAppendString(nil, 1, "k"))
+	e := decodeEntry(t, msg)
+	if code != grpcOK || !e.Found || string(e.Value) != "hello" || e.Version != version || e.ExpiresAt == 0 {
+		t.Fatalf("Get: status %d, %+v", code, e)
+	}
+
+	msg, code = c.call("MGet", pbAppendString(pbAppendString(nil, 1, "missing"), 1, "k"))
+	var entries []pbEntry
+	pbFields(msg, func(r *pbReader, num, wt int) error {
+		b, err := r.bytes()
+		entries = append(entries, decodeEntry(t, b))
+		return err
+	})
+	if code != grpcOK || len(entries) != 2 || entries[0].Key != "missing" || entries[0].Found || string(entries[1].Value) != "hello" {
+		t.Fatalf("MGet: status %d, %+v", code, entries)
+	}
+
+	if _, code = c.call("Delete", pbAppendString(nil, 1, "k")); code != grpcOK {
+		t.Fatalf("Delete: status %d", code)
+	}
+	if msg, _ = c.call("Get", pbAppendString(nil, 1, "k")); decodeEntry(t, msg).Found {
+		t.Fatal("Get after Delete found the key")
+	}
+
+	for _, tc := range []struct {
+		method string
+		req    []byte
+		want   int
+	}{
+		{"Get", nil, grpcInvalidArgument},
+		{"Get", pbAppendString(nil, 1, "a/b"), grpcInvalidArgument},
+		{"Set", pbAppendInt(pbAppendString(nil, 1, "k"), 3, -1), grpcInvalidArgument},
+		{"Nope", nil, grpcUnimplemented},
+	} {
+		if _, code := c.call(tc.method, tc.req); code != tc.want {
+			t.Errorf("%s(%x): status %d, want %d", tc.method, tc.req, code, tc.want)
+		}
+	}
+}
+
+func TestGRPCAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("rkey", "reader", RoleRead)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	c := startGRPC(t, n)
+
+	get := pbAppendString(nil, 1, "k")
+	set := pbAppendBytes(pbAppendString(nil, 1, "k"), 2, []byte("v"))
+	if _, code := c.call("Get", get); code != grpcUnauthenticated {
+		t.Fatalf("anonymous Get: status %d", code)
+	}
+	c.auth = "nope"
+	if _, code := c.call("Get", get); code != grpcUnauthenticated {
+		t.Fatalf("Get with a bad token: status %d", code)
+	}
+	c.auth = "rkey"
+	if _, code := c.call("Get", get); code != grpcOK {
+		t.Fatalf("reader Get: status %d", code)
+	}
+	if _, code := c.call("Set", set); code != grpcPermissionDenied {
+		t.Fatalf("reader Set: status %d", code)
+	}
+	if _, ok := n.Store().GetLive("k", time.Now()); ok {
+		t.Fatal("refused Set was stored")
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	c := startGRPC(t, n)
+
+	resp := c.open("Watch", bytes.NewReader(grpcFrame(pbAppendString(nil, 1, "user:"))))
+	defer resp.Body.Close()
+	if got := n.watches.count.Load(); got != 1 {
+		t.Fatalf("%d watchers after Watch", got)
+	}
+	c.call("Set", pbAppendBytes(pbAppendString(nil, 1, "other"), 2, []byte("x")))
+	c.call("Set", pbAppendBytes(pbAppendString(nil, 1, "user:1"), 2, []byte("ann")))
+	c.call("Delete", pbAppendString(nil, 1, "user:1"))
+
+	for _, want := range []pbWatchEvent{{Op: "set", Key: "user:1", Value: []byte("ann")}, {Op: "del", Key: "user:1"}} {
+		msg, ok := readFrame(t, resp.Body)
+		if !ok { t.Fatal("watch stream ended") }
+		var ev pbWatchEvent
+		pbFields(msg, func(r *pbReader, num, wt int) error {
+			switch num {
+			case 1:
+				return pbString(r, wt, &ev.Op)
+			case 2:
+				return pbString(r, wt, &ev.Key)
+			case 3:
+				return pbBytesField(r, wt, &ev.Value)
+			case 4:
+				return pbInt64(r, wt, &ev.Version)
+			case 6:
+				return pbString(r, wt, &ev.Origin)
+			}
+			return r.skip(wt)
+		})
+		if ev.Op != want.Op || ev.Key != want.Key || !bytes.Equal(ev.Value, want.Value) || ev.Version == 0 || ev.Origin != "N" {
+			t.Fatalf("event %+v, want %+v", ev, want)
+		}
+	}
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for n.watches.count.Load() != 0 {
+		if time.Now().After(deadline) { t.Fatal("watcher not removed after the client left") }
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGRPCSync(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	c := startGRPC(t, n)
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 1; i <= 3; i++ {
+			m := SyncMsg{Op: "set", Key: "k" + strconv.Itoa(i), Value: []byte("v"), Version: time.Now().UnixNano(), Origin: "P", Flags: 9}
+			pw.Write(grpcFrame(appendSyncProto(nil, m)))
+		}
+		pw.Close()
+	}()
+	resp := c.open("Sync", pr)
+	defer resp.Body.Close()
+	msg, _ := readFrame(t, resp.Body)
+	io.Copy(io.Discard, resp.Body)
+	var received uint64
+	pbFields(msg, func(r *pbReader, num, wt int) error { return pbUint(r, wt, &received) })
+	if resp.Trailer.Get("Grpc-Status") != "0" || received != 3 {
+		t.Fatalf("Sync: status %q, received %d", resp.Trailer.Get("Grpc-Status"), received)
+	}
+	if it, ok := n.Store().GetLive("k3", time.Now()); !ok || it.Origin != "P" || it.Flags != 9 {
+		t.Fatalf("synced item: %+v", it)
+	}
+}
+
+func TestSyncProtoRoundTrip(t *testing.T) {
+	exp := time.Unix(0, 1_800_000_000_123_456_789)
+	m := SyncMsg{Op: "set", Key: "k", Value: []byte{0, 1, 2}, ExpiresAt: &exp, Version: 42, Origin: "N1", Compressed: true, Encrypted: true,
+		Flags: 0xdeadbeef, Trace: "00-trace", RequestID: "rid", Signer: "N1", Sig: []byte("sig")}
+	got, err := decodeSyncProto(appendSyncProto(nil, m))
+	if err != nil { t.Fatal(err) }
+	if !got.ExpiresAt.Equal(exp) {
+		t.Fatalf("expires_at %v, want %v", got.ExpiresAt, exp)
+	}
+	got.ExpiresAt = m.ExpiresAt
+	if !reflect.DeepEqual(got, m) {
+		t.Fatalf("round trip = %+v, want %+v", got, m)
+	}
+	// Unknown fields are skipped.
+	b := pbAppendString(appendSyncProto(nil, SyncMsg{Key: "k"}), 99, "future")
+	if got, err := decodeSyncProto(b); err != nil || got.Key != "k" {
+		t.Fatalf("with an unknown field: %+v, %v", got, err)
+	}
+	if _, err := decodeSyncProto([]byte{0x12, 0x05, 'k'}); err == nil {
+		t.Fatal("decoded a truncated message")
+	}
+}
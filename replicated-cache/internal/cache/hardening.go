@@ -0,0 +1,85 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file applies baseline HTTP hardening to every response of the client and admin listeners,
+ahead of authentication, so 401s and 403s carry it too. Responses get X-Content-Type-Options:
+nosniff, so browsers never render a cached value as HTML or script, X-Frame-Options: DENY and
+Referrer-Policy: no-referrer; over TLS they also get Strict-Transport-Security for HSTSMaxAge.
+
+Requests with methods the API does not use at all (TRACE, CONNECT, WebDAV verbs, ...) get 501
+before any handler runs; within a route, the mux's method patterns already answer 405 with an
+Allow header. Requests whose headers exceed RequestLimits.MaxHeaderBytes get 431. cache-node also
+hands that limit to http.Server, which enforces it while parsing; the check here covers programs
+that serve Routes from their own server.
+
+The header values are shared slices assigned directly, as on the GET fast path, so hardening adds
+no allocations per request.
+
+Functions:
+- (*Node) harden(next http.Handler): http.Handler
+- headerBytes(h http.Header): int
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultHSTSMaxAge is the Strict-Transport-Security lifetime NewNode starts
+// with.
+const DefaultHSTSMaxAge = 180 * 24 * time.Hour
+
+var (
+	hdrNoSniff    = []string{"nosniff"}
+	hdrDeny       = []string{"DENY"}
+	hdrNoReferrer = []string{"no-referrer"}
+)
+
+// hardenMethods are the methods any route accepts; OPTIONS is for CORS
+// preflights.
+var hardenMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPut: true,
+	http.MethodPost: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+func (n *Node) harden(next http.Handler) http.Handler {
+	var hsts []string
+	if n.HSTSMaxAge > 0 {
+		hsts = []string{fmt.Sprintf("max-age=%d; includeSubDomains", int64(n.HSTSMaxAge/time.Second))}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h["X-Content-Type-Options"] = hdrNoSniff
+		h["X-Frame-Options"] = hdrDeny
+		h["Referrer-Policy"] = hdrNoReferrer
+		if r.TLS != nil && hsts != nil {
+			h["Strict-Transport-Security"] = hsts
+		}
+		if !hardenMethods[r.Method] {
+			http.Error(w, "method not implemented", http.StatusNotImplemented)
+			return
+		}
+		if max := n.Limits.MaxHeaderBytes; max > 0 && headerBytes(r.Header) > max {
+			http.Error(w, "request headers too large", http.StatusRequestHeaderFieldsTooLarge)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headerBytes approximates the size of h on the wire.
+func headerBytes(h http.Header) int {
+	size := 0
+	for k, vs := range h {
+		for _, v := range vs {
+			size += len(k) + len(v) + 4 // ": " and CRLF
+		}
+	}
+	return size
+}
@@ -0,0 +1,210 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /health. By default it answers a plain "ok", which is what peers'
+heartbeats check. With ?detail=true it returns a JSON report on the node's components (peer
+reachability, replication backlog, memory pressure and persistence), each rated ok, degraded or
+unhealthy, plus an overall status that is the worst of them. Degraded nodes still serve traffic
+and answer 200; an unhealthy node (e.g. one whose WAL appends are failing) answers 503.
+
+GET /healthz and GET /readyz are the liveness and readiness probes for orchestrators. /healthz
+passes whenever the process can answer. /readyz fails while the node is bootstrapping (e.g.
+replaying its WAL, see Bootstrap), is in maintenance, or can reach fewer than MinReadyPeers
+peers, so a load balancer only sends it traffic once it can serve it.
+
+Functions:
+- (*Node) Health(): HealthReport
+- (*Node) handleHealth(w http.ResponseWriter, r *http.Request)
+- (*Node) Bootstrap(): func()
+- (*Node) SetMaintenance(on bool)
+- (*Node) Ready(): (bool, string)
+- (*Node) handleHealthz / handleReadyz / handleMaintenance
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	HealthOK        = "ok"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// memoryPressure is the fraction of Store.MaxBytes above which the node
+// reports memory as degraded: eviction is about to start, or has.
+const memoryPressure = 0.9
+
+type ComponentHealth struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type PeerReachability struct {
+	Peer                string `json:"peer"`
+	Reachable           bool   `json:"reachable"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	NodeID     string                     `json:"node_id"`
+	Components map[string]ComponentHealth `json:"components"`
+	Peers      []PeerReachability         `json:"peers"`
+}
+
+func worse(a, b string) string {
+	rank := map[string]int{HealthOK: 0, HealthDegraded: 1, HealthUnhealthy: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// peerReachability lists known peers; a peer is reachable while it is in the
+// replication set with no failures since its last successful send or heartbeat.
+func (n *Node) peerReachability() (peers []PeerReachability, reachable int) {
+	seen := make(map[string]bool)
+	for _, h := range n.PeerHealth() {
+		seen[h.Peer] = true
+		peers = append(peers, PeerReachability{Peer: h.Peer, Reachable: h.Active && h.ConsecutiveFailures == 0, ConsecutiveFailures: h.ConsecutiveFailures})
+	}
+	for _, p := range n.activePeers() {
+		if !seen[p] {
+			peers = append(peers, PeerReachability{Peer: p, Reachable: true})
+		}
+	}
+	for _, p := range peers {
+		if p.Reachable {
+			reachable++
+		}
+	}
+	return peers, reachable
+}
+
+// Health rates each component and the node as a whole.
+func (n *Node) Health() HealthReport {
+	rep := HealthReport{Status: HealthOK, NodeID: n.ID, Components: make(map[string]ComponentHealth, 4)}
+	set := func(name, status, detail string) {
+		rep.Components[name] = ComponentHealth{Status: status, Detail: detail}
+		rep.Status = worse(rep.Status, status)
+	}
+
+	var reachable int
+	rep.Peers, reachable = n.peerReachability()
+	if reachable < len(rep.Peers) {
+		set("peers", HealthDegraded, fmt.Sprintf("%d of %d peers reachable", reachable, len(rep.Peers)))
+	} else {
+		set("peers", HealthOK, fmt.Sprintf("%d peers reachable", reachable))
+	}
+
+	overload := n.overload()
+	depth, hints := n.totalQueueDepth(), n.outbox.Len()
+	detail := fmt.Sprintf("%d queued, %d hints pending", depth, hints)
+	if overload == shedQueueFull {
+		set("replication", HealthDegraded, detail+"; rejecting writes")
+	} else {
+		set("replication", HealthOK, detail)
+	}
+
+	st := n.store.Stats()
+	switch limit := n.store.MaxBytes; {
+	case overload == shedHeapFull:
+		set("memory", HealthDegraded, "heap limit exceeded; rejecting writes")
+	case limit > 0 && float64(st.Bytes) >= memoryPressure*float64(limit):
+		set("memory", HealthDegraded, fmt.Sprintf("store at %d of %d bytes", st.Bytes, limit))
+	default:
+		set("memory", HealthOK, fmt.Sprintf("store at %d bytes", st.Bytes))
+	}
+
+	n.applyMu.RLock()
+	hasWAL := n.wal != nil
+	n.applyMu.RUnlock()
+	switch err := n.walErr.Load().(string); {
+	case !hasWAL:
+		set("persistence", HealthOK, "no wal configured")
+	case err != "":
+		set("persistence", HealthUnhealthy, "wal append failing: "+err)
+	default:
+		set("persistence", HealthOK, "wal appending")
+	}
+	return rep
+}
+
+func (n *Node) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(nodeIDHeader, n.ID)
+	if r.URL.Query().Get("detail") != "true" {
+		w.WriteHeader(200)
+		w.Write([]byte("ok"))
+		return
+	}
+	rep := n.Health()
+	status := http.StatusOK
+	if rep.Status == HealthUnhealthy {
+		status = http.StatusServiceUnavailable
+	}
+	writeEncoded(w, r, status, rep)
+}
+
+// Bootstrap marks the node not ready until the returned func is called, e.g.
+// while warming the store before taking traffic. Calls may nest.
+func (n *Node) Bootstrap() (done func()) {
+	n.bootstrapping.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { n.bootstrapping.Add(-1) }) }
+}
+
+// SetMaintenance takes the node out of (or back into) rotation: /readyz
+// fails while it is on, but requests are still served.
+func (n *Node) SetMaintenance(on bool) {
+	if n.maintenance.Swap(on) != on {
+		n.log.Info("maintenance mode changed", "component", "health", "maintenance", on)
+	}
+}
+
+// Ready reports whether the node should receive traffic and, if not, why.
+func (n *Node) Ready() (bool, string) {
+	if n.bootstrapping.Load() > 0 {
+		return false, "bootstrapping"
+	}
+	if n.maintenance.Load() {
+		return false, "in maintenance"
+	}
+	if n.MinReadyPeers > 0 {
+		if _, reachable := n.peerReachability(); reachable < n.MinReadyPeers {
+			return false, fmt.Sprintf("%d of %d required peers reachable", reachable, n.MinReadyPeers)
+		}
+	}
+	return true, ""
+}
+
+func (n *Node) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func (n *Node) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	if ok, why := n.Ready(); !ok {
+		http.Error(w, why, http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready"))
+}
+
+// handleMaintenance serves POST /admin/maintenance?on=true|false.
+func (n *Node) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	on, err := strconv.ParseBool(r.URL.Query().Get("on"))
+	if err != nil {
+		http.Error(w, "on must be true or false", 400)
+		return
+	}
+	n.SetMaintenance(on)
+	w.WriteHeader(204)
+}
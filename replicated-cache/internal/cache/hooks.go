@@ -0,0 +1,96 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file lets a program embedding a Node follow the changes to its store as they happen, to keep
+derived state such as local indexes or metrics without polling. OnSet and OnDelete hooks run for
+every write and delete the node applies, whether made here or replicated from a peer; OnExpire
+hooks for items that expire here, by a read or the janitor; OnEvict hooks for keys evicted to
+make room, here or, with ReplicateEvictions, by a peer. Unlike watchers (see watch.go), hooks see
+evictions, since the key is gone from this node's memory either way.
+
+Hooks run synchronously on the goroutine applying the change, after it is in the store and the WAL
+and with no node lock held, and may run concurrently with each other. A hook may write to the node,
+e.g. to keep an index key, but the write that triggered it waits for it, and the hook's own write
+runs the hooks in turn, so it must stop at the keys it derives. When writes to one key race, their
+hooks may run in a different order than the store applied them, so a hook that needs the final state
+should read it back. Registering copies the hook lists, so a node without hooks pays one atomic load
+per change.
+
+Functions:
+- (*Node) OnSet(fn func(key string, it Item))
+- (*Node) OnDelete(fn func(key string))
+- (*Node) OnExpire(fn func(key string))
+- (*Node) OnEvict(fn func(key string))
+- (*Node) addHook(kind int, fn func(key string, it Item))
+- (*Node) runHooks(kind int, key string, it Item)
+*/
+
+package cache
+
+const (
+	hookSet = iota
+	hookDelete
+	hookExpire
+	hookEvict
+	hookKinds
+)
+
+// hookLists holds the registered hooks of each kind. It is never changed once
+// published; addHook swaps in a copy.
+type hookLists [hookKinds][]func(key string, it Item)
+
+// OnSet registers fn to run after each write applied to the store. it holds
+// the plain value, decrypted and decompressed, which fn must not change.
+func (n *Node) OnSet(fn func(key string, it Item)) {
+	n.addHook(hookSet, fn)
+}
+
+// OnDelete registers fn to run after each delete applied to the store.
+func (n *Node) OnDelete(fn func(key string)) {
+	n.addHook(hookDelete, func(key string, _ Item) { fn(key) })
+}
+
+// OnExpire registers fn to run after an item expires here.
+func (n *Node) OnExpire(fn func(key string)) {
+	n.addHook(hookExpire, func(key string, _ Item) { fn(key) })
+}
+
+// OnEvict registers fn to run after a key is evicted here.
+func (n *Node) OnEvict(fn func(key string)) {
+	n.addHook(hookEvict, func(key string, _ Item) { fn(key) })
+}
+
+func (n *Node) addHook(kind int, fn func(key string, it Item)) {
+	for {
+		cur := n.hooks.Load()
+		next := new(hookLists)
+		if cur != nil {
+			*next = *cur
+		}
+		next[kind] = append(next[kind][:len(next[kind]):len(next[kind])], fn)
+		if n.hooks.CompareAndSwap(cur, next) {
+			return
+		}
+	}
+}
+
+// runHooks calls the hooks of one kind. Set hooks are skipped when the value
+// cannot be decoded, as a GET of it would fail.
+func (n *Node) runHooks(kind int, key string, it Item) {
+	hs := n.hooks.Load()
+	if hs == nil || len(hs[kind]) == 0 {
+		return
+	}
+	if kind == hookSet {
+		var err error
+		if it, err = n.plainItem(key, it); err != nil {
+			return
+		}
+	}
+	for _, fn := range hs[kind] {
+		fn(key, it)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements hot-key detection with the Space-Saving algorithm: a fixed number of
+counters, kept in a min-heap, track the most frequently read keys. A key not yet tracked takes
+over the smallest counter (inheriting its count), so memory stays bounded while the heaviest
+hitters are always kept. Counts are halved periodically so the ranking follows current traffic.
+Recording only tries the lock, so under heavy contention some reads go uncounted instead of
+slowing GETs down.
+
+Functions:
+- newHotKeys(capacity int): *hotKeys
+- (*hotKeys) record(key string)
+- (*hotKeys) top(n int): []HotKey
+- (*hotKeys) Len/Less/Swap/Push/Pop: container/heap plumbing
+*/
+
+package cache
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// HotKey is one entry of the hot-key report.
+type HotKey struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+type hotEntry struct {
+	key   string
+	count uint64
+	index int
+}
+
+type hotKeys struct {
+	mu      sync.Mutex
+	entries []*hotEntry // min-heap by count
+	byKey   map[string]*hotEntry
+	cap     int
+	records int
+}
+
+func newHotKeys(capacity int) *hotKeys {
+	return &hotKeys{byKey: make(map[string]*hotEntry, capacity), cap: capacity}
+}
+
+func (h *hotKeys) record(key string) {
+	if h == nil || !h.mu.TryLock() {
+		return
+	}
+	defer h.mu.Unlock()
+	if e, ok := h.byKey[key]; ok {
+		e.count++
+		heap.Fix(h, e.index)
+	} else if len(h.entries) < h.cap {
+		e := &hotEntry{key: key, count: 1}
+		h.byKey[key] = e
+		heap.Push(h, e)
+	} else {
+		e := h.entries[0]
+		delete(h.byKey, e.key)
+		e.key = key
+		e.count++
+		h.byKey[key] = e
+		heap.Fix(h, 0)
+	}
+	if h.records++; h.records >= h.cap*1000 {
+		// Halving keeps the heap order, so no re-heapify is needed.
+		h.records = 0
+		for _, e := range h.entries {
+			e.count /= 2
+		}
+	}
+}
+
+// top returns up to n of the hottest keys, hottest first.
+func (h *hotKeys) top(n int) []HotKey {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	out := make([]HotKey, 0, len(h.entries))
+	for _, e := range h.entries {
+		out = append(out, HotKey{Key: e.key, Count: e.count})
+	}
+	h.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	if n > 0 && n < len(out) {
+		out = out[:n]
+	}
+	return out
+}
+
+func (h *hotKeys) Len() int           { return len(h.entries) }
+func (h *hotKeys) Less(i, j int) bool { return h.entries[i].count < h.entries[j].count }
+func (h *hotKeys) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+func (h *hotKeys) Push(x any) {
+	e := x.(*hotEntry)
+	e.index = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+func (h *hotKeys) Pop() any {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return e
+}
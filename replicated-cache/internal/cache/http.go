@@ -8,14 +8,51 @@
 // and synchronization between nodes. The endpoints support replication controls
 // and TTL (time-to-live) for cache entries. The file also includes utility functions
 // for parsing request paths, durations, and managing replication acknowledgments.
+// POST /sync accepts JSON or msgpack bodies (by Content-Type) holding one message or a batch; GET /sync/stream upgrades
+// to a long-lived framed sync channel (see stream.go).
+// POST /admin/restore rolls the node back to a point in time using its WAL.
+// PUT and DELETE answer 503 with Retry-After while the node is overloaded (see shed.go), and /kv answers 429 to
+// clients over their RateLimit (see ratelimit.go). Bodies and handler time are bounded by Limits (see limits.go).
+// Every request gets an X-Request-ID (see requestid.go) that is logged and forwarded with its sync messages.
+// With Auth set, /kv and /admin requests need a bearer token or API key with a suitable role (see auth.go, acl.go).
+// With SyncSecrets set, /sync and /sync/stream require an HMAC signature from a peer sharing the secret (see syncauth.go).
+// With PeerAuth set, /sync, /sync/stream and /health require a peer's client certificate (see tls.go).
+// With CORS set, browsers on allowed origins may call the API directly (see cors.go).
+// With a Tracer set, requests carrying a traceparent header continue the caller's trace.
+// GET /metrics serves Prometheus metrics (see metrics.go); GET /stats the same in one JSON document (see stats.go),
+// GET /version reports the build (see version.go), and GET /cluster/stats merges /stats from every active peer (see cluster.go).
+// GET /cluster lists the nodes for smart clients; /kv answers a stale X-Cache-Topology with the current epoch.
+// GET /admin/hotkeys?n=N lists the most frequently read keys; GET /admin/dashboard serves a built-in web UI (see dashboard.go).
+// GET /admin/recent?key=K lists the last mutations the node saw, from clients and peers (see recent.go).
+// GET /admin/audit?since=T&until=T lists audited mutations and admin actions with the principal behind them (see audit.go).
+// /admin/* is also served by AdminRoutes for a separate admin listener, and only there with AdminSeparate (see admin.go).
+// With ValueKeys set, values are stored and replicated encrypted and decrypted on GET (see valuecrypt.go).
+// With KeyRules set, PUT rejects malformed keys with 400 and /sync drops sets for them (see keyrules.go).
+// With PeerKeys set, /sync applies only messages signed by their origin node (see msgsign.go).
+// PUT and DELETE return an X-Cache-Session token; GETs presenting it see the session's writes, fetching them with
+// GET /sync/item/KEY from the nodes that took them when this node lags (see session.go).
+// GET /watch upgrades to a WebSocket that pushes changes to subscribed keys (see websocket.go); with GRPC set,
+// /cache.v1.Cache/ serves the gRPC API (see grpc.go). GET /changes streams the same changes as resumable
+// Server-Sent Events (see changefeed.go).
+// GET /kv/KEY/watch?since=VERSION long-polls one key until it holds a newer version (see longpoll.go).
+// PUT without ?ttl honours Cache-Control max-age and Expires, and GET sets Cache-Control and Age for values with a TTL (see httpcache.go).
+// POST /pubsub/CHANNEL publishes to a channel on every node; GET /pubsub?channel=C streams its messages (see pubsub.go).
+// Structured answers (stats, cluster, admin lists) are JSON, MessagePack or CBOR as Accept asks (see negotiate.go).
+// GET /openapi.json describes all of these endpoints as an OpenAPI 3.1 document (see openapi.go).
+// GET supports Range requests and gzip responses (Accept-Encoding); PUT accepts gzip, deflate and zstd bodies (see zstd.go); GET misses are filled from the Node's Loader (read-through) when one is set.
 
 package cache
 
 import (
+	"bytes"
+	"context"
+	"compress/flate"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -24,38 +61,164 @@ import (
 
 func (n *Node) Routes() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(200)
-		w.Write([]byte("ok"))
-	})
+	mux.HandleFunc("GET /health", n.peerOnly(n.handleHealth))
+	mux.HandleFunc("GET /healthz", n.handleHealthz)
+	mux.HandleFunc("GET /readyz", n.handleReadyz)
 	mux.HandleFunc("GET /kv/", n.handleGet)
-	mux.HandleFunc("PUT /kv/", n.handlePut)
-	mux.HandleFunc("DELETE /kv/", n.handleDelete)
-	mux.HandleFunc("POST /sync", n.handleSync)
-	return logging(mux)
+	mux.HandleFunc("GET /kv/{key}/watch", n.handleLongPoll)
+	mux.HandleFunc("PUT /kv/", n.shedWrites(n.handlePut))
+	mux.HandleFunc("DELETE /kv/", n.shedWrites(n.handleDelete))
+	mux.HandleFunc("POST /sync", n.peerOnly(n.handleSync))
+	mux.HandleFunc("GET /sync/stream", n.peerOnly(n.handleSyncStream))
+	mux.HandleFunc("GET /sync/item/{key}", n.peerOnly(n.handleSyncItem))
+	mux.HandleFunc("GET /metrics", n.handleMetrics)
+	mux.HandleFunc("GET /stats", n.handleStats)
+	mux.HandleFunc("GET /version", n.handleVersion)
+	mux.HandleFunc("GET /cluster", n.handleCluster)
+	mux.HandleFunc("GET /cluster/stats", n.handleClusterStats)
+	mux.HandleFunc("GET /watch", n.handleWatch)
+	mux.HandleFunc("GET /changes", n.handleChanges)
+	mux.HandleFunc("POST /pubsub/{channel}", n.handlePublish)
+	mux.HandleFunc("GET /pubsub", n.handleSubscribe)
+	mux.HandleFunc("GET /openapi.json", n.handleOpenAPI)
+	if !n.AdminSeparate {
+		n.adminHandlers(mux)
+	}
+	if n.GRPC {
+		g := n.grpcHandler()
+		mux.HandleFunc("POST "+grpcPrefix+"Sync", n.peerOnly(g))
+		mux.Handle("POST "+grpcPrefix+"{method}", g)
+	}
+	// Plain GET /kv/ requests, the bulk of the traffic, skip pattern matching.
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kv := strings.HasPrefix(r.URL.Path, "/kv/")
+		if kv {
+			n.topologyHint(w, r)
+		}
+		if r.Method == http.MethodGet && kv && strings.IndexByte(r.URL.Path[len("/kv/"):], '/') < 0 {
+			n.handleGet(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	if n.KeyPolicy != nil {
+		h = n.checkPolicy(h)
+	}
+	if n.RateLimit.Rate > 0 || len(n.RateLimit.Overrides) > 0 {
+		h = n.rateLimit(h) // inside authenticate, so clients are known by name
+	}
+	if n.Auth != nil {
+		h = n.authenticate(h)
+	}
+	h = n.limitRequests(h)
+	if n.CORS != nil {
+		h = n.cors(h) // outside authenticate: preflights carry no credentials
+	}
+	if n.Tracer != nil {
+		h = n.traceHTTP(h)
+	}
+	h = n.harden(h) // outside authenticate, so 401s are hardened too
+	h = n.logging(h)
+	return n.requestIDs(h)
 }
 
+var errMissingKey = errors.New("missing key")
+
 func keyFromPath(path string) (string, error) {
-	parts := strings.SplitN(strings.TrimPrefix(path, "/kv/"), "/", 2)
-	if len(parts) == 0 || parts[0] == "" {
-		return "", errors.New("missing key")
+	key := strings.TrimPrefix(path, "/kv/")
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		key = key[:i]
+	}
+	if key == "" {
+		return "", errMissingKey
 	}
-	return parts[0], nil
+	return key, nil
 }
 
+// Header values shared by every small GET response, assigned directly to
+// avoid Header.Set's per-call allocations. net/http never mutates them.
+var (
+	hdrOctetStream    = []string{"application/octet-stream"}
+	hdrAcceptEncoding = []string{"Accept-Encoding"}
+	hdrBytes          = []string{"bytes"}
+)
+
 func (n *Node) handleGet(w http.ResponseWriter, r *http.Request) {
 	key, err := keyFromPath(r.URL.Path)
 	if err != nil {
 		http.Error(w, err.Error(), 400); return
 	}
-	it, ok := n.store.Get(key)
-	now := time.Now()
-	if !ok || it.Tombstone || it.expired(now) {
+	n.hot.record(key)
+	_, span := n.startSpan(r.Context(), "store.get")
+	span.SetAttr("key", key)
+	it, ok := n.store.GetLive(key, n.now())
+	span.End()
+	if token, has := r.Header[sessionHeader]; has {
+		var done bool
+		if it, ok, done = n.sessionRead(w, r, key, token[0], it, ok); done {
+			return
+		}
+	}
+	if !ok && n.Loader != nil {
+		it, err = n.load(r.Context(), key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			http.Error(w, fmt.Sprintf("load failed: %v", err), 502); return
+		default:
+			ok = true
+		}
+	}
+	if !ok {
+		n.metrics.misses.Add(1)
+		if c := n.store.nsCounters(key); c != nil {
+			c.misses.Add(1)
+		}
 		http.NotFound(w, r); return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.WriteHeader(200)
-	w.Write(it.Value)
+	if it.Encrypted {
+		if it, err = n.decryptItem(key, it); err != nil {
+			n.log.Error("cannot decrypt value", "component", "crypto", "key", key, "err", err)
+			http.Error(w, "cannot decrypt value", 500); return
+		}
+	}
+	n.metrics.hits.Add(1)
+	if c := n.store.nsCounters(key); c != nil {
+		c.hits.Add(1)
+	}
+	h := w.Header()
+	h["Content-Type"] = hdrOctetStream
+	if v := h["Vary"]; len(v) == 0 {
+		h["Vary"] = hdrAcceptEncoding
+	} else {
+		// Keep the Vary: Origin that cors added.
+		h["Vary"] = append(v, "Accept-Encoding")
+	}
+	setFreshness(h, it, n.now(), n.Auth != nil || n.ACL != nil)
+	if !it.Compressed && len(it.Value) < gzipResponseAbove && !conditionalRequest(r) {
+		// Fast path for small values: no ServeContent, no gzip, no copies.
+		h["Accept-Ranges"] = hdrBytes
+		w.Write(it.Value)
+		return
+	}
+	if r.Header.Get("Range") == "" && len(it.Value) >= gzipResponseAbove && acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(200)
+		writeGzip(w, it)
+		return
+	}
+	if it.Compressed && r.Header.Get("Range") == "" {
+		// Inflate straight into the response instead of buffering the value.
+		w.WriteHeader(200)
+		io.Copy(w, flate.NewReader(bytes.NewReader(it.Value)))
+		return
+	}
+	value, err := it.plainValue()
+	if err != nil {
+		http.Error(w, "corrupt compressed value", 500); return
+	}
+	// ServeContent handles Range/If-Range and writes the body in chunks.
+	http.ServeContent(w, r, "", time.Unix(0, it.Version), bytes.NewReader(value))
 }
 
 func parseDurationQS(v string) (time.Duration, error) {
@@ -75,11 +238,18 @@ func parseDurationQS(v string) (time.Duration, error) {
 func (n *Node) handlePut(w http.ResponseWriter, r *http.Request) {
 	key, err := keyFromPath(r.URL.Path)
 	if err != nil { http.Error(w, err.Error(), 400); return }
-	body, err := io.ReadAll(r.Body)
-	if err != nil { http.Error(w, "read body error", 400); return }
+	if err := n.checkKey(r, key); err != nil { http.Error(w, err.Error(), 400); return }
+	src, err := requestBody(r)
+	if errors.Is(err, errUnsupportedEncoding) { http.Error(w, err.Error(), http.StatusUnsupportedMediaType); return }
+	if err != nil { http.Error(w, "bad compressed body: "+err.Error(), 400); return }
+	body, err := readLimited(src, n.Limits.MaxValueBytes)
+	if err != nil { http.Error(w, "read body error: "+err.Error(), bodyErrorStatus(err)); return }
 
 	ttl, err := parseDurationQS(r.URL.Query().Get("ttl"))
 	if err != nil { http.Error(w, err.Error(), 400); return }
+	if !r.URL.Query().Has("ttl") {
+		if ttl, err = ttlFromHeaders(r.Header, n.now()); err != nil { http.Error(w, err.Error(), 400); return }
+	}
 
 	minRep := 0
 	if q := r.URL.Query().Get("min"); q != "" {
@@ -87,41 +257,71 @@ func (n *Node) handlePut(w http.ResponseWriter, r *http.Request) {
 	}
 	full := r.URL.Query().Get("full") == "true"
 
-	version := time.Now().UnixNano()
-	item := Item{
-		Value:   body,
-		Version: version,
-		Origin:  n.ID,
-	}
-	if ttl > 0 {
-		item.ExpiresAt = time.Now().Add(ttl)
-	}
-
-	applied := n.store.Put(key, item)
+	item := n.newItem(key, body, ttl)
+	_, span := n.startSpan(r.Context(), "store.put")
+	span.SetAttr("key", key)
+	applied := n.apply(key, item)
+	span.End()
 	if !applied {
+		n.recent.add(OpRecord{
+			Time: time.Now().UTC(), Source: "client", Op: "set", Key: key, Version: item.Version, Origin: n.ID,
+			Outcome: OutcomeStale, Client: n.clientIdentity(r), RequestID: requestIDFrom(r.Context()),
+		})
 		http.Error(w, "write lost to newer version", 409)
 		return
 	}
+	n.metrics.sets.Add(1)
+	n.audit(r, "set", key, item.Version)
 
-	acked, total, err := n.Replicate(r.Context(), SyncMsg{
-		Op:        "set",
-		Key:       key,
-		Value:     body,
-		ExpiresAt: ptrTimeOrNil(item.ExpiresAt),
-		Version:   version,
-		Origin:    n.ID,
-	}, minRep, full)
+	acked, total, err := n.Replicate(r.Context(), syncMsgFor(key, item), minRep, full)
 
 	if err != nil {
 		http.Error(w, fmt.Sprintf("replication error: %v (acked %d/%d)", err, acked, total), 502)
 		return
 	}
 
+	n.issueSession(w, r, item.Version)
 	w.Header().Set("X-Replicated-Acked", fmt.Sprintf("%d", acked))
 	w.Header().Set("X-Replicated-Total", fmt.Sprintf("%d", total))
 	w.WriteHeader(201)
 }
 
+// conditionalRequest reports whether r carries headers that only
+// http.ServeContent knows how to answer (ranges and preconditions).
+func conditionalRequest(r *http.Request) bool {
+	for _, k := range [...]string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if _, ok := r.Header[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newItem stamps a locally written value with a fresh version, its expiry
+// and, above CompressAbove, compression.
+func (n *Node) newItem(key string, value []byte, ttl time.Duration) Item {
+	now := n.now()
+	it := Item{Value: value, Version: n.versions.next(now), Origin: n.ID}
+	if ttl > 0 {
+		it.ExpiresAt = now.Add(ttl)
+	}
+	return n.sealItem(key, it)
+}
+
+// sealItem compresses a plain value above CompressAbove and encrypts it with
+// ValueKeys, as the node stores values.
+func (n *Node) sealItem(key string, it Item) Item {
+	if n.CompressAbove > 0 && len(it.Value) >= n.CompressAbove {
+		it.Value, it.Compressed = compressValue(it.Value)
+	}
+	if n.ValueKeys != nil {
+		if sealed, ok := n.ValueKeys.seal(key, it.Value); ok {
+			it.Value, it.Encrypted = sealed, true
+		}
+	}
+	return it
+}
+
 func (n *Node) handleDelete(w http.ResponseWriter, r *http.Request) {
 	key, err := keyFromPath(r.URL.Path)
 	if err != nil { http.Error(w, err.Error(), 400); return }
@@ -132,9 +332,14 @@ func (n *Node) handleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	full := r.URL.Query().Get("full") == "true"
 
-	version := time.Now().UnixNano()
+	version := n.versions.next(n.now())
 	it := Item{Version: version, Origin: n.ID, Tombstone: true}
-	n.store.Put(key, it)
+	_, span := n.startSpan(r.Context(), "store.delete")
+	span.SetAttr("key", key)
+	n.apply(key, it)
+	span.End()
+	n.metrics.deletes.Add(1)
+	n.audit(r, "del", key, version)
 
 	acked, total, err := n.Replicate(r.Context(), SyncMsg{
 		Op:      "del",
@@ -147,25 +352,145 @@ func (n *Node) handleDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("replication error: %v (acked %d/%d)", err, acked, total), 502)
 		return
 	}
+	n.issueSession(w, r, version)
 	w.Header().Set("X-Replicated-Acked", fmt.Sprintf("%d", acked))
 	w.Header().Set("X-Replicated-Total", fmt.Sprintf("%d", total))
 	w.WriteHeader(204)
 }
 
 func (n *Node) handleSync(w http.ResponseWriter, r *http.Request) {
-	var msg SyncMsg
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		http.Error(w, "bad json", 400); return
-	}
-	switch msg.Op {
-	case "set":
-		item := Item{Value: msg.Value, Version: msg.Version, Origin: msg.Origin}
-		if msg.ExpiresAt != nil { item.ExpiresAt = *msg.ExpiresAt }
-		n.store.Put(msg.Key, item)
-	case "del":
-		n.store.Put(msg.Key, Item{Version: msg.Version, Origin: msg.Origin, Tombstone: true})
+	w.Header().Set(syncEncodingsHeader, contentTypeMsgpack+", application/json")
+	buf := getBuf()
+	defer putBuf(buf)
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		http.Error(w, "read body error: "+err.Error(), bodyErrorStatus(err)); return
+	}
+	body := buf.Bytes() // decoders copy what they keep
+	if err := n.verifySync(r, body); err != nil {
+		n.rejectSync(w, r, err); return
+	}
+	var err error
+	var msgs []SyncMsg
+	switch ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct {
+	case contentTypeMsgpack, "application/x-msgpack":
+		if msgs, err = decodeSyncBatchMsgpack(body); err != nil {
+			http.Error(w, "bad msgpack", 400); return
+		}
+	case "", "application/json":
+		if msgs, err = decodeSyncBatchJSON(body); err != nil {
+			http.Error(w, "bad json", 400); return
+		}
 	default:
-		http.Error(w, "unknown op", 400); return
+		http.Error(w, "unsupported sync encoding", http.StatusUnsupportedMediaType); return
+	}
+	if err := n.applySync(msgs...); err != nil {
+		http.Error(w, err.Error(), 400); return
 	}
 	w.WriteHeader(204)
-}
\ No newline at end of file
+}
+
+// decodeSyncBatchJSON accepts a single SyncMsg object or an array of them.
+func decodeSyncBatchJSON(b []byte) ([]SyncMsg, error) {
+	if t := bytes.TrimLeft(b, " \t\r\n"); len(t) > 0 && t[0] == '[' {
+		var msgs []SyncMsg
+		err := json.Unmarshal(b, &msgs)
+		return msgs, err
+	}
+	var msg SyncMsg
+	err := json.Unmarshal(b, &msg)
+	return []SyncMsg{msg}, err
+}
+
+// applySync applies messages received from a peer, over HTTP or a sync
+// stream. Every valid message is applied; the first bad one is reported.
+func (n *Node) applySync(msgs ...SyncMsg) error {
+	var err error
+	debug := n.log.Enabled(context.Background(), slog.LevelDebug)
+	for _, msg := range msgs {
+		var span *Span
+		if sc, ok := parseTraceparent(msg.Trace); ok {
+			_, span = n.startSpan(context.WithValue(context.Background(), spanKey{}, sc), "sync.apply")
+			span.SetAttr("key", msg.Key)
+			span.SetAttr("op", msg.Op)
+		}
+		if debug {
+			n.log.Debug("sync applied", "component", "sync", "origin", msg.Origin, "key", msg.Key, "op", msg.Op, "request_id", msg.RequestID)
+		}
+		if verr := n.verifyMsg(&msg); verr != nil {
+			n.metrics.sigRejected.Add(1)
+			n.log.Warn("sync message rejected", "component", "sync", "origin", msg.Origin, "signer", msg.Signer, "key", msg.Key, "err", verr)
+			if err == nil {
+				err = verr
+			}
+			n.recordSync(&msg, OutcomeError)
+			span.End()
+			continue
+		}
+		outcome := OutcomeStale
+		switch msg.Op {
+		case "set", "del":
+			if msg.Op == "set" && n.KeyRules != nil {
+				// Dropped, not refused: the sender would retry it forever.
+				if kerr := n.KeyRules.Check(msg.Key); kerr != nil {
+					n.metrics.keysRejected.Add(1)
+					n.log.Warn("sync key rejected", "component", "sync", "origin", msg.Origin, "key", msg.Key, "err", kerr)
+					outcome = OutcomeError
+					break
+				}
+			}
+			if n.apply(msg.Key, msg.item()) {
+				outcome = OutcomeApplied
+			}
+		case "evict":
+			if n.store.Evict(msg.Key, msg.Version, msg.Origin) {
+				n.runHooks(hookEvict, msg.Key, Item{Version: msg.Version, Origin: msg.Origin})
+				outcome = OutcomeApplied
+			}
+		case "publish":
+			// A channel message, not a change: delivered, never recorded.
+			n.metrics.pubsubDelivered.Add(int64(n.pubsub.deliver(msg.Key, msg.Value)))
+			span.End()
+			continue
+		default:
+			outcome = OutcomeError
+			if err == nil {
+				err = fmt.Errorf("unknown op %q", msg.Op)
+			}
+		}
+		n.recordSync(&msg, outcome)
+		span.End()
+	}
+	return err
+}
+
+func (n *Node) handleRestore(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		http.Error(w, "missing restore point", 400); return
+	}
+	version, err := ParseRestorePoint(to)
+	if err != nil {
+		http.Error(w, err.Error(), 400); return
+	}
+	if err := n.RestoreTo(version); err != nil {
+		code := 500
+		if errors.Is(err, ErrRestoreCompacted) {
+			code = 400
+		}
+		http.Error(w, fmt.Sprintf("restore failed: %v", err), code)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (n *Node) handleHotKeys(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if q := r.URL.Query().Get("n"); q != "" {
+		v, err := strconv.Atoi(q)
+		if err != nil || v < 0 {
+			http.Error(w, "bad n", 400); return
+		}
+		limit = v
+	}
+	writeEncoded(w, r, http.StatusOK, n.HotKeys(limit))
+}
@@ -0,0 +1,105 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file maps item expiry onto HTTP caching headers, so a node can sit behind HTTP caches, CDNs
+and other tooling that speak them. A PUT without ?ttl takes its TTL from the request's
+Cache-Control (s-maxage, as the node is a shared cache, then max-age) or, failing that, its
+Expires date, as a caching proxy would for a response. A GET of a value that expires answers with
+Cache-Control: max-age, the value's full lifetime, and Age, the seconds since it was written (its
+version, see versionClock in node.go), so a downstream cache holds it for as long as the node
+would and no longer. When Auth or an ACL is set the max-age is marked private: the credential
+travels in X-API-Key rather than Authorization, so nothing else stops a shared cache from storing
+one tenant's value and serving it to callers without a key. Values without a TTL get neither
+header, which keeps small GETs free of allocations: they may change at any time, and downstream
+caches apply their own defaults.
+
+Functions:
+- ttlFromHeaders(h http.Header, now time.Time): (time.Duration, error)
+- cacheControlSeconds(cc string, directive string): (int64, bool, error)
+- setFreshness(h http.Header, it Item, now time.Time, private bool)
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errExpiredOnArrival = errors.New("the requested lifetime has already passed")
+
+// maxTTL caps header TTLs, which are not otherwise bounded, well below the
+// range of time.Duration.
+const maxTTL = 100 * 365 * 24 * time.Hour
+
+// ttlFromHeaders returns the TTL a PUT's Cache-Control or Expires header asks
+// for, or 0 when it has neither.
+func ttlFromHeaders(h http.Header, now time.Time) (time.Duration, error) {
+	if cc := strings.Join(h.Values("Cache-Control"), ","); cc != "" {
+		for _, d := range [...]string{"s-maxage", "max-age"} {
+			secs, ok, err := cacheControlSeconds(cc, d)
+			switch {
+			case err != nil:
+				return 0, err
+			case !ok:
+				continue
+			case secs == 0:
+				return 0, fmt.Errorf("Cache-Control %s: %w", d, errExpiredOnArrival)
+			}
+			return time.Duration(min(secs, int64(maxTTL/time.Second))) * time.Second, nil
+		}
+	}
+	v := h.Get("Expires")
+	if v == "" {
+		return 0, nil
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad Expires: %w", err)
+	}
+	ttl := t.Sub(now)
+	if ttl <= 0 {
+		return 0, fmt.Errorf("Expires: %w", errExpiredOnArrival)
+	}
+	return min(ttl, maxTTL), nil
+}
+
+// cacheControlSeconds finds directive=N in a Cache-Control value.
+func cacheControlSeconds(cc, directive string) (int64, bool, error) {
+	for _, d := range strings.Split(cc, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if !strings.EqualFold(name, directive) {
+			continue
+		}
+		secs, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		if err != nil || secs < 0 {
+			return 0, false, fmt.Errorf("bad Cache-Control %s", directive)
+		}
+		return secs, true, nil
+	}
+	return 0, false, nil
+}
+
+// setFreshness sets Cache-Control and Age on a GET response for an item that
+// expires. private keeps shared caches from storing the response.
+func setFreshness(h http.Header, it Item, now time.Time, private bool) {
+	if it.ExpiresAt.IsZero() {
+		return
+	}
+	written := time.Unix(0, it.Version)
+	v := make([]string, 2)
+	v[0] = "max-age="
+	if private {
+		v[0] = "private, max-age="
+	}
+	v[0] += strconv.FormatInt(int64(max(it.ExpiresAt.Sub(written), 0)/time.Second), 10)
+	v[1] = strconv.FormatInt(int64(max(now.Sub(written), 0)/time.Second), 10)
+	h["Cache-Control"], h["Age"] = v[:1:1], v[1:]
+}
@@ -0,0 +1,118 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for mapping TTLs onto HTTP caching headers.
+
+List of functions:
+	- TestTTLFromHeaders: Tests reading a PUT's TTL from Cache-Control and Expires.
+	- TestCacheHeadersOverHTTP: Tests header TTLs on PUT and Age and Cache-Control on GET.
+	- TestCacheHeadersPrivateWithAuth: Tests that GETs behind authentication are marked private.
+*/
+
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTLFromHeaders(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		cc, expires string
+		want        time.Duration
+		bad         bool
+	}{
+		{"", "", 0, false},
+		{"max-age=60", "", time.Minute, false},
+		{"public, max-age=\"90\"", "", 90 * time.Second, false},
+		{"max-age=60, s-maxage=300", "", 5 * time.Minute, false},
+		{"no-cache", now.Add(time.Hour).Format(http.TimeFormat), time.Hour, false},
+		{"max-age=30", now.Add(time.Hour).Format(http.TimeFormat), 30 * time.Second, false},
+		{"max-age=0", "", 0, true},
+		{"max-age=soon", "", 0, true},
+		{"", now.Add(-time.Second).Format(http.TimeFormat), 0, true},
+		{"", "tomorrow", 0, true},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		if c.cc != "" { h.Set("Cache-Control", c.cc) }
+		if c.expires != "" { h.Set("Expires", c.expires) }
+		got, err := ttlFromHeaders(h, now)
+		if (err != nil) != c.bad || got != c.want {
+			t.Errorf("Cache-Control %q Expires %q: got %v, %v; want %v (error %t)", c.cc, c.expires, got, err, c.want, c.bad)
+		}
+	}
+}
+
+func TestCacheHeadersOverHTTP(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	put := func(key, query string, h http.Header) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key+query, strings.NewReader("v"))
+		for k, v := range h { req.Header[k] = v }
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	get := func(key string) http.Header {
+		resp, err := http.Get(srv.URL + "/kv/" + key)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		if resp.StatusCode != 200 { t.Fatalf("GET %s: %d", key, resp.StatusCode) }
+		return resp.Header
+	}
+
+	if code := put("a", "", http.Header{"Cache-Control": {"max-age=120"}}); code != 201 { t.Fatalf("PUT a: %d", code) }
+	if code := put("b", "?ttl=30s", http.Header{"Cache-Control": {"max-age=120"}}); code != 201 { t.Fatalf("PUT b: %d", code) }
+	if code := put("c", "", nil); code != 201 { t.Fatalf("PUT c: %d", code) }
+	if code := put("d", "", http.Header{"Expires": {"Thu, 01 Jan 1970 00:00:00 GMT"}}); code != 400 { t.Fatalf("PUT d: %d", code) }
+
+	if h := get("a"); h.Get("Cache-Control") != "max-age=120" || h.Get("Age") != "0" {
+		t.Fatalf("a: Cache-Control %q Age %q", h.Get("Cache-Control"), h.Get("Age"))
+	}
+	if h := get("b"); h.Get("Cache-Control") != "max-age=30" {
+		t.Fatalf("b: the ttl query should win, got Cache-Control %q", h.Get("Cache-Control"))
+	}
+	if h := get("c"); h.Get("Cache-Control") != "" || h.Get("Age") != "" {
+		t.Fatalf("c: Cache-Control %q Age %q", h.Get("Cache-Control"), h.Get("Age"))
+	}
+	it, _ := n.store.GetLive("a", time.Now())
+	h := http.Header{}
+	setFreshness(h, it, time.Unix(0, it.Version).Add(45*time.Second), false)
+	if h.Get("Age") != "45" || h.Get("Cache-Control") != "max-age=120" {
+		t.Fatalf("later: %v", h)
+	}
+}
+
+func TestCacheHeadersPrivateWithAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("s3cret", "app")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	do := func(method string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/kv/a?ttl=60s", strings.NewReader("v"))
+		req.Header.Set("X-API-Key", "s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp
+	}
+	if resp := do("PUT"); resp.StatusCode != 201 { t.Fatalf("PUT: %d", resp.StatusCode) }
+	resp := do("GET")
+	if resp.StatusCode != 200 || resp.Header.Get("Cache-Control") != "private, max-age=60" {
+		t.Fatalf("GET: %d Cache-Control %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,381 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements JWT bearer token validation, so the cache can accept tokens from an existing
+OIDC provider instead of keeping its own keys. A JWTAuth checks the token's signature against the
+provider's JSON Web Key Set (RS256/384/512 and ES256/384; "none" and shared-secret algorithms are
+refused), then its issuer, audience, expiry and not-before time. The key set is fetched from
+JWKSURL, or discovered from the issuer's /.well-known/openid-configuration, cached for an hour and
+refetched early when a token names a key ID it has not seen, which is how providers roll keys.
+Fetches are attempted at most once a minute, failed ones included, and run without holding the
+lock: one request fetches while others with a known key keep being served, and those needing
+the new key wait for that one fetch.
+
+The caller's name comes from NameClaim (default "sub"), and its roles from RolesClaim (a string or
+array claim such as "roles" or "groups"), optionally translated through RoleMap so provider group
+names can map onto the cache's roles.
+
+Functions:
+- (*JWTAuth) Authenticate(r *http.Request): (*Principal, error)
+- (*JWTAuth) verify(token string, now time.Time): (map[string]any, error)
+- (*JWTAuth) key(kid string): (crypto.PublicKey, error)
+- (*JWTAuth) fetchKeys(): (map[string]crypto.PublicKey, error)
+- parseJWK(k jwk): (crypto.PublicKey, error)
+- verifySignature(alg string, pub crypto.PublicKey, signed, sig []byte): error
+- AnyOf(auths ...Authenticator): Authenticator
+*/
+
+package cache
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jwksTTL        = time.Hour
+	jwksMinRefresh = time.Minute
+	jwtLeeway      = 30 * time.Second // allowed clock skew for exp and nbf
+)
+
+// JWTAuth authenticates requests carrying a JWT bearer token.
+type JWTAuth struct {
+	Issuer   string // required "iss"
+	Audience string // required to appear in "aud"; empty skips the check
+	JWKSURL  string // empty: discovered from Issuer
+
+	NameClaim  string            // default "sub"
+	RolesClaim string            // claim holding the caller's roles or groups
+	RoleMap    map[string]string // claim value -> role; values not listed pass through unchanged
+
+	Client *http.Client // default: 10s timeout
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey // by kid
+	fetched  time.Time                   // last successful fetch
+	tried    time.Time                   // last fetch started, successful or not
+	fetchErr error                       // from the last fetch
+	fetching chan struct{}               // closed when the fetch in progress ends
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j *JWTAuth) Authenticate(r *http.Request) (*Principal, error) {
+	tok := bearerToken(r)
+	if tok == "" {
+		return nil, errNoCredentials
+	}
+	claims, err := j.verify(tok, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	nameClaim := j.NameClaim
+	if nameClaim == "" {
+		nameClaim = "sub"
+	}
+	p := &Principal{}
+	p.Name, _ = claims[nameClaim].(string)
+	if p.Name == "" {
+		return nil, fmt.Errorf("token has no %q claim", nameClaim)
+	}
+	if j.RolesClaim != "" {
+		for _, v := range stringList(claims[j.RolesClaim]) {
+			if mapped, ok := j.RoleMap[v]; ok {
+				v = mapped
+			}
+			p.Roles = append(p.Roles, v)
+		}
+	}
+	return p, nil
+}
+
+// stringList accepts a claim that is a string (space-separated, as OAuth
+// scopes are) or an array of strings.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// verify checks token's signature and standard claims and returns its claims.
+func (j *JWTAuth) verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errBadCredentials
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errBadCredentials
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errBadCredentials
+	}
+	pub, err := j.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errBadCredentials
+	}
+	if iss, _ := claims["iss"].(string); iss != j.Issuer {
+		return nil, fmt.Errorf("token issuer %q not accepted", iss)
+	}
+	if j.Audience != "" {
+		var ok bool
+		switch aud := claims["aud"].(type) {
+		case string:
+			ok = aud == j.Audience
+		case []any:
+			for _, a := range aud {
+				ok = ok || a == j.Audience
+			}
+		}
+		if !ok {
+			return nil, errors.New("token audience not accepted")
+		}
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the signing key kid, refetching the key set when it is stale
+// or does not have kid yet.
+func (j *JWTAuth) key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	k, ok := j.keys[kid]
+	if ok && time.Since(j.fetched) < jwksTTL {
+		j.mu.Unlock()
+		return k, nil
+	}
+	switch wait := j.fetching; {
+	case wait == nil && time.Since(j.tried) >= jwksMinRefresh:
+		wait = make(chan struct{})
+		j.fetching, j.tried = wait, time.Now()
+		j.mu.Unlock()
+		keys, err := j.fetchKeys()
+		j.mu.Lock()
+		if err == nil {
+			j.keys, j.fetched = keys, time.Now()
+		}
+		j.fetchErr, j.fetching = err, nil
+		close(wait)
+	case wait != nil && !ok:
+		j.mu.Unlock()
+		<-wait
+		j.mu.Lock()
+	}
+	defer j.mu.Unlock()
+	if k, ok := j.keys[kid]; ok {
+		return k, nil // keep serving with the keys we have if a fetch failed
+	}
+	if j.fetchErr != nil {
+		return nil, fmt.Errorf("fetching signing keys: %w", j.fetchErr)
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// fetchKeys fetches the key set. It is called without j.mu held.
+func (j *JWTAuth) fetchKeys() (map[string]crypto.PublicKey, error) {
+	client := j.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	getJSON := func(url string, v any) error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("%s: status %d", url, resp.StatusCode)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	url := j.JWKSURL
+	if url == "" {
+		var disc struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := getJSON(strings.TrimRight(j.Issuer, "/")+"/.well-known/openid-configuration", &disc); err != nil {
+			return nil, err
+		}
+		if disc.JWKSURI == "" {
+			return nil, errors.New("openid configuration has no jwks_uri")
+		}
+		url = disc.JWKSURI
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(url, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := parseJWK(k); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	return keys, nil
+}
+
+func parseJWK(k jwk) (crypto.PublicKey, error) {
+	b64 := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("bad key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("bad RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, pub crypto.PublicKey, signed, sig []byte) error {
+	var h crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h = crypto.SHA256
+	case "RS384", "ES384":
+		h = crypto.SHA384
+	case "RS512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("token algorithm %q not accepted", alg)
+	}
+	hh := h.New()
+	hh.Write(signed)
+	digest := hh.Sum(nil)
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' || rsa.VerifyPKCS1v15(pub, h, digest, sig) != nil {
+			return errBadCredentials
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return errBadCredentials
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errBadCredentials
+		}
+		return nil
+	}
+	return errBadCredentials
+}
+
+type anyOf []Authenticator
+
+// AnyOf accepts a request if any of auths does, e.g. API keys for services
+// and JWTs for people.
+func AnyOf(auths ...Authenticator) Authenticator { return anyOf(auths) }
+
+func (a anyOf) Authenticate(r *http.Request) (*Principal, error) {
+	err := errNoCredentials
+	for _, auth := range a {
+		p, e := auth.Authenticate(r)
+		if e == nil {
+			return p, nil
+		}
+		if e != errNoCredentials && (err == errNoCredentials || err == errBadCredentials) {
+			err = e // report the most specific failure
+		}
+	}
+	return nil, err
+}
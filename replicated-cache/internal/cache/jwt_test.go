@@ -0,0 +1,228 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for JWT bearer token validation.
+
+List of functions:
+	- signJWT: Signs a token with an RSA or ECDSA test key.
+	- TestJWTAuth: Tests signature, issuer, audience and expiry checks, key discovery and role mapping.
+	- TestJWTKeyRefresh: Tests that key set fetches are shared, rate limited when failing, and do not block known keys.
+	- TestAnyOf: Tests that API keys and JWTs can be accepted together.
+*/
+
+package cache
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, key crypto.Signer, kid string, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil { t.Fatal(err) }
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil { t.Fatal(err) }
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTAuth(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil { t.Fatal(err) }
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil { t.Fatal(err) }
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	var jwksHits int
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			jwksHits++
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "e1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ja := &JWTAuth{Issuer: srv.URL, Audience: "cache", RolesClaim: "groups", RoleMap: map[string]string{"ops": "admin"}}
+	now := time.Now().Unix()
+	claims := func(mod func(map[string]any)) map[string]any {
+		c := map[string]any{"iss": srv.URL, "aud": []string{"other", "cache"}, "sub": "alice", "exp": now + 60, "groups": []string{"ops", "read"}}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	auth := func(tok string) (*Principal, error) {
+		r := httptest.NewRequest("GET", "/kv/x", nil)
+		r.Header.Set("Authorization", "Bearer "+tok)
+		return ja.Authenticate(r)
+	}
+
+	p, err := auth(signJWT(t, rsaKey, "r1", claims(nil)))
+	if err != nil { t.Fatal(err) }
+	if p.Name != "alice" || strings.Join(p.Roles, ",") != "admin,read" {
+		t.Fatalf("principal = %+v", p)
+	}
+	if p, err := auth(signJWT(t, ecKey, "e1", claims(nil))); err != nil || p.Name != "alice" {
+		t.Fatalf("ES256: principal %+v, err %v", p, err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for name, tok := range map[string]string{
+		"wrong key":      signJWT(t, other, "r1", claims(nil)),
+		"wrong issuer":   signJWT(t, rsaKey, "r1", claims(func(c map[string]any) { c["iss"] = "https://evil" })),
+		"wrong audience": signJWT(t, rsaKey, "r1", claims(func(c map[string]any) { c["aud"] = "other" })),
+		"expired":        signJWT(t, rsaKey, "r1", claims(func(c map[string]any) { c["exp"] = now - 120 })),
+		"no expiry":      signJWT(t, rsaKey, "r1", claims(func(c map[string]any) { delete(c, "exp") })),
+		"not yet valid":  signJWT(t, rsaKey, "r1", claims(func(c map[string]any) { c["nbf"] = now + 600 })),
+		"alg none":       b64([]byte(`{"alg":"none","kid":"r1"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".",
+		"not a jwt":      "s3cret",
+	} {
+		if _, err := auth(tok); err == nil {
+			t.Fatalf("%s: token accepted", name)
+		}
+	}
+	if jwksHits != 1 {
+		t.Fatalf("key set fetched %d times; want 1", jwksHits)
+	}
+	// An unknown kid right after a fetch does not refetch the key set.
+	if _, err := auth(signJWT(t, rsaKey, "r2", claims(nil))); err == nil {
+		t.Fatal("accepted unknown kid")
+	}
+	if jwksHits != 1 {
+		t.Fatalf("unknown kid refetched keys within a minute")
+	}
+}
+
+func TestJWTKeyRefresh(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil { t.Fatal(err) }
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var hits atomic.Int32
+	var failing atomic.Bool
+	entered, release := make(chan struct{}, 10), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		entered <- struct{}{}
+		<-release
+		if failing.Load() {
+			http.Error(w, "down", 500); return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "r1", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		}})
+	}))
+	defer srv.Close()
+	claims := map[string]any{"iss": "https://idp", "sub": "alice", "exp": time.Now().Unix() + 60}
+	tok := signJWT(t, rsaKey, "r1", claims)
+	auth := func(ja *JWTAuth) error {
+		r := httptest.NewRequest("GET", "/kv/x", nil)
+		r.Header.Set("Authorization", "Bearer "+tok)
+		_, err := ja.Authenticate(r)
+		return err
+	}
+
+	// Concurrent requests for a key not yet fetched share one fetch.
+	ja := &JWTAuth{Issuer: "https://idp", JWKSURL: srv.URL}
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() { defer wg.Done(); errs <- auth(ja) }()
+	}
+	<-entered
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil { t.Fatal(err) }
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("key set fetched %d times; want 1", hits.Load())
+	}
+
+	// While a stale key set is being refetched, known keys are still served.
+	release = make(chan struct{})
+	ja.mu.Lock()
+	ja.fetched, ja.tried = time.Now().Add(-2*jwksTTL), time.Time{}
+	ja.mu.Unlock()
+	done := make(chan error)
+	go func() { done <- auth(ja) }()
+	<-entered
+	if err := auth(ja); err != nil {
+		t.Fatalf("known key during a fetch: %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil { t.Fatal(err) }
+
+	// A failed fetch is not retried for a minute.
+	failing.Store(true)
+	hits.Store(0)
+	ja = &JWTAuth{Issuer: "https://idp", JWKSURL: srv.URL}
+	for i := 0; i < 3; i++ {
+		if err := auth(ja); err == nil || !strings.Contains(err.Error(), "fetching signing keys") {
+			t.Fatalf("with the key set down: %v", err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("failing key set fetched %d times; want 1", hits.Load())
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("s3cret", "svc")
+	a := AnyOf(keys, &JWTAuth{Issuer: "https://issuer.invalid"})
+	r := httptest.NewRequest("GET", "/kv/x", nil)
+	if _, err := a.Authenticate(r); err != errNoCredentials {
+		t.Fatalf("no credentials: err %v", err)
+	}
+	r.Header.Set("X-API-Key", "s3cret")
+	if p, err := a.Authenticate(r); err != nil || p.Name != "svc" {
+		t.Fatalf("API key: principal %+v, err %v", p, err)
+	}
+	r.Header.Set("X-API-Key", "wrong")
+	if _, err := a.Authenticate(r); err != errBadCredentials {
+		t.Fatalf("bad key: err %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements key validation rules, so malformed keys from one buggy client cannot
+spread to every node. With Node.KeyRules set, keys must be valid UTF-8, no longer than MaxLen
+bytes and, when Charset is given, made only of the characters it lists ("a-zA-Z0-9:_.-";
+ranges and single ASCII characters). Prefixes requires the keys an authenticated caller writes
+to start with one of its prefixes, so each tenant stays in its own part of the key space; "*"
+applies to callers without an entry of their own.
+
+PUT answers 400 for a key that breaks the rules. Sets arriving on /sync are checked against
+MaxLen and Charset (peers carry no caller, so Prefixes does not apply) and dropped, logged and
+counted in cache_keys_rejected_total when they fail. The batch is still acknowledged: the sender
+would otherwise queue and retry a write that can never succeed. Deletes and evictions are not
+checked, so tightening the rules never strands keys that are already stored.
+
+Functions:
+- NewKeyRules(maxLen int, charset string, prefixes map[string][]string): (*KeyRules, error)
+- (*KeyRules) Check(key string): error
+- (*KeyRules) checkPrefix(p *Principal, key string): error
+- (*Node) checkKey(r *http.Request, key string): error
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyRules constrain the keys clients and peers may write; build them with
+// NewKeyRules.
+type KeyRules struct {
+	MaxLen   int                 // bytes; 0 = no limit
+	Charset  string              // allowed characters, e.g. "a-zA-Z0-9:_.-"; empty allows any
+	Prefixes map[string][]string // principal name (or "*") -> allowed key prefixes
+	allowed  [utf8.RuneSelf]bool
+}
+
+// NewKeyRules validates charset and returns the rules.
+func NewKeyRules(maxLen int, charset string, prefixes map[string][]string) (*KeyRules, error) {
+	k := &KeyRules{MaxLen: maxLen, Charset: charset, Prefixes: prefixes}
+	for i := 0; i < len(charset); i++ {
+		lo, hi := charset[i], charset[i]
+		if i+2 < len(charset) && charset[i+1] == '-' {
+			hi = charset[i+2]
+			i += 2
+		}
+		if lo >= utf8.RuneSelf || hi >= utf8.RuneSelf || lo > hi {
+			return nil, fmt.Errorf("bad key charset %q: want ASCII characters and ranges like a-z", charset)
+		}
+		for c := int(lo); c <= int(hi); c++ {
+			k.allowed[c] = true
+		}
+	}
+	return k, nil
+}
+
+// Check reports why key breaks the length and charset rules, or nil.
+func (k *KeyRules) Check(key string) error {
+	if k.MaxLen > 0 && len(key) > k.MaxLen {
+		return fmt.Errorf("key longer than %d bytes", k.MaxLen)
+	}
+	if k.Charset == "" {
+		if !utf8.ValidString(key) {
+			return fmt.Errorf("key is not valid UTF-8")
+		}
+		return nil
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c >= utf8.RuneSelf || !k.allowed[c] {
+			return fmt.Errorf("key contains %q; allowed characters are %s", key[i:i+1], k.Charset)
+		}
+	}
+	return nil
+}
+
+// checkPrefix requires key to start with one of p's prefixes, if it has any.
+func (k *KeyRules) checkPrefix(p *Principal, key string) error {
+	if p == nil {
+		return nil
+	}
+	prefixes, ok := k.Prefixes[p.Name]
+	if !ok {
+		prefixes = k.Prefixes["*"]
+	}
+	if len(prefixes) == 0 {
+		return nil
+	}
+	for _, pre := range prefixes {
+		if strings.HasPrefix(key, pre) {
+			return nil
+		}
+	}
+	return fmt.Errorf("keys written by %s must start with %s", p.Name, strings.Join(prefixes, " or "))
+}
+
+// checkKey applies KeyRules to a key a client is writing.
+func (n *Node) checkKey(r *http.Request, key string) error {
+	if n.KeyRules == nil {
+		return nil
+	}
+	if err := n.KeyRules.Check(key); err != nil {
+		return err
+	}
+	return n.KeyRules.checkPrefix(principalFrom(r.Context()), key)
+}
@@ -0,0 +1,144 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements adaptive per-peer replication timeouts. Each peer's recent successful
+sync latencies are kept in a small ring buffer; with AdaptiveTimeout set, the timeout for a
+request to that peer is its p99 latency times TimeoutFactor, clamped to [MinReqTimeout,
+ReqTimeout]. A slow WAN peer thus gets the time it needs while a failed LAN peer is detected
+quickly, instead of one global ReqTimeout being too short for one and too long for the other.
+Until a peer has enough samples it gets ReqTimeout.
+Heartbeat round-trip times are kept in windows of their own. They give each peer an adaptive
+heartbeat timeout (so a dead peer is noticed within a few RTTs), stand in for sync latency on
+peers that receive too few writes to have their own samples, and are reported as min/avg/p99.
+
+Functions:
+- (*latencyWindow) observe(d time.Duration)
+- (*latencyWindow) p99(): (time.Duration, bool)
+- (*latencyWindow) summary(): (lo, avg, p99 time.Duration, ok bool)
+- (*Node) observeLatency(peer string, d time.Duration)
+- (*Node) observeHeartbeat(peer string, d time.Duration)
+- (*Node) peerTimeout(peer string): time.Duration
+- (*Node) heartbeatTimeout(peer string): time.Duration
+- (*Node) adaptiveTimeout(w *latencyWindow): (time.Duration, bool)
+*/
+
+package cache
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize = 256
+	// latencyMinSamples is how many samples a peer needs before its timeout adapts.
+	latencyMinSamples = 20
+)
+
+// latencyWindow holds a peer's most recent latencies and a cached p99 that
+// is recomputed every few samples.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	n       int // total observed
+	cached  time.Duration
+	stale   int // samples since cached was computed
+}
+
+func (l *latencyWindow) observe(d time.Duration) {
+	l.mu.Lock()
+	l.samples[l.n%latencyWindowSize] = d
+	l.n++
+	l.stale++
+	l.mu.Unlock()
+}
+
+func (l *latencyWindow) p99() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.n < latencyMinSamples {
+		return 0, false
+	}
+	if l.cached == 0 || l.stale >= latencyWindowSize/16 {
+		sorted := slices.Clone(l.samples[:min(l.n, latencyWindowSize)])
+		slices.Sort(sorted)
+		l.cached = sorted[len(sorted)*99/100]
+		l.stale = 0
+	}
+	return l.cached, true
+}
+
+// summary returns the window's minimum, mean and p99; ok is false until
+// latencyMinSamples have been observed.
+func (l *latencyWindow) summary() (lo, avg, p99 time.Duration, ok bool) {
+	p99, ok = l.p99()
+	if !ok {
+		return 0, 0, 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	samples := l.samples[:min(l.n, latencyWindowSize)]
+	lo = samples[0]
+	var sum time.Duration
+	for _, d := range samples {
+		lo = min(lo, d)
+		sum += d
+	}
+	return lo, sum / time.Duration(len(samples)), p99, true
+}
+
+func (n *Node) observeLatency(peer string, d time.Duration) {
+	v, _ := n.latencies.LoadOrStore(peer, new(latencyWindow))
+	v.(*latencyWindow).observe(d)
+}
+
+func (n *Node) observeHeartbeat(peer string, d time.Duration) {
+	v, _ := n.hbRTT.LoadOrStore(peer, new(latencyWindow))
+	v.(*latencyWindow).observe(d)
+}
+
+// peerTimeout returns the timeout to use for one sync request to peer,
+// based on its sync latency or, lacking samples, its heartbeat RTT.
+func (n *Node) peerTimeout(peer string) time.Duration {
+	if !n.AdaptiveTimeout {
+		return n.ReqTimeout
+	}
+	for _, m := range []*sync.Map{&n.latencies, &n.hbRTT} {
+		if v, ok := m.Load(peer); ok {
+			if t, ok := n.adaptiveTimeout(v.(*latencyWindow)); ok {
+				return t
+			}
+		}
+	}
+	return n.ReqTimeout
+}
+
+// heartbeatTimeout returns how long a heartbeat to peer may take before the
+// peer counts as failed.
+func (n *Node) heartbeatTimeout(peer string) time.Duration {
+	if v, ok := n.hbRTT.Load(peer); ok && n.AdaptiveTimeout {
+		if t, ok := n.adaptiveTimeout(v.(*latencyWindow)); ok {
+			return t
+		}
+	}
+	return n.ReqTimeout
+}
+
+// adaptiveTimeout is w's p99 times TimeoutFactor, clamped to
+// [MinReqTimeout, ReqTimeout].
+func (n *Node) adaptiveTimeout(w *latencyWindow) (time.Duration, bool) {
+	p99, ok := w.p99()
+	if !ok {
+		return 0, false
+	}
+	factor := n.TimeoutFactor
+	if factor <= 0 {
+		factor = 3
+	}
+	t := time.Duration(float64(p99) * factor)
+	return max(n.MinReqTimeout, min(t, n.ReqTimeout)), true
+}
@@ -0,0 +1,235 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a TinyLFU eviction policy. Access frequencies are estimated with a
+count-min sketch of 4 rows of saturating 8-bit counters that are halved periodically, so old
+popularity fades. A doorkeeper bloom filter sits in front of the sketch: a key's first access
+only sets its bits, so the long tail of keys seen once never reaches the counters. Victims are
+chosen by sampling a few tracked keys and taking the one with the lowest estimated frequency.
+When a new key would push the store over its limit it is only admitted if it is estimated to
+be used more often than that victim; otherwise the new key itself is evicted. This suits skewed
+(zipfian) workloads far better than LRU, as a burst of one-off keys cannot flush the hot set.
+Counter updates are lock-free atomics, so reads never block on the policy.
+
+Functions:
+- newCountMinSketch(width int): *countMinSketch
+- (*countMinSketch) slot(h uint64, i int): (*atomic.Uint32, uint)
+- (*countMinSketch) add(key string)
+- (*countMinSketch) estimate(key string): int
+- (*countMinSketch) halve()
+- (*countMinSketch) doorBit(h uint64, i int): (*atomic.Uint64, uint64)
+- (*countMinSketch) seen(h uint64): bool
+- (*countMinSketch) count(h uint64)
+- NewLFUPolicy(): EvictionPolicy
+- (*lfuPolicy) OnInsert/OnAccess/OnRemove/Victim: LFU bookkeeping
+*/
+
+package cache
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	sketchDepth = 4
+	// lfuSampleSize is how many tracked keys are compared to pick one victim.
+	lfuSampleSize = 8
+	// doorkeeperProbes is how many bits a key sets in the doorkeeper.
+	doorkeeperProbes = 3
+)
+
+// countMinSketch packs four 8-bit counters into each uint32 so a row can be
+// updated with a single atomic compare-and-swap. The doorkeeper is a bloom
+// filter with about 12 bits per add between resets, cleared with the halving.
+type countMinSketch struct {
+	rows     [sketchDepth][]atomic.Uint32
+	mask     uint64
+	door     []atomic.Uint64
+	doorMask uint64
+	seed     maphash.Seed
+	adds     atomic.Int64
+	resetAt  int64
+}
+
+func newCountMinSketch(width int) *countMinSketch {
+	w := 64
+	for w < width {
+		w <<= 1
+	}
+	c := &countMinSketch{mask: uint64(w*4 - 1), seed: maphash.MakeSeed(), resetAt: int64(w * 10)}
+	c.door = make([]atomic.Uint64, 2*w)
+	c.doorMask = uint64(len(c.door)*64 - 1)
+	for i := range c.rows {
+		c.rows[i] = make([]atomic.Uint32, w)
+	}
+	return c
+}
+
+// slot returns the word and byte shift of key's counter in row i, deriving
+// the per-row index from one 64-bit hash by double hashing.
+func (c *countMinSketch) slot(h uint64, i int) (*atomic.Uint32, uint) {
+	idx := (h + uint64(i)*(h>>32|1)) & c.mask
+	return &c.rows[i][idx/4], uint(idx%4) * 8
+}
+
+// add records one access to key: the first since the last reset goes to the
+// doorkeeper, later ones to the counters.
+func (c *countMinSketch) add(key string) {
+	h := maphash.String(c.seed, key)
+	if c.seen(h) {
+		c.count(h)
+	}
+	// Only the goroutine that swaps the count back to zero halves, so a
+	// burst of adds past resetAt ages the counters once.
+	if n := c.adds.Add(1); n >= c.resetAt && c.adds.CompareAndSwap(n, 0) {
+		c.halve()
+	}
+}
+
+// doorBit returns the word and mask of h's i-th doorkeeper bit. The hash is
+// rotated first so the bits do not follow the counter slots.
+func (c *countMinSketch) doorBit(h uint64, i int) (*atomic.Uint64, uint64) {
+	h = bits.RotateLeft64(h, 29)
+	bit := (h + uint64(i)*(h>>32|1)) & c.doorMask
+	return &c.door[bit/64], 1 << (bit % 64)
+}
+
+// seen sets the doorkeeper bits for h and reports whether they were all set
+// already.
+func (c *countMinSketch) seen(h uint64) bool {
+	all := true
+	for i := 0; i < doorkeeperProbes; i++ {
+		word, m := c.doorBit(h, i)
+		for {
+			old := word.Load()
+			if old&m != 0 {
+				break
+			}
+			if word.CompareAndSwap(old, old|m) {
+				all = false
+				break
+			}
+		}
+	}
+	return all
+}
+
+// count increments h's counter in every row, saturating at 255.
+func (c *countMinSketch) count(h uint64) {
+	for i := 0; i < sketchDepth; i++ {
+		word, shift := c.slot(h, i)
+		for {
+			old := word.Load()
+			if (old>>shift)&0xff == 0xff {
+				break
+			}
+			if word.CompareAndSwap(old, old+1<<shift) {
+				break
+			}
+		}
+	}
+}
+
+// estimate returns key's access count: the counters' minimum, plus one if
+// the doorkeeper has seen it.
+func (c *countMinSketch) estimate(key string) int {
+	h := maphash.String(c.seed, key)
+	min := 0xff
+	for i := 0; i < sketchDepth; i++ {
+		word, shift := c.slot(h, i)
+		if v := int(uint8(word.Load() >> shift)); v < min {
+			min = v
+		}
+	}
+	for i := 0; i < doorkeeperProbes; i++ {
+		if word, m := c.doorBit(h, i); word.Load()&m == 0 {
+			return min
+		}
+	}
+	return min + 1
+}
+
+// halve ages every counter so that past popularity decays, and clears the
+// doorkeeper.
+func (c *countMinSketch) halve() {
+	for i := range c.door {
+		c.door[i].Store(0)
+	}
+	for i := range c.rows {
+		for j := range c.rows[i] {
+			for {
+				old := c.rows[i][j].Load()
+				if c.rows[i][j].CompareAndSwap(old, (old>>1)&0x7f7f7f7f) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// lfuPolicy tracks the set of live keys for sampling; frequencies live in the
+// sketch. A key maps to true from its insert until it has been through
+// admission or overwritten in place.
+type lfuPolicy struct {
+	sketch *countMinSketch
+	mu     sync.Mutex
+	keys   map[string]bool
+}
+
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{sketch: newCountMinSketch(1 << 16), keys: make(map[string]bool)}
+}
+
+func (p *lfuPolicy) OnInsert(key string) {
+	p.sketch.add(key)
+	p.mu.Lock()
+	_, resident := p.keys[key]
+	p.keys[key] = !resident
+	p.mu.Unlock()
+}
+
+func (p *lfuPolicy) OnAccess(key string) { p.sketch.add(key) }
+
+func (p *lfuPolicy) OnRemove(key string) {
+	p.mu.Lock()
+	delete(p.keys, key)
+	p.mu.Unlock()
+}
+
+// Victim samples tracked keys (map iteration starts at a random point) and
+// returns the least frequently used one. When exclude was just inserted and
+// is not used more often than that key, it returns exclude instead: the new
+// key is not admitted.
+func (p *lfuPolicy) Victim(exclude string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		best     string
+		bestFreq int
+		seen     int
+	)
+	for k := range p.keys {
+		if k == exclude {
+			continue
+		}
+		if f := p.sketch.estimate(k); seen == 0 || f < bestFreq {
+			best, bestFreq = k, f
+		}
+		if seen++; seen >= lfuSampleSize {
+			break
+		}
+	}
+	if seen > 0 && p.keys[exclude] {
+		p.keys[exclude] = false
+		if p.sketch.estimate(exclude) <= bestFreq {
+			return exclude, true
+		}
+	}
+	return best, seen > 0
+}
@@ -0,0 +1,103 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file bounds how much of the node a single request can hold on to. Request bodies are capped
+(MaxValueBytes for PUT values, after any gzip decoding; MaxSyncBytes for POST /sync batches) and
+answered 413 beyond that. Each request also gets a Timeout: its context is cancelled after it,
+which stops replication waits and read-through loads, and the connection's read deadline is set
+to it, so a client trickling a body in (slow loris) is cut off instead of pinning a handler
+goroutine. GET and HEAD requests are exempt, which keeps the read fast path free of allocations:
+they carry no body, and read-through loads have their own ReqTimeout. So are the long-lived sync
+stream, which manages its own connection, and gRPC calls, whose streams bound each message and
+unary calls their own time (see grpc.go).
+
+http.TimeoutHandler is not used because it buffers whole responses and cannot hijack.
+
+Functions:
+- (*Node) limitRequests(next http.Handler): http.Handler
+- readLimited(r io.Reader, max int64): ([]byte, error)
+- bodyErrorStatus(err error): int
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestLimits bound request bodies and handler time; zero disables each.
+type RequestLimits struct {
+	MaxValueBytes int64         // PUT body, after decoding
+	MaxSyncBytes  int64         // POST /sync body
+	Timeout       time.Duration // per request, including reading the body
+	// MaxHeaderBytes bounds request headers (see hardening.go).
+	MaxHeaderBytes int
+}
+
+// DefaultRequestLimits returns the limits NewNode starts with.
+func DefaultRequestLimits() RequestLimits {
+	return RequestLimits{MaxValueBytes: 32 << 20, MaxSyncBytes: maxStreamFrame, Timeout: 30 * time.Second, MaxHeaderBytes: 64 << 10}
+}
+
+var errTooLarge = errors.New("request body too large")
+
+func (n *Node) limitRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := n.Limits
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasPrefix(r.URL.Path, grpcPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		max := l.MaxValueBytes
+		if r.URL.Path == "/sync" {
+			max = l.MaxSyncBytes
+		}
+		if max > 0 && r.Body != nil && r.Body != http.NoBody {
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		if l.Timeout > 0 {
+			deadline := time.Now().Add(l.Timeout)
+			http.NewResponseController(w).SetReadDeadline(deadline)
+			ctx, cancel := context.WithDeadline(r.Context(), deadline)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readLimited reads all of r, failing with errTooLarge past max bytes
+// (zero: no limit). It guards decoded bodies, which MaxBytesReader cannot.
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+	b, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(b)) > max {
+		err = fmt.Errorf("%w (limit %d bytes)", errTooLarge, max)
+	}
+	return b, err
+}
+
+// bodyErrorStatus maps a body read error to 413 for oversized bodies, 408
+// for bodies that did not arrive in time, and 400 otherwise.
+func bodyErrorStatus(err error) int {
+	var mbe *http.MaxBytesError
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, errTooLarge), errors.As(err, &mbe):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &timeout) && timeout.Timeout():
+		return http.StatusRequestTimeout
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,132 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements read-through loading. When a Node has a Loader, a GET that misses
+asks the loader for the value, stores it (compressed and with a TTL as configured) and
+replicates it to peers in the background. Concurrent misses for the same key are
+coalesced into a single loader call (singleflight), so a popular key expiring does not
+stampede the backing store.
+
+Functions:
+- NewHTTPLoader(base string, client *http.Client): LoaderFunc
+- (*flightGroup) do(key string, fn func() (Item, error)): (Item, error)
+- (*Node) load(ctx context.Context, key string): (Item, error)
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a LoaderFunc when the backing store has no value.
+var ErrNotFound = errors.New("not found")
+
+// LoaderFunc fetches the value for a missing key from a backing store. A zero
+// ttl means the loaded value does not expire.
+type LoaderFunc func(ctx context.Context, key string) (value []byte, ttl time.Duration, err error)
+
+// NewHTTPLoader loads keys with GET base/<key>. A 404 means ErrNotFound, and a
+// Cache-Control max-age on the response becomes the entry's TTL.
+func NewHTTPLoader(base string, client *http.Client) LoaderFunc {
+	base = strings.TrimRight(base, "/")
+	return func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/"+url.PathEscape(key), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, 0, ErrNotFound
+		case resp.StatusCode != http.StatusOK:
+			return nil, 0, fmt.Errorf("loader: status %d", resp.StatusCode)
+		}
+		value, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, err
+		}
+		var ttl time.Duration
+		for _, d := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(d), "max-age="); ok {
+				ttl, _ = parseDurationQS(v)
+			}
+		}
+		return value, ttl, nil
+	}
+}
+
+// flightGroup runs at most one call per key at a time; callers that arrive
+// while a call is in flight wait for and share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done chan struct{}
+	it   Item
+	err  error
+}
+
+func (g *flightGroup) do(key string, fn func() (Item, error)) (Item, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.it, c.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	c := &flight{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.it, c.err = fn()
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+	return c.it, c.err
+}
+
+// load fills a miss for key from the Loader. The call is detached from ctx so
+// that one impatient client does not fail everyone waiting on the same flight.
+func (n *Node) load(ctx context.Context, key string) (Item, error) {
+	return n.loads.do(key, func() (Item, error) {
+		if it, ok := n.store.GetLive(key, n.now()); ok {
+			return it, nil // filled while we were queuing for the flight
+		}
+		lctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), n.ReqTimeout)
+		defer cancel()
+		value, ttl, err := n.Loader(lctx, key)
+		if err != nil {
+			return Item{}, err
+		}
+		it := n.newItem(key, value, ttl)
+		if !n.apply(key, it) {
+			// A concurrent write won; serve that instead.
+			if cur, ok := n.store.GetLive(key, n.now()); ok {
+				return cur, nil
+			}
+		}
+		go n.Replicate(withRequestID(context.Background(), requestIDFrom(ctx)), syncMsgFor(key, it), 0, false)
+		return it, nil
+	})
+}
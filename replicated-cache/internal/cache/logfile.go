@@ -0,0 +1,210 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a log file with built-in rotation, for bare-metal deployments without
+journald or a log shipper. A RotatingFile is an io.Writer that appends to a file and, once the
+file would grow past MaxSize bytes or has been open for MaxAge, renames it to
+"<name>.<UTC timestamp>" and starts a new one. Rotated files are optionally gzip-compressed and
+only the newest MaxBackups are kept. Compression and pruning run in the background so a write
+never waits for them; Close waits for them to finish.
+
+Functions:
+- OpenRotatingFile(path string, opts RotateOptions): (*RotatingFile, error)
+- (*RotatingFile) Write(p []byte): (int, error)
+- (*RotatingFile) Rotate(): error
+- (*RotatingFile) Close(): error
+- (*RotatingFile) openLocked(): error
+- (*RotatingFile) rotateLocked(): error
+- (*RotatingFile) compressAndPrune(backup string)
+- (*RotatingFile) backups(): []string
+- exists(path string): bool
+- gzipFile(path string): error
+*/
+
+package cache
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime names rotated files; it sorts in time order.
+const backupTime = "20060102T150405.000"
+
+// RotateOptions configures a RotatingFile. Zero values disable each limit.
+type RotateOptions struct {
+	MaxSize    int64         // rotate before the file would exceed this many bytes
+	MaxAge     time.Duration // rotate once the file has been written for this long
+	MaxBackups int           // keep at most this many rotated files
+	Compress   bool          // gzip rotated files
+}
+
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	bgMu sync.Mutex // serializes compressAndPrune runs
+	bg   sync.WaitGroup
+}
+
+// OpenRotatingFile opens (or creates) path for appending.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, opts: opts}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.openLocked(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) openLocked() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, fi.Size(), time.Now()
+	return nil
+}
+
+// Write appends p, rotating first if p would push the file past a limit.
+// A single write larger than MaxSize still goes into one file.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && (r.opts.MaxSize > 0 && r.size+int64(len(p)) > r.opts.MaxSize ||
+		r.opts.MaxAge > 0 && time.Since(r.opened) >= r.opts.MaxAge) {
+		if err := r.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate starts a new file now, e.g. on SIGHUP.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	return r.rotateLocked()
+}
+
+func (r *RotatingFile) rotateLocked() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	backup := r.path + "." + time.Now().UTC().Format(backupTime)
+	for t := time.Now().UTC(); exists(backup) || exists(backup+".gz"); {
+		// Rotated twice within a millisecond; never overwrite a backup.
+		t = t.Add(time.Millisecond)
+		backup = r.path + "." + t.Format(backupTime)
+	}
+	if err := os.Rename(r.path, backup); err != nil {
+		// Keep logging to the old file rather than losing records.
+		return errors.Join(err, r.openLocked())
+	}
+	if err := r.openLocked(); err != nil {
+		return err
+	}
+	r.bg.Add(1)
+	go r.compressAndPrune(backup)
+	return nil
+}
+
+func (r *RotatingFile) compressAndPrune(backup string) {
+	defer r.bg.Done()
+	r.bgMu.Lock()
+	defer r.bgMu.Unlock()
+	if r.opts.Compress {
+		gzipFile(backup) // on failure the backup stays uncompressed
+	}
+	if r.opts.MaxBackups <= 0 {
+		return
+	}
+	old := r.backups()
+	for len(old) > r.opts.MaxBackups {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+}
+
+// backups lists rotated files, oldest first.
+func (r *RotatingFile) backups() []string {
+	matches, _ := filepath.Glob(r.path + ".*")
+	var out []string
+	for _, m := range matches {
+		ts := strings.TrimSuffix(strings.TrimPrefix(m, r.path+"."), ".gz")
+		if _, err := time.Parse(backupTime, ts); err == nil {
+			out = append(out, m)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// gzipFile replaces path with path+".gz".
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	err = errors.Join(err, zw.Close(), out.Close())
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Close closes the file and waits for background compression to finish.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.mu.Unlock()
+	r.bg.Wait()
+	return err
+}
@@ -0,0 +1,78 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the rotating log file.
+
+List of functions:
+	- TestRotatingFileBySize: Tests size-based rotation, compression and backup pruning.
+	- TestRotatingFileByAge: Tests that a file open longer than MaxAge is rotated on the next write.
+*/
+
+package cache
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	r, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, MaxBackups: 2, Compress: true})
+	if err != nil { t.Fatal(err) }
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		if _, err := r.Write([]byte(line)); err != nil { t.Fatal(err) }
+	}
+	if err := r.Close(); err != nil { t.Fatal(err) }
+
+	cur, _ := os.ReadFile(path)
+	if string(cur) != "six\n" {
+		t.Fatalf("current file = %q", cur)
+	}
+	backups := r.backups()
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups kept, got %v", backups)
+	}
+	var got []string
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".gz") { t.Fatalf("backup %s not compressed", b) }
+		f, _ := os.Open(b)
+		zr, err := gzip.NewReader(f)
+		if err != nil { t.Fatal(err) }
+		data, _ := io.ReadAll(zr)
+		f.Close()
+		got = append(got, string(data))
+	}
+	if got[0] != "three\n" || got[1] != "four\nfive\n" {
+		t.Fatalf("backup contents = %q", got)
+	}
+	if _, err := r.Write([]byte("x")); err == nil {
+		t.Fatal("write after Close succeeded")
+	}
+}
+
+func TestRotatingFileByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.log")
+	r, err := OpenRotatingFile(path, RotateOptions{MaxAge: time.Hour})
+	if err != nil { t.Fatal(err) }
+	defer r.Close()
+	r.Write([]byte("old\n"))
+	r.Write([]byte("still old\n"))
+	r.opened = r.opened.Add(-2 * time.Hour)
+	r.Write([]byte("new\n"))
+	if b := r.backups(); len(b) != 1 {
+		t.Fatalf("want one backup, got %v", b)
+	}
+	old, _ := os.ReadFile(r.backups()[0])
+	cur, _ := os.ReadFile(path)
+	if string(old) != "old\nstill old\n" || string(cur) != "new\n" {
+		t.Fatalf("backup %q, current %q", old, cur)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /kv/KEY/watch?since=VERSION&timeout=D, a long poll for clients that want
+to hear about changes to one key without holding a WebSocket or an event stream open. The request
+is answered as soon as the key holds a version newer than since: at once if it already does, else
+when a write or delete replicated to this node (or made here) brings one. The answer is the event
+as /watch and /changes send it, with the new version also in X-Cache-Version; the client polls
+again with since set to it. A key that expires while a poll waits is reported as "expire" with the
+version it had. Expiry does not change the version, so a poll started after the key expired waits
+for the next write like any other.
+
+Without since, any stored version answers at once, so the first poll reads the key's current
+state. When nothing changes within timeout (default 30s, at most 5m), the answer is 304 Not
+Modified with the current version, or 0 for a key never written. The usual /kv checks for a GET of
+the key apply.
+
+Functions:
+- (*Node) handleLongPoll(w http.ResponseWriter, r *http.Request)
+- (*Node) writeLongPoll(w http.ResponseWriter, r *http.Request, ev watchEvent)
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	longPollTimeout    = 30 * time.Second
+	longPollMaxTimeout = 5 * time.Minute
+	versionHeader      = "X-Cache-Version"
+)
+
+func (n *Node) handleLongPoll(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if key == "" {
+		http.Error(w, errMissingKey.Error(), 400)
+		return
+	}
+	q := r.URL.Query()
+	since := int64(-1)
+	if s := q.Get("since"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			http.Error(w, "bad since: want a version", 400)
+			return
+		}
+		since = v
+	}
+	timeout := longPollTimeout
+	if s := q.Get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "bad timeout", 400)
+			return
+		}
+		timeout = min(d, longPollMaxTimeout)
+	}
+
+	// Subscribed before reading the key, so a change in between is not missed.
+	wt := n.watches.subscribe([]string{key}, nil)
+	defer n.watches.unsubscribe(wt)
+	current := func() (watchEvent, bool) {
+		it, ok := n.store.Get(key)
+		op := "set"
+		switch {
+		case !ok:
+			return watchEvent{}, false
+		case it.Tombstone:
+			op = "del"
+		case !it.ExpiresAt.IsZero() && !n.now().Before(it.ExpiresAt):
+			op = "expire"
+		}
+		return watchEvent{op: op, key: key, it: it}, true
+	}
+	if ev, ok := current(); ok && ev.it.Version > since {
+		n.writeLongPoll(w, r, ev)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev, ok := <-wt.events:
+			if !ok {
+				// Dropped for lagging: the key changed, so report where it is now.
+				if ev, ok = current(); !ok {
+					ev = watchEvent{op: "del", key: key}
+				}
+				n.writeLongPoll(w, r, ev)
+				return
+			}
+			if ev.it.Version > since || (ev.op == "expire" && ev.it.Version == since) {
+				n.writeLongPoll(w, r, ev)
+				return
+			}
+		case <-timer.C:
+			it, _ := n.store.Get(key)
+			w.Header().Set(versionHeader, strconv.FormatInt(it.Version, 10))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (n *Node) writeLongPoll(w http.ResponseWriter, r *http.Request, ev watchEvent) {
+	msg, err := n.changeEventFor(ev, false)
+	if err != nil {
+		n.log.Error("cannot decrypt value", "component", "crypto", "key", ev.key, "err", err)
+		http.Error(w, "cannot decrypt value", 500)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set(versionHeader, strconv.FormatInt(ev.it.Version, 10))
+	writeEncoded(w, r, http.StatusOK, msg)
+}
@@ -0,0 +1,99 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the GET /kv/KEY/watch long poll.
+
+List of functions:
+	- longPoll: Polls a key and returns the status, X-Cache-Version and decoded event.
+	- TestLongPoll: Tests immediate answers, waiting for writes, deletes and expiry, and timing out.
+*/
+
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func longPoll(t *testing.T, srv *httptest.Server, key, query string) (int, int64, changeEvent) {
+	resp, err := http.Get(srv.URL + "/kv/" + key + "/watch?" + query)
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	var ev changeEvent
+	if resp.StatusCode == 200 {
+		if err := json.NewDecoder(resp.Body).Decode(&ev); err != nil { t.Fatal(err) }
+	}
+	io.Copy(io.Discard, resp.Body)
+	version, _ := strconv.ParseInt(resp.Header.Get(versionHeader), 10, 64)
+	return resp.StatusCode, version, ev
+}
+
+func TestLongPoll(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	put := func(key, value, query string) {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key+"?"+query, strings.NewReader(value))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+	}
+	after := func(d time.Duration, f func()) { go func() { time.Sleep(d); f() }() }
+
+	if code, v, _ := longPoll(t, srv, "k", "timeout=20ms"); code != 304 || v != 0 {
+		t.Fatalf("poll of a missing key: %d, version %d", code, v)
+	}
+	put("k", "a", "")
+	code, v1, ev := longPoll(t, srv, "k", "")
+	if code != 200 || ev.Type != "set" || string(ev.Value) != "a" || ev.Version != v1 || v1 == 0 {
+		t.Fatalf("first poll: %d %+v, version %d", code, ev, v1)
+	}
+	if code, v, _ := longPoll(t, srv, "k", "since="+strconv.FormatInt(v1, 10)+"&timeout=20ms"); code != 304 || v != v1 {
+		t.Fatalf("poll without a change: %d, version %d", code, v)
+	}
+
+	after(20*time.Millisecond, func() { put("k", "b", "") })
+	code, v2, ev := longPoll(t, srv, "k", "since="+strconv.FormatInt(v1, 10))
+	if code != 200 || string(ev.Value) != "b" || v2 <= v1 {
+		t.Fatalf("poll across a write: %d %+v, version %d", code, ev, v2)
+	}
+	after(20*time.Millisecond, func() {
+		req, _ := http.NewRequest("DELETE", srv.URL+"/kv/k", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil { resp.Body.Close() }
+	})
+	if code, v3, ev := longPoll(t, srv, "k", "since="+strconv.FormatInt(v2, 10)); code != 200 || ev.Type != "del" || v3 <= v2 {
+		t.Fatalf("poll across a delete: %d %+v, version %d", code, ev, v3)
+	}
+
+	// A key expiring while a poll waits is reported with its version.
+	put("e", "x", "ttl=30ms")
+	_, ve, _ := longPoll(t, srv, "e", "")
+	after(60*time.Millisecond, n.runJanitor)
+	if code, v, ev := longPoll(t, srv, "e", "since="+strconv.FormatInt(ve, 10)); code != 200 || ev.Type != "expire" || v != ve {
+		t.Fatalf("poll across expiry: %d %+v, version %d", code, ev, v)
+	}
+
+	// A key named "watch" is still read by plain GETs.
+	put("watch", "w", "")
+	resp, err := http.Get(srv.URL + "/kv/watch")
+	if err != nil { t.Fatal(err) }
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "w" {
+		t.Fatalf("GET /kv/watch = %q", body)
+	}
+	if code, _, _ := longPoll(t, srv, "k", "since=-1"); code != 400 {
+		t.Fatalf("negative since: %d", code)
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a listener for the memcached text protocol, so applications using memcached
+clients can be pointed at the cluster without code changes. ServeMemcache answers get (with any
+number of keys), set, add, replace, delete and touch on the same store as /kv, plus version,
+verbosity and quit. Storage commands and touch take memcached's expiration times: 0 for none, up to
+30 days in seconds, otherwise a Unix time, with a negative or past time expiring the item at once.
+The client flags of set, add and replace are kept with the item and replicated, since clients use
+them to tell how a value was serialized; values written over HTTP or RESP have flags 0.
+
+Keyed commands go through the same checks as /kv requests (see wireproto.go): get counts as a GET,
+delete as a DELETE and the others as PUTs. The text protocol has no AUTH command, so on a node with
+authentication the client logs in as memcached does with text-protocol authentication: its first
+set carries "username password" as the value, the password being an API key or bearer token and the
+user name being ignored. Until then every other command is answered "CLIENT_ERROR unauthenticated".
+
+Keys follow memcached's rules (at most 250 bytes, no spaces or control characters) and may not
+contain "/". add and replace are checked against this node's copy, as NX and XX are over RESP.
+flush_all and the cas commands are not supported: the first would wipe the whole cluster and the
+others need a compare-and-swap the replication model cannot offer.
+
+Functions:
+- (*Node) ServeMemcache(ctx context.Context, ln net.Listener): error
+- (*mcConn) serve(ctx context.Context)
+- (*mcConn) exec(ctx context.Context, args []string): bool
+- (*mcConn) get(ctx context.Context, keys []string)
+- (*mcConn) store(ctx context.Context, args []string): bool
+- (*mcConn) auth(data []byte): string
+- (*mcConn) call(ctx context.Context, method, key string, run func(r *http.Request) string): string
+- validMCKey(key string): bool
+- mcExpiry(exptime int64, now time.Time): (time.Time, bool)
+- (*Node) mcStore(r *http.Request, key, cmd string, flags uint32, exptime int64, data []byte): string
+- (*Node) mcTouch(r *http.Request, key string, exptime int64): string
+- (*Node) mcDelete(r *http.Request, key string): string
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mcMaxKey = 250
+	// mcMaxRelative is the largest expiration time taken as relative; larger
+	// ones are Unix times.
+	mcMaxRelative = 30 * 24 * 60 * 60
+	mcBadFormat   = "CLIENT_ERROR bad command line format"
+)
+
+// ServeMemcache serves memcached clients on ln until ctx is done, then closes
+// ln and every open connection.
+func (n *Node) ServeMemcache(ctx context.Context, ln net.Listener) error {
+	return n.serveConns(ctx, ln, "memcached", func(ctx context.Context, c *wireConn) {
+		(&mcConn{c}).serve(ctx)
+	})
+}
+
+type mcConn struct {
+	*wireConn
+}
+
+func (c *mcConn) serve(ctx context.Context) {
+	c.n.metrics.mcConns.Add(1)
+	defer c.n.metrics.mcConns.Add(-1)
+	for {
+		c.conn.SetDeadline(time.Now().Add(wireIdleTimeout))
+		line, err := c.readLine()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			}
+			return
+		}
+		c.n.metrics.mcCommands.Add(1)
+		quit := c.exec(ctx, strings.Fields(string(line)))
+		if quit || c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// exec runs one command, writing its reply; it returns true to close the
+// connection.
+func (c *mcConn) exec(ctx context.Context, args []string) bool {
+	if len(args) == 0 {
+		c.w.WriteString("ERROR\r\n")
+		return false
+	}
+	reply := ""
+	switch cmd := args[0]; cmd {
+	case "get":
+		if len(args) < 2 {
+			reply = "ERROR"
+			break
+		}
+		c.get(ctx, args[1:])
+		return false
+	case "set", "add", "replace":
+		return c.store(ctx, args)
+	case "delete", "touch":
+		noreply := args[len(args)-1] == "noreply"
+		if noreply {
+			args = args[:len(args)-1]
+		}
+		switch {
+		case cmd == "delete" && (len(args) == 2 || len(args) == 3 && args[2] == "0"):
+			reply = c.call(ctx, http.MethodDelete, args[1], func(r *http.Request) string {
+				return c.n.mcDelete(r, args[1])
+			})
+		case cmd == "touch" && len(args) == 3:
+			exptime, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				reply = mcBadFormat
+				break
+			}
+			reply = c.call(ctx, http.MethodPut, args[1], func(r *http.Request) string {
+				return c.n.mcTouch(r, args[1], exptime)
+			})
+		default:
+			reply = mcBadFormat
+		}
+		if noreply {
+			return false
+		}
+	case "version":
+		reply = "VERSION " + Build().Version
+	case "verbosity":
+		reply = "OK"
+	case "quit":
+		return true
+	default:
+		reply = "ERROR"
+	}
+	c.w.WriteString(reply + "\r\n")
+	return false
+}
+
+// get answers "get KEY...": a VALUE block for each key found, then END.
+// Values are collected first, so that a refused key leaves only its error.
+func (c *mcConn) get(ctx context.Context, keys []string) {
+	items := make([]Item, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		reply := c.call(ctx, http.MethodGet, key, func(r *http.Request) string {
+			it, ok, err := c.n.wireGet(r, key)
+			if err != nil {
+				return "SERVER_ERROR " + err.Error()
+			}
+			items[i], found[i] = it, ok
+			return ""
+		})
+		if reply != "" {
+			c.w.WriteString(reply + "\r\n")
+			return
+		}
+	}
+	for i, key := range keys {
+		if found[i] {
+			fmt.Fprintf(c.w, "VALUE %s %d %d\r\n", key, items[i].Flags, len(items[i].Value))
+			c.w.Write(items[i].Value)
+			c.w.WriteString("\r\n")
+		}
+	}
+	c.w.WriteString("END\r\n")
+}
+
+// store answers "set|add|replace KEY FLAGS EXPTIME BYTES [noreply]", reading
+// the data block that follows. It returns true when the connection cannot
+// continue because the data block could not be found.
+func (c *mcConn) store(ctx context.Context, args []string) bool {
+	noreply := len(args) == 6 && args[5] == "noreply"
+	if len(args) != 5 && !noreply {
+		c.w.WriteString(mcBadFormat + "\r\n")
+		return true
+	}
+	key, cmd := args[1], args[0]
+	flags, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	size, err3 := strconv.ParseInt(args[4], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		c.w.WriteString(mcBadFormat + "\r\n")
+		return true
+	}
+	anonymous := c.n.Auth != nil && c.token == ""
+	if anonymous && size > wireMaxAnonymous {
+		c.w.WriteString("CLIENT_ERROR unauthenticated\r\n")
+		return true
+	}
+	if size > c.n.wireMaxValue() {
+		if _, err := io.CopyN(io.Discard, c.r, size+2); err != nil {
+			return true
+		}
+		c.w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return false
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return true
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		c.w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return true
+	}
+	data = data[:size]
+	var reply string
+	switch {
+	case anonymous && cmd == "set":
+		reply = c.auth(data)
+	case anonymous:
+		reply = "CLIENT_ERROR unauthenticated"
+	default:
+		reply = c.call(ctx, http.MethodPut, key, func(r *http.Request) string {
+			return c.n.mcStore(r, key, cmd, uint32(flags), exptime, data)
+		})
+	}
+	if !noreply {
+		c.w.WriteString(reply + "\r\n")
+	}
+	return false
+}
+
+// auth logs in with the "username password" data of a client's first set.
+func (c *mcConn) auth(data []byte) string {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "CLIENT_ERROR authentication failure"
+	}
+	if wait, ok := c.login(fields[len(fields)-1]); !ok {
+		if wait > 0 {
+			return fmt.Sprintf("CLIENT_ERROR too many failed authentications; retry in %ds", int((wait+time.Second-1)/time.Second))
+		}
+		return "CLIENT_ERROR authentication failure"
+	}
+	return "STORED"
+}
+
+// call runs a command on key through wireChain, returning run's reply or the
+// error for the check that refused it.
+func (c *mcConn) call(ctx context.Context, method, key string, run func(r *http.Request) string) string {
+	if !validMCKey(key) {
+		return mcBadFormat
+	}
+	var reply string
+	rej := c.wireConn.call(ctx, method, key, func(r *http.Request) { reply = run(r) })
+	switch {
+	case rej == nil:
+		return reply
+	case rej.status == http.StatusUnauthorized:
+		return "CLIENT_ERROR unauthenticated"
+	case rej.status < 500 && rej.status != http.StatusTooManyRequests:
+		return "CLIENT_ERROR " + rej.message()
+	}
+	return "SERVER_ERROR " + rej.message()
+}
+
+func validMCKey(key string) bool {
+	if key == "" || len(key) > mcMaxKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if b := key[i]; b <= ' ' || b == 0x7f || b == '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// mcExpiry converts a memcached expiration time to an expiry (zero for none),
+// reporting whether it has already passed.
+func mcExpiry(exptime int64, now time.Time) (time.Time, bool) {
+	switch {
+	case exptime == 0:
+		return time.Time{}, false
+	case exptime < 0:
+		return now, true
+	case exptime <= mcMaxRelative:
+		return now.Add(time.Duration(exptime) * time.Second), false
+	}
+	at := time.Unix(exptime, 0)
+	return at, !at.After(now)
+}
+
+func (n *Node) mcStore(r *http.Request, key, cmd string, flags uint32, exptime int64, data []byte) string {
+	if err := n.checkKey(r, key); err != nil {
+		return "CLIENT_ERROR " + err.Error()
+	}
+	now := n.now()
+	_, exists := n.store.GetLive(key, now)
+	if cmd == "add" && exists || cmd == "replace" && !exists {
+		return "NOT_STORED"
+	}
+	expiresAt, expired := mcExpiry(exptime, now)
+	if expired {
+		if exists {
+			if reply := n.mcDelete(r, key); reply != "DELETED" {
+				return reply
+			}
+		}
+		return "STORED"
+	}
+	it := n.newItem(key, data, 0)
+	it.ExpiresAt, it.Flags = expiresAt, flags
+	if _, _, err := n.wireWrite(r, key, "set", it, 0, false); err != nil {
+		return "SERVER_ERROR " + err.Error()
+	}
+	return "STORED"
+}
+
+// mcTouch rewrites key's expiry as a new version.
+func (n *Node) mcTouch(r *http.Request, key string, exptime int64) string {
+	now := n.now()
+	it, ok := n.store.GetLive(key, now)
+	if !ok {
+		return "NOT_FOUND"
+	}
+	expiresAt, expired := mcExpiry(exptime, now)
+	if expired {
+		if reply := n.mcDelete(r, key); reply != "DELETED" {
+			return reply
+		}
+		return "TOUCHED"
+	}
+	it.Version, it.Origin, it.ExpiresAt = n.versions.next(now), n.ID, expiresAt
+	if _, _, err := n.wireWrite(r, key, "set", it, 0, false); err != nil {
+		return "SERVER_ERROR " + err.Error()
+	}
+	return "TOUCHED"
+}
+
+func (n *Node) mcDelete(r *http.Request, key string) string {
+	if _, ok := n.store.GetLive(key, n.now()); !ok {
+		return "NOT_FOUND"
+	}
+	if _, _, err := n.wireWrite(r, key, "del", Item{Version: n.versions.next(n.now()), Origin: n.ID, Tombstone: true}, 0, false); err != nil {
+		return "SERVER_ERROR " + err.Error()
+	}
+	return "DELETED"
+}
@@ -0,0 +1,183 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the memcached text protocol listener.
+
+List of functions:
+	- startMemcache: Serves a node's memcached listener on a loopback port and returns a connected client.
+	- TestMemcacheCommands: Tests get, set, add, replace, delete and touch, client flags, expiration times and replication.
+	- TestMemcacheAuth: Tests text-protocol authentication and that roles apply to memcached commands.
+	- TestMCExpiry: Tests the conversion of memcached expiration times.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mcClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startMemcache(t *testing.T, n *Node) *mcClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- n.ServeMemcache(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeMemcache: %v", err)
+		}
+	})
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil { t.Fatal(err) }
+	return &mcClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends raw and returns the reply: everything up to END for get, else one
+// line. Lines are joined with "|" and stripped of their CRLF.
+func (c *mcClient) do(raw string) string {
+	if _, err := io.WriteString(c.conn, raw); err != nil { c.t.Fatal(err) }
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var lines []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil { c.t.Fatal(err) }
+		line = strings.TrimSuffix(line, "\r\n")
+		lines = append(lines, line)
+		if !strings.Contains(raw, "get ") || line == "END" || strings.Contains(line, "ERROR") {
+			return strings.Join(lines, "|")
+		}
+	}
+}
+
+func TestMemcacheCommands(t *testing.T) {
+	peer := NewNode("N2", ":y", nil)
+	peer.AccessLog = false
+	srv := httptest.NewServer(peer.Routes())
+	defer srv.Close()
+	n := NewNode("N1", ":x", []string{srv.URL})
+	c := startMemcache(t, n)
+
+	for _, tc := range []struct{ send, want string }{
+		{"get k\r\n", "END"},
+		{"set k 42 0 5\r\nhello\r\n", "STORED"},
+		{"get k\r\n", "VALUE k 42 5|hello|END"},
+		{"add k 0 0 1\r\nx\r\n", "NOT_STORED"},
+		{"replace other 0 0 1\r\nx\r\n", "NOT_STORED"},
+		{"add other 7 100 2\r\nhi\r\n", "STORED"},
+		{"replace k 3 0 3\r\nbye\r\n", "STORED"},
+		{"get k missing other\r\n", "VALUE k 3 3|bye|VALUE other 7 2|hi|END"},
+		{"touch k 100\r\n", "TOUCHED"},
+		{"touch missing 100\r\n", "NOT_FOUND"},
+		{"delete other\r\n", "DELETED"},
+		{"delete other\r\n", "NOT_FOUND"},
+		{"set gone 0 -1 1\r\nx\r\n", "STORED"},
+		{"get gone\r\n", "END"},
+		{"set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", "VALUE quiet 0 1|q|END"},
+		{"set a/b 0 0 1\r\nx\r\n", mcBadFormat},
+		{"get " + strings.Repeat("k", mcMaxKey+1) + "\r\n", mcBadFormat},
+		{"flush_all\r\n", "ERROR"},
+		{"version\r\n", "VERSION " + Build().Version},
+	} {
+		if got := c.do(tc.send); got != tc.want {
+			t.Fatalf("%q = %q, want %q", tc.send, got, tc.want)
+		}
+	}
+	if it, ok := n.Store().GetLive("k", time.Now()); !ok || it.ExpiresAt.IsZero() || it.Flags != 3 {
+		t.Fatalf("k after touch: %+v", it)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		it, ok := peer.Store().GetLive("k", time.Now())
+		if ok && string(it.Value) == "bye" && it.Flags == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("memcached write not replicated with its flags: %+v", it)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A data block without its CRLF closes the connection.
+	if got := c.do("set k 0 0 1\r\nxyz\r\n"); got != "CLIENT_ERROR bad data chunk" {
+		t.Fatalf("bad data chunk = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection open after bad data chunk")
+	}
+}
+
+func TestMemcacheAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("rkey", "reader", RoleRead)
+	keys.Add("wkey", "writer", RoleWrite)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	c := startMemcache(t, n)
+
+	for _, tc := range []struct{ send, want string }{
+		{"get k\r\n", "CLIENT_ERROR unauthenticated"},
+		{"add k 0 0 1\r\nx\r\n", "CLIENT_ERROR unauthenticated"},
+		{"set auth 0 0 9\r\nuser nope\r\n", "CLIENT_ERROR authentication failure"},
+		{"set auth 0 0 9\r\nuser rkey\r\n", "STORED"},
+		{"get k\r\n", "END"},
+		{"set k 0 0 1\r\nx\r\n", "CLIENT_ERROR reader needs the write role"},
+	} {
+		if got := c.do(tc.send); got != tc.want {
+			t.Fatalf("%q = %q, want %q", tc.send, got, tc.want)
+		}
+	}
+
+	w := startMemcache(t, n)
+	for _, tc := range []struct{ send, want string }{
+		{"set auth 0 0 9\r\nuser wkey\r\n", "STORED"},
+		{"set k 0 0 1\r\nx\r\n", "STORED"},
+		{"get k\r\n", "VALUE k 0 1|x|END"},
+	} {
+		if got := w.do(tc.send); got != tc.want {
+			t.Fatalf("%q = %q, want %q", tc.send, got, tc.want)
+		}
+	}
+	if recs := n.auditLog.query(AuditQuery{Key: "k"}); len(recs) != 1 || recs[0].Principal != "writer" {
+		t.Fatalf("audit records: %+v", recs)
+	}
+}
+
+func TestMCExpiry(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	for _, tc := range []struct {
+		exptime int64
+		want    time.Time
+		expired bool
+	}{
+		{0, time.Time{}, false},
+		{-1, now, true},
+		{60, now.Add(time.Minute), false},
+		{mcMaxRelative, now.Add(30 * 24 * time.Hour), false},
+		{1_800_000_600, time.Unix(1_800_000_600, 0), false},
+		{1_700_000_000, time.Unix(1_700_000_000, 0), true},
+	} {
+		got, expired := mcExpiry(tc.exptime, now)
+		if !got.Equal(tc.want) || expired != tc.expired {
+			t.Errorf("mcExpiry(%d) = %v, %v; want %v, %v", tc.exptime, got, expired, tc.want, tc.expired)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the Prometheus /metrics endpoint. Counters are plain atomics updated on
+the request and replication paths (so recording never allocates) and are rendered in the
+Prometheus text exposition format on scrape, together with gauges read from the Store,
+the replication queues, the outbox and the peer set. HTTP latency is recorded per route in
+fixed-bucket histograms, and requests are counted per route and status code; both are
+recorded by the logging middleware.
+
+Functions:
+- (*histogram) observe(d time.Duration)
+- routeOf(r *http.Request): int
+- (*nodeMetrics) observeHTTP(route, status int, d time.Duration)
+- (*Node) peerStats(peer string): *peerStats
+- (*Node) recordSend(peer string, msgs []SyncMsg, d time.Duration, err error)
+- (*Node) PeerHealth(): []PeerHealth
+- (*Node) handleMetrics(w http.ResponseWriter, r *http.Request)
+- (*promWriter) metric/histogram: text format helpers
+*/
+
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the histogram upper bounds in seconds.
+var latencyBuckets = [...]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	counts [len(latencyBuckets) + 1]atomic.Uint64 // last is +Inf
+	sumNs  atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets[:], s)
+	h.counts[i].Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+const (
+	routeGet = iota
+	routePut
+	routeDelete
+	routeSync
+	routeHealth
+	routeAdmin
+	routeOther
+	numRoutes
+)
+
+var routeNames = [numRoutes]string{"get", "put", "delete", "sync", "health", "admin", "other"}
+
+func routeOf(r *http.Request) int {
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/kv/"):
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			return routeGet
+		case http.MethodPut:
+			return routePut
+		case http.MethodDelete:
+			return routeDelete
+		}
+	case strings.HasPrefix(p, "/sync"):
+		return routeSync
+	case p == "/health":
+		return routeHealth
+	case strings.HasPrefix(p, "/admin/"):
+		return routeAdmin
+	}
+	return routeOther
+}
+
+// nodeMetrics are the Node's own counters; store-level ones live in StoreStats.
+type nodeMetrics struct {
+	hits, misses, sets, deletes atomic.Uint64
+	keysRejected                atomic.Uint64 // sync sets dropped by KeyRules
+	sigRejected                 atomic.Uint64 // sync messages failing signature checks
+	authFailures, authThrottled atomic.Uint64 // see auththrottle.go
+	authBans                    atomic.Uint64
+	policyDenied, policyErrors  atomic.Uint64 // see policy.go
+	sessionProxied              atomic.Uint64 // reads served from a peer's copy (see session.go)
+	sessionFailed               atomic.Uint64
+	respConns                   atomic.Int64 // see resp.go
+	respCommands                atomic.Uint64
+	mcConns                     atomic.Int64 // see memcache.go
+	mcCommands                  atomic.Uint64
+	grpcCalls                   atomic.Uint64 // see grpc.go
+	grpcErrors                  atomic.Uint64
+	grpcWatchers                atomic.Int64
+	wsWatchers                  atomic.Int64 // see websocket.go
+	sseStreams                  atomic.Int64 // see changefeed.go
+	webhookDelivered            atomic.Int64 // see webhooks.go
+	webhookFailed               atomic.Int64
+	webhookGaps                 atomic.Int64
+	cdcPublished                atomic.Int64 // see cdc.go
+	cdcErrors                   atomic.Int64
+	cdcGaps                     atomic.Int64
+	natsPublished               atomic.Int64 // see nats.go
+	natsReceived                atomic.Int64
+	pubsubPublished             atomic.Int64 // see pubsub.go
+	pubsubDelivered             atomic.Int64
+	pubsubDropped               atomic.Int64
+	bridgeApplied               atomic.Int64 // see bridge.go
+	bridgeStale                 atomic.Int64
+	bridgeGaps                  atomic.Int64
+	bridgeConnected             atomic.Int64
+	bridgeLag                   atomic.Int64 // nanoseconds, at the last bridged event
+	http                        [numRoutes]histogram
+	status                      [numRoutes][500]atomic.Uint64 // by route, then status code - 100
+
+	janitor           histogram // duration of each janitor run
+	janitorLastReaped atomic.Uint64
+}
+
+// peerStats counts replication outcomes and heartbeat state for one peer.
+type peerStats struct {
+	acks, fails atomic.Uint64
+	up          atomic.Bool
+	consecutive atomic.Int64 // bumpFail's failure count
+	lastOK      atomic.Int64 // unix nanoseconds of the last acknowledged send
+	latencyNs   atomic.Int64 // summed over acknowledged sends
+	sends       atomic.Uint64
+	bytes       atomic.Uint64 // value bytes acknowledged
+}
+
+// PeerHealth is a snapshot of replication to one peer. Peers that bumpFail
+// removed from the replication set are still reported, with Active false.
+type PeerHealth struct {
+	Peer                string        `json:"peer"`
+	Active              bool          `json:"active"`
+	Up                  bool          `json:"up"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	LastSuccess         time.Time     `json:"last_success"`
+	AvgLatency          time.Duration `json:"avg_latency"`
+	Acks                uint64        `json:"acks"`
+	Failures            uint64        `json:"failures"`
+	BytesReplicated     uint64        `json:"bytes_replicated"`
+	QueueDepth          int           `json:"queue_depth"`
+
+	// Heartbeat round-trip times over the last 256 successful heartbeats;
+	// zero until latencyMinSamples have been recorded.
+	HeartbeatRTTMin time.Duration `json:"heartbeat_rtt_min"`
+	HeartbeatRTTAvg time.Duration `json:"heartbeat_rtt_avg"`
+	HeartbeatRTTP99 time.Duration `json:"heartbeat_rtt_p99"`
+}
+
+func (n *Node) peerStats(peer string) *peerStats {
+	if v, ok := n.peerMetrics.Load(peer); ok {
+		return v.(*peerStats)
+	}
+	v, _ := n.peerMetrics.LoadOrStore(peer, new(peerStats))
+	return v.(*peerStats)
+}
+
+// recordSend updates peer's stats after a send of msgs that took d.
+func (n *Node) recordSend(peer string, msgs []SyncMsg, d time.Duration, err error) {
+	ps := n.peerStats(peer)
+	if err != nil {
+		ps.fails.Add(uint64(len(msgs)))
+		return
+	}
+	var size int
+	for i := range msgs {
+		size += len(msgs[i].Value)
+	}
+	ps.acks.Add(uint64(len(msgs)))
+	ps.bytes.Add(uint64(size))
+	ps.sends.Add(1)
+	ps.latencyNs.Add(int64(d))
+	ps.lastOK.Store(time.Now().UnixNano())
+}
+
+// PeerHealth reports every peer the node has replicated to or checked, sorted by address.
+func (n *Node) PeerHealth() []PeerHealth {
+	active := make(map[string]bool)
+	for _, p := range n.activePeers() {
+		active[p] = true
+	}
+	var out []PeerHealth
+	n.peerMetrics.Range(func(k, v any) bool {
+		p, ps := k.(string), v.(*peerStats)
+		h := PeerHealth{
+			Peer:                p,
+			Active:              active[p],
+			Up:                  ps.up.Load(),
+			ConsecutiveFailures: int(ps.consecutive.Load()),
+			Acks:                ps.acks.Load(),
+			Failures:            ps.fails.Load(),
+			BytesReplicated:     ps.bytes.Load(),
+			QueueDepth:          n.queueDepth(p),
+		}
+		if ns := ps.lastOK.Load(); ns != 0 {
+			h.LastSuccess = time.Unix(0, ns)
+		}
+		if sends := ps.sends.Load(); sends > 0 {
+			h.AvgLatency = time.Duration(ps.latencyNs.Load() / int64(sends))
+		}
+		if w, ok := n.hbRTT.Load(p); ok {
+			h.HeartbeatRTTMin, h.HeartbeatRTTAvg, h.HeartbeatRTTP99, _ = w.(*latencyWindow).summary()
+		}
+		out = append(out, h)
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out
+}
+
+// observeHTTP records one finished request. Status codes outside 100-599
+// are counted as 599.
+func (m *nodeMetrics) observeHTTP(route, status int, d time.Duration) {
+	m.http[route].observe(d)
+	if status < 100 || status > 599 {
+		status = 599
+	}
+	m.status[route][status-100].Add(1)
+}
+
+func (n *Node) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	pw := &promWriter{w: bufio.NewWriter(w)}
+	defer pw.w.Flush()
+
+	m := &n.metrics
+	st := n.store.Stats()
+	pw.metric("cache_hits_total", "counter", "GETs served from the store or loader.", float64(m.hits.Load()))
+	pw.metric("cache_misses_total", "counter", "GETs that found no value.", float64(m.misses.Load()))
+	pw.metric("cache_sets_total", "counter", "Client writes applied.", float64(m.sets.Load()))
+	pw.metric("cache_deletes_total", "counter", "Client deletes applied.", float64(m.deletes.Load()))
+	pw.metric("cache_keys_rejected_total", "counter", "Replicated writes dropped because their key broke the key rules.", float64(m.keysRejected.Load()))
+	pw.metric("cache_auth_failures_total", "counter", "Requests refused for missing or bad credentials.", float64(m.authFailures.Load()))
+	pw.metric("cache_auth_throttled_total", "counter", "Requests refused with 429 while their source was locked out after failed authentications.", float64(m.authThrottled.Load()))
+	pw.metric("cache_auth_bans_total", "counter", "Sources banned for repeated authentication failures.", float64(m.authBans.Load()))
+	pw.metric("cache_key_policy_denied_total", "counter", "Key requests refused with 403 by the key policy hook.", float64(m.policyDenied.Load()))
+	pw.metric("cache_resp_connections", "gauge", "Open RESP (Redis protocol) connections.", float64(m.respConns.Load()))
+	pw.metric("cache_resp_commands_total", "counter", "Commands received on RESP connections.", float64(m.respCommands.Load()))
+	pw.metric("cache_memcache_connections", "gauge", "Open memcached protocol connections.", float64(m.mcConns.Load()))
+	pw.metric("cache_memcache_commands_total", "counter", "Commands received on memcached protocol connections.", float64(m.mcCommands.Load()))
+	pw.metric("cache_grpc_calls_total", "counter", "gRPC calls received.", float64(m.grpcCalls.Load()))
+	pw.metric("cache_grpc_errors_total", "counter", "gRPC calls that ended with a status other than OK.", float64(m.grpcErrors.Load()))
+	pw.metric("cache_grpc_watchers", "gauge", "Open gRPC Watch streams.", float64(m.grpcWatchers.Load()))
+	pw.metric("cache_websocket_watchers", "gauge", "Open /watch WebSocket connections.", float64(m.wsWatchers.Load()))
+	pw.metric("cache_changefeed_streams", "gauge", "Open /changes event streams.", float64(m.sseStreams.Load()))
+	pw.metric("cache_webhook_events_delivered_total", "counter", "Change events delivered to webhooks.", float64(m.webhookDelivered.Load()))
+	pw.metric("cache_webhook_events_failed_total", "counter", "Change events in webhook batches given up on after retries or a rejection.", float64(m.webhookFailed.Load()))
+	pw.metric("cache_webhook_gaps_total", "counter", "Times a webhook fell behind further than the changefeed keeps and missed events.", float64(m.webhookGaps.Load()))
+	pw.metric("cache_cdc_records_published_total", "counter", "Change records published to Kafka.", float64(m.cdcPublished.Load()))
+	pw.metric("cache_cdc_errors_total", "counter", "Failed attempts to publish a batch of change records to Kafka.", float64(m.cdcErrors.Load()))
+	pw.metric("cache_cdc_gaps_total", "counter", "Times CDC fell behind further than the changefeed keeps and missed changes.", float64(m.cdcGaps.Load()))
+	pw.metric("cache_nats_published_total", "counter", "Sync publications sent over NATS.", float64(m.natsPublished.Load()))
+	pw.metric("cache_nats_received_total", "counter", "Sync publications received over NATS.", float64(m.natsReceived.Load()))
+	pw.metric("cache_pubsub_published_total", "counter", "Messages published on channels at this node.", float64(m.pubsubPublished.Load()))
+	pw.metric("cache_pubsub_delivered_total", "counter", "Channel messages delivered to subscribers on this node, from any node.", float64(m.pubsubDelivered.Load()))
+	pw.metric("cache_pubsub_dropped_total", "counter", "Channel messages not relayed to a peer, because the relay queue was full or the send failed.", float64(m.pubsubDropped.Load()))
+	pw.metric("cache_pubsub_subscribers", "gauge", "Open channel subscriptions (SSE streams and RESP connections).", float64(n.pubsub.count.Load()))
+	pw.metric("cache_bridge_applied_total", "counter", "Writes from a remote cluster applied here and replicated to the peers.", float64(m.bridgeApplied.Load()))
+	pw.metric("cache_bridge_stale_total", "counter", "Writes from a remote cluster not applied because a newer version was stored.", float64(m.bridgeStale.Load()))
+	pw.metric("cache_bridge_gaps_total", "counter", "Times the remote cluster's feed had dropped events the bridge had not seen.", float64(m.bridgeGaps.Load()))
+	pw.metric("cache_bridge_connected", "gauge", "Cross-cluster feeds this node is following.", float64(m.bridgeConnected.Load()))
+	pw.metric("cache_bridge_lag_seconds", "gauge", "Age of the last bridged write when it was applied here.", float64(m.bridgeLag.Load())/1e9)
+	pw.metric("cache_session_reads_proxied_total", "counter", "Session reads answered with a newer copy fetched from the node that took the write.", float64(m.sessionProxied.Load()))
+	pw.metric("cache_session_reads_failed_total", "counter", "Session reads refused with 503 because a node holding the session's writes was unreachable.", float64(m.sessionFailed.Load()))
+	pw.metric("cache_key_policy_errors_total", "counter", "Key requests refused with 503 because the key policy hook failed.", float64(m.policyErrors.Load()))
+	pw.metric("cache_auth_banned_sources", "gauge", "Sources currently banned.", float64(n.authFails.banned(time.Now())))
+	pw.metric("cache_sync_signature_rejected_total", "counter", "Sync messages refused for a missing or bad signature.", float64(m.sigRejected.Load()))
+	pw.metric("cache_evictions_total", "counter", "Entries evicted to stay within memory limits.", float64(st.Evictions))
+	pw.metric("cache_expirations_total", "counter", "Entries removed after their TTL.", float64(st.Expirations))
+	pw.metric("cache_keys", "gauge", "Entries in the store, including tombstones.", float64(st.Keys))
+	pw.metric("cache_tombstones", "gauge", "Deleted entries kept until TombstoneTTL.", float64(st.Tombstones))
+	pw.metric("cache_tombstones_reaped_total", "counter", "Tombstones dropped after TombstoneTTL.", float64(st.TombstonesReaped))
+	pw.metric("cache_janitor_last_tombstones_reaped", "gauge", "Tombstones dropped by the most recent janitor run.", float64(m.janitorLastReaped.Load()))
+	oldest := 0.0
+	if at, ok := n.store.OldestTombstone(); ok {
+		oldest = n.now().Sub(at).Seconds()
+	}
+	pw.metric("cache_oldest_tombstone_age_seconds", "gauge", "Age of the oldest tombstone still held (0 if none).", oldest)
+	pw.header("cache_janitor_duration_seconds", "histogram", "Duration of janitor expiry runs.")
+	pw.histogram("cache_janitor_duration_seconds", "", &m.janitor)
+	pw.metric("cache_bytes", "gauge", "Estimated store size in bytes.", float64(st.Bytes))
+	pw.metric("cache_replication_queue_depth", "gauge", "Sync messages waiting for peer workers.", float64(n.totalQueueDepth()))
+	pw.metric("cache_hints_pending", "gauge", "Undelivered sync messages in the outbox.", float64(n.outbox.Len()))
+	pw.metric("cache_peers_active", "gauge", "Peers currently in the replication set.", float64(len(n.activePeers())))
+
+	peers := n.PeerHealth()
+	perPeer := func(name, typ, help string, value func(h *PeerHealth) float64) {
+		pw.header(name, typ, help)
+		for i := range peers {
+			pw.sample(name, `peer="`+escapeLabel(peers[i].Peer)+`"`, value(&peers[i]))
+		}
+	}
+	perPeer("cache_replication_acks_total", "counter", "Sync messages acknowledged, by peer.",
+		func(h *PeerHealth) float64 { return float64(h.Acks) })
+	perPeer("cache_replication_failures_total", "counter", "Sync messages that failed, by peer.",
+		func(h *PeerHealth) float64 { return float64(h.Failures) })
+	perPeer("cache_replication_bytes_total", "counter", "Value bytes acknowledged, by peer.",
+		func(h *PeerHealth) float64 { return float64(h.BytesReplicated) })
+	perPeer("cache_replication_latency_avg_seconds", "gauge", "Mean latency of acknowledged sync calls, by peer.",
+		func(h *PeerHealth) float64 { return h.AvgLatency.Seconds() })
+	perPeer("cache_peer_queue_depth", "gauge", "Sync messages waiting for the peer's workers.",
+		func(h *PeerHealth) float64 { return float64(h.QueueDepth) })
+	perPeer("cache_peer_consecutive_failures", "gauge", "Failed sends and heartbeats since the last success; the peer is dropped at the limit.",
+		func(h *PeerHealth) float64 { return float64(h.ConsecutiveFailures) })
+	perPeer("cache_peer_last_success_timestamp_seconds", "gauge", "Unix time of the last acknowledged sync call (0 if none).",
+		func(h *PeerHealth) float64 {
+			if h.LastSuccess.IsZero() {
+				return 0
+			}
+			return float64(h.LastSuccess.UnixNano()) / 1e9
+		})
+	perPeer("cache_peer_active", "gauge", "1 while the peer is in the replication set.",
+		func(h *PeerHealth) float64 { return b2f(h.Active) })
+	perPeer("cache_peer_up", "gauge", "1 if the last heartbeat to the peer succeeded.",
+		func(h *PeerHealth) float64 { return b2f(h.Up) })
+	perPeer("cache_peer_heartbeat_rtt_min_seconds", "gauge", "Fastest recent heartbeat round trip, by peer.",
+		func(h *PeerHealth) float64 { return h.HeartbeatRTTMin.Seconds() })
+	perPeer("cache_peer_heartbeat_rtt_avg_seconds", "gauge", "Mean recent heartbeat round trip, by peer.",
+		func(h *PeerHealth) float64 { return h.HeartbeatRTTAvg.Seconds() })
+	perPeer("cache_peer_heartbeat_rtt_p99_seconds", "gauge", "p99 recent heartbeat round trip, by peer.",
+		func(h *PeerHealth) float64 { return h.HeartbeatRTTP99.Seconds() })
+
+	if ns := n.store.NamespaceStats(); ns != nil {
+		names := make([]string, 0, len(ns))
+		for name := range ns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		perNS := func(metric, typ, help string, value func(s NamespaceStats) float64) {
+			pw.header(metric, typ, help)
+			for _, name := range names {
+				pw.sample(metric, `namespace="`+escapeLabel(name)+`"`, value(ns[name]))
+			}
+		}
+		perNS("cache_namespace_hits_total", "counter", "GETs served, by namespace.", func(s NamespaceStats) float64 { return float64(s.Hits) })
+		perNS("cache_namespace_misses_total", "counter", "GETs that found no value, by namespace.", func(s NamespaceStats) float64 { return float64(s.Misses) })
+		perNS("cache_namespace_evictions_total", "counter", "Entries evicted, by namespace.", func(s NamespaceStats) float64 { return float64(s.Evictions) })
+		perNS("cache_namespace_expirations_total", "counter", "Entries removed after their TTL, by namespace.", func(s NamespaceStats) float64 { return float64(s.Expirations) })
+		perNS("cache_namespace_keys", "gauge", "Entries in the store, by namespace.", func(s NamespaceStats) float64 { return float64(s.Keys) })
+		perNS("cache_namespace_bytes", "gauge", "Estimated store size in bytes, by namespace.", func(s NamespaceStats) float64 { return float64(s.Bytes) })
+	}
+
+	pw.header("cache_http_request_duration_seconds", "histogram", "HTTP request latency by route.")
+	for i := range m.http {
+		pw.histogram("cache_http_request_duration_seconds", `route="`+routeNames[i]+`"`, &m.http[i])
+	}
+	pw.header("cache_http_requests_total", "counter", "HTTP requests by route and status code.")
+	for i := range m.status {
+		for code := range m.status[i] {
+			if c := m.status[i][code].Load(); c > 0 {
+				pw.sample("cache_http_requests_total", `route="`+routeNames[i]+`",code="`+strconv.Itoa(code+100)+`"`, float64(c))
+			}
+		}
+	}
+}
+
+type promWriter struct {
+	w *bufio.Writer
+}
+
+func (p *promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (p *promWriter) sample(name, labels string, v float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	p.w.WriteString(name + " " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+}
+
+func (p *promWriter) metric(name, typ, help string, v float64) {
+	p.header(name, typ, help)
+	p.sample(name, "", v)
+}
+
+func (p *promWriter) histogram(name, labels string, h *histogram) {
+	var cum uint64
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	for i, le := range latencyBuckets {
+		cum += h.counts[i].Load()
+		p.sample(name+"_bucket", prefix+`le="`+strconv.FormatFloat(le, 'g', -1, 64)+`"`, float64(cum))
+	}
+	cum += h.counts[len(latencyBuckets)].Load()
+	p.sample(name+"_bucket", prefix+`le="+Inf"`, float64(cum))
+	p.sample(name+"_sum", labels, time.Duration(h.sumNs.Load()).Seconds())
+	p.sample(name+"_count", labels, float64(cum))
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
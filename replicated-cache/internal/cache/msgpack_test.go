@@ -0,0 +1,128 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the msgpack sync encoding and its negotiation with peers.
+
+List of functions:
+	- TestSyncMsgpackRoundTrip: Tests that SyncMsgs survive encode/decode, including binary values.
+	- TestSyncFallsBackToJSON: Tests that a peer answering 415 is sent JSON from then on.
+	- TestSyncFallsBackToJSONOn400: Tests that a node from before msgpack, which answers it with 400, is sent JSON.
+	- TestSyncBatchDecode: Tests that batches and single messages decode in both encodings.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSyncMsgpackRoundTrip(t *testing.T) {
+	exp := time.Unix(0, 1754800000123456789)
+	in := SyncMsg{Op: "set", Key: "k", Value: []byte{0, 1, 2, 0xff}, ExpiresAt: &exp, Version: 1754800000000000000, Origin: "N1", Flags: 0xdeadbeef}
+	out, err := decodeSyncMsgpack(in.appendMsgpack(nil))
+	if err != nil { t.Fatal(err) }
+	if out.Op != in.Op || out.Key != in.Key || !bytes.Equal(out.Value, in.Value) ||
+		out.Version != in.Version || out.Origin != in.Origin || !out.ExpiresAt.Equal(exp) || out.Flags != in.Flags {
+		t.Fatalf("round trip mismatch: %+v", out)
+	}
+
+	del, err := decodeSyncMsgpack(SyncMsg{Op: "del", Key: "k", Version: 2, Origin: "N1"}.appendMsgpack(nil))
+	if err != nil { t.Fatal(err) }
+	if del.ExpiresAt != nil || del.Op != "del" {
+		t.Fatalf("unexpected del decode: %+v", del)
+	}
+	if _, err := decodeSyncMsgpack([]byte{0x86, 0xa2, 'o'}); err == nil {
+		t.Fatal("truncated input should fail")
+	}
+}
+
+func TestSyncFallsBackToJSON(t *testing.T) {
+	var got []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Content-Type"))
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType); return
+		}
+		var msg SyncMsg
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(400); return
+		}
+		w.WriteHeader(204)
+	}))
+	defer peer.Close()
+
+	n := NewNode("N", ":x", nil)
+	msg := SyncMsg{Op: "set", Key: "k", Value: []byte("v"), Version: 1, Origin: "N"}
+	for i := 0; i < 2; i++ {
+		if err := n.sendSync(context.Background(), peer.URL, msg); err != nil { t.Fatal(err) }
+	}
+	want := []string{contentTypeMsgpack, "application/json", "application/json"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
+
+func TestSyncFallsBackToJSONOn400(t *testing.T) {
+	var got []string
+	// A baseline node: JSON only, and any body it cannot parse is a 400.
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Content-Type"))
+		var msg SyncMsg
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "bad json", 400); return
+		}
+		w.WriteHeader(204)
+	}))
+	defer old.Close()
+
+	n := NewNode("N", ":x", nil)
+	msg := SyncMsg{Op: "set", Key: "k", Value: []byte("v"), Version: 1, Origin: "N"}
+	for i := 0; i < 2; i++ {
+		if err := n.sendSync(context.Background(), old.URL, msg); err != nil { t.Fatal(err) }
+	}
+	want := []string{contentTypeMsgpack, "application/json", "application/json"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+
+	// A 400 from a node that takes msgpack is an answer about the message.
+	got = nil
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Content-Type"))
+		w.Header().Set(syncEncodingsHeader, contentTypeMsgpack+", application/json")
+		w.WriteHeader(400)
+	}))
+	defer peer.Close()
+	if err := n.sendSync(context.Background(), peer.URL, msg); err == nil {
+		t.Fatal("400 from a msgpack peer should be an error")
+	}
+	if len(got) != 1 || got[0] != contentTypeMsgpack {
+		t.Fatalf("msgpack peer sent %v", got)
+	}
+}
+
+func TestSyncBatchDecode(t *testing.T) {
+	msgs := []SyncMsg{{Op: "set", Key: "a", Value: []byte("1"), Version: 1}, {Op: "del", Key: "b", Version: 2}}
+	got, err := decodeSyncBatchMsgpack(appendSyncBatchMsgpack(nil, msgs))
+	if err != nil || len(got) != 2 || got[0].Key != "a" || got[1].Op != "del" {
+		t.Fatalf("msgpack batch: %+v, %v", got, err)
+	}
+	got, err = decodeSyncBatchMsgpack(appendSyncBatchMsgpack(nil, msgs[:1]))
+	if err != nil || len(got) != 1 || got[0].Key != "a" {
+		t.Fatalf("msgpack single: %+v, %v", got, err)
+	}
+	js, _ := json.Marshal(msgs)
+	got, err = decodeSyncBatchJSON(append([]byte("\n "), js...))
+	if err != nil || len(got) != 2 || got[1].Key != "b" {
+		t.Fatalf("json batch: %+v, %v", got, err)
+	}
+}
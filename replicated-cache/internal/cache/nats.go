@@ -0,0 +1,521 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements NATS as a replication transport, for clusters that already run NATS. With
+NATSLoop running, Replicate publishes each write once, msgpack-encoded, to a subject every node of
+the cluster subscribes to (default "cache.sync"), instead of sending one request per peer. The
+NATS server does the fan-out, and since it delivers one publisher's messages on a subject in
+order, every peer applies a node's writes in the order they were made.
+
+Each publication carries a reply subject on the sender's inbox; a node that applies it answers
+"ok <node id>" (or "err <node id> <reason>"), so Replicate still counts acknowledgements per peer
+for min= and full, and peers that do not answer within their timeout get the write hinted in the
+outbox as with HTTP. Peers are matched to answers by the node IDs learned from heartbeats; a peer
+whose ID is not known yet, writes larger than the server's max_payload, and everything while the
+connection is down go over HTTP as before. Heartbeats, hinted handoff and reads stay on HTTP. With
+SyncSecrets set, publications carry the same X-Sync-Signature as HTTP sync requests (method "PUB",
+the subject as path) in NATS headers, so NATS 2.2 or later is required.
+
+The client speaks the NATS text protocol directly: CONNECT with no_echo (a node never sees its own
+publications), SUB, PUB/HPUB and PING/PONG, with user:password@ or token@ credentials from the URL
+and TLS for tls:// URLs or servers that require it. NATSLoop reconnects with backoff when the
+connection drops.
+
+Functions:
+- (*Node) NATSLoop(ctx context.Context, opts NATSOptions)
+- (*Node) dialNATS(ctx context.Context, opts NATSOptions): (*natsConn, error)
+- (*natsConn) readLoop(): error
+- (*natsConn) readMsg(headers bool, f []string): error
+- (*natsConn) applyLoop()
+- (*Node) applyNATS(m natsMsg): string
+- (*natsConn) publish(subject, reply string, hdr http.Header, data []byte): error
+- (*natsConn) publishSync(msgs []SyncMsg, reply string): error
+- (*natsConn) request(msgs []SyncMsg, peers int): (string, chan natsAck, error)
+- (*natsConn) unregister(reply string)
+- (*Node) replicateNATS(msg SyncMsg, peers []string, done chan<- error): []string
+- (*Node) awaitNATSAcks(c *natsConn, reply string, acks chan natsAck, msg SyncMsg, ids map[string]string, done chan<- error)
+- (*Node) peerIDFor(peer string): string
+- parseNATSHeader(b []byte): (http.Header, error)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	natsDefaultSubject = "cache.sync"
+	natsNodeHeader     = "Cache-Node"
+	natsMaxBackoff     = 30 * time.Second
+	natsWriteTimeout   = 5 * time.Second
+
+	natsSyncSID  = "1"
+	natsInboxSID = "2"
+)
+
+var errNATSTooLarge = errors.New("larger than the NATS server's max_payload")
+
+// NATSOptions configures NATSLoop.
+type NATSOptions struct {
+	// URL is nats://[user:password@|token@]host[:4222], or tls://... to
+	// require TLS.
+	URL     string
+	Subject string      // shared by the cluster's nodes; default "cache.sync"
+	TLS     *tls.Config // for TLS connections; nil uses the system roots
+}
+
+type natsConn struct {
+	n          *Node
+	conn       net.Conn
+	r          *bufio.Reader
+	subject    string
+	inbox      string
+	maxPayload int
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	seq     atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan natsAck // reply subject -> Replicate waiting for acks
+	inbound chan natsMsg
+}
+
+type natsMsg struct {
+	subject, reply string
+	hdr            http.Header
+	data           []byte
+}
+
+type natsAck struct {
+	id  string
+	err error
+}
+
+// NATSLoop keeps a connection to the NATS server at opts.URL and replicates
+// through it while connected, until ctx is done.
+func (n *Node) NATSLoop(ctx context.Context, opts NATSOptions) {
+	if opts.Subject == "" {
+		opts.Subject = natsDefaultSubject
+	}
+	backoff := time.Second
+	for ctx.Err() == nil {
+		c, err := n.dialNATS(ctx, opts)
+		if err != nil {
+			n.log.Warn("NATS connect failed", "component", "nats", "err", err, "retry_in", backoff)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+				backoff = min(backoff*2, natsMaxBackoff)
+			}
+			continue
+		}
+		backoff = time.Second
+		n.log.Info("replicating over NATS", "component", "nats", "server", c.conn.RemoteAddr().String(), "subject", opts.Subject)
+		stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+		n.nats.Store(c)
+		go c.applyLoop()
+		err = c.readLoop()
+		n.nats.CompareAndSwap(c, nil)
+		stop()
+		c.conn.Close()
+		close(c.inbound)
+		if ctx.Err() == nil {
+			n.log.Warn("NATS connection lost; replicating over HTTP", "component", "nats", "err", err)
+		}
+	}
+}
+
+func (n *Node) dialNATS(ctx context.Context, opts NATSOptions) (*natsConn, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return nil, fmt.Errorf("bad NATS URL %q", opts.URL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	timeout := n.ReqTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			conn.Close()
+		}
+	}()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	line, err := bufio.NewReader(conn).ReadString('\n') // INFO is read before any TLS upgrade
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		MaxPayload  int  `json:"max_payload"`
+		Headers     bool `json:"headers"`
+		TLSRequired bool `json:"tls_required"`
+	}
+	if op, arg, _ := strings.Cut(strings.TrimSpace(line), " "); op != "INFO" || json.Unmarshal([]byte(arg), &info) != nil {
+		return nil, fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	if u.Scheme == "tls" || info.TLSRequired {
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if opts.TLS != nil {
+			cfg = opts.TLS.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tc
+	}
+	if !info.Headers {
+		return nil, errors.New("NATS server does not support headers (2.2 or later required)")
+	}
+
+	connect := map[string]any{
+		"verbose": false, "pedantic": false, "lang": "go", "version": "replicated-cache", "protocol": 1,
+		"name": "cache-" + n.ID, "headers": true, "no_echo": true, "tls_required": u.Scheme == "tls",
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			connect["user"], connect["pass"] = u.User.Username(), pass
+		} else {
+			connect["auth_token"] = u.User.Username()
+		}
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	c := &natsConn{
+		n: n, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn),
+		subject: opts.Subject, inbox: "_INBOX." + hex.EncodeToString(id[:]), maxPayload: info.MaxPayload,
+		pending: make(map[string]chan natsAck), inbound: make(chan natsMsg, 256),
+	}
+	b, _ := json.Marshal(connect)
+	fmt.Fprintf(c.w, "CONNECT %s\r\nSUB %s %s\r\nSUB %s.* %s\r\nPING\r\n", b, c.subject, natsSyncSID, c.inbox, natsInboxSID)
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	// The server answers the PING once it has processed CONNECT and SUB, or
+	// reports why it refused them.
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return nil, fmt.Errorf("NATS: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	ok = true
+	return c, nil
+}
+
+// readLoop reads from the server until the connection fails.
+func (c *natsConn) readLoop() error {
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			c.wmu.Lock()
+			c.conn.SetWriteDeadline(time.Now().Add(natsWriteTimeout))
+			c.w.WriteString("PONG\r\n")
+			err = c.w.Flush()
+			c.wmu.Unlock()
+		case "-ERR":
+			c.n.log.Warn("NATS error", "component", "nats", "err", args)
+		case "MSG", "HMSG":
+			err = c.readMsg(strings.ToUpper(op) == "HMSG", strings.Fields(args))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readMsg reads the payload announced by a MSG or HMSG line and dispatches it.
+func (c *natsConn) readMsg(headers bool, f []string) error {
+	// MSG <subject> <sid> [reply] <size>; HMSG <subject> <sid> [reply] <header size> <size>
+	want := 3
+	if headers {
+		want = 4
+	}
+	if len(f) != want && len(f) != want+1 {
+		return fmt.Errorf("bad NATS message line %q", f)
+	}
+	var m natsMsg
+	m.subject = f[0]
+	sid := f[1]
+	if len(f) == want+1 {
+		m.reply = f[2]
+	}
+	size, err := strconv.Atoi(f[len(f)-1])
+	hsize := 0
+	if headers && err == nil {
+		hsize, err = strconv.Atoi(f[len(f)-2])
+	}
+	if err != nil || size < hsize || size > 64<<20 {
+		return fmt.Errorf("bad NATS message size in %q", f)
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return err
+	}
+	if m.hdr, err = parseNATSHeader(buf[:hsize]); err != nil {
+		return err
+	}
+	m.data = buf[hsize:size]
+	switch sid {
+	case natsSyncSID:
+		c.inbound <- m
+	case natsInboxSID:
+		c.mu.Lock()
+		acks := c.pending[m.subject]
+		c.mu.Unlock()
+		if acks == nil {
+			return nil // answered after Replicate stopped waiting
+		}
+		status, rest, _ := strings.Cut(string(m.data), " ")
+		id, reason, _ := strings.Cut(rest, " ")
+		a := natsAck{id: id}
+		if status != "ok" {
+			a.err = fmt.Errorf("peer %s: %s", id, reason)
+		}
+		select {
+		case acks <- a:
+		default:
+		}
+	}
+	return nil
+}
+
+// applyLoop applies writes from other nodes in the order they arrive and
+// answers each.
+func (c *natsConn) applyLoop() {
+	for m := range c.inbound {
+		ack := c.n.applyNATS(m)
+		if m.reply != "" {
+			c.publish(m.reply, "", nil, []byte(ack))
+		}
+	}
+}
+
+// applyNATS checks and applies one publication and returns the answer for it.
+func (n *Node) applyNATS(m natsMsg) string {
+	n.metrics.natsReceived.Add(1)
+	req := &http.Request{Method: "PUB", URL: &url.URL{Path: m.subject}, Header: m.hdr}
+	err := n.verifySync(req, m.data)
+	if err != nil {
+		n.log.Warn("NATS sync message rejected", "component", "nats", "sender", m.hdr.Get(natsNodeHeader), "err", err)
+	} else {
+		var msgs []SyncMsg
+		if msgs, err = decodeSyncBatchMsgpack(m.data); err == nil {
+			err = n.applySync(msgs...)
+		}
+	}
+	if err != nil {
+		return "err " + n.ID + " " + err.Error()
+	}
+	return "ok " + n.ID
+}
+
+// publish sends data to subject, with hdr as NATS headers when not empty.
+func (c *natsConn) publish(subject, reply string, hdr http.Header, data []byte) error {
+	var hb bytes.Buffer
+	if len(hdr) > 0 {
+		hb.WriteString("NATS/1.0\r\n")
+		hdr.Write(&hb)
+		hb.WriteString("\r\n")
+	}
+	if c.maxPayload > 0 && hb.Len()+len(data) > c.maxPayload {
+		return errNATSTooLarge
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(natsWriteTimeout))
+	if reply != "" {
+		reply += " "
+	}
+	if hb.Len() > 0 {
+		fmt.Fprintf(c.w, "HPUB %s %s%d %d\r\n", subject, reply, hb.Len(), hb.Len()+len(data))
+		c.w.Write(hb.Bytes())
+	} else {
+		fmt.Fprintf(c.w, "PUB %s %s%d\r\n", subject, reply, len(data))
+	}
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+	return c.w.Flush()
+}
+
+// publishSync publishes msgs to the cluster's subject, signed like an HTTP
+// sync request.
+func (c *natsConn) publishSync(msgs []SyncMsg, reply string) error {
+	body := appendSyncBatchMsgpack(nil, msgs)
+	req := &http.Request{Method: "PUB", URL: &url.URL{Path: c.subject}, Header: http.Header{}}
+	c.n.signSync(req, body)
+	req.Header.Set(natsNodeHeader, c.n.ID)
+	if err := c.publish(c.subject, reply, req.Header, body); err != nil {
+		return err
+	}
+	c.n.metrics.natsPublished.Add(1)
+	return nil
+}
+
+// request publishes msgs with a fresh reply subject and returns it with the
+// channel its answers, up to peers of them, arrive on.
+func (c *natsConn) request(msgs []SyncMsg, peers int) (string, chan natsAck, error) {
+	reply := c.inbox + "." + strconv.FormatInt(c.seq.Add(1), 10)
+	acks := make(chan natsAck, peers)
+	c.mu.Lock()
+	c.pending[reply] = acks
+	c.mu.Unlock()
+	if err := c.publishSync(msgs, reply); err != nil {
+		c.unregister(reply)
+		return "", nil, err
+	}
+	return reply, acks, nil
+}
+
+func (c *natsConn) unregister(reply string) {
+	c.mu.Lock()
+	delete(c.pending, reply)
+	c.mu.Unlock()
+}
+
+// replicateNATS publishes msg for the peers whose node ID is known, while
+// connected, and returns the peers it did not cover; done gets one result per
+// covered peer.
+func (n *Node) replicateNATS(msg SyncMsg, peers []string, done chan<- error) []string {
+	c := n.nats.Load()
+	if c == nil {
+		return peers
+	}
+	ids := make(map[string]string)
+	var rest []string
+	for _, p := range peers {
+		if id := n.peerIDFor(p); id != "" {
+			ids[id] = p
+		} else {
+			rest = append(rest, p)
+		}
+	}
+	if len(ids) == 0 {
+		return peers
+	}
+	reply, acks, err := c.request([]SyncMsg{msg}, len(ids))
+	if err != nil {
+		n.log.Debug("NATS publish failed; using http", "component", "nats", "key", msg.Key, "err", err)
+		return peers
+	}
+	go n.awaitNATSAcks(c, reply, acks, msg, ids, done)
+	return rest
+}
+
+// awaitNATSAcks collects the answers of the peers in ids (node ID -> peer
+// URL), hinting msg for those that fail or do not answer in time.
+func (n *Node) awaitNATSAcks(c *natsConn, reply string, acks chan natsAck, msg SyncMsg, ids map[string]string, done chan<- error) {
+	defer c.unregister(reply)
+	start := time.Now()
+	var wait time.Duration
+	for _, p := range ids {
+		wait = max(wait, n.peerTimeout(p))
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	finish := func(id string, err error) {
+		p := ids[id]
+		delete(ids, id)
+		d := time.Since(start)
+		if err == nil {
+			n.observeLatency(p, d)
+		} else {
+			n.hint(p, msg)
+		}
+		n.recordSend(p, []SyncMsg{msg}, d, err)
+		n.bumpFail(p, err == nil)
+		done <- err
+	}
+	for len(ids) > 0 {
+		select {
+		case a := <-acks:
+			if _, ok := ids[a.id]; ok {
+				finish(a.id, a.err)
+			}
+		case <-timer.C:
+			for id := range ids {
+				finish(id, fmt.Errorf("no NATS acknowledgement from %s", id))
+			}
+		}
+	}
+}
+
+// peerIDFor returns the node ID heartbeats reported for peer, or "".
+func (n *Node) peerIDFor(peer string) string {
+	var id string
+	n.peerIDs.Range(func(k, v any) bool {
+		if v.(string) == peer {
+			id = k.(string)
+			return false
+		}
+		return true
+	})
+	return id
+}
+
+// parseNATSHeader parses a "NATS/1.0" header block; an empty one is nil.
+func parseNATSHeader(b []byte) (http.Header, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	if line, err := r.ReadLine(); err != nil || !strings.HasPrefix(line, "NATS/1.0") {
+		return nil, fmt.Errorf("bad NATS header block")
+	}
+	h, err := r.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return http.Header(h), nil
+}
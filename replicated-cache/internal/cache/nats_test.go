@@ -0,0 +1,208 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the NATS replication transport, against a fake NATS server.
+
+List of functions:
+	- startFakeNATS: Starts a server that routes PUB/HPUB to matching SUBs, honouring no_echo.
+	- TestNATSReplication: Tests acknowledged fan-out over NATS, signing, and HTTP for peers with unknown IDs.
+	- TestParseNATSHeader: Tests parsing NATS header blocks.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeNATSClient struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	noEcho bool
+	subs   map[string]string // sid -> subject, "prefix.*" matching one more token
+}
+
+// startFakeNATS returns the server's nats:// URL and a count of messages
+// published to subject.
+func startFakeNATS(t *testing.T, subject string) (string, *atomic.Int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	clients := map[*fakeNATSClient]bool{}
+	var published atomic.Int32
+	route := func(from *fakeNATSClient, subj, reply string, hdr, data []byte) {
+		if subj == subject {
+			published.Add(1)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for c := range clients {
+			if c == from && c.noEcho {
+				continue
+			}
+			c.mu.Lock()
+			for sid, pattern := range c.subs {
+				prefix, wild := strings.CutSuffix(pattern, "*")
+				if pattern != subj && !(wild && strings.HasPrefix(subj, prefix) && !strings.Contains(subj[len(prefix):], ".")) {
+					continue
+				}
+				to := ""
+				if reply != "" {
+					to = reply + " "
+				}
+				if hdr != nil {
+					fmt.Fprintf(c.conn, "HMSG %s %s %s%d %d\r\n%s%s\r\n", subj, sid, to, len(hdr), len(hdr)+len(data), hdr, data)
+				} else {
+					fmt.Fprintf(c.conn, "MSG %s %s %s%d\r\n%s\r\n", subj, sid, to, len(data), data)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		c := &fakeNATSClient{conn: conn, subs: map[string]string{}}
+		mu.Lock()
+		clients[c] = true
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			delete(clients, c)
+			mu.Unlock()
+		}()
+		io.WriteString(conn, `INFO {"server_id":"fake","max_payload":1048576,"headers":true}`+"\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+			f := strings.Fields(args)
+			switch op {
+			case "CONNECT":
+				var opts struct {
+					NoEcho bool `json:"no_echo"`
+				}
+				json.Unmarshal([]byte(args), &opts)
+				c.noEcho = opts.NoEcho
+			case "PING":
+				c.mu.Lock()
+				io.WriteString(conn, "PONG\r\n")
+				c.mu.Unlock()
+			case "SUB":
+				c.mu.Lock()
+				c.subs[f[1]] = f[0]
+				c.mu.Unlock()
+			case "PUB", "HPUB":
+				size, _ := strconv.Atoi(f[len(f)-1])
+				hsize := 0
+				if op == "HPUB" {
+					hsize, _ = strconv.Atoi(f[len(f)-2])
+				}
+				buf := make([]byte, size+2)
+				io.ReadFull(r, buf)
+				reply := ""
+				if (op == "PUB" && len(f) == 3) || (op == "HPUB" && len(f) == 4) {
+					reply = f[1]
+				}
+				var hdr []byte
+				if op == "HPUB" {
+					hdr = buf[:hsize]
+				}
+				route(c, f[0], reply, hdr, buf[hsize:size])
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return "nats://" + ln.Addr().String(), &published
+}
+
+func TestNATSReplication(t *testing.T) {
+	url, published := startFakeNATS(t, natsDefaultSubject)
+	secret := [][]byte{[]byte("0123456789abcdef")}
+	n2 := NewNode("N2", ":y", nil)
+	n2.SyncSecrets = secret
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	var posts atomic.Int32
+	srv3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		w.WriteHeader(204)
+	}))
+	defer srv3.Close()
+
+	n1 := NewNode("N1", ":x", []string{srv2.URL, srv3.URL})
+	n1.SyncSecrets = secret
+	if !n1.heartbeat(context.Background(), srv2.URL) {
+		t.Fatal("heartbeat to N2 failed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n1.NATSLoop(ctx, NATSOptions{URL: url})
+	go n2.NATSLoop(ctx, NATSOptions{URL: url})
+	for n1.nats.Load() == nil || n2.nats.Load() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 1; i <= 3; i++ {
+		msg := SyncMsg{Op: "set", Key: "k", Value: []byte(strconv.Itoa(i)), Version: int64(i), Origin: "N1"}
+		acked, total, err := n1.Replicate(context.Background(), msg, 0, true)
+		if err != nil || acked != 2 || total != 2 {
+			t.Fatalf("Replicate: %d/%d acks, %v", acked, total, err)
+		}
+	}
+	if it, ok := n2.Store().Get("k"); !ok || string(it.Value) != "3" {
+		t.Fatalf("N2 has %+v, %v", it, ok)
+	}
+	// N2 went over NATS, srv3 (whose node ID is unknown) over HTTP.
+	if published.Load() != 3 || n2.metrics.natsReceived.Load() != 3 || posts.Load() != 3 {
+		t.Fatalf("%d publications, %d received by N2, %d HTTP posts", published.Load(), n2.metrics.natsReceived.Load(), posts.Load())
+	}
+
+	// A node with another secret refuses the publication and says so.
+	n2.SyncSecrets = [][]byte{[]byte("fedcba9876543210")}
+	n1.ReqTimeout = 200 * time.Millisecond // Replicate waits this long for the missing ack
+	msg := SyncMsg{Op: "set", Key: "k", Value: []byte("4"), Version: 4, Origin: "N1"}
+	if _, _, err := n1.Replicate(context.Background(), msg, 2, false); err == nil || !strings.Contains(err.Error(), "bad sync signature") {
+		t.Fatalf("Replicate to a node with another secret: %v", err)
+	}
+}
+
+func TestParseNATSHeader(t *testing.T) {
+	h, err := parseNATSHeader([]byte("NATS/1.0\r\nCache-Node: N1\r\nX-Sync-Signature: t=1,n=2,v1=ab\r\n\r\n"))
+	if err != nil || h.Get(natsNodeHeader) != "N1" || h.Get(syncSigHeader) != "t=1,n=2,v1=ab" {
+		t.Fatalf("header %v, %v", h, err)
+	}
+	if h, err := parseNATSHeader(nil); h != nil || err != nil {
+		t.Fatalf("empty header %v, %v", h, err)
+	}
+	if _, err := parseNATSHeader([]byte("HTTP/1.1\r\n\r\n")); err == nil {
+		t.Fatal("accepted a header block without NATS/1.0")
+	}
+}
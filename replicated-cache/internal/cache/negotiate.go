@@ -0,0 +1,337 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements content negotiation for the endpoints that answer with structured data
+(/stats, /cluster, /cluster/stats, /version, /health?detail=true, /kv/KEY/watch, POST /pubsub/CHANNEL
+and the JSON lists under /admin). Besides JSON they can answer in MessagePack
+(application/msgpack, also accepted as application/x-msgpack and application/vnd.msgpack) or CBOR
+(application/cbor), chosen from the request's Accept header by quality. JSON stays the default,
+including when Accept is missing, only has wildcards or names none of these.
+
+The binary forms have exactly the shape of the JSON: struct fields are map entries named and
+omitted as their json tags say, map keys are sorted, and durations are integer nanoseconds. Byte
+slices are binary strings instead of base64, and times are a MessagePack timestamp (extension -1)
+or a CBOR standard date/time string (tag 0). The encoder only encodes, so no request body is
+negotiated here; POST /sync has its own MessagePack codec (see msgpack.go).
+
+Functions:
+- negotiate(r *http.Request): string
+- writeEncoded(w http.ResponseWriter, r *http.Request, status int, v any)
+- encodeAs(contentType string, v any): ([]byte, error)
+- fieldsOf(t reflect.Type): []encField
+- appendEncoded(b []byte, v reflect.Value, f encFormat): ([]byte, error)
+- isEmptyValue(v reflect.Value): bool
+- (mpFormat) ...: MessagePack primitives
+- (cborFormat) ...: CBOR primitives
+*/
+
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentTypeCBOR = "application/cbor"
+
+// negotiate returns the content type to answer r with: application/json,
+// application/msgpack or application/cbor.
+func negotiate(r *http.Request) string {
+	best, bestQ := "application/json", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		switch mt {
+		case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+			mt = contentTypeMsgpack
+		case contentTypeCBOR, "application/json":
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+	return best
+}
+
+// writeEncoded answers with status and v, in the format r asked for.
+func writeEncoded(w http.ResponseWriter, r *http.Request, status int, v any) {
+	ct := negotiate(r)
+	w.Header().Add("Vary", "Accept")
+	if ct == "application/json" {
+		w.Header().Set("Content-Type", ct)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+	b, err := encodeAs(ct, v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// encodeAs encodes v as MessagePack or CBOR.
+func encodeAs(contentType string, v any) ([]byte, error) {
+	var f encFormat = mpFormat{}
+	if contentType == contentTypeCBOR {
+		f = cborFormat{}
+	}
+	return appendEncoded(nil, reflect.ValueOf(v), f)
+}
+
+// encFormat writes the primitives of one binary format.
+type encFormat interface {
+	mapHeader(b []byte, n int) []byte
+	arrayHeader(b []byte, n int) []byte
+	str(b []byte, s string) []byte
+	bytes(b []byte, p []byte) []byte
+	int(b []byte, v int64) []byte
+	uint(b []byte, v uint64) []byte
+	float(b []byte, v float64) []byte
+	bool(b []byte, v bool) []byte
+	null(b []byte) []byte
+	time(b []byte, t time.Time) []byte
+}
+
+// encField is a struct field as encoding/json sees it.
+type encField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var encFieldCache sync.Map // reflect.Type -> []encField
+
+// fieldsOf lists t's encoded fields in order, with untagged embedded structs
+// flattened into their parent.
+func fieldsOf(t reflect.Type) []encField {
+	if fs, ok := encFieldCache.Load(t); ok {
+		return fs.([]encField)
+	}
+	var fs []encField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for _, f := range fieldsOf(sf.Type) {
+				f.index = append([]int{i}, f.index...)
+				fs = append(fs, f)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fs = append(fs, encField{name: name, index: []int{i}, omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty")})
+	}
+	encFieldCache.Store(t, fs)
+	return fs
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+func appendEncoded(b []byte, v reflect.Value, f encFormat) ([]byte, error) {
+	if !v.IsValid() {
+		return f.null(b), nil
+	}
+	if v.Type() == timeType {
+		return f.time(b, v.Interface().(time.Time)), nil
+	}
+	var err error
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return f.null(b), nil
+		}
+		return appendEncoded(b, v.Elem(), f)
+	case reflect.Bool:
+		return f.bool(b, v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f.int(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return f.uint(b, v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return f.float(b, v.Float()), nil
+	case reflect.String:
+		return f.str(b, v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return f.null(b), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			return f.bytes(b, v.Bytes()), nil
+		}
+		b = f.arrayHeader(b, v.Len())
+		for i := range v.Len() {
+			if b, err = appendEncoded(b, v.Index(i), f); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return f.null(b), nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot encode map with %s keys", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		b = f.mapHeader(b, len(keys))
+		for _, k := range keys {
+			b = f.str(b, k.String())
+			if b, err = appendEncoded(b, v.MapIndex(k), f); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Struct:
+		fields := fieldsOf(v.Type())
+		vals := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, fd := range fields {
+			fv := v.FieldByIndex(fd.index)
+			if fd.omitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			vals, names = append(vals, fv), append(names, fd.name)
+		}
+		b = f.mapHeader(b, len(vals))
+		for i, fv := range vals {
+			b = f.str(b, names[i])
+			if b, err = appendEncoded(b, fv, f); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot encode %s", v.Type())
+}
+
+// isEmptyValue is encoding/json's test for omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.IsZero()
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+type mpFormat struct{}
+
+func (mpFormat) mapHeader(b []byte, n int) []byte   { return mpAppendMapHeader(b, n) }
+func (mpFormat) arrayHeader(b []byte, n int) []byte { return mpAppendArrayHeader(b, n) }
+func (mpFormat) str(b []byte, s string) []byte      { return mpAppendStr(b, s) }
+func (mpFormat) bytes(b []byte, p []byte) []byte    { return append(mpAppendBinHeader(b, len(p)), p...) }
+func (mpFormat) int(b []byte, v int64) []byte       { return mpAppendInt(b, v) }
+func (mpFormat) bool(b []byte, v bool) []byte       { return mpAppendBool(b, v) }
+func (mpFormat) null(b []byte) []byte               { return mpAppendNil(b) }
+
+func (mpFormat) uint(b []byte, v uint64) []byte {
+	if v <= math.MaxInt64 {
+		return mpAppendInt(b, int64(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+}
+
+func (mpFormat) float(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+// time writes the 96-bit timestamp extension, which holds any time.Time.
+func (mpFormat) time(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, 0xff)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+}
+
+type cborFormat struct{}
+
+// head writes a CBOR initial byte for major type major and argument n.
+func (cborFormat) head(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major|27), n)
+	}
+}
+
+func (c cborFormat) mapHeader(b []byte, n int) []byte   { return c.head(b, 5, uint64(n)) }
+func (c cborFormat) arrayHeader(b []byte, n int) []byte { return c.head(b, 4, uint64(n)) }
+func (c cborFormat) str(b []byte, s string) []byte      { return append(c.head(b, 3, uint64(len(s))), s...) }
+func (c cborFormat) bytes(b []byte, p []byte) []byte {
+	return append(c.head(b, 2, uint64(len(p))), p...)
+}
+func (c cborFormat) uint(b []byte, v uint64) []byte { return c.head(b, 0, v) }
+func (cborFormat) null(b []byte) []byte             { return append(b, 0xf6) }
+
+func (c cborFormat) int(b []byte, v int64) []byte {
+	if v < 0 {
+		return c.head(b, 1, uint64(-(v + 1)))
+	}
+	return c.head(b, 0, uint64(v))
+}
+
+func (cborFormat) float(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(v))
+}
+
+func (cborFormat) bool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xf5)
+	}
+	return append(b, 0xf4)
+}
+
+// time writes tag 0, an RFC 3339 string, as JSON writes times.
+func (c cborFormat) time(b []byte, t time.Time) []byte {
+	return c.str(append(b, 0xc0), t.Format(time.RFC3339Nano))
+}
@@ -0,0 +1,117 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for content negotiation and the MessagePack and CBOR encoders.
+
+List of functions:
+	- TestNegotiate: Tests choosing a format from the Accept header.
+	- TestEncodeAs: Tests MessagePack and CBOR encodings against hand-made bytes.
+	- TestStatsNegotiated: Tests /stats answering in MessagePack and CBOR.
+*/
+
+package cache
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                     "application/json",
+		"*/*":                                  "application/json",
+		"text/html, */*;q=0.8":                 "application/json",
+		"application/msgpack":                  contentTypeMsgpack,
+		"application/x-msgpack":                contentTypeMsgpack,
+		"application/cbor":                     contentTypeCBOR,
+		"application/json;q=0.5, application/cbor": contentTypeCBOR,
+		"application/cbor;q=0.2, application/json": "application/json",
+		"application/msgpack;q=bad, application/cbor;q=0.1": contentTypeCBOR,
+	} {
+		r := httptest.NewRequest("GET", "/stats", nil)
+		r.Header.Set("Accept", accept)
+		if got := negotiate(r); got != want {
+			t.Errorf("Accept %q: got %s, want %s", accept, got, want)
+		}
+	}
+}
+
+func TestEncodeAs(t *testing.T) {
+	v := struct {
+		Name  string `json:"name"`
+		Count uint64 `json:"count"`
+		Neg   int64  `json:"neg"`
+		Raw   []byte `json:"raw"`
+		Skip  string `json:"skip,omitempty"`
+		Time  time.Time
+	}{"a", 300, -2, []byte{1}, "", time.Unix(1, 5).UTC()}
+	stamp := "1970-01-01T00:00:01.000000005Z"
+	for ct, want := range map[string]string{
+		contentTypeMsgpack: "85" + "a46e616d65" + "a161" + "a5636f756e74" + "d3000000000000012c" + "a36e6567" + "d3fffffffffffffffe" +
+			"a3726177" + "c40101" + "a454696d65" + "c70cff" + "00000005" + "0000000000000001",
+		contentTypeCBOR: "a5" + "646e616d65" + "6161" + "65636f756e74" + "19012c" + "636e6567" + "21" +
+			"63726177" + "4101" + "6454696d65" + "c0" + "781e" + hex.EncodeToString([]byte(stamp)),
+	} {
+		b, err := encodeAs(ct, v)
+		if err != nil { t.Fatal(err) }
+		if got := hex.EncodeToString(b); got != want {
+			t.Errorf("%s:\n got %s\nwant %s", ct, got, want)
+		}
+	}
+	if _, err := encodeAs(contentTypeCBOR, map[int]int{1: 1}); err == nil {
+		t.Fatal("encoded a map with int keys")
+	}
+}
+
+func TestStatsNegotiated(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	get := func(accept string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", srv.URL+"/stats", nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil { t.Fatal(err) }
+		return resp, b
+	}
+
+	resp, b := get("application/msgpack")
+	if resp.Header.Get("Content-Type") != contentTypeMsgpack || resp.Header.Get("Vary") != "Accept" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+	r := &mpReader{b: b}
+	fields, err := r.mapLen()
+	if err != nil { t.Fatal(err) }
+	var nodeID string
+	for range fields {
+		k, err := r.str()
+		if err != nil { t.Fatal(err) }
+		if k == "node_id" {
+			if nodeID, err = r.str(); err != nil { t.Fatal(err) }
+			continue
+		}
+		if err := r.skip(); err != nil { t.Fatal(err) }
+	}
+	if nodeID != "N" || len(r.b) != 0 {
+		t.Fatalf("node_id %q, %d bytes left", nodeID, len(r.b))
+	}
+
+	resp, b = get("application/cbor")
+	if resp.Header.Get("Content-Type") != contentTypeCBOR || len(b) == 0 || b[0]>>5 != 5 {
+		t.Fatalf("content type %q, body % x", resp.Header.Get("Content-Type"), b[:min(len(b), 8)])
+	}
+	if resp, _ = get(""); resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("default content type %q", resp.Header.Get("Content-Type"))
+	}
+}
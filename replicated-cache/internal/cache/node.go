@@ -4,32 +4,53 @@ Project: replicated-in-memory-cache-golang
 Date: Aug 10th 2025
 
 Summary:
-This file defines the Node type, which represents a single node in a replicated in-memory cache cluster. 
+This file defines the Node type, which represents a single node in a replicated in-memory cache cluster.
 The Node manages peer discovery, health checking, replication of cache updates, and periodic cleanup of expired entries.
 It handles communication with peer nodes over HTTP, tracks peer health, and coordinates data consistency across the cluster.
 
 Functions in this file:
 - NewNode: Constructs a new Node with the given ID, address, and initial peers.
 - Store: Returns the underlying Store instance for this Node.
+- SetLogger: Replaces the structured logger used for the node's log records.
+- HotKeys: Reports the most frequently read keys.
 - activePeers: Returns a slice of currently active peer addresses.
 - bumpFail: Updates failure counts for a peer and removes it if failures exceed a threshold.
-- HeartbeatLoop: Periodically checks the health of peer nodes and updates their status.
-- JanitorLoop: Periodically removes expired tombstoned entries from the store.
-- Replicate: Sends a synchronization message to peers and waits for acknowledgements.
+- HeartbeatLoop / heartbeat: Periodically checks the health of peer nodes, timing each round trip, and updates their status.
+- JanitorLoop / runJanitor: Periodically removes due expired and tombstoned entries from the store, within a time budget.
+- Replicate: Queues a synchronization message for each peer's workers and waits for acknowledgements.
+- DefaultTransportOptions / peerTransport / SetTransport: Build and install the tuned keep-alive HTTP transport used to talk to peers.
+- sendSync / sendSyncBatch: Send one or a batch of synchronization messages to a peer over its sync stream or a POST, negotiating msgpack or JSON.
+- hint: Queues a message that a peer failed to acknowledge.
+- onEvict / broadcast: Best-effort notification of local evictions to peers and eviction hooks.
+- onExpire: Publishes local expirations to watchers and expiry hooks.
+- OpenOutbox / CloseOutbox: Attach a disk-backed outbox and close it on shutdown.
+- HintLoop: Periodically redelivers queued hints to the peers that missed them, dropping those for removed peers.
+- deliverHints: Sends one peer's pending hints in order and acknowledges the delivered ones.
+- apply: Applies an item to the store, publishes it to watchers and hooks and records it in the WAL when one is attached.
+- versionClock next / observe: Stamp local writes with hybrid logical clock versions that follow every version seen.
+- OpenWAL: Replays a WAL (optionally only up to a restore point) and attaches it to the Node.
+- RestoreTo: Rolls the store and WAL back to a point in time, keeping the old log.
+- CompactWAL / WALCompactLoop: Replace the WAL with a snapshot of the store once it has grown enough.
+- CloseWAL: Flushes and closes the attached WAL.
 */
 
 package cache
 
 import (
-	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -39,31 +60,220 @@ type Node struct {
 	store  *Store
 	client *http.Client
 
+	log *slog.Logger // slog.Default() at construction, tagged with node_id
+
+	// applyMu lets RestoreTo exclude writers while it swaps the store and WAL.
+	applyMu sync.RWMutex
+	wal     *WAL
+	walErr  atomic.Value // string: the last WAL append error, "" once appends succeed again
+	WALOpts WALOptions   // encryption key and corruption handling for the WAL
+	outbox  *Outbox
+
 	peersMu     sync.RWMutex
 	peers       map[string]struct{}
 	failCounts  map[string]int
 	maxFailures int
 
+	workersMu sync.Mutex
+	workers   map[string]*peerWorker // see replicator.go
+
 	ReqTimeout   time.Duration
 	HBInterval   time.Duration
 	JanitorEvery time.Duration
-	TombstoneTTL time.Duration
+	// JanitorBudget caps how long one janitor tick may spend expiring entries.
+	JanitorBudget time.Duration
+	TombstoneTTL  time.Duration
+	HintEvery     time.Duration
+	// WALCompactAbove is the log size past which WALCompactLoop compacts the
+	// WAL, once it has also doubled since the last compaction; 0 never does.
+	WALCompactAbove int64
+
+	// AdaptiveTimeout derives each peer's sync timeout from its observed p99
+	// latency times TimeoutFactor, within [MinReqTimeout, ReqTimeout] (see latency.go).
+	AdaptiveTimeout bool
+	TimeoutFactor   float64
+	MinReqTimeout   time.Duration
+	latencies       sync.Map // peer -> *latencyWindow
+	hbRTT           sync.Map // peer -> *latencyWindow of heartbeat round trips
+
+	// CompressAbove, when non-zero, stores and replicates values of at least
+	// this many bytes DEFLATE-compressed.
+	CompressAbove int
+
+	hot *hotKeys // GET frequency tracker; nil disables it
+
+	// Tracer, when set, receives spans for requests, replication and store
+	// operations (see trace.go).
+	Tracer SpanExporter
+	// TraceSampler and LogSampler choose which requests are traced and
+	// access-logged; nil keeps all of them (see sampling.go).
+	TraceSampler *Sampler
+	LogSampler   *Sampler
+	// Auth, when set, authenticates every /kv and /admin request and checks
+	// the caller's role (see auth.go).
+	Auth Authenticator
+	// DefaultRole is the role of callers whose credentials carry none;
+	// "" grants nothing.
+	DefaultRole string
+	// ACL, when set, limits each caller to its key namespaces (see acl.go).
+	ACL *ACL
+	// KeyPolicy, when set, is asked about every /kv request (see policy.go).
+	KeyPolicy KeyPolicy
+	// PeerAuth, when set, requires mutual TLS on the peer-only paths (see tls.go).
+	PeerAuth *PeerAuth
+	// SyncSecrets, when set, signs outgoing replication and requires a
+	// signature on incoming /sync requests; the first secret signs (see
+	// syncauth.go).
+	SyncSecrets [][]byte
+	// ValueKeys, when set, encrypts values at rest and in replication (see
+	// valuecrypt.go).
+	ValueKeys  *ValueKeys
+	syncNonces nonceCache
+	// KeyRules, when set, rejects malformed keys on PUT and /sync (see
+	// keyrules.go).
+	KeyRules *KeyRules
+	// AuthThrottle, when set, locks out addresses after repeated failed
+	// authentications (see auththrottle.go).
+	AuthThrottle *AuthThrottle
+	authFails    authFailures
+	// SigningKey signs outgoing sync messages; PeerKeys, when set, holds each
+	// node's public keys and makes signatures mandatory (see msgsign.go).
+	SigningKey ed25519.PrivateKey
+	PeerKeys   map[string][]ed25519.PublicKey
+	// Audit, when set, records every client PUT and DELETE and admin action
+	// (see audit.go).
+	Audit    AuditSink
+	auditLog auditHistory // latest audit records, for GET /admin/audit
+
+	metrics     nodeMetrics // see metrics.go
+	peerMetrics sync.Map    // peer -> *peerStats
+	started     time.Time   // for uptime in /stats
+	recent      recentOps   // last mutations seen, see recent.go
+
+	// AccessLog logs every request; turn it off on busy nodes, where the log
+	// line costs more than serving a small GET.
+	AccessLog bool
+	// AccessLogFormat is "" (a structured record on the node's logger),
+	// "combined" (Apache combined) or "json"; the latter two are written to
+	// AccessLogOutput, default os.Stdout (see accesslog.go).
+	AccessLogFormat string
+	AccessLogOutput io.Writer
+	accessLogMu     sync.Mutex
+
+	// MinReadyPeers is how many peers must be reachable for GET /readyz to
+	// pass (see health.go).
+	MinReadyPeers int
+	bootstrapping atomic.Int32 // Bootstrap calls not yet done
+	maintenance   atomic.Bool
+
+	// Shed rejects writes while the node is overloaded (see shed.go).
+	Shed          ShedLimits
+	shedCheckedAt atomic.Int64
+	shedReason    atomic.Pointer[string]
+	// TrustedProxies are the networks of reverse proxies, such as
+	// cache-gateway, whose X-Forwarded-For names the client. Rate limits,
+	// authentication lockouts and audit records then apply to that client
+	// instead of the proxy (see clientAddr).
+	TrustedProxies []*net.IPNet
+	// RateLimit caps each client's /kv request rate (see ratelimit.go).
+	RateLimit RateLimits
+	limiter   rateLimiter
+	// Limits bound request bodies and handler time (see limits.go).
+	Limits RequestLimits
+	// CORS, when set, lets browser applications on other origins call the
+	// API (see cors.go).
+	CORS *CORSOptions
+	// AdminSeparate keeps /admin/* off Routes, leaving it to AdminRoutes;
+	// AdminAllow limits AdminRoutes to these networks (see admin.go).
+	AdminSeparate bool
+	AdminAllow    []*net.IPNet
+	// DisableDangerous makes destructive admin operations answer 403.
+	DisableDangerous bool
+	// HSTSMaxAge is the Strict-Transport-Security lifetime sent over TLS;
+	// zero omits the header (see hardening.go).
+	HSTSMaxAge time.Duration
+	// GRPC serves the gRPC API of proto/cache.proto beside HTTP (see grpc.go).
+	GRPC bool
+
+	// Loader, when set, fills GET misses from a backing store (see loader.go).
+	Loader LoaderFunc
+	loads  flightGroup
+
+	// ReplicateEvictions asks peers to drop their copy of items this node evicts.
+	ReplicateEvictions bool
+
+	// Clock, when set, replaces the system clock for versions and expiry (see clock.go).
+	Clock Clock
+
+	// PeerWorkers bounds concurrent sync requests per peer; PeerQueueSize bounds
+	// how many messages may wait for them before spilling into the outbox.
+	PeerWorkers   int
+	PeerQueueSize int
+	// BatchWindow, when non-zero, lets each worker wait this long for more
+	// messages to the same peer and send them together in one sync call.
+	BatchWindow time.Duration
+
+	// SyncEncoding is the wire format for outgoing sync messages: "msgpack"
+	// (default) or "json". Peers that answer 415 to msgpack are sent JSON.
+	SyncEncoding string
+	jsonPeers    sync.Map // peer -> true once it has rejected msgpack
+
+	// SyncStream sends msgpack sync messages over one long-lived connection
+	// per peer (see stream.go) instead of a request per message.
+	SyncStream bool
+	streamsMu  sync.Mutex
+	streams    map[string]*syncStream
+	httpPeers  sync.Map                        // peer -> true once it has refused a stream
+	peerIDs    sync.Map                        // node ID -> peer URL, from heartbeats (see session.go)
+	watches    watchHub                        // gRPC and WebSocket watchers (see watch.go)
+	webhooks   atomic.Pointer[[]*webhookState] // set by WebhookLoop (see webhooks.go)
+	nats       atomic.Pointer[natsConn]        // NATS replication transport while connected (see nats.go)
+	topology   atomic.Pointer[string]          // epoch of the peer set, for GET /cluster (see cluster.go)
+	pubsub     pubsubHub                       // channel subscribers and the publication relay (see pubsub.go)
+	versions   versionClock                    // versions of local writes
+	hooks      atomic.Pointer[hookLists]       // OnSet, OnDelete, OnExpire and OnEvict callbacks (see hooks.go)
+
+	peerPolicy *PeerPolicy // from SetTransport; also applied to sync stream dials
 }
 
 func NewNode(id, addr string, initialPeers []string) *Node {
 	n := &Node{
-		ID:           id,
-		Addr:         addr,
-		store:        NewStore(),
-		client:       &http.Client{Timeout: 5 * time.Second},
-		peers:        make(map[string]struct{}),
-		failCounts:   make(map[string]int),
-		maxFailures:  3,
-		ReqTimeout:   4 * time.Second,
-		HBInterval:   5 * time.Second,
-		JanitorEvery: 2 * time.Second,
-		TombstoneTTL: 5 * time.Minute,
+		ID:            id,
+		log:           slog.Default().With("node_id", id),
+		Addr:          addr,
+		store:         NewStore(),
+		client:        &http.Client{Timeout: 5 * time.Second, Transport: peerTransport(DefaultTransportOptions())},
+		peerPolicy:    DefaultPeerPolicy(),
+		peers:         make(map[string]struct{}),
+		failCounts:    make(map[string]int),
+		maxFailures:   3,
+		workers:       make(map[string]*peerWorker),
+		streams:       make(map[string]*syncStream),
+		PeerWorkers:   4,
+		PeerQueueSize: 1024,
+		ReqTimeout:    4 * time.Second,
+		TimeoutFactor: 3,
+		MinReqTimeout: 50 * time.Millisecond,
+		HBInterval:    5 * time.Second,
+		JanitorEvery:  2 * time.Second,
+		JanitorBudget: 25 * time.Millisecond,
+		TombstoneTTL:  5 * time.Minute,
+		HintEvery:     time.Second,
+		hot:           newHotKeys(256),
+		AccessLog:     true,
+		DefaultRole:   RoleWrite,
+		Limits:        DefaultRequestLimits(),
+		HSTSMaxAge:    DefaultHSTSMaxAge,
+		started:       time.Now(),
 	}
+	n.outbox, _ = OpenOutbox("", WALOptions{})
+	n.walErr.Store("")
+	n.shedReason.Store(new(string))
+	n.store.OnEvict = n.onEvict
+	n.store.OnExpire = n.onExpire
+	n.recent.resize(defaultRecentOps)
+	n.SetChangefeed(defaultChangefeed)
+	n.auditLog.resize(defaultAuditRetention)
 	for _, p := range initialPeers {
 		p = strings.TrimRight(strings.TrimSpace(p), "/")
 		if p != "" {
@@ -75,6 +285,12 @@ func NewNode(id, addr string, initialPeers []string) *Node {
 
 func (n *Node) Store() *Store { return n.store }
 
+// SetLogger replaces the node's logger; node_id is added to every record.
+func (n *Node) SetLogger(l *slog.Logger) { n.log = l.With("node_id", n.ID) }
+
+// HotKeys returns up to limit of the most frequently read keys, hottest first.
+func (n *Node) HotKeys(limit int) []HotKey { return n.hot.top(limit) }
+
 func (n *Node) activePeers() []string {
 	n.peersMu.RLock()
 	defer n.peersMu.RUnlock()
@@ -89,12 +305,16 @@ func (n *Node) bumpFail(p string, ok bool) {
 	defer n.peersMu.Unlock()
 	if ok {
 		n.failCounts[p] = 0
+		n.peerStats(p).consecutive.Store(0)
 		return
 	}
 	n.failCounts[p]++
+	n.peerStats(p).consecutive.Store(int64(n.failCounts[p]))
 	if n.failCounts[p] >= n.maxFailures {
 		delete(n.peers, p)
-		log.Printf("[peers] %s exceeded failures; removing", p)
+		n.setTopology(n.peers)
+		n.stopWorker(p)
+		n.log.Warn("peer exceeded failures; removing", "component", "peers", "peer", p)
 	}
 }
 
@@ -107,23 +327,36 @@ func (n *Node) HeartbeatLoop(ctx context.Context) {
 			return
 		case <-t.C:
 			for _, p := range n.activePeers() {
-				req, _ := http.NewRequestWithContext(ctx, http.MethodGet, p+"/health", nil)
-				resp, err := n.client.Do(req)
-				if err != nil || resp.StatusCode != 200 {
-					if resp != nil {
-						resp.Body.Close()
-					}
-					n.bumpFail(p, false)
-					continue
-				}
-				io.Copy(io.Discard, resp.Body)
-				resp.Body.Close()
-				n.bumpFail(p, true)
+				ok := n.heartbeat(ctx, p)
+				n.peerStats(p).up.Store(ok)
+				n.bumpFail(p, ok)
 			}
 		}
 	}
 }
 
+// heartbeat checks peer's /health and records the round-trip time.
+func (n *Node) heartbeat(ctx context.Context, peer string) bool {
+	ctx, cancel := context.WithTimeout(ctx, n.heartbeatTimeout(peer))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/health", nil)
+	start := time.Now()
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return false
+	}
+	if id := resp.Header.Get(nodeIDHeader); id != "" {
+		n.peerIDs.Store(id, peer)
+	}
+	n.observeHeartbeat(peer, time.Since(start))
+	return true
+}
+
 func (n *Node) JanitorLoop(ctx context.Context) {
 	t := time.NewTicker(n.JanitorEvery)
 	defer t.Stop()
@@ -132,13 +365,39 @@ func (n *Node) JanitorLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-t.C:
-			n.store.HardDeleteExpired(time.Now(), n.TombstoneTTL)
+			n.runJanitor()
 		}
 	}
 }
 
+// runJanitor makes one expiry pass and records how long it took and how
+// many tombstones it dropped.
+func (n *Node) runJanitor() {
+	before := n.store.Stats().TombstonesReaped
+	start := time.Now()
+	n.store.ExpireDue(n.now(), n.TombstoneTTL, n.JanitorBudget, n.onExpire)
+	d := time.Since(start)
+	n.metrics.janitor.observe(d)
+	n.metrics.janitorLastReaped.Store(n.store.Stats().TombstonesReaped - before)
+}
+
 // Replicate sends a SyncMsg to peers and waits for min/full acknowledgements.
+// Sends keep running after Replicate returns; any peer that fails (or whose
+// queue is full) gets the message queued in the outbox for later delivery.
+// While NATSLoop is connected, peers with a known node ID are sent one NATS
+// publication instead (see nats.go).
 func (n *Node) Replicate(ctx context.Context, msg SyncMsg, min int, full bool) (acked, total int, err error) {
+	ctx, span := n.startSpan(ctx, "replicate")
+	defer span.End()
+	span.SetAttr("key", msg.Key)
+	span.SetAttr("op", msg.Op)
+	if sc := spanFromContext(ctx); sc.IsValid() {
+		msg.Trace = sc.String()
+	}
+	if msg.RequestID == "" {
+		msg.RequestID = requestIDFrom(ctx)
+	}
+	n.signMsg(&msg)
 	peers := n.activePeers()
 	total = len(peers)
 	if total == 0 {
@@ -159,50 +418,488 @@ func (n *Node) Replicate(ctx context.Context, msg SyncMsg, min int, full bool) (
 		target = total
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, n.ReqTimeout)
-	defer cancel()
-
-	payload, _ := json.Marshal(msg)
-	type res struct{ ok bool; err error }
-	ch := make(chan res, total)
-
-	for _, p := range peers {
-		go func(peer string) {
-			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/sync", bytes.NewReader(payload))
-			req.Header.Set("Content-Type", "application/json")
-			resp, e := n.client.Do(req)
-			if e != nil {
-				n.bumpFail(peer, false)
-				ch <- res{false, e}
-				return
-			}
-			io.Copy(io.Discard, resp.Body)
-			resp.Body.Close()
-			if resp.StatusCode/100 == 2 {
-				n.bumpFail(peer, true)
-				ch <- res{true, nil}
-				return
-			}
-			n.bumpFail(peer, false)
-			ch <- res{false, fmt.Errorf("status %d", resp.StatusCode)}
-		}(p)
+	// The fan-out is handed to the per-peer workers and outlives this call:
+	// the client only waits for target acks, the rest are delivered (or
+	// hinted) in the background.
+	ch := make(chan error, total)
+	for _, p := range n.replicateNATS(msg, peers, ch) {
+		if !n.enqueueSync(p, syncJob{msg: msg, done: ch}) {
+			n.hint(p, msg)
+			ch <- fmt.Errorf("replication queue for %s full", p)
+		}
 	}
 
+	timeout := time.NewTimer(n.ReqTimeout)
+	defer timeout.Stop()
 	var firstErr error
 	for acked < target {
 		select {
 		case <-ctx.Done():
+			return acked, total, ctx.Err()
+		case <-timeout.C:
 			if firstErr == nil {
 				firstErr = fmt.Errorf("timeout waiting for %d/%d acks (got %d)", target, total, acked)
 			}
 			return acked, total, firstErr
-		case r := <-ch:
-			if r.ok {
+		case e := <-ch:
+			if e == nil {
 				acked++
 			} else if firstErr == nil {
-				firstErr = r.err
+				firstErr = e
 			}
 		}
 	}
 	return acked, total, firstErr
-}
\ No newline at end of file
+}
+
+// TransportOptions tune the HTTP client used for replication and heartbeats.
+// The defaults keep enough idle keep-alive connections per peer for the
+// replication workers to reuse instead of redialing.
+type TransportOptions struct {
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int // 0 = unlimited
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	TCPKeepAlive        time.Duration
+	DisableKeepAlives   bool
+	// HTTP2 negotiates HTTP/2 with https peers (ALPN); cleartext peers stay on HTTP/1.1.
+	HTTP2 bool
+	// TLS configures connections to https peers, e.g. RootCAs from LoadCertPool
+	// to trust a private CA; nil uses the system roots (see tls.go).
+	TLS *tls.Config
+	// PeerPolicy, when set, refuses connections to addresses it does not
+	// allow (see peerurl.go).
+	PeerPolicy *PeerPolicy
+	// RoundTripper, when set, carries peer requests instead of a transport
+	// built from the options above, e.g. package cachetest's in-memory
+	// network. PeerPolicy is checked against each request's URL instead of
+	// at dial time (see peerurl.go). Sync streams still dial, so leave
+	// SyncStream off with it.
+	RoundTripper http.RoundTripper
+}
+
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     90 * time.Second,
+		DialTimeout:         3 * time.Second,
+		TCPKeepAlive:        30 * time.Second,
+		HTTP2:               true,
+		PeerPolicy:          DefaultPeerPolicy(),
+	}
+}
+
+func peerTransport(o TransportOptions) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	d := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: o.TCPKeepAlive}
+	if o.PeerPolicy != nil {
+		d.Control = o.PeerPolicy.control
+	}
+	t.DialContext = d.DialContext
+	t.MaxIdleConns = 0 // bounded per host instead
+	t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = o.MaxConnsPerHost
+	t.IdleConnTimeout = o.IdleConnTimeout
+	t.DisableKeepAlives = o.DisableKeepAlives
+	t.ForceAttemptHTTP2 = o.HTTP2
+	if o.TLS != nil {
+		t.TLSClientConfig = o.TLS.Clone()
+	}
+	return t
+}
+
+// SetTransport replaces the peer HTTP client's transport. Call it before the
+// node starts replicating.
+func (n *Node) SetTransport(o TransportOptions) {
+	n.client.Transport = peerTransport(o)
+	switch {
+	case o.RoundTripper != nil && o.PeerPolicy != nil:
+		n.client.Transport = &policyTransport{o.PeerPolicy, o.RoundTripper}
+	case o.RoundTripper != nil:
+		n.client.Transport = o.RoundTripper
+	}
+	n.peerPolicy = o.PeerPolicy
+}
+
+// sendSync POSTs a SyncMsg to one peer; see sendSyncBatch.
+func (n *Node) sendSync(ctx context.Context, peer string, msg SyncMsg) error {
+	if msg.Sig == nil {
+		n.signMsg(&msg) // evictions, and hints queued before signing was set up
+	}
+	return n.sendSyncBatch(ctx, peer, []SyncMsg{msg})
+}
+
+// sendSyncBatch POSTs msgs to one peer in a single request. It uses msgpack
+// unless SyncEncoding is "json" or the peer has previously rejected msgpack,
+// in which case it falls back to JSON and remembers that for the peer. A
+// rejection is a 415, or a 400 without the syncEncodingsHeader every /sync
+// response carries since msgpack: nodes from before it answer msgpack with
+// 400 "bad json", so this keeps a rolling upgrade replicating. With SyncStream
+// set, msgpack batches go over the peer's sync stream instead.
+func (n *Node) sendSyncBatch(ctx context.Context, peer string, msgs []SyncMsg) error {
+	_, legacy := n.jsonPeers.Load(peer)
+	useJSON := n.SyncEncoding == "json" || legacy
+	if _, noStream := n.httpPeers.Load(peer); n.SyncStream && !useJSON && !noStream {
+		s, err := n.stream(peer)
+		if err == nil {
+			return s.send(ctx, msgs)
+		}
+		if !errors.Is(err, errStreamRefused) {
+			return err
+		}
+		n.log.Info("peer does not accept sync streams; using http", "component", "sync", "peer", peer)
+		n.httpPeers.Store(peer, true)
+	}
+	for {
+		buf := getBuf()
+		ctype := contentTypeMsgpack
+		if useJSON {
+			ctype = "application/json"
+			if len(msgs) == 1 {
+				json.NewEncoder(buf).Encode(msgs[0])
+			} else {
+				json.NewEncoder(buf).Encode(msgs)
+			}
+		} else if len(msgs) != 1 || len(msgs[0].Value) < streamValueAbove {
+			buf.Write(appendSyncBatchMsgpack(buf.AvailableBuffer(), msgs))
+		}
+		var body io.ReadCloser = newPooledBody(buf)
+		size := int64(buf.Len())
+		parts := [][]byte{buf.Bytes()}
+		if !useJSON && len(msgs) == 1 && len(msgs[0].Value) >= streamValueAbove {
+			body, size, parts = streamSyncBody(buf, msgs[0])
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/sync", body)
+		if err != nil {
+			body.Close()
+			return err
+		}
+		req.ContentLength = size
+		req.Header.Set("Content-Type", ctype)
+		n.signSync(req, parts...)
+		if len(msgs) == 1 && msgs[0].Trace != "" {
+			req.Header.Set("Traceparent", msgs[0].Trace)
+		}
+		if len(msgs) == 1 && msgs[0].RequestID != "" {
+			req.Header.Set(requestIDHeader, msgs[0].RequestID)
+		}
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		old := resp.StatusCode == http.StatusBadRequest && resp.Header.Get(syncEncodingsHeader) == ""
+		if !useJSON && (resp.StatusCode == http.StatusUnsupportedMediaType || old) {
+			n.log.Info("peer does not accept msgpack; using json", "component", "sync", "peer", peer, "status", resp.StatusCode)
+			n.jsonPeers.Store(peer, true)
+			useJSON = true
+			continue
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// onEvict forwards a local eviction to peers when ReplicateEvictions is set.
+// Peers drop only the exact version that was evicted and write no tombstone.
+func (n *Node) onEvict(key string, it Item) {
+	n.runHooks(hookEvict, key, it)
+	if !n.ReplicateEvictions {
+		return
+	}
+	go n.broadcast(SyncMsg{Op: "evict", Key: key, Version: it.Version, Origin: it.Origin})
+}
+
+// onExpire tells watchers and hooks about items that expired here. Tombstones
+// reaped by the janitor are not changes to the data and are left out.
+func (n *Node) onExpire(key string, it Item) {
+	if !it.Tombstone {
+		n.watches.publish("expire", key, it)
+		n.runHooks(hookExpire, key, it)
+	}
+}
+
+// broadcast sends msg to all active peers (in one NATS publication when
+// connected) without waiting for acks or queuing hints.
+func (n *Node) broadcast(msg SyncMsg) {
+	if c := n.nats.Load(); c != nil && c.publishSync([]SyncMsg{msg}, "") == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.ReqTimeout)
+	defer cancel()
+	for _, p := range n.activePeers() {
+		if err := n.sendSync(ctx, p, msg); err != nil {
+			n.log.Warn("broadcast failed", "component", "sync", "op", msg.Op, "key", msg.Key, "peer", p, "err", err)
+		}
+	}
+}
+
+// hint queues msg for peer in the outbox.
+func (n *Node) hint(peer string, msg SyncMsg) {
+	if err := n.outbox.Add(peer, msg); err != nil {
+		n.log.Error("dropping hint", "component", "hints", "op", msg.Op, "key", msg.Key, "peer", peer, "err", err)
+	}
+}
+
+// OpenOutbox replaces the in-memory outbox with one persisted under dir,
+// loading any hints left over from a previous run.
+func (n *Node) OpenOutbox(dir string) error {
+	o, err := OpenOutbox(dir, n.WALOpts)
+	if err != nil {
+		return err
+	}
+	n.outbox = o
+	if l := o.Len(); l > 0 {
+		n.log.Info("loaded undelivered hints", "component", "hints", "count", l, "dir", dir)
+	}
+	return nil
+}
+
+func (n *Node) CloseOutbox() error { return n.outbox.Close() }
+
+// HintLoop periodically redelivers queued hints, oldest first, stopping at the
+// first failure for each peer so that it is retried on the next tick. Hints
+// for a peer that is no longer among the node's peers, such as one removed
+// after too many failures or left in the outbox by an earlier run, are dropped.
+func (n *Node) HintLoop(ctx context.Context) {
+	t := time.NewTicker(n.HintEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			active := n.activePeers()
+			for _, p := range n.outbox.Peers() {
+				if slices.Contains(active, p) {
+					n.deliverHints(ctx, p)
+					continue
+				}
+				dropped, err := n.outbox.Drop(p)
+				if err != nil {
+					n.log.Error("removing hints file failed", "component", "hints", "peer", p, "err", err)
+				}
+				n.log.Warn("dropped hints for a removed peer", "component", "hints", "count", dropped, "peer", p)
+			}
+		}
+	}
+}
+
+func (n *Node) deliverHints(ctx context.Context, peer string) {
+	pending := n.outbox.Pending(peer)
+	sent := 0
+	for _, msg := range pending {
+		reqCtx, cancel := context.WithTimeout(ctx, n.peerTimeout(peer))
+		err := n.sendSync(reqCtx, peer, msg)
+		cancel()
+		if err != nil {
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return
+	}
+	if err := n.outbox.Ack(peer, sent); err != nil {
+		n.log.Error("acknowledging hints failed", "component", "hints", "count", sent, "peer", peer, "err", err)
+	}
+	n.log.Info("delivered hints", "component", "hints", "count", sent, "pending", len(pending), "peer", peer)
+}
+
+// walCompactCheck is how often WALCompactLoop looks at the size of the WAL.
+const walCompactCheck = 10 * time.Second
+
+// maxVersionDrift is how far ahead of the local clock a version may be and
+// still move versionClock; versions from clocks further ahead are not followed.
+const maxVersionDrift = time.Minute
+
+// versionClock is a hybrid logical clock for versions: nanoseconds since the
+// epoch, but never at or below a version the node has made or applied. A write
+// made after seeing another therefore wins last-writer-wins against it, even
+// when the other came from a node (or a region, see bridge.go) whose clock is
+// ahead.
+type versionClock struct {
+	last atomic.Int64
+}
+
+// next returns the version for a write made at now.
+func (c *versionClock) next(now time.Time) int64 {
+	for {
+		last := c.last.Load()
+		v := max(now.UnixNano(), last+1)
+		if c.last.CompareAndSwap(last, v) {
+			return v
+		}
+	}
+}
+
+// observe moves the clock past version, seen at now.
+func (c *versionClock) observe(version int64, now time.Time) {
+	if version > now.Add(maxVersionDrift).UnixNano() {
+		return
+	}
+	for {
+		last := c.last.Load()
+		if version <= last || c.last.CompareAndSwap(last, version) {
+			return
+		}
+	}
+}
+
+// apply puts an item into the store and, if it won, appends it to the WAL.
+// Eviction and change hooks run last, outside applyMu, so a hook that writes
+// back to the node cannot deadlock with RestoreTo.
+func (n *Node) apply(key string, it Item) bool {
+	n.versions.observe(it.Version, n.now())
+	n.applyMu.RLock()
+	applied, evicted := n.store.put(key, it)
+	if !applied {
+		n.applyMu.RUnlock()
+		return false
+	}
+	op, hook := "set", hookSet
+	if it.Tombstone {
+		op, hook = "del", hookDelete
+	}
+	n.watches.publish(op, key, it)
+	if n.wal != nil {
+		if err := n.wal.Append(syncMsgFor(key, it)); err != nil {
+			n.log.Error("wal append failed", "component", "wal", "key", key, "err", err)
+			n.walErr.Store(err.Error())
+		} else if n.walErr.Load() != "" {
+			n.walErr.Store("")
+		}
+	}
+	n.applyMu.RUnlock()
+	n.store.notifyEvicted(evicted)
+	n.runHooks(hook, key, it)
+	return true
+}
+
+// OpenWAL replays the log at path into the store and then appends all further
+// mutations to it. If restoreTo is non-zero, only records with a version at or
+// before it are replayed and the log is rewritten to match.
+func (n *Node) OpenWAL(path string, restoreTo int64) error {
+	w, err := OpenWAL(path, n.WALOpts)
+	if err != nil {
+		return err
+	}
+	n.applyMu.Lock()
+	n.wal = w
+	n.applyMu.Unlock()
+	defer n.Bootstrap()()
+	if restoreTo != 0 {
+		return n.RestoreTo(restoreTo)
+	}
+	return ReadWAL(path, n.WALOpts, func(msg SyncMsg) error {
+		n.versions.observe(msg.Version, n.now())
+		w.saw(msg.Version)
+		n.store.Put(msg.Key, msg.item())
+		return nil
+	})
+}
+
+// RestoreTo rebuilds the store from the WAL using only records with a version
+// at or before the given one, and drops the later records from the log. The
+// log as it was is kept next to it, suffixed with ".pre-restore." and the time.
+// A version from before the last compaction fails with ErrRestoreCompacted.
+func (n *Node) RestoreTo(version int64) error {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	if n.wal == nil {
+		return fmt.Errorf("no wal configured")
+	}
+	if oldest := n.wal.Compacted(); version < oldest {
+		return fmt.Errorf("%w: the log goes back to %s", ErrRestoreCompacted, time.Unix(0, oldest).UTC().Format(time.RFC3339Nano))
+	}
+	restored := NewStore()
+	keep := func(msg SyncMsg) bool { return msg.Version <= version }
+	err := ReadWAL(n.wal.path, n.wal.opts, func(msg SyncMsg) error {
+		if keep(msg) {
+			n.versions.observe(msg.Version, n.now())
+			restored.Put(msg.Key, msg.item())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	backup := n.wal.path + ".pre-restore." + time.Now().UTC().Format(backupTime)
+	if err := n.wal.Rewrite(keep, backup); err != nil {
+		return err
+	}
+	n.store.replaceWith(restored)
+	n.log.Info("restored store", "component", "wal", "version", version, "backup", backup)
+	return nil
+}
+
+// CompactWAL replaces the WAL with a snapshot of the store: one record for
+// each key that is neither expired nor a tombstone past TombstoneTTL. Writes
+// go on meanwhile; RestoreTo waits for it.
+func (n *Node) CompactWAL() error {
+	n.applyMu.RLock()
+	defer n.applyMu.RUnlock()
+	if n.wal == nil {
+		return fmt.Errorf("no wal configured")
+	}
+	before, _ := n.wal.Size()
+	now := n.now()
+	err := n.wal.Compact(func(add func(SyncMsg) error) error {
+		var err error
+		n.store.each(func(key string, it Item) bool {
+			if !it.reapable(now, n.TombstoneTTL) {
+				err = add(syncMsgFor(key, it))
+			}
+			return err == nil
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	after, _ := n.wal.Size()
+	n.log.Info("compacted wal", "component", "wal", "bytes_before", before, "bytes_after", after)
+	return nil
+}
+
+// WALCompactLoop compacts the WAL whenever it is over WALCompactAbove and
+// twice its size after the last compaction, checking every walCompactCheck.
+func (n *Node) WALCompactLoop(ctx context.Context) {
+	if n.WALCompactAbove <= 0 {
+		return
+	}
+	t := time.NewTicker(walCompactCheck)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n.applyMu.RLock()
+			w := n.wal
+			n.applyMu.RUnlock()
+			if w == nil {
+				continue
+			}
+			if size, base := w.Size(); size > n.WALCompactAbove && size > 2*base {
+				if err := n.CompactWAL(); err != nil {
+					n.log.Error("wal compaction failed", "component", "wal", "err", err)
+				}
+			}
+		}
+	}
+}
+
+func (n *Node) CloseWAL() error {
+	n.applyMu.Lock()
+	defer n.applyMu.Unlock()
+	if n.wal == nil {
+		return nil
+	}
+	err := n.wal.Close()
+	n.wal = nil
+	return err
+}
@@ -7,17 +7,29 @@
 // This file contains integration tests for the replicated in-memory cache node functionality.
 // The tests verify correct replication of key-value data between nodes, ensure that sync
 // operations do not cause rebroadcast loops, and check the heartbeat mechanism for peer health.
+// The streaming sync channel and its fallback to plain POSTs are covered too.
 // The tests use Go's httptest package to simulate HTTP servers and peer interactions.
 
 package cache
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -94,4 +106,1626 @@ func TestHeartbeatLoop(t *testing.T) {
 	n.peers = map[string]struct{}{srv.URL: {}}
 	go n.HeartbeatLoop(ctx)
 	time.Sleep(150 * time.Millisecond)
-}
\ No newline at end of file
+}
+
+// A write that a peer misses is queued, survives a restart via the outbox dir,
+// and is delivered once the peer comes back.
+func TestHintedHandoff(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	var down atomic.Bool
+	down.Store(true)
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(503); return
+		}
+		n2.Routes().ServeHTTP(w, r)
+	}))
+	defer srv2.Close()
+
+	dir := t.TempDir()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	if err := n1.OpenOutbox(dir); err != nil { t.Fatal(err) }
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/k", bytes.NewReader([]byte("v")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for n1.outbox.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n1.CloseOutbox()
+
+	// "Restart" n1 and let it deliver the hint to the recovered peer.
+	restarted := NewNode("N1", ":x", []string{srv2.URL})
+	if err := restarted.OpenOutbox(dir); err != nil { t.Fatal(err) }
+	defer restarted.CloseOutbox()
+	if restarted.outbox.Len() != 1 {
+		t.Fatalf("want 1 persisted hint, got %d", restarted.outbox.Len())
+	}
+	down.Store(false)
+	restarted.deliverHints(context.Background(), srv2.URL)
+	if it, ok := n2.Store().Get("k"); !ok || string(it.Value) != "v" {
+		t.Fatal("hint was not delivered")
+	}
+	if restarted.outbox.Len() != 0 {
+		t.Fatal("delivered hint should be acked")
+	}
+}
+
+// Hints for a peer the node no longer replicates to are dropped, not retried
+// forever.
+func TestHintsForRemovedPeer(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(503) }))
+	defer down.Close()
+	n := NewNode("N1", ":x", []string{down.URL})
+	n.HintEvery = 10 * time.Millisecond
+	if err := n.OpenOutbox(t.TempDir()); err != nil { t.Fatal(err) }
+	defer n.CloseOutbox()
+	n.hint(down.URL, SyncMsg{Op: "set", Key: "k", Version: 1})
+	n.hint("http://gone.example", SyncMsg{Op: "set", Key: "k", Version: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.HintLoop(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for n.outbox.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p := n.outbox.Peers(); len(p) != 1 || p[0] != down.URL {
+		t.Fatalf("peers with hints = %v, want only the configured peer", p)
+	}
+
+	// Once the peer is removed after repeated failures, its hints go too.
+	for i := 0; i < n.maxFailures; i++ {
+		n.bumpFail(down.URL, false)
+	}
+	for n.outbox.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l := n.outbox.Len(); l != 0 {
+		t.Fatalf("%d hints left for removed peers", l)
+	}
+}
+
+// With SyncStream set, concurrent replicated writes share one upgraded
+// connection; a peer without the stream endpoint is sent plain POSTs.
+func TestSyncStream(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.SyncStream = true
+	done := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		go func(i int) {
+			msg := SyncMsg{Op: "set", Key: fmt.Sprintf("k%02d", i), Value: []byte("v"), Version: int64(i + 1), Origin: "N1"}
+			_, _, err := n1.Replicate(context.Background(), msg, 1, false)
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 50; i++ {
+		if err := <-done; err != nil { t.Fatal(err) }
+	}
+	if n2.Store().Stats().Keys != 50 {
+		t.Fatalf("want 50 keys on peer, got %d", n2.Store().Stats().Keys)
+	}
+	if len(n1.streams) != 1 {
+		t.Fatalf("want one open stream, got %d", len(n1.streams))
+	}
+
+	var posts atomic.Int32
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sync" {
+			w.WriteHeader(404); return
+		}
+		posts.Add(1)
+		w.WriteHeader(204)
+	}))
+	defer legacy.Close()
+	msg := SyncMsg{Op: "set", Key: "k", Value: []byte("v"), Version: 1, Origin: "N1"}
+	for i := 0; i < 2; i++ {
+		if err := n1.sendSync(context.Background(), legacy.URL, msg); err != nil { t.Fatal(err) }
+	}
+	if posts.Load() != 2 {
+		t.Fatalf("want 2 POSTs to legacy peer, got %d", posts.Load())
+	}
+}
+
+// With a BatchWindow, concurrent writes to one peer are merged into fewer sync calls.
+func TestGroupCommit(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	var calls atomic.Int32
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sync" {
+			calls.Add(1)
+		}
+		n2.Routes().ServeHTTP(w, r)
+	}))
+	defer srv2.Close()
+
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.PeerWorkers = 1
+	n1.BatchWindow = 50 * time.Millisecond
+	done := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			msg := SyncMsg{Op: "set", Key: fmt.Sprintf("k%02d", i), Value: []byte("v"), Version: int64(i + 1), Origin: "N1"}
+			_, _, err := n1.Replicate(context.Background(), msg, 1, false)
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		if err := <-done; err != nil { t.Fatal(err) }
+	}
+	if n2.Store().Stats().Keys != 20 {
+		t.Fatalf("want 20 keys on peer, got %d", n2.Store().Stats().Keys)
+	}
+	if c := calls.Load(); c >= 20 {
+		t.Fatalf("want writes batched, got %d sync calls", c)
+	}
+}
+
+// A peer dropped after repeated failures takes its worker goroutines with it.
+func TestDroppedPeerStopsWorkers(t *testing.T) {
+	runWorkers := func() int {
+		buf := make([]byte, 1<<20)
+		return strings.Count(string(buf[:runtime.Stack(buf, true)]), ").runWorker(")
+	}
+	before := runWorkers()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", 500)
+	}))
+	defer down.Close()
+	n := NewNode("N1", ":x", []string{down.URL})
+	n.PeerWorkers = 4
+	for i := 0; i < n.maxFailures; i++ {
+		msg := SyncMsg{Op: "set", Key: fmt.Sprint("k", i), Value: []byte("v"), Version: int64(i + 1), Origin: "N1"}
+		n.Replicate(context.Background(), msg, 0, false)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(n.activePeers()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("peer not dropped: %v", n.activePeers())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for runWorkers() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d workers still running for a dropped peer", runWorkers()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	n.workersMu.Lock()
+	defer n.workersMu.Unlock()
+	if len(n.workers) != 0 {
+		t.Fatalf("dropped peer still has a worker pool")
+	}
+}
+
+// Large values are stored and replicated compressed but read back unchanged.
+func TestCompressedValues(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.CompressAbove = 64
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	value := bytes.Repeat([]byte(`{"name":"widget","tags":["a","b"]},`), 100)
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/big?min=1", bytes.NewReader(value))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	for _, n := range []*Node{n1, n2} {
+		it, ok := n.Store().Get("big")
+		if !ok || !it.Compressed || len(it.Value) >= len(value) {
+			t.Fatalf("%s: want compressed value, got compressed=%v len=%d", n.ID, it.Compressed, len(it.Value))
+		}
+	}
+	for _, url := range []string{srv1.URL, srv2.URL} {
+		res, err := http.Get(url + "/kv/big")
+		if err != nil { t.Fatal(err) }
+		b, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if !bytes.Equal(b, value) {
+			t.Fatalf("GET from %s returned %d bytes, want original %d", url, len(b), len(value))
+		}
+	}
+}
+
+// Concurrent misses for one key share a single loader call.
+func TestReadThroughCoalescesMisses(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		if r.URL.Path != "/hot" {
+			w.WriteHeader(404); return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("loaded"))
+	}))
+	defer origin.Close()
+
+	n := NewNode("N", ":x", nil)
+	n.Loader = NewHTTPLoader(origin.URL, http.DefaultClient)
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	bodies := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			res, err := http.Get(srv.URL + "/kv/hot")
+			if err != nil {
+				bodies <- err.Error(); return
+			}
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+			bodies <- string(b)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	for i := 0; i < 10; i++ {
+		if b := <-bodies; b != "loaded" {
+			t.Fatalf("want loaded value, got %q", b)
+		}
+	}
+	if c := calls.Load(); c != 1 {
+		t.Fatalf("want 1 loader call, got %d", c)
+	}
+	if it, ok := n.Store().Get("hot"); !ok || it.ExpiresAt.IsZero() {
+		t.Fatal("loaded value should be cached with the origin's max-age")
+	}
+
+	res, err := http.Get(srv.URL + "/kv/cold")
+	if err != nil { t.Fatal(err) }
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Fatalf("origin miss: want 404, got %d", res.StatusCode)
+	}
+}
+
+// Large values replicate via the streamed sync body and can be read by range.
+func TestLargeValueRangeRead(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	value := make([]byte, 256<<10)
+	for i := range value {
+		value[i] = byte(i % 251)
+	}
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/blob?min=1", bytes.NewReader(value))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", srv2.URL+"/kv/blob", nil)
+	req.Header.Set("Range", "bytes=1000-1999")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent || !bytes.Equal(b, value[1000:2000]) {
+		t.Fatalf("range read: status %d, %d bytes", res.StatusCode, len(b))
+	}
+}
+
+// An overloaded node rejects writes with 503 and Retry-After but keeps serving reads.
+func TestLoadShedding(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.Shed = ShedLimits{Goroutines: 1, RetryAfter: 2 * time.Second}
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/kv/k", bytes.NewReader([]byte("v")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 503 || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("want 503 with Retry-After 2, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	res, err := http.Get(srv.URL + "/kv/k")
+	if err != nil { t.Fatal(err) }
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Fatalf("reads should not be shed, got %d", res.StatusCode)
+	}
+}
+
+// Nodes in one process check their heap limit concurrently without sharing state.
+func TestLoadSheddingHeap(t *testing.T) {
+	nodes := []*Node{NewNode("A", ":x", nil), NewNode("B", ":x", nil)}
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		n.Shed = ShedLimits{HeapBytes: 1}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					n.overload()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	for _, n := range nodes {
+		n.shedCheckedAt.Store(0)
+		if reason := n.overload(); reason != shedHeapFull {
+			t.Fatalf("node %s: overload() = %q, want %q", n.ID, reason, shedHeapFull)
+		}
+	}
+}
+
+// Each client gets its own token bucket; clients over their rate get 429 with Retry-After.
+func TestRateLimit(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("a", "alice")
+	keys.Add("b", "bob")
+	keys.Add("c", "carol")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.RateLimit = RateLimits{Rate: 0.5, Burst: 2, WritesOnly: true, Overrides: map[string]float64{"carol": 0}}
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, key string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/kv/k", bytes.NewReader([]byte("v")))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < 2; i++ {
+		if resp := do("PUT", "a"); resp.StatusCode != 201 {
+			t.Fatalf("PUT %d within burst: status %d", i, resp.StatusCode)
+		}
+	}
+	resp := do("PUT", "a")
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "2" {
+		t.Fatalf("want 429 with Retry-After 2, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if resp := do("GET", "a"); resp.StatusCode != 200 {
+		t.Fatalf("reads should not be limited, got %d", resp.StatusCode)
+	}
+	if resp := do("PUT", "b"); resp.StatusCode != 201 {
+		t.Fatalf("another client was limited: %d", resp.StatusCode)
+	}
+	for i := 0; i < 5; i++ {
+		if resp := do("PUT", "c"); resp.StatusCode != 201 {
+			t.Fatalf("exempt client was limited: %d", resp.StatusCode)
+		}
+	}
+
+	// Anonymous callers behind a trusted proxy get a bucket each; the
+	// header is ignored from anyone else.
+	n = NewNode("P", ":x", nil)
+	n.AccessLog = false
+	n.TrustedProxies, _ = ParseCIDRs("10.0.0.0/8")
+	n.RateLimit = RateLimits{Rate: 0.5, Burst: 1}
+	h := n.Routes()
+	put := func(remote, xff string) int {
+		r := httptest.NewRequest("PUT", "/kv/k", bytes.NewReader([]byte("v")))
+		r.RemoteAddr = remote + ":4000"
+		r.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	for _, tc := range []struct {
+		remote, xff string
+		want        int
+	}{
+		{"10.0.0.5", "203.0.113.7", 201},
+		{"10.0.0.5", "203.0.113.7", 429},
+		{"10.0.0.5", "203.0.113.8", 201},
+		{"192.0.2.1", "203.0.113.9", 201},
+		{"192.0.2.1", "203.0.113.10", 429},
+	} {
+		if got := put(tc.remote, tc.xff); got != tc.want {
+			t.Fatalf("PUT from %s for %s: status %d, want %d", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+
+	var l rateLimiter
+	now := time.Now()
+	l.allow("x", 10, 1, now)
+	if ok, _ := l.allow("x", 10, 1, now.Add(50*time.Millisecond)); ok {
+		t.Fatal("bucket refilled too fast")
+	}
+	if ok, _ := l.allow("x", 10, 1, now.Add(160*time.Millisecond)); !ok {
+		t.Fatal("bucket did not refill")
+	}
+	l.allow("y", 10, 1, now.Add(2*rateSweepEvery))
+	if _, ok := l.buckets["x"]; ok || len(l.buckets) != 1 {
+		t.Fatalf("idle buckets not swept: %v", l.buckets)
+	}
+}
+
+// Oversized bodies get 413, also when they only grow once decompressed, and a
+// client that stalls mid-body is cut off at the request timeout.
+func TestRequestLimits(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Limits = RequestLimits{MaxValueBytes: 10, MaxSyncBytes: 50, Timeout: 200 * time.Millisecond}
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	send := func(method, path string, body []byte, gz bool) int {
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if gz {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	var zipped bytes.Buffer
+	zw := gzip.NewWriter(&zipped)
+	zw.Write(make([]byte, 100))
+	zw.Close()
+	for _, tc := range []struct {
+		name, method, path string
+		body               []byte
+		gz                 bool
+		want               int
+	}{
+		{"value at limit", "PUT", "/kv/k", []byte("0123456789"), false, 201},
+		{"value over limit", "PUT", "/kv/k", []byte("0123456789x"), false, 413},
+		{"gzip bomb", "PUT", "/kv/k", zipped.Bytes(), true, 413},
+		{"sync over limit", "POST", "/sync", bytes.Repeat([]byte(" "), 51), false, 413},
+	} {
+		if got := send(tc.method, tc.path, tc.body, tc.gz); got != tc.want {
+			t.Fatalf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil { t.Fatal(err) }
+	defer conn.Close()
+	fmt.Fprintf(conn, "PUT /kv/slow HTTP/1.1\r\nHost: x\r\nContent-Length: 10\r\n\r\n01")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil { t.Fatal(err) }
+	if !strings.Contains(line, " 408 ") {
+		t.Fatalf("stalled body: got %q, want 408", line)
+	}
+}
+
+// Malformed keys are refused on PUT and dropped from /sync batches, whose
+// other messages still apply.
+func TestKeyRules(t *testing.T) {
+	if _, err := NewKeyRules(0, "z-a", nil); err == nil {
+		t.Fatal("accepted a reversed range")
+	}
+	rules, err := NewKeyRules(10, "a-z0-9:_-", map[string][]string{"tenant-a": {"a:"}})
+	if err != nil { t.Fatal(err) }
+	keys := NewAPIKeys()
+	keys.Add("ka", "tenant-a")
+	keys.Add("kb", "tenant-b")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.KeyRules = rules
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	put := func(key, apiKey string) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key, strings.NewReader("v"))
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, tc := range []struct {
+		key, apiKey string
+		want        int
+	}{
+		{"a:ok", "", 201},
+		{"a:Upper", "", 400},
+		{"a:0123456789", "", 400},
+		{"a%20b", "", 400},
+	} {
+		if got := put(tc.key, tc.apiKey); got != tc.want {
+			t.Fatalf("PUT %s: status %d, want %d", tc.key, got, tc.want)
+		}
+	}
+	n.Auth = keys
+	srv.Config.Handler = n.Routes()
+	for _, tc := range []struct {
+		key, apiKey string
+		want        int
+	}{
+		{"a:1", "ka", 201},
+		{"b:1", "ka", 400},
+		{"b:1", "kb", 201},
+	} {
+		if got := put(tc.key, tc.apiKey); got != tc.want {
+			t.Fatalf("PUT %s with key %s: status %d, want %d", tc.key, tc.apiKey, got, tc.want)
+		}
+	}
+
+	n.store.Put("Old", Item{Value: []byte("v"), Version: 1, Origin: "N"})
+	batch, _ := json.Marshal([]SyncMsg{
+		{Op: "set", Key: "BAD", Value: []byte("x"), Version: 5, Origin: "P"},
+		{Op: "set", Key: "good", Value: []byte("y"), Version: 5, Origin: "P"},
+		{Op: "del", Key: "Old", Version: 5, Origin: "P"},
+	})
+	resp, err := http.Post(srv.URL+"/sync", "application/json", bytes.NewReader(batch))
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 204 {
+		t.Fatalf("sync status %d, want 204", resp.StatusCode)
+	}
+	if _, ok := n.store.Get("BAD"); ok {
+		t.Fatal("sync stored a rejected key")
+	}
+	if it, ok := n.store.Get("good"); !ok || string(it.Value) != "y" {
+		t.Fatalf("good key = %+v, %v", it, ok)
+	}
+	if it, _ := n.store.Get("Old"); !it.Tombstone {
+		t.Fatalf("delete of a nonconforming key not applied: %+v", it)
+	}
+	if got := n.metrics.keysRejected.Load(); got != 1 {
+		t.Fatalf("keysRejected = %d, want 1", got)
+	}
+}
+
+// Allowed origins get CORS headers and preflights are answered before
+// authentication; other origins do not.
+func TestCORS(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("s3cret", "app")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.CORS = &CORSOptions{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}, MaxAge: time.Minute}
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	do := func(method, origin string, hdr map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/kv/k", nil)
+		req.Header.Set("Origin", origin)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp
+	}
+	preflight := map[string]string{"Access-Control-Request-Method": "PUT", "Access-Control-Request-Headers": "authorization"}
+	resp := do("OPTIONS", "https://app.example.com", preflight)
+	if resp.StatusCode != 204 || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Methods"), "PUT") ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") ||
+		resp.Header.Get("Access-Control-Max-Age") != "60" {
+		t.Fatalf("preflight: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := do("OPTIONS", "https://evil.example.com", preflight); resp.StatusCode != 403 {
+		t.Fatalf("preflight from other origin: %d", resp.StatusCode)
+	}
+	resp = do("GET", "https://api.example.org", map[string]string{"Authorization": "Bearer s3cret"})
+	if resp.StatusCode != 404 || resp.Header.Get("Access-Control-Allow-Origin") != "https://api.example.org" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "X-Request-Id") {
+		t.Fatalf("wildcard origin: %d %v", resp.StatusCode, resp.Header)
+	}
+	resp = do("GET", "https://example.org.evil.com", map[string]string{"Authorization": "Bearer s3cret"})
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("disallowed origin got CORS headers: %v", resp.Header)
+	}
+	// A hit varies on both Origin and Accept-Encoding, so a shared cache
+	// cannot hand one origin's Access-Control-Allow-Origin to another.
+	n.store.Put("k", Item{Value: []byte("v"), Version: 1})
+	resp = do("GET", "https://app.example.com", map[string]string{"Authorization": "Bearer s3cret"})
+	vary := strings.Join(resp.Header.Values("Vary"), ",")
+	if resp.StatusCode != 200 || !strings.Contains(vary, "Origin") || !strings.Contains(vary, "Accept-Encoding") {
+		t.Fatalf("hit: %d Vary %q", resp.StatusCode, vary)
+	}
+}
+
+// Every response carries the security headers, HSTS only over TLS; unused
+// methods and oversized headers are refused.
+func TestHardening(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("s3cret", "app")
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.Limits.MaxHeaderBytes = 1 << 10
+	srv := httptest.NewUnstartedServer(n.Routes())
+	srv.StartTLS()
+	defer srv.Close()
+	client := srv.Client()
+
+	do := func(method, path string, hdr map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp
+	}
+	resp := do("GET", "/kv/k", nil)
+	if resp.StatusCode != 401 || resp.Header.Get("X-Content-Type-Options") != "nosniff" ||
+		resp.Header.Get("X-Frame-Options") != "DENY" ||
+		!strings.HasPrefix(resp.Header.Get("Strict-Transport-Security"), "max-age=15552000") {
+		t.Fatalf("unauthenticated GET: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := do("TRACE", "/kv/k", nil); resp.StatusCode != 501 {
+		t.Fatalf("TRACE = %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/kv/k", map[string]string{"X-API-Key": "s3cret"}); resp.StatusCode != 405 || resp.Header.Get("Allow") == "" {
+		t.Fatalf("POST /kv/k = %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp := do("GET", "/kv/k", map[string]string{"X-API-Key": "s3cret", "X-Junk": strings.Repeat("a", 2<<10)}); resp.StatusCode != 431 {
+		t.Fatalf("oversized headers = %d", resp.StatusCode)
+	}
+
+	rr := httptest.NewRecorder()
+	n.Routes().ServeHTTP(rr, httptest.NewRequest("GET", "/stats", nil))
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" || rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Fatalf("plain HTTP headers: %v", rr.Header())
+	}
+}
+
+// Clients may send gzip bodies and receive gzip responses for large values.
+func TestGzipClientEncoding(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	value := bytes.Repeat([]byte("lorem ipsum dolor sit amet "), 200)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(value)
+	zw.Close()
+	req, _ := http.NewRequest("PUT", srv.URL+"/kv/text", &gz)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 201 {
+		t.Fatalf("gzip PUT: status %d", resp.StatusCode)
+	}
+
+	// The default transport asks for gzip and transparently decompresses.
+	res, err := http.Get(srv.URL + "/kv/text")
+	if err != nil { t.Fatal(err) }
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !res.Uncompressed || !bytes.Equal(b, value) {
+		t.Fatalf("want gzip response of the original value, uncompressed=%v len=%d", res.Uncompressed, len(b))
+	}
+}
+
+type discardResponse struct{ h http.Header }
+
+func (d *discardResponse) Header() http.Header         { return d.h }
+func (d *discardResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardResponse) WriteHeader(int)             {}
+
+// Small GETs should not allocate once the access log is off.
+func BenchmarkGetSmall(b *testing.B) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Store().Put("k", Item{Value: []byte("small value"), Version: 1, Origin: "A"})
+	h := n.Routes()
+	req := httptest.NewRequest("GET", "/kv/k", nil)
+	w := &discardResponse{h: http.Header{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clear(w.h)
+		h.ServeHTTP(w, req)
+	}
+}
+
+// Adaptive timeouts follow each peer's observed latency within the configured bounds.
+func TestAdaptivePeerTimeout(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AdaptiveTimeout = true
+	n.ReqTimeout = time.Second
+	if got := n.peerTimeout("lan"); got != time.Second {
+		t.Fatalf("without samples want ReqTimeout, got %s", got)
+	}
+	for i := 0; i < 100; i++ {
+		n.observeLatency("lan", time.Millisecond)
+		n.observeLatency("wan", 200*time.Millisecond)
+	}
+	if got := n.peerTimeout("lan"); got != n.MinReqTimeout {
+		t.Fatalf("fast peer: want MinReqTimeout %s, got %s", n.MinReqTimeout, got)
+	}
+	if got := n.peerTimeout("wan"); got != 600*time.Millisecond {
+		t.Fatalf("slow peer: want 600ms, got %s", got)
+	}
+	for i := 0; i < 100; i++ {
+		n.observeLatency("wan", 2*time.Second)
+	}
+	if got := n.peerTimeout("wan"); got != time.Second {
+		t.Fatalf("capped peer: want ReqTimeout, got %s", got)
+	}
+}
+
+// Heartbeats record their round trip; the RTT summary is reported per peer and
+// stands in for sync latency in the adaptive timeout.
+func TestHeartbeatRTT(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv := httptest.NewServer(n2.Routes())
+	defer srv.Close()
+	n1 := NewNode("N1", ":x", []string{srv.URL})
+	n1.AdaptiveTimeout = true
+	n1.ReqTimeout = time.Second
+	for i := 0; i < latencyMinSamples; i++ {
+		if !n1.heartbeat(context.Background(), srv.URL) {
+			t.Fatal("heartbeat to live peer failed")
+		}
+	}
+	n1.peerStats(srv.URL)
+	h := n1.PeerHealth()[0]
+	if h.HeartbeatRTTMin <= 0 || h.HeartbeatRTTMin > h.HeartbeatRTTAvg || h.HeartbeatRTTAvg > h.HeartbeatRTTP99 {
+		t.Fatalf("rtt min/avg/p99 = %s/%s/%s", h.HeartbeatRTTMin, h.HeartbeatRTTAvg, h.HeartbeatRTTP99)
+	}
+	if got := n1.peerTimeout(srv.URL); got != n1.MinReqTimeout {
+		t.Fatalf("peerTimeout from heartbeat RTT = %s, want %s", got, n1.MinReqTimeout)
+	}
+	if n1.heartbeat(context.Background(), srv.URL+"/nope") {
+		t.Fatal("heartbeat to a 404 should fail")
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false // metrics are recorded either way
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/kv/k", bytes.NewReader([]byte("v")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	for _, k := range []string{"k", "k", "missing"} {
+		res, err := http.Get(srv.URL + "/kv/" + k)
+		if err != nil { t.Fatal(err) }
+		res.Body.Close()
+	}
+
+	res, err := http.Get(srv.URL + "/metrics")
+	if err != nil { t.Fatal(err) }
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	for _, want := range []string{
+		"cache_hits_total 2\n",
+		"cache_misses_total 1\n",
+		"cache_sets_total 1\n",
+		"cache_keys 1\n",
+		`cache_http_request_duration_seconds_count{route="get"} 3` + "\n",
+		"# TYPE cache_http_request_duration_seconds histogram\n",
+		`cache_http_requests_total{route="get",code="200"} 2` + "\n",
+		`cache_http_requests_total{route="get",code="404"} 1` + "\n",
+		`cache_http_requests_total{route="put",code="201"} 1` + "\n",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Fatalf("metrics missing %q:\n%s", want, b)
+		}
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *spanRecorder) ExportSpan(s *Span) {
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+}
+
+func TestParseSampler(t *testing.T) {
+	s, err := ParseSampler("get=0.01, *=0.5")
+	if err != nil { t.Fatal(err) }
+	if got, want := s.String(), "get=0.01,put=0.5,delete=0.5,sync=0.5,health=0.5,admin=0.5,other=0.5,errors=1"; got != want {
+		t.Fatalf("sampler = %s, want %s", got, want)
+	}
+	for _, bad := range []string{"get", "get=2", "bogus=1", "put=x"} {
+		if _, err := ParseSampler(bad); err == nil {
+			t.Fatalf("ParseSampler(%q) accepted", bad)
+		}
+	}
+}
+
+// Unsampled requests record no spans unless they fail; callers' traces are always kept.
+func TestTraceSampling(t *testing.T) {
+	rec := &spanRecorder{}
+	n := NewNode("N", ":x", nil)
+	n.Tracer = rec
+	n.AccessLog = false
+	n.TraceSampler, _ = ParseSampler("*=0")
+	status := 200
+	h := n.logging(n.traceHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := n.startSpan(r.Context(), "store.get")
+		span.End()
+		w.WriteHeader(status)
+	})))
+	serve := func(traceparent string) {
+		req := httptest.NewRequest("GET", "/kv/k", nil)
+		if traceparent != "" {
+			req.Header.Set("Traceparent", traceparent)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	names := func() (out []string) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		for _, s := range rec.spans {
+			out = append(out, s.Name+"/"+s.Attrs["http.status"]+"/"+s.Attrs["sampled"])
+		}
+		rec.spans = nil
+		return out
+	}
+
+	serve("")
+	if got := names(); len(got) != 0 {
+		t.Fatalf("unsampled request traced: %v", got)
+	}
+	status = 503
+	serve("")
+	if got := names(); !reflect.DeepEqual(got, []string{"http.get/503/error"}) {
+		t.Fatalf("failed request: %v", got)
+	}
+	status = 200
+	serve("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if got := names(); !reflect.DeepEqual(got, []string{"store.get//", "http.get/200/"}) {
+		t.Fatalf("caller-sampled request: %v", got)
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	var out syncBuffer
+	n := NewNode("N", ":x", nil)
+	n.AccessLogFormat, n.AccessLogOutput = "json", &out
+	n.LogSampler, _ = ParseSampler("get=0")
+	h := n.logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kv/bad" {
+			w.WriteHeader(500)
+		}
+	}))
+	for _, path := range []string{"/kv/a", "/kv/bad", "/kv/b"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/kv/a", nil))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"uri":"/kv/bad"`) || !strings.Contains(lines[1], `"method":"PUT"`) {
+		t.Fatalf("sampled log = %q", lines)
+	}
+}
+
+// A client's trace continues through replication onto the peer.
+func TestTracePropagation(t *testing.T) {
+	rec := &spanRecorder{}
+	n2 := NewNode("N2", ":y", nil)
+	n2.Tracer = rec
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.Tracer = rec
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/k?min=1", bytes.NewReader([]byte("v")))
+	req.Header.Set("Traceparent", parent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+
+	want, _ := parseTraceparent(parent)
+	seen := map[string]bool{}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, s := range rec.spans {
+		if s.Context.TraceID != want.TraceID {
+			t.Fatalf("span %s on %s has a different trace", s.Name, s.Node)
+		}
+		seen[s.Node+"/"+s.Name] = true
+	}
+	for _, k := range []string{"N1/http.put", "N1/store.put", "N1/replicate", "N1/sync.send", "N2/http.sync", "N2/sync.apply"} {
+		if !seen[k] {
+			t.Fatalf("missing span %s; got %v", k, seen)
+		}
+	}
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// A client's X-Request-ID is echoed and shows up in the peer's log when it applies the write.
+func TestRequestIDPropagation(t *testing.T) {
+	var logs syncBuffer
+	n2 := NewNode("N2", ":y", nil)
+	n2.SetLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.BatchWindow = time.Millisecond // the ID must survive msgpack batches, not just the header
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/k?min=1", bytes.NewReader([]byte("v")))
+	req.Header.Set("X-Request-ID", "req-123")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); got != "req-123" {
+		t.Fatalf("X-Request-ID = %q, want req-123", got)
+	}
+	if !strings.Contains(logs.String(), `"msg":"sync applied","node_id":"N2"`) || !strings.Contains(logs.String(), `"request_id":"req-123"`) {
+		t.Fatalf("peer log does not mention the request:\n%s", logs.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", srv1.URL+"/kv/k", nil)
+	req.Header.Set("X-Request-ID", "has spaces in it")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); len(got) != 16 {
+		t.Fatalf("invalid client ID should be replaced by a generated one, got %q", got)
+	}
+}
+
+func TestDebugRoutes(t *testing.T) {
+	n := NewNode("N1", ":x", nil)
+	srv := httptest.NewServer(n.DebugRoutes())
+	defer srv.Close()
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("GET %s = %d", path, resp.StatusCode)
+		}
+	}
+	// The client-facing routes must not expose profiles.
+	rr := httptest.NewRecorder()
+	n.Routes().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != 404 {
+		t.Fatalf("Routes served /debug/pprof/ with %d", rr.Code)
+	}
+}
+
+// The admin listener serves /admin/* and /debug/* to allowed networks; with
+// AdminSeparate the public routes no longer serve /admin/*.
+func TestAdminRoutes(t *testing.T) {
+	n := NewNode("N1", ":x", nil)
+	n.AccessLog = false
+	get := func(h http.Handler, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil)) // from 192.0.2.1
+		return rr.Code
+	}
+	if code := get(n.Routes(), "/admin/recent"); code != 200 {
+		t.Fatalf("public /admin/recent = %d", code)
+	}
+	n.AdminSeparate = true
+	if code := get(n.Routes(), "/admin/recent"); code != 404 {
+		t.Fatalf("public /admin/recent with AdminSeparate = %d", code)
+	}
+	for _, path := range []string{"/admin/recent", "/admin/hotkeys", "/debug/vars"} {
+		if code := get(n.AdminRoutes(), path); code != 200 {
+			t.Fatalf("admin %s = %d", path, code)
+		}
+	}
+	nets, err := ParseCIDRs("10.0.0.0/8, 192.0.2.1, ::1")
+	if err != nil { t.Fatal(err) }
+	n.AdminAllow = nets
+	if code := get(n.AdminRoutes(), "/admin/recent"); code != 200 {
+		t.Fatalf("allowed address got %d", code)
+	}
+	n.AdminAllow = nets[:1]
+	if code := get(n.AdminRoutes(), "/debug/vars"); code != 403 {
+		t.Fatalf("address outside allowlist got %d", code)
+	}
+	if _, err := ParseCIDRs("10.0.0.0/33"); err == nil {
+		t.Fatal("accepted a bad network")
+	}
+
+	n.AdminAllow = nil
+	n.DisableDangerous = true
+	rr := httptest.NewRecorder()
+	n.AdminRoutes().ServeHTTP(rr, httptest.NewRequest("POST", "/admin/restore?to=1", nil))
+	if rr.Code != 403 {
+		t.Fatalf("restore with DisableDangerous = %d", rr.Code)
+	}
+	if recs := n.auditLog.query(AuditQuery{Op: "restore"}); len(recs) != 1 || recs[0].Status != 403 {
+		t.Fatalf("refused restore not audited: %+v", recs)
+	}
+}
+
+func TestPeerHealth(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	live := httptest.NewServer(n2.Routes())
+	defer live.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	n1 := NewNode("N1", ":x", []string{live.URL, dead.URL})
+	srv := httptest.NewServer(n1.Routes())
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/kv/k?min=1", bytes.NewReader([]byte("hello")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+
+	health := map[string]PeerHealth{}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		for _, h := range n1.PeerHealth() {
+			health[h.Peer] = h
+		}
+		if health[live.URL].Acks == 1 && health[dead.URL].Failures == 1 {
+			break
+		}
+	}
+	if h := health[live.URL]; h.Acks != 1 || h.BytesReplicated != 5 || h.LastSuccess.IsZero() || h.AvgLatency <= 0 || h.ConsecutiveFailures != 0 {
+		t.Fatalf("live peer health = %+v", h)
+	}
+	if h := health[dead.URL]; h.Failures != 1 || h.ConsecutiveFailures != 1 || !h.LastSuccess.IsZero() {
+		t.Fatalf("dead peer health = %+v", h)
+	}
+
+	rr := httptest.NewRecorder()
+	n1.handleMetrics(rr, httptest.NewRequest("GET", "/metrics", nil))
+	want := `cache_peer_consecutive_failures{peer="` + dead.URL + `"} 1` + "\n"
+	if !strings.Contains(rr.Body.String(), want) {
+		t.Fatalf("metrics missing %q:\n%s", want, rr.Body.String())
+	}
+}
+
+type auditRecorder struct {
+	mu   sync.Mutex
+	recs []AuditRecord
+}
+
+func (a *auditRecorder) Audit(rec AuditRecord) {
+	a.mu.Lock()
+	a.recs = append(a.recs, rec)
+	a.mu.Unlock()
+}
+
+// Client writes are audited once, on the node that took them, not on peers.
+func TestAuditLog(t *testing.T) {
+	peerAudit := &auditRecorder{}
+	n2 := NewNode("N2", ":y", nil)
+	n2.Audit = peerAudit
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	audit := &auditRecorder{}
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.Audit = audit
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/k?min=1", bytes.NewReader([]byte("v")))
+	req.Header.Set("X-Request-ID", "r1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	req, _ = http.NewRequest("DELETE", srv1.URL+"/kv/k?min=1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+
+	if len(audit.recs) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(audit.recs))
+	}
+	set, del := audit.recs[0], audit.recs[1]
+	if set.Op != "set" || set.Key != "k" || set.Origin != "N1" || set.Client != "127.0.0.1" || set.RequestID != "r1" || set.Version == 0 {
+		t.Fatalf("set record = %+v", set)
+	}
+	if del.Op != "del" || del.Version <= set.Version {
+		t.Fatalf("del record = %+v", del)
+	}
+	if it, _ := n1.store.Get("k"); it.Version != del.Version {
+		t.Fatalf("audited version %d, stored %d", del.Version, it.Version)
+	}
+	peerAudit.mu.Lock()
+	defer peerAudit.mu.Unlock()
+	if len(peerAudit.recs) != 0 {
+		t.Fatalf("peer audited replicated writes: %+v", peerAudit.recs)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	n := NewNode("N", ":x", []string{"http://127.0.0.1:1"})
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	n.store.Put("k", Item{Value: []byte("v"), Version: 1})
+	n.store.Put("gone", Item{Version: 1, Tombstone: true})
+	for _, k := range []string{"k", "k", "k", "missing"} {
+		res, err := http.Get(srv.URL + "/kv/" + k)
+		if err != nil { t.Fatal(err) }
+		res.Body.Close()
+	}
+
+	res, err := http.Get(srv.URL + "/stats")
+	if err != nil { t.Fatal(err) }
+	defer res.Body.Close()
+	var st NodeStats
+	if err := json.NewDecoder(res.Body).Decode(&st); err != nil { t.Fatal(err) }
+	if st.NodeID != "N" || st.HitRatio != 0.75 || st.Store.Keys != 2 || st.Store.Tombstones != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+	if st.Runtime.Goroutines == 0 || st.Replication.PeersActive != 1 || st.UptimeSeconds <= 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	for _, m := range []string{"PUT", "DELETE"} {
+		req, _ := http.NewRequest(m, srv.URL+"/kv/k", strings.NewReader("v"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/admin/dashboard")
+	if err != nil { t.Fatal(err) }
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") || !bytes.Contains(page, []byte("<title>")) {
+		t.Fatalf("dashboard page: %s %q", resp.Header.Get("Content-Type"), page[:min(len(page), 64)])
+	}
+
+	resp, err = http.Get(srv.URL + "/admin/dashboard?format=json")
+	if err != nil { t.Fatal(err) }
+	var d DashboardData
+	err = json.NewDecoder(resp.Body).Decode(&d)
+	resp.Body.Close()
+	if err != nil { t.Fatal(err) }
+	if d.Node.NodeID != "N" || d.Cluster.Nodes != 1 || len(d.Recent) != 2 {
+		t.Fatalf("dashboard data = %+v", d)
+	}
+	if d.Recent[0].Op != "del" || d.Recent[1].Op != "set" || d.Recent[0].Key != "k" {
+		t.Fatalf("recent ops not newest first: %+v", d.Recent)
+	}
+}
+
+// The recent operations ring keeps only the newest entries, also across a resize.
+func TestRecentOpsWraps(t *testing.T) {
+	var o recentOps
+	o.resize(10)
+	for i := 0; i < 15; i++ {
+		o.add(OpRecord{Version: int64(i)})
+	}
+	got := o.list("", "", 100)
+	if len(got) != 10 || got[0].Version != 14 || got[9].Version != 5 {
+		t.Fatalf("list = %d entries, first %d, last %d", len(got), got[0].Version, got[len(got)-1].Version)
+	}
+	o.resize(3)
+	o.add(OpRecord{Version: 15})
+	if got := o.list("", "", 100); len(got) != 3 || got[0].Version != 15 || got[2].Version != 13 {
+		t.Fatalf("after resize = %+v", got)
+	}
+	o.resize(0)
+	o.add(OpRecord{Version: 16})
+	if got := o.list("", "", 100); len(got) != 0 {
+		t.Fatalf("disabled ring kept %+v", got)
+	}
+}
+
+// The recent operations show who overwrote a key, including sync writes that lost.
+func TestRecentOps(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	req, _ := http.NewRequest("PUT", srv.URL+"/kv/k", strings.NewReader("mine"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	n.applySync(
+		SyncMsg{Op: "set", Key: "k", Value: []byte("theirs"), Version: time.Now().Add(time.Hour).UnixNano(), Origin: "P"},
+		SyncMsg{Op: "set", Key: "k", Value: []byte("old"), Version: 1, Origin: "Q"},
+		SyncMsg{Op: "set", Key: "other", Value: []byte("x"), Version: 1, Origin: "Q"},
+	)
+
+	resp, err = http.Get(srv.URL + "/admin/recent?key=k")
+	if err != nil { t.Fatal(err) }
+	var ops []OpRecord
+	json.NewDecoder(resp.Body).Decode(&ops)
+	resp.Body.Close()
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.Source+"/"+op.Origin+"/"+op.Outcome)
+	}
+	want := []string{"sync/Q/stale", "sync/P/applied", "client/N/applied"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("recent ops for k = %v, want %v", got, want)
+	}
+	if ops := n.RecentOps("", 2); len(ops) != 2 || ops[0].Key != "other" {
+		t.Fatalf("RecentOps limit: %+v", ops)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	peer := httptest.NewServer(http.NotFoundHandler())
+	peer.Close()
+	n := NewNode("N", ":x", []string{peer.URL})
+	n.store.Put("k", Item{Value: []byte("0123456789"), Version: 1})
+	a := newAlerter(n, AlertOptions{MinHitRatio: 0.5, MinGets: 4, PeerDownFor: time.Minute, MaxBytes: 1})
+	names := func(as []Alert) (out []string) {
+		for _, al := range as {
+			out = append(out, al.Status+" "+al.Name)
+		}
+		return out
+	}
+
+	now := time.Now()
+	n.metrics.hits.Add(1)
+	n.metrics.misses.Add(3)
+	n.bumpFail(peer.URL, false)
+	got := names(a.check(now))
+	want := []string{"firing hit_ratio_low", "firing memory_high"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("first check = %v, want %v", got, want)
+	}
+	if got := a.check(now.Add(30 * time.Second)); len(got) != 0 {
+		t.Fatalf("alerts repeated while firing: %v", names(got))
+	}
+	got = names(a.check(now.Add(time.Minute)))
+	if !reflect.DeepEqual(got, []string{"firing peer_down:" + peer.URL}) {
+		t.Fatalf("peer down after PeerDownFor: %v", got)
+	}
+
+	n.metrics.hits.Add(10)
+	n.bumpFail(peer.URL, true)
+	a.opts.MaxBytes = 1 << 20
+	got = names(a.check(now.Add(2 * time.Minute)))
+	want = []string{"resolved hit_ratio_low", "resolved peer_down:" + peer.URL, "resolved memory_high"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolve check = %v, want %v", got, want)
+	}
+
+	var body Alert
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer hook.Close()
+	a.opts.Webhook, a.opts.Client = hook.URL, hook.Client()
+	a.notify(context.Background(), Alert{Text: "[firing] memory_high on N: x", Name: "memory_high", Status: AlertFiring})
+	if body.Text == "" || body.Name != "memory_high" {
+		t.Fatalf("webhook body = %+v", body)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	rr := httptest.NewRecorder()
+	n.Routes().ServeHTTP(rr, httptest.NewRequest("GET", "/version", nil))
+	var v struct {
+		NodeID string `json:"node_id"`
+		BuildInfo
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&v); err != nil { t.Fatal(err) }
+	if v.NodeID != "N" || v.Version != version || v.GoVersion == "" {
+		t.Fatalf("version = %+v", v)
+	}
+	if b := (BuildInfo{Version: "v1.2.0", Commit: "abc123"}); b.String() != "v1.2.0 (abc123)" {
+		t.Fatalf("String() = %q", b.String())
+	}
+}
+
+func TestClusterStats(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL, "http://127.0.0.1:1"})
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+	n1.store.Put("a", Item{Value: []byte("1"), Version: 1})
+	n1.store.Put("b", Item{Value: []byte("2"), Version: 1})
+	n1.store.Put("c", Item{Value: []byte("3"), Version: 1})
+	n1.store.Put("d", Item{Value: []byte("4"), Version: 1})
+	n2.store.Put("a", Item{Value: []byte("1"), Version: 1})
+
+	res, err := http.Get(srv1.URL + "/cluster/stats")
+	if err != nil { t.Fatal(err) }
+	defer res.Body.Close()
+	var cs ClusterStats
+	if err := json.NewDecoder(res.Body).Decode(&cs); err != nil { t.Fatal(err) }
+	if cs.Nodes != 3 || cs.Unreachable != 1 || cs.TotalKeys != 5 {
+		t.Fatalf("cluster stats = %+v", cs)
+	}
+	if cs.MinLiveKeys != 1 || cs.MaxLiveKeys != 4 || cs.KeySpread != 0.75 {
+		t.Fatalf("divergence = min %d max %d spread %v", cs.MinLiveKeys, cs.MaxLiveKeys, cs.KeySpread)
+	}
+	if cs.MixedVersions || cs.Versions[Build().String()] != 2 {
+		t.Fatalf("versions = %v (mixed %v)", cs.Versions, cs.MixedVersions)
+	}
+	if cs.PerNode[0].NodeID != "N1" || cs.PerNode[0].Stats != nil {
+		t.Fatalf("self entry = %+v", cs.PerNode[0])
+	}
+}
+
+func TestHealthDetail(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	n := NewNode("N", ":x", []string{dead.URL})
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	get := func(q string) (*http.Response, HealthReport) {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/health" + q)
+		if err != nil { t.Fatal(err) }
+		defer res.Body.Close()
+		var rep HealthReport
+		if q != "" {
+			if err := json.NewDecoder(res.Body).Decode(&rep); err != nil { t.Fatal(err) }
+		}
+		return res, rep
+	}
+
+	if res, rep := get("?detail=true"); res.StatusCode != 200 || rep.Status != HealthOK {
+		t.Fatalf("fresh node: %d %+v", res.StatusCode, rep)
+	}
+
+	n.bumpFail(dead.URL, false)
+	if res, rep := get("?detail=true"); res.StatusCode != 200 || rep.Status != HealthDegraded || rep.Components["peers"].Status != HealthDegraded {
+		t.Fatalf("with an unreachable peer: %d %+v", res.StatusCode, rep)
+	}
+
+	if err := n.OpenWAL(filepath.Join(t.TempDir(), "wal"), 0); err != nil { t.Fatal(err) }
+	n.wal.Close()
+	n.apply("k", Item{Value: []byte("v"), Version: 1})
+	if res, rep := get("?detail=true"); res.StatusCode != 503 || rep.Status != HealthUnhealthy || rep.Components["persistence"].Status != HealthUnhealthy {
+		t.Fatalf("with a failing wal: %d %+v", res.StatusCode, rep)
+	}
+	// Heartbeats keep seeing a plain ok.
+	if res, _ := get(""); res.StatusCode != 200 {
+		t.Fatalf("plain /health = %d", res.StatusCode)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n := NewNode("N", ":x", []string{srv2.URL})
+	n.MinReadyPeers = 1
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	status := func(path string) int {
+		t.Helper()
+		res, err := http.Get(srv.URL + path)
+		if err != nil { t.Fatal(err) }
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	if got := status("/readyz"); got != 200 {
+		t.Fatalf("readyz = %d, want 200", got)
+	}
+	done := n.Bootstrap()
+	if got := status("/readyz"); got != 503 {
+		t.Fatalf("readyz while bootstrapping = %d, want 503", got)
+	}
+	if got := status("/healthz"); got != 200 {
+		t.Fatalf("healthz while bootstrapping = %d, want 200", got)
+	}
+	done()
+
+	res, err := http.Post(srv.URL+"/admin/maintenance?on=true", "", nil)
+	if err != nil { t.Fatal(err) }
+	res.Body.Close()
+	if got := status("/readyz"); got != 503 {
+		t.Fatalf("readyz in maintenance = %d, want 503", got)
+	}
+	n.SetMaintenance(false)
+
+	for i := 0; i < 3; i++ {
+		n.bumpFail(srv2.URL, false)
+	}
+	if got := status("/readyz"); got != 503 {
+		t.Fatalf("readyz without peers = %d, want 503", got)
+	}
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	for _, format := range []string{"combined", "json"} {
+		var out syncBuffer
+		n := NewNode("N", ":x", nil)
+		n.AccessLogFormat, n.AccessLogOutput = format, &out
+		n.store.Put("k", Item{Value: []byte("hello"), Version: 1})
+		srv := httptest.NewServer(n.Routes())
+		req, _ := http.NewRequest("GET", srv.URL+"/kv/k?x=1", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("X-Request-ID", "rid-1")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		res.Body.Close()
+		srv.Close()
+
+		line := out.String()
+		switch format {
+		case "combined":
+			// 127.0.0.1 - - [16/Oct/2026:10:00:00 +0000] "GET /kv/k?x=1 HTTP/1.1" 200 5 "-" "test-agent"
+			if !strings.HasPrefix(line, "127.0.0.1 - - [") || !strings.HasSuffix(line, `] "GET /kv/k?x=1 HTTP/1.1" 200 5 "-" "test-agent"`+"\n") {
+				t.Fatalf("combined line = %q", line)
+			}
+		case "json":
+			var rec map[string]any
+			if err := json.Unmarshal([]byte(line), &rec); err != nil { t.Fatalf("%v: %q", err, line) }
+			if rec["remote"] != "127.0.0.1" || rec["status"] != 200.0 || rec["bytes"] != 5.0 || rec["user_agent"] != "test-agent" || rec["request_id"] != "rid-1" {
+				t.Fatalf("json record = %v", rec)
+			}
+		}
+	}
+}
+
+func TestStatsDPush(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer pc.Close()
+	n := NewNode("N", ":x", []string{"http://peer:1"})
+	n.store.Put("k", Item{Value: []byte("v"), Version: 1})
+	n.metrics.hits.Add(3)
+	n.recordSend("http://peer:1", []SyncMsg{{Value: []byte("abc")}}, time.Millisecond, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.StatsDLoop(ctx, StatsDOptions{Addr: pc.LocalAddr().String(), Prefix: "cache.", Tags: []string{"env:test"}, DogStatsD: true, Interval: 10 * time.Millisecond})
+
+	buf := make([]byte, 64<<10)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	size, _, err := pc.ReadFrom(buf)
+	if err != nil { t.Fatal(err) }
+	got := string(buf[:size])
+	for _, want := range []string{
+		"cache.hits:3|c|#env:test\n",
+		"cache.keys:1|g|#env:test\n",
+		"cache.replication.acks:1|c|#env:test,peer:http://peer:1\n",
+	} {
+		if !strings.Contains(got+"\n", want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+	// Counters are sent as deltas, so an idle second push has no hits line.
+	size, _, err = pc.ReadFrom(buf)
+	if err != nil { t.Fatal(err) }
+	if strings.Contains(string(buf[:size]), "cache.hits:") {
+		t.Fatalf("second push repeated the hits counter:\n%s", buf[:size])
+	}
+}
+
+// A session token from a write on one node lets a lagging node serve that
+// write (or delete) by fetching it from the node that took it.
+func TestSessionReadYourWrites(t *testing.T) {
+	n1, n2 := NewNode("N1", ":x", nil), NewNode("N2", ":y", nil)
+	n1.AccessLog, n2.AccessLog = false, false
+	srv1, srv2 := httptest.NewServer(n1.Routes()), httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n2.peers = map[string]struct{}{srv1.URL: {}}
+	if !n2.heartbeat(context.Background(), srv1.URL) {
+		t.Fatal("heartbeat failed")
+	}
+	n2.Store().Put("k", Item{Value: []byte("stale"), Version: 1, Origin: "N2"})
+
+	do := func(method, url, token string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, url, strings.NewReader("fresh"))
+		if token != "" {
+			req.Header.Set(sessionHeader, token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(b)
+	}
+	resp, _ := do("PUT", srv1.URL+"/kv/k", "")
+	token := resp.Header.Get(sessionHeader)
+	if resp.StatusCode != 201 || token == "" {
+		t.Fatalf("PUT: %d, token %q", resp.StatusCode, token)
+	}
+	if _, body := do("GET", srv2.URL+"/kv/k", ""); body != "stale" {
+		t.Fatalf("without a session: %q", body)
+	}
+	if resp, body := do("GET", srv2.URL+"/kv/k", token); resp.StatusCode != 200 || body != "fresh" {
+		t.Fatalf("with a session: %d %q", resp.StatusCode, body)
+	}
+	if resp, _ := do("GET", srv2.URL+"/kv/other", token); resp.StatusCode != 404 {
+		t.Fatalf("unwritten key with a session: %d", resp.StatusCode)
+	}
+
+	resp, _ = do("DELETE", srv1.URL+"/kv/k", token)
+	token = resp.Header.Get(sessionHeader)
+	if resp, _ := do("GET", srv2.URL+"/kv/k", token); resp.StatusCode != 404 {
+		t.Fatalf("deleted key with a session: %d", resp.StatusCode)
+	}
+	if n2.metrics.sessionProxied.Load() != 2 {
+		t.Fatalf("proxied %d session reads, want 2", n2.metrics.sessionProxied.Load())
+	}
+
+	future := session{"N1": time.Now().Add(time.Hour).UnixNano()}.encode()
+	if resp, _ := do("GET", srv2.URL+"/kv/k", future); resp.StatusCode != 400 {
+		t.Fatalf("token from the future: %d", resp.StatusCode)
+	}
+	srv1.Close()
+	if resp, _ := do("GET", srv2.URL+"/kv/k", token); resp.StatusCode != 503 {
+		t.Fatalf("unreachable writer: %d", resp.StatusCode)
+	}
+	// A local copy as new as the session's writes needs no other node.
+	n2.Store().Put("k", Item{Value: []byte("newer"), Version: time.Now().UnixNano(), Origin: "N2"})
+	if resp, body := do("GET", srv2.URL+"/kv/k", token); resp.StatusCode != 200 || body != "newer" {
+		t.Fatalf("up-to-date local copy: %d %q", resp.StatusCode, body)
+	}
+}
+
+// An OnSet hook may write back to the node, even while RestoreTo waits to
+// exclude writers.
+func TestHookWritesBack(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	if err := n.OpenWAL(filepath.Join(t.TempDir(), "wal"), 0); err != nil { t.Fatal(err) }
+	restored := make(chan error, 1)
+	n.OnSet(func(key string, it Item) {
+		if strings.HasPrefix(key, "idx:") {
+			return
+		}
+		go func() { restored <- n.RestoreTo(1 << 62) }()
+		time.Sleep(20 * time.Millisecond) // let RestoreTo queue for the lock
+		if err := n.Set(context.Background(), "idx:"+string(it.Value), []byte(key), 0, 0, false); err != nil {
+			t.Error(err)
+		}
+	})
+	done := make(chan error, 1)
+	go func() { done <- n.Set(context.Background(), "k", []byte("v"), 0, 0, false) }()
+	select {
+	case err := <-done:
+		if err != nil { t.Fatal(err) }
+	case <-time.After(5 * time.Second):
+		t.Fatal("Set from an OnSet hook deadlocked")
+	}
+	if err := <-restored; err != nil { t.Fatal(err) }
+	if got, err := n.Get(context.Background(), "idx:v"); err != nil || string(got) != "k" {
+		t.Fatalf("idx:v = %q, %v", got, err)
+	}
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+}
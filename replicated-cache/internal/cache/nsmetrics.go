@@ -0,0 +1,140 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements per-namespace metrics (a namespace is the key prefix before ':', see
+namespaceOf). Once enabled with Store.TrackNamespaces, the store keeps key and byte counts,
+evictions and expirations per namespace, and the node adds hits and misses. To keep label
+cardinality bounded, only the first max namespaces seen get their own counters; later ones are
+pooled under "_other", and keys without a namespace are counted under "_none".
+
+Functions:
+- (*Store) TrackNamespaces(max int)
+- (*Store) nsCounters(key string): *nsCounters
+- (*nsTable) get(ns string): *nsCounters
+- (*nsTable) reset(d *storeData)
+- (*Store) NamespaceStats(): map[string]NamespaceStats
+*/
+
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	nsOther = "_other"
+	nsNone  = "_none"
+)
+
+// NamespaceStats are the counters kept for one namespace.
+type NamespaceStats struct {
+	Keys        int64  `json:"keys"`
+	Bytes       int64  `json:"bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+type nsCounters struct {
+	keys, bytes                          atomic.Int64
+	hits, misses, evictions, expirations atomic.Uint64
+}
+
+type nsTable struct {
+	max   int
+	m     sync.Map // namespace -> *nsCounters
+	n     atomic.Int32
+	other nsCounters
+}
+
+// TrackNamespaces turns on per-namespace metrics for up to max namespaces.
+// Call it before the store is used; existing entries are counted once now.
+func (s *Store) TrackNamespaces(max int) {
+	if max <= 0 {
+		s.ns.Store(nil)
+		return
+	}
+	t := &nsTable{max: max}
+	t.reset(s.data.Load())
+	s.ns.Store(t)
+}
+
+// nsCounters returns the counters for key's namespace, or nil when
+// namespace metrics are off.
+func (s *Store) nsCounters(key string) *nsCounters {
+	t := s.ns.Load()
+	if t == nil {
+		return nil
+	}
+	ns := namespaceOf(key)
+	if ns == "" {
+		ns = nsNone
+	}
+	return t.get(ns)
+}
+
+func (t *nsTable) get(ns string) *nsCounters {
+	if c, ok := t.m.Load(ns); ok {
+		return c.(*nsCounters)
+	}
+	if int(t.n.Load()) >= t.max {
+		return &t.other
+	}
+	c, loaded := t.m.LoadOrStore(ns, new(nsCounters))
+	if !loaded {
+		t.n.Add(1)
+	}
+	return c.(*nsCounters)
+}
+
+// reset recounts keys and bytes from d, e.g. after the store's contents were
+// replaced by a restore.
+func (t *nsTable) reset(d *storeData) {
+	t.m.Range(func(_, c any) bool {
+		c.(*nsCounters).keys.Store(0)
+		c.(*nsCounters).bytes.Store(0)
+		return true
+	})
+	t.other.keys.Store(0)
+	t.other.bytes.Store(0)
+	d.m.Range(func(k, v any) bool {
+		ns := namespaceOf(k.(string))
+		if ns == "" {
+			ns = nsNone
+		}
+		c := t.get(ns)
+		c.keys.Add(1)
+		c.bytes.Add(itemSize(k.(string), v.(*Item)))
+		return true
+	})
+}
+
+// NamespaceStats returns the per-namespace counters, or nil when namespace
+// metrics are off.
+func (s *Store) NamespaceStats() map[string]NamespaceStats {
+	t := s.ns.Load()
+	if t == nil {
+		return nil
+	}
+	out := make(map[string]NamespaceStats)
+	snap := func(c *nsCounters) NamespaceStats {
+		return NamespaceStats{
+			Keys: c.keys.Load(), Bytes: c.bytes.Load(),
+			Hits: c.hits.Load(), Misses: c.misses.Load(),
+			Evictions: c.evictions.Load(), Expirations: c.expirations.Load(),
+		}
+	}
+	t.m.Range(func(k, c any) bool {
+		out[k.(string)] = snap(c.(*nsCounters))
+		return true
+	})
+	if t.n.Load() >= int32(t.max) {
+		out[nsOther] = snap(&t.other)
+	}
+	return out
+}
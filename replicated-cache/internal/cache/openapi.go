@@ -0,0 +1,50 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file serves GET /openapi.json, an OpenAPI 3.1 description of the HTTP API: the kv, watch,
+pub/sub, sync, health, stats and admin endpoints with their query parameters, headers, status codes
+and JSON bodies, so clients in other languages can be generated from it. The document
+(openapi.json, embedded in the binary) is written by hand next to the handlers; a test checks that
+every route registered in Routes and AdminRoutes appears in it. info.version is this node's build
+version. Like /version, it needs no credentials.
+
+Functions:
+- openAPIDoc(): []byte
+- (*Node) handleOpenAPI(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIDoc is openAPISpec with info.version set to the build version.
+var openAPIDoc = sync.OnceValue(func() []byte {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		panic("cache: bad embedded openapi.json: " + err.Error())
+	}
+	if info, ok := doc["info"].(map[string]any); ok {
+		info["version"] = Build().Version
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+})
+
+func (n *Node) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDoc())
+}
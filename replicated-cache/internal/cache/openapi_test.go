@@ -0,0 +1,84 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the OpenAPI document served on /openapi.json.
+
+List of functions:
+	- TestOpenAPICoversRoutes: Tests that every registered route is described and every $ref resolves.
+	- TestOpenAPIServed: Tests that /openapi.json serves the document with the build version.
+*/
+
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil { t.Fatal(err) }
+	route := regexp.MustCompile(`HandleFunc\("([A-Z]+) (/[^"]*)"`)
+	routes := 0
+	for _, file := range []string{"http.go", "admin.go"} {
+		src, err := os.ReadFile(file)
+		if err != nil { t.Fatal(err) }
+		for _, m := range route.FindAllStringSubmatch(string(src), -1) {
+			method, path := strings.ToLower(m[1]), m[2]
+			if path == "/kv/" {
+				path = "/kv/{key}"
+			}
+			routes++
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("%s %s is not in openapi.json", m[1], path)
+			}
+		}
+	}
+	if routes < 20 {
+		t.Fatalf("found only %d routes; has registration changed?", routes)
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(openAPISpec, &all); err != nil { t.Fatal(err) }
+	for _, m := range regexp.MustCompile(`"\$ref": "#/([^"]+)"`).FindAllStringSubmatch(string(openAPISpec), -1) {
+		var v any = all
+		for _, part := range strings.Split(m[1], "/") {
+			obj, _ := v.(map[string]any)
+			v = obj[part]
+		}
+		if v == nil {
+			t.Errorf("unresolved $ref #/%s", m[1])
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/openapi.json")
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct{ Version string } `json:"info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil { t.Fatal(err) }
+	if doc.OpenAPI != "3.1.0" || doc.Info.Version != Build().Version {
+		t.Fatalf("got openapi %q version %q", doc.OpenAPI, doc.Info.Version)
+	}
+}
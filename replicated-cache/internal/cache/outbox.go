@@ -0,0 +1,278 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the replication outbox (hinted handoff). When a peer does not acknowledge
+a sync message, the message is queued for that peer and redelivered later by the Node's
+HintLoop. If the outbox has a directory, each peer's queue is also kept on disk as a WAL-framed
+file, so writes accepted with partial acks still reach the peers that missed them after a restart.
+Acks do not rewrite that file: the number of delivered records at its head is kept in a small
+sidecar file, and the hints file is compacted only once more than half of it has been delivered.
+The sidecar is replaced by renaming, so a crash never leaves it half written. Hints for a peer the
+node has stopped replicating to can never be delivered; Drop discards them.
+
+Functions:
+- OpenOutbox(dir string, opts WALOptions): (*Outbox, error)
+- (*Outbox) Add(peer string, msg SyncMsg) error
+- (*Outbox) Peers() []string
+- (*Outbox) Pending(peer string) []SyncMsg
+- (*Outbox) Ack(peer string, n int) error
+- (*Outbox) Drop(peer string) (int, error)
+- (*Outbox) Len() int
+- (*Outbox) Close() error
+- hintFile(dir, peer string) string
+- readAcked(path string): int
+*/
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	hintSuffix  = ".hints"
+	ackedSuffix = ".acked" // after hintSuffix: records at the head of the hints file already delivered
+)
+
+// Outbox holds per-peer queues of sync messages awaiting delivery.
+type Outbox struct {
+	mu         sync.Mutex
+	dir        string // empty keeps hints in memory only
+	opts       WALOptions
+	queues     map[string]*hintQueue
+	MaxPerPeer int
+}
+
+type hintQueue struct {
+	log     *WAL
+	pending []SyncMsg
+	acked   int // delivered records still at the head of log
+}
+
+// OpenOutbox creates an outbox. With a non-empty dir, queues left by a previous
+// run are loaded from disk.
+func OpenOutbox(dir string, opts WALOptions) (*Outbox, error) {
+	o := &Outbox{dir: dir, opts: opts, queues: make(map[string]*hintQueue), MaxPerPeer: 100000}
+	if dir == "" {
+		return o, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+hintSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		peer, err := url.QueryUnescape(strings.TrimSuffix(filepath.Base(f), hintSuffix))
+		if err != nil {
+			continue
+		}
+		q, err := o.queue(peer)
+		if err != nil {
+			return nil, err
+		}
+		q.acked = readAcked(f + ackedSuffix)
+		skip := q.acked
+		err = ReadWAL(f, opts, func(msg SyncMsg) error {
+			if skip > 0 {
+				skip--
+				return nil
+			}
+			q.pending = append(q.pending, msg)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		q.acked -= skip
+	}
+	return o, nil
+}
+
+// queue returns the queue for peer, creating it (and its file) if needed. Callers hold o.mu
+// or, during OpenOutbox, have exclusive access.
+func (o *Outbox) queue(peer string) (*hintQueue, error) {
+	if q, ok := o.queues[peer]; ok {
+		return q, nil
+	}
+	q := &hintQueue{}
+	if o.dir != "" {
+		w, err := OpenWAL(hintFile(o.dir, peer), o.opts)
+		if err != nil {
+			return nil, err
+		}
+		q.log = w
+	}
+	o.queues[peer] = q
+	return q, nil
+}
+
+// Add queues msg for later delivery to peer.
+func (o *Outbox) Add(peer string, msg SyncMsg) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q, err := o.queue(peer)
+	if err != nil {
+		return err
+	}
+	if o.MaxPerPeer > 0 && len(q.pending) >= o.MaxPerPeer {
+		return fmt.Errorf("outbox for %s full (%d hints)", peer, len(q.pending))
+	}
+	if q.log != nil {
+		if err := q.log.Append(msg); err != nil {
+			return err
+		}
+	}
+	q.pending = append(q.pending, msg)
+	return nil
+}
+
+// Peers returns the peers that have undelivered hints.
+func (o *Outbox) Peers() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]string, 0, len(o.queues))
+	for p, q := range o.queues {
+		if len(q.pending) > 0 {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Pending returns a copy of the hints queued for peer, oldest first.
+func (o *Outbox) Pending(peer string) []SyncMsg {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q, ok := o.queues[peer]
+	if !ok {
+		return nil
+	}
+	return append([]SyncMsg(nil), q.pending...)
+}
+
+// Ack drops the first n hints for peer once they have been delivered. On disk
+// it records the new count in the sidecar file, and compacts the hints file
+// only when its delivered records outnumber the pending ones, so draining a
+// queue costs a linear number of record writes rather than one rewrite per ack.
+// A crash before the count is written only redelivers hints, which peers
+// apply idempotently.
+func (o *Outbox) Ack(peer string, n int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q, ok := o.queues[peer]
+	if !ok || n <= 0 {
+		return nil
+	}
+	if n > len(q.pending) {
+		n = len(q.pending)
+	}
+	q.pending = q.pending[n:]
+	if q.log == nil {
+		return nil
+	}
+	q.acked += n
+	acked := hintFile(o.dir, peer) + ackedSuffix
+	if q.acked <= len(q.pending) {
+		return replaceFile(acked, []byte(strconv.Itoa(q.acked)))
+	}
+	// Drop the count before compacting: a crash in between must not let it
+	// apply to the compacted file.
+	if err := os.Remove(acked); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	skipped := 0
+	err := q.log.Rewrite(func(SyncMsg) bool {
+		if skipped < q.acked {
+			skipped++
+			return false
+		}
+		return true
+	}, "")
+	if err != nil {
+		return err
+	}
+	q.acked = 0
+	return nil
+}
+
+// Drop discards the queue for peer, and its files, and returns how many hints
+// it held.
+func (o *Outbox) Drop(peer string) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q, ok := o.queues[peer]
+	if !ok {
+		return 0, nil
+	}
+	delete(o.queues, peer)
+	if q.log == nil {
+		return len(q.pending), nil
+	}
+	err := q.log.Close()
+	f := hintFile(o.dir, peer)
+	// The count goes first: left behind, it would skip hints queued for the
+	// peer later.
+	for _, path := range []string{f + ackedSuffix, f} {
+		if rerr := os.Remove(path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+			err = rerr
+		}
+	}
+	return len(q.pending), err
+}
+
+// Len returns the total number of undelivered hints.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	total := 0
+	for _, q := range o.queues {
+		total += len(q.pending)
+	}
+	return total
+}
+
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var first error
+	for _, q := range o.queues {
+		if q.log == nil {
+			continue
+		}
+		if err := q.log.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func hintFile(dir, peer string) string {
+	return filepath.Join(dir, url.QueryEscape(peer)+hintSuffix)
+}
+
+// readAcked returns the count in an acked sidecar file. A missing or damaged
+// file reads as zero, which at worst redelivers hints.
+func readAcked(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
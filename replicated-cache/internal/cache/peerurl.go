@@ -0,0 +1,169 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file restricts where the node's replication client may connect, so a peer URL (from -peers
+or any API that adds peers) cannot turn it into a request forwarder aimed at internal services
+such as a cloud metadata endpoint. A PeerPolicy allows a set of URL schemes and, optionally, a
+set of networks. CheckURL validates a peer URL before it is used: an allowed scheme, a host, no
+credentials, query or fragment, and an IP literal inside the allowed networks.
+
+Host names are checked where it matters, when connecting: TransportOptions.PeerPolicy installs a
+dialer hook that refuses any address outside the policy after DNS resolution, so neither a name
+that resolves to an internal address, DNS rebinding, nor a redirect from a peer can reach one.
+Without explicit networks, every address is allowed except link-local ones (169.254.0.0/16 and
+fe80::/10, where metadata services live), unspecified and multicast addresses; listing a
+link-local network in Networks allows it. A TransportOptions.RoundTripper does not dial, so
+SetTransport wraps it in policyTransport, which checks each request's URL instead: IP literals
+against the policy, and host names not at all unless Networks is set, when they are refused,
+since their addresses cannot be checked.
+
+Functions:
+- DefaultPeerPolicy(): *PeerPolicy
+- NewPeerPolicy(schemes, cidrs []string): (*PeerPolicy, error)
+- (*PeerPolicy) CheckURL(raw string): (string, error)
+- (*PeerPolicy) allowIP(ip net.IP): error
+- (*PeerPolicy) control(network, address string, c syscall.RawConn): error
+- (*policyTransport) RoundTrip(req *http.Request): (*http.Response, error)
+- (*Node) CheckPeerURL(raw string): (string, error)
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// PeerPolicy limits the URLs and addresses the node connects to as peers.
+type PeerPolicy struct {
+	Schemes  []string     // allowed URL schemes
+	Networks []*net.IPNet // allowed peer addresses; empty allows any but link-local
+}
+
+// DefaultPeerPolicy allows http and https peers at any address except
+// link-local ones.
+func DefaultPeerPolicy() *PeerPolicy {
+	return &PeerPolicy{Schemes: []string{"http", "https"}}
+}
+
+// NewPeerPolicy builds a policy from scheme names and CIDRs ("10.0.0.0/8");
+// a bare IP allows that single address.
+func NewPeerPolicy(schemes, cidrs []string) (*PeerPolicy, error) {
+	p := &PeerPolicy{}
+	for _, s := range schemes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if s != "http" && s != "https" {
+			return nil, fmt.Errorf("peer scheme %q not supported (want http or https)", s)
+		}
+		p.Schemes = append(p.Schemes, s)
+	}
+	if len(p.Schemes) == 0 {
+		return nil, fmt.Errorf("no peer schemes allowed")
+	}
+	networks, err := ParseCIDRs(strings.Join(cidrs, ","))
+	if err != nil {
+		return nil, fmt.Errorf("bad peer networks: %w", err)
+	}
+	p.Networks = networks
+	return p, nil
+}
+
+// CheckURL validates a peer base URL and returns it without a trailing slash.
+// Host names are not resolved here; the dialer checks their addresses.
+func (p *PeerPolicy) CheckURL(raw string) (string, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("peer %q: %w", raw, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	ok := false
+	for _, s := range p.Schemes {
+		ok = ok || s == scheme
+	}
+	switch {
+	case !ok:
+		return "", fmt.Errorf("peer %q: scheme %q not allowed (allowed: %s)", raw, u.Scheme, strings.Join(p.Schemes, ", "))
+	case u.Hostname() == "":
+		return "", fmt.Errorf("peer %q: no host", raw)
+	case u.User != nil:
+		return "", fmt.Errorf("peer %q: credentials in peer URLs are not allowed", raw)
+	case u.RawQuery != "" || u.Fragment != "" || u.Opaque != "":
+		return "", fmt.Errorf("peer %q: want a base URL without query or fragment", raw)
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if err := p.allowIP(ip); err != nil {
+			return "", fmt.Errorf("peer %q: %w", raw, err)
+		}
+	}
+	return raw, nil
+}
+
+// allowIP reports why ip may not be connected to, or nil.
+func (p *PeerPolicy) allowIP(ip net.IP) error {
+	for _, n := range p.Networks {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	switch {
+	case len(p.Networks) > 0:
+		return fmt.Errorf("address %s is outside the allowed peer networks", ip)
+	case ip.IsUnspecified() || ip.IsMulticast():
+		return fmt.Errorf("address %s is not a peer address", ip)
+	case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast():
+		return fmt.Errorf("link-local address %s is not allowed as a peer", ip)
+	}
+	return nil
+}
+
+// control is a net.Dialer Control hook that refuses addresses outside the
+// policy, after name resolution.
+func (p *PeerPolicy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dialing %s: not an IP address", address)
+	}
+	return p.allowIP(ip)
+}
+
+// policyTransport applies a PeerPolicy to a RoundTripper that does not dial.
+type policyTransport struct {
+	policy *PeerPolicy
+	next   http.RoundTripper
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := req.URL.Scheme + "://" + req.URL.Host
+	if _, err := t.policy.CheckURL(base); err != nil {
+		return nil, err
+	}
+	if len(t.policy.Networks) > 0 && net.ParseIP(req.URL.Hostname()) == nil {
+		return nil, fmt.Errorf("peer %q: host names cannot be checked against the allowed peer networks without dialing", base)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// CheckPeerURL validates raw against the node's peer policy; anything that
+// adds peers at runtime must call it first.
+func (n *Node) CheckPeerURL(raw string) (string, error) {
+	p := n.peerPolicy
+	if p == nil {
+		p = DefaultPeerPolicy()
+	}
+	return p.CheckURL(raw)
+}
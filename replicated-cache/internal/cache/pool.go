@@ -0,0 +1,93 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file holds the sync.Pools used on the request paths: byte buffers for reading sync
+bodies and encoding outgoing sync payloads, and DEFLATE and gzip writers for value and response compression.
+Buffers that grew unusually large are dropped instead of pooled so one huge value does
+not pin its memory for the life of the process. Large values are never copied into a
+buffer at all: their sync body streams the value bytes straight from the stored item.
+
+Functions:
+- getBuf(): *bytes.Buffer
+- putBuf(b *bytes.Buffer)
+- newPooledBody(b *bytes.Buffer): *pooledBody
+- (*pooledBody) Close(): error
+- streamSyncBody(buf *bytes.Buffer, msg SyncMsg): (io.ReadCloser, int64, [][]byte)
+*/
+
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// maxPooledBuf is the largest buffer capacity returned to the pool.
+const maxPooledBuf = 1 << 20
+
+// streamValueAbove is the value size from which a single msgpack sync message
+// is sent as head + value + tail instead of being encoded into one buffer.
+const streamValueAbove = 64 << 10
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+var flateWriterPool = sync.Pool{New: func() any {
+	zw, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return zw
+}}
+
+var gzipWriterPool = sync.Pool{New: func() any {
+	gw, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+	return gw
+}}
+
+func getBuf() *bytes.Buffer {
+	b := bufPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBuf(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBuf {
+		bufPool.Put(b)
+	}
+}
+
+// pooledBody is a request body that returns its buffer to the pool once the
+// HTTP transport has finished with it (the transport always closes bodies).
+type pooledBody struct {
+	*bytes.Reader
+	buf  *bytes.Buffer
+	once sync.Once
+}
+
+func newPooledBody(b *bytes.Buffer) *pooledBody {
+	return &pooledBody{Reader: bytes.NewReader(b.Bytes()), buf: b}
+}
+
+func (b *pooledBody) Close() error {
+	b.once.Do(func() { putBuf(b.buf) })
+	return nil
+}
+
+// streamSyncBody encodes msg's head and tail into buf and returns a body that
+// reads head, value and tail in turn, along with its length and those three
+// parts (for signing).
+func streamSyncBody(buf *bytes.Buffer, msg SyncMsg) (io.ReadCloser, int64, [][]byte) {
+	buf.Reset()
+	buf.Write(msg.appendMsgpackHead(buf.AvailableBuffer()))
+	head := buf.Len()
+	buf.Write(msg.appendMsgpackTail(buf.AvailableBuffer()))
+	b := buf.Bytes()
+	r := io.MultiReader(bytes.NewReader(b[:head]), bytes.NewReader(msg.Value), bytes.NewReader(b[head:]))
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, newPooledBody(buf)}, int64(len(b) + len(msg.Value)), [][]byte{b[:head], msg.Value, b[head:]}
+}
@@ -0,0 +1,405 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the small subset of the protobuf wire format needed by the gRPC API, and the
+messages of proto/cache.proto. Like msgpack.go it is written by hand to keep the module free of
+dependencies: fields are varints (ints, bools) or length-delimited (strings, bytes, nested
+messages), fields holding their zero value are not written, as in proto3, and unknown fields are
+skipped so the schema can grow.
+
+Functions:
+- pbAppendTag/pbAppendVarint/pbAppendInt/pbAppendBool/pbAppendBytes/pbAppendString: field encoders
+- (*pbReader) next(): (int, int, error)
+- (*pbReader) varint/bytes/str/skip: low-level reads
+- pbFields(b []byte, field func(r *pbReader, num, wireType int) error): error
+- pbString/pbBytesField/pbUint/pbInt64/pbUint32/pbBool: field decoders
+- (pbEntry) appendProto(b []byte): []byte
+- (*pbSetRequest) unmarshal, (*pbDeleteRequest) unmarshal, (*pbMGetRequest) unmarshal: request decoders
+- unmarshalKey(b []byte): (string, error)
+- (pbWriteResponse) appendProto, (pbWatchEvent) appendProto: response encoders
+- appendSyncProto(b []byte, m SyncMsg): []byte
+- decodeSyncProto(b []byte): (SyncMsg, error)
+*/
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+var errProtobufShort = errors.New("protobuf: unexpected end of data")
+
+func pbAppendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func pbAppendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(pbAppendTag(b, field, pbVarint), v)
+}
+
+func pbAppendInt(b []byte, field int, v int64) []byte {
+	return pbAppendVarint(b, field, uint64(v))
+}
+
+func pbAppendBool(b []byte, field int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return pbAppendVarint(b, field, 1)
+}
+
+func pbAppendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(pbAppendTag(b, field, pbBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func pbAppendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = binary.AppendUvarint(pbAppendTag(b, field, pbBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+type pbReader struct {
+	b []byte
+}
+
+// next returns the next field number and wire type.
+func (r *pbReader) next() (int, int, error) {
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	if tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+		return 0, 0, errors.New("protobuf: bad field number")
+	}
+	return int(tag >> 3), int(tag & 7), nil
+}
+
+func (r *pbReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errProtobufShort
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+// bytes returns a length-delimited field; it aliases the input.
+func (r *pbReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(r.b)) {
+		return nil, errProtobufShort
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, nil
+}
+
+func (r *pbReader) str() (string, error) {
+	v, err := r.bytes()
+	return string(v), err
+}
+
+func (r *pbReader) skip(wireType int) error {
+	var n int
+	switch wireType {
+	case pbVarint:
+		_, err := r.varint()
+		return err
+	case pbBytes:
+		_, err := r.bytes()
+		return err
+	case pbFixed64:
+		n = 8
+	case pbFixed32:
+		n = 4
+	default:
+		return fmt.Errorf("protobuf: unsupported wire type %d", wireType)
+	}
+	if len(r.b) < n {
+		return errProtobufShort
+	}
+	r.b = r.b[n:]
+	return nil
+}
+
+// pbFields calls field for each field of the message in b, with r positioned
+// at its value; field must consume it or return skip.
+func pbFields(b []byte, field func(r *pbReader, num, wireType int) error) error {
+	r := &pbReader{b: b}
+	for len(r.b) > 0 {
+		num, wt, err := r.next()
+		if err != nil {
+			return err
+		}
+		if err := field(r, num, wt); err != nil {
+			return fmt.Errorf("protobuf: field %d: %w", num, err)
+		}
+	}
+	return nil
+}
+
+// errWireType reports a known field sent with the wrong wire type.
+var errWireType = errors.New("unexpected wire type")
+
+func pbString(r *pbReader, wt int, dst *string) error {
+	if wt != pbBytes {
+		return errWireType
+	}
+	v, err := r.str()
+	*dst = v
+	return err
+}
+
+func pbBytesField(r *pbReader, wt int, dst *[]byte) error {
+	if wt != pbBytes {
+		return errWireType
+	}
+	v, err := r.bytes()
+	*dst = append([]byte(nil), v...)
+	return err
+}
+
+func pbUint(r *pbReader, wt int, dst *uint64) error {
+	if wt != pbVarint {
+		return errWireType
+	}
+	v, err := r.varint()
+	*dst = v
+	return err
+}
+
+func pbInt64(r *pbReader, wt int, dst *int64) error {
+	var v uint64
+	err := pbUint(r, wt, &v)
+	*dst = int64(v)
+	return err
+}
+
+func pbUint32(r *pbReader, wt int, dst *uint32) error {
+	var v uint64
+	err := pbUint(r, wt, &v)
+	*dst = uint32(v)
+	return err
+}
+
+func pbBool(r *pbReader, wt int, dst *bool) error {
+	var v uint64
+	err := pbUint(r, wt, &v)
+	*dst = v != 0
+	return err
+}
+
+// unmarshalKey decodes GetRequest and WatchRequest, whose only field is a
+// string numbered 1.
+func unmarshalKey(b []byte) (string, error) {
+	var key string
+	err := pbFields(b, func(r *pbReader, num, wt int) error {
+		if num == 1 {
+			return pbString(r, wt, &key)
+		}
+		return r.skip(wt)
+	})
+	return key, err
+}
+
+// pbEntry is the Entry message.
+type pbEntry struct {
+	Key       string
+	Found     bool
+	Value     []byte
+	Version   int64
+	ExpiresAt int64
+	Flags     uint32
+}
+
+func (e pbEntry) appendProto(b []byte) []byte {
+	b = pbAppendString(b, 1, e.Key)
+	b = pbAppendBool(b, 2, e.Found)
+	b = pbAppendBytes(b, 3, e.Value)
+	b = pbAppendInt(b, 4, e.Version)
+	b = pbAppendInt(b, 5, e.ExpiresAt)
+	return pbAppendVarint(b, 6, uint64(e.Flags))
+}
+
+type pbSetRequest struct {
+	Key         string
+	Value       []byte
+	TTLMillis   int64
+	MinReplicas uint32
+	Full        bool
+}
+
+func (m *pbSetRequest) unmarshal(b []byte) error {
+	return pbFields(b, func(r *pbReader, num, wt int) error {
+		switch num {
+		case 1:
+			return pbString(r, wt, &m.Key)
+		case 2:
+			return pbBytesField(r, wt, &m.Value)
+		case 3:
+			return pbInt64(r, wt, &m.TTLMillis)
+		case 4:
+			return pbUint32(r, wt, &m.MinReplicas)
+		case 5:
+			return pbBool(r, wt, &m.Full)
+		}
+		return r.skip(wt)
+	})
+}
+
+type pbDeleteRequest struct {
+	Key         string
+	MinReplicas uint32
+	Full        bool
+}
+
+func (m *pbDeleteRequest) unmarshal(b []byte) error {
+	return pbFields(b, func(r *pbReader, num, wt int) error {
+		switch num {
+		case 1:
+			return pbString(r, wt, &m.Key)
+		case 2:
+			return pbUint32(r, wt, &m.MinReplicas)
+		case 3:
+			return pbBool(r, wt, &m.Full)
+		}
+		return r.skip(wt)
+	})
+}
+
+type pbMGetRequest struct {
+	Keys []string
+}
+
+func (m *pbMGetRequest) unmarshal(b []byte) error {
+	return pbFields(b, func(r *pbReader, num, wt int) error {
+		if num == 1 {
+			var key string
+			err := pbString(r, wt, &key)
+			m.Keys = append(m.Keys, key)
+			return err
+		}
+		return r.skip(wt)
+	})
+}
+
+type pbWriteResponse struct {
+	Version int64
+	Acked   int
+	Total   int
+}
+
+func (m pbWriteResponse) appendProto(b []byte) []byte {
+	b = pbAppendInt(b, 1, m.Version)
+	b = pbAppendVarint(b, 2, uint64(m.Acked))
+	return pbAppendVarint(b, 3, uint64(m.Total))
+}
+
+type pbWatchEvent struct {
+	Op        string
+	Key       string
+	Value     []byte
+	Version   int64
+	ExpiresAt int64
+	Origin    string
+	Flags     uint32
+}
+
+func (m pbWatchEvent) appendProto(b []byte) []byte {
+	b = pbAppendString(b, 1, m.Op)
+	b = pbAppendString(b, 2, m.Key)
+	b = pbAppendBytes(b, 3, m.Value)
+	b = pbAppendInt(b, 4, m.Version)
+	b = pbAppendInt(b, 5, m.ExpiresAt)
+	b = pbAppendString(b, 6, m.Origin)
+	return pbAppendVarint(b, 7, uint64(m.Flags))
+}
+
+// appendSyncProto encodes m as a SyncMessage.
+func appendSyncProto(b []byte, m SyncMsg) []byte {
+	b = pbAppendString(b, 1, m.Op)
+	b = pbAppendString(b, 2, m.Key)
+	b = pbAppendBytes(b, 3, m.Value)
+	if m.ExpiresAt != nil {
+		b = pbAppendInt(b, 4, m.ExpiresAt.UnixNano())
+	}
+	b = pbAppendInt(b, 5, m.Version)
+	b = pbAppendString(b, 6, m.Origin)
+	b = pbAppendBool(b, 7, m.Compressed)
+	b = pbAppendBool(b, 8, m.Encrypted)
+	b = pbAppendVarint(b, 9, uint64(m.Flags))
+	b = pbAppendString(b, 10, m.Trace)
+	b = pbAppendString(b, 11, m.RequestID)
+	b = pbAppendString(b, 12, m.Signer)
+	return pbAppendBytes(b, 13, m.Sig)
+}
+
+// decodeSyncProto decodes a SyncMessage.
+func decodeSyncProto(b []byte) (SyncMsg, error) {
+	var m SyncMsg
+	err := pbFields(b, func(r *pbReader, num, wt int) error {
+		switch num {
+		case 1:
+			return pbString(r, wt, &m.Op)
+		case 2:
+			return pbString(r, wt, &m.Key)
+		case 3:
+			return pbBytesField(r, wt, &m.Value)
+		case 4:
+			var ns int64
+			err := pbInt64(r, wt, &ns)
+			if ns != 0 {
+				t := time.Unix(0, ns)
+				m.ExpiresAt = &t
+			}
+			return err
+		case 5:
+			return pbInt64(r, wt, &m.Version)
+		case 6:
+			return pbString(r, wt, &m.Origin)
+		case 7:
+			return pbBool(r, wt, &m.Compressed)
+		case 8:
+			return pbBool(r, wt, &m.Encrypted)
+		case 9:
+			return pbUint32(r, wt, &m.Flags)
+		case 10:
+			return pbString(r, wt, &m.Trace)
+		case 11:
+			return pbString(r, wt, &m.RequestID)
+		case 12:
+			return pbString(r, wt, &m.Signer)
+		case 13:
+			return pbBytesField(r, wt, &m.Sig)
+		}
+		return r.skip(wt)
+	})
+	return m, err
+}
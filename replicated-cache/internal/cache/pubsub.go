@@ -0,0 +1,388 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements publish/subscribe channels, which are separate from the keys: a message published
+on a channel goes to the subscribers of that channel, or of a matching pattern, connected to any
+node, and is not stored. Patterns are Redis globs (*, ?, [a-z], [^a], with \ escaping).
+
+Publish delivers a message to this node's subscribers at once and hands it to a relay, which sends
+queued messages to every active peer as "publish" sync messages, in order and in batches (in one
+NATS publication when connected). Peers deliver them to their own subscribers and do not pass them
+on. Delivery is at most once, like Redis: a peer that is down misses the messages, which are not
+hinted, and a relay queue over pubsubRelayQueue drops them. A subscriber whose buffer of
+pubsubBuffer messages is full is dropped and told so.
+
+Over HTTP, POST /pubsub/CHANNEL publishes the body and answers {"receivers": N}, the subscribers on
+this node that got it. GET /pubsub?channel=C&pattern=P streams messages as Server-Sent Events
+until the client disconnects. The RESP listener offers PUBLISH, SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE
+and PUNSUBSCRIBE (see resp.go). Publishing needs the write role and subscribing the read role;
+the ACL, which covers keys, does not apply to channels.
+
+Functions:
+- (*pubsubHub) subscribe(): *subscriber
+- (*pubsubHub) update(s *subscriber, add bool, channels, patterns []string): int
+- (*pubsubHub) unsubscribe(s *subscriber)
+- (*pubsubHub) deliver(channel string, msg []byte): int
+- globMatch(pattern, s string): bool
+- matchClass(class string, c byte): (bool, int)
+- (*Node) Publish(channel string, msg []byte): int
+- (*Node) relayPublish(msg SyncMsg)
+- (*Node) sendPublications(batch []SyncMsg)
+- (*Node) mayPubSub(r *http.Request, method string): *wireRejection
+- (*Node) handlePublish(w http.ResponseWriter, r *http.Request)
+- (*Node) handleSubscribe(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	pubsubBuffer     = 1024
+	pubsubRelayQueue = 64 << 10 // publications waiting for the relay
+	pubsubRelayBatch = 256
+)
+
+// pubsubMessage is a delivered message; Pattern is set for pattern matches.
+type pubsubMessage struct {
+	Channel string `json:"channel"`
+	Pattern string `json:"pattern,omitempty"`
+	Message []byte `json:"message"`
+}
+
+type subscriber struct {
+	channels map[string]struct{}
+	patterns []string
+	msgs     chan pubsubMessage
+	lagged   bool // set before msgs is closed for falling behind
+}
+
+type pubsubHub struct {
+	mu    sync.Mutex
+	subs  map[*subscriber]struct{}
+	count atomic.Int64
+
+	relayMu sync.Mutex
+	queue   []SyncMsg
+	relays  bool // a relay goroutine is draining queue
+}
+
+func (h *pubsubHub) subscribe() *subscriber {
+	s := &subscriber{channels: make(map[string]struct{}), msgs: make(chan pubsubMessage, pubsubBuffer)}
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*subscriber]struct{})
+	}
+	h.subs[s] = struct{}{}
+	h.count.Store(int64(len(h.subs)))
+	h.mu.Unlock()
+	return s
+}
+
+// update adds channels and patterns to s, or removes them, and returns how
+// many s then has.
+func (h *pubsubHub) update(s *subscriber, add bool, channels, patterns []string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range channels {
+		if add {
+			s.channels[c] = struct{}{}
+		} else {
+			delete(s.channels, c)
+		}
+	}
+	for _, p := range patterns {
+		switch {
+		case !add:
+			s.patterns = slices.DeleteFunc(s.patterns, func(q string) bool { return q == p })
+		case !slices.Contains(s.patterns, p):
+			s.patterns = append(s.patterns, p)
+		}
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// unsubscribe removes s; it is a no-op for subscribers already dropped.
+func (h *pubsubHub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.msgs)
+	}
+	h.count.Store(int64(len(h.subs)))
+	h.mu.Unlock()
+}
+
+// deliver hands msg to the subscribers of channel, once for the channel and
+// once for each matching pattern, and returns how many deliveries it made.
+func (h *pubsubHub) deliver(channel string, msg []byte) int {
+	if h.count.Load() == 0 {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for s := range h.subs {
+		send := func(m pubsubMessage) bool {
+			select {
+			case s.msgs <- m:
+				n++
+				return true
+			default:
+				s.lagged = true
+				delete(h.subs, s)
+				close(s.msgs)
+				return false
+			}
+		}
+		if _, ok := s.channels[channel]; ok && !send(pubsubMessage{Channel: channel, Message: msg}) {
+			continue
+		}
+		for _, p := range s.patterns {
+			if globMatch(p, channel) && !send(pubsubMessage{Channel: channel, Pattern: p, Message: msg}) {
+				break
+			}
+		}
+	}
+	h.count.Store(int64(len(h.subs)))
+	return n
+}
+
+// globMatch reports whether s matches the Redis glob pattern.
+func globMatch(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+			continue
+		case '[':
+			if s == "" {
+				return false
+			}
+			if ok, size := matchClass(pattern[1:], s[0]); size > 0 {
+				if !ok {
+					return false
+				}
+				pattern, s = pattern[1+size:], s[1:]
+				continue
+			}
+			// An unterminated class is a literal "[".
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+		}
+		if s == "" || s[0] != pattern[0] {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// matchClass matches c against the class at the start of class, just after
+// its "[", and returns the class's length including the "]", or 0 if it is
+// not terminated.
+func matchClass(class string, c byte) (bool, int) {
+	i, negate, match := 0, false, false
+	if i < len(class) && class[i] == '^' {
+		negate = true
+		i++
+	}
+	for i < len(class) && class[i] != ']' {
+		lo := class[i]
+		if lo == '\\' && i+1 < len(class) {
+			i++
+			lo = class[i]
+		}
+		hi := lo
+		if i+2 < len(class) && class[i+1] == '-' && class[i+2] != ']' {
+			hi = class[i+2]
+			i += 2
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			match = true
+		}
+		i++
+	}
+	if i == len(class) {
+		return false, 0
+	}
+	return match != negate, i + 1
+}
+
+// Publish sends msg to the subscribers of channel on every node and returns
+// how many on this node received it.
+func (n *Node) Publish(channel string, msg []byte) int {
+	n.metrics.pubsubPublished.Add(1)
+	got := n.pubsub.deliver(channel, msg)
+	n.metrics.pubsubDelivered.Add(int64(got))
+	m := SyncMsg{Op: "publish", Key: channel, Value: msg, Version: time.Now().UnixNano(), Origin: n.ID}
+	n.signMsg(&m)
+	n.relayPublish(m)
+	return got
+}
+
+// relayPublish queues msg for the peers, starting a relay if none is running.
+func (n *Node) relayPublish(msg SyncMsg) {
+	h := &n.pubsub
+	h.relayMu.Lock()
+	if len(h.queue) >= pubsubRelayQueue {
+		h.relayMu.Unlock()
+		n.metrics.pubsubDropped.Add(1)
+		return
+	}
+	h.queue = append(h.queue, msg)
+	if h.relays {
+		h.relayMu.Unlock()
+		return
+	}
+	h.relays = true
+	h.relayMu.Unlock()
+	go func() {
+		for {
+			h.relayMu.Lock()
+			batch := h.queue[:min(len(h.queue), pubsubRelayBatch)]
+			h.queue = h.queue[len(batch):]
+			if len(batch) == 0 {
+				h.queue, h.relays = nil, false
+				h.relayMu.Unlock()
+				return
+			}
+			h.relayMu.Unlock()
+			n.sendPublications(batch)
+		}
+	}()
+}
+
+// sendPublications sends batch to every active peer, without retrying.
+func (n *Node) sendPublications(batch []SyncMsg) {
+	if c := n.nats.Load(); c != nil && c.publishSync(batch, "") == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.ReqTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, p := range n.activePeers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.sendSyncBatch(ctx, p, batch); err != nil {
+				n.metrics.pubsubDropped.Add(int64(len(batch)))
+				n.log.Warn("publication relay failed", "component", "pubsub", "peer", p, "messages", len(batch), "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// mayPubSub runs r's caller through the /kv checks for method without a
+// key: authentication, the role and the rate limit.
+func (n *Node) mayPubSub(r *http.Request, method string) *wireRejection {
+	kr := r.Clone(r.Context())
+	kr.Method, kr.URL, kr.RequestURI = method, &url.URL{Path: "/kv/"}, ""
+	kr.Body, kr.ContentLength = http.NoBody, 0
+	return checkedCall(n.wireChain(true), kr, func(*http.Request) {})
+}
+
+func (n *Node) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if rej := n.mayPubSub(r, http.MethodPut); rej != nil {
+		for k, v := range rej.header {
+			w.Header()[k] = v
+		}
+		http.Error(w, rej.message(), rej.status)
+		return
+	}
+	msg, err := readLimited(r.Body, n.Limits.MaxValueBytes)
+	if err != nil {
+		http.Error(w, err.Error(), bodyErrorStatus(err))
+		return
+	}
+	got := n.Publish(r.PathValue("channel"), msg)
+	writeEncoded(w, r, http.StatusOK, map[string]int{"receivers": got})
+}
+
+func (n *Node) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	channels, patterns := q["channel"], q["pattern"]
+	switch {
+	case len(channels)+len(patterns) == 0:
+		http.Error(w, "missing channel or pattern", http.StatusBadRequest)
+		return
+	case len(channels)+len(patterns) > watchMaxFilters:
+		http.Error(w, "too many channels and patterns", http.StatusBadRequest)
+		return
+	}
+	if rej := n.mayPubSub(r, http.MethodGet); rej != nil {
+		for k, v := range rej.header {
+			w.Header()[k] = v
+		}
+		http.Error(w, rej.message(), rej.status)
+		return
+	}
+	s := n.pubsub.subscribe()
+	defer n.pubsub.unsubscribe(s)
+	n.pubsub.update(s, true, channels, patterns)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // for nginx
+	rc := http.NewResponseController(w)
+	io.WriteString(w, ": subscribed\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			io.WriteString(w, ": ping\n\n")
+		case m, ok := <-s.msgs:
+			if !ok {
+				writeSSE(w, 0, "error", map[string]string{"type": "error", "error": "subscriber fell behind"})
+				rc.Flush()
+				return
+			}
+			if writeSSE(w, 0, "message", m) != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
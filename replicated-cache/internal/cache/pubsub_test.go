@@ -0,0 +1,183 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for publish/subscribe channels.
+
+List of functions:
+	- TestPubSub: Tests publishing over HTTP and RESP to subscribers on another node, patterns and subscribed mode.
+	- TestPubSubRoles: Tests that publishing needs the write role.
+	- TestGlobMatch: Tests Redis glob patterns.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	n2 := NewNode("N2", ":y", nil)
+	n2.AccessLog = false
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.AccessLog = false
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	// A RESP subscriber on N2.
+	sub := startRESP(t, n2)
+	sub.send("SUBSCRIBE", "news", "alerts")
+	for _, want := range []string{"(array) 3", "subscribe", "news", "(integer) 1", "(array) 3", "subscribe", "alerts", "(integer) 2"} {
+		if got := sub.read(); got != want {
+			t.Fatalf("SUBSCRIBE reply %q, want %q", got, want)
+		}
+	}
+	sub.send("PSUBSCRIBE", "user.*")
+	for _, want := range []string{"(array) 3", "psubscribe", "user.*", "(integer) 3"} {
+		if got := sub.read(); got != want {
+			t.Fatalf("PSUBSCRIBE reply %q, want %q", got, want)
+		}
+	}
+	// An SSE subscriber on N1.
+	resp, err := http.Get(srv1.URL + "/pubsub?channel=news")
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	if line, _ := events.ReadString('\n'); line != ": subscribed\n" {
+		t.Fatalf("stream starts with %q", line)
+	}
+	for n1.pubsub.count.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Published on N1: to the local stream at once, relayed to N2.
+	pr, err := http.Post(srv1.URL+"/pubsub/news", "text/plain", strings.NewReader("hello"))
+	if err != nil { t.Fatal(err) }
+	var body struct{ Receivers int }
+	json.NewDecoder(pr.Body).Decode(&body)
+	pr.Body.Close()
+	if pr.StatusCode != 200 || body.Receivers != 1 {
+		t.Fatalf("publish: %s, %d receivers", pr.Status, body.Receivers)
+	}
+	for _, want := range []string{"(array) 3", "message", "news", "hello"} {
+		if got := sub.read(); got != want {
+			t.Fatalf("pushed %q, want %q", got, want)
+		}
+	}
+	var m pubsubMessage
+	for {
+		line, err := events.ReadString('\n')
+		if err != nil { t.Fatal(err) }
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			json.Unmarshal([]byte(data), &m)
+			break
+		}
+	}
+	if m.Channel != "news" || string(m.Message) != "hello" {
+		t.Fatalf("streamed %+v", m)
+	}
+
+	// Published over RESP on N2: to the pattern here, nowhere on N1.
+	pub := startRESP(t, n2)
+	if got := pub.do("PUBLISH", "user.7", "hi"); got != "(integer) 1" {
+		t.Fatalf("PUBLISH = %q", got)
+	}
+	for _, want := range []string{"(array) 4", "pmessage", "user.*", "user.7", "hi"} {
+		if got := sub.read(); got != want {
+			t.Fatalf("pushed %q, want %q", got, want)
+		}
+	}
+
+	// Subscribed connections take only subscription commands and PING.
+	if got := sub.do("GET", "k"); !strings.HasPrefix(got, "ERR Can't execute 'get'") {
+		t.Fatalf("GET while subscribed = %q", got)
+	}
+	sub.send("PING")
+	for _, want := range []string{"(array) 2", "pong", ""} {
+		if got := sub.read(); got != want {
+			t.Fatalf("PING reply %q, want %q", got, want)
+		}
+	}
+	sub.send("UNSUBSCRIBE")
+	for i := 0; i < 2; i++ {
+		if got := sub.read(); got != "(array) 3" {
+			t.Fatalf("UNSUBSCRIBE reply %q", got)
+		}
+		sub.read()
+		sub.read()
+		sub.read()
+	}
+	sub.send("PUNSUBSCRIBE", "user.*")
+	for _, want := range []string{"(array) 3", "punsubscribe", "user.*", "(integer) 0"} {
+		if got := sub.read(); got != want {
+			t.Fatalf("PUNSUBSCRIBE reply %q, want %q", got, want)
+		}
+	}
+	if got := sub.do("GET", "k"); got != "(nil)" {
+		t.Fatalf("GET after unsubscribing = %q", got)
+	}
+	if n2.pubsub.count.Load() != 0 {
+		t.Fatalf("%d subscribers left on N2", n2.pubsub.count.Load())
+	}
+}
+
+func TestPubSubRoles(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	keys := NewAPIKeys()
+	keys.Add("reader-key", "reader", RoleRead)
+	n.Auth = keys
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	req, _ := http.NewRequest("POST", srv.URL+"/pubsub/news", strings.NewReader("x"))
+	req.Header.Set("X-API-Key", "reader-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("publish as a reader: %s", resp.Status)
+	}
+	c := startRESP(t, n)
+	if got := c.do("SUBSCRIBE", "news"); got != "NOAUTH Authentication required." {
+		t.Fatalf("SUBSCRIBE before AUTH = %q", got)
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"news", "news", true},
+		{"news", "newsx", false},
+		{"*", "", true},
+		{"user.*", "user.1", true},
+		{"user.*", "user", false},
+		{"*.created", "order.created", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"a[b", "a[b", true},
+		{"a*b*c", "aXbYbZc", true},
+	} {
+		if got := globMatch(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v", tc.pattern, tc.s, got)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements per-client rate limiting for the /kv API, so one runaway client cannot flood
+the node with writes that then fan out to every peer. With Node.RateLimit.Rate set, each client
+gets a token bucket refilled at Rate requests per second and holding up to Burst; a request that
+finds the bucket empty is answered 429 with a Retry-After header. Clients are told apart the same
+way the audit log names them: by authenticated principal, else TLS client certificate, else
+address, which behind Node.TrustedProxies is the one they forwarded (see clientIdentity). Overrides give particular clients their own rate, or exempt them
+with a rate of zero. Buckets that have refilled completely are dropped periodically, so idle
+clients cost no memory.
+
+Functions:
+- (*rateLimiter) allow(client string, rate, burst float64, now time.Time): (bool, time.Duration)
+- (*Node) rateLimit(next http.Handler): http.Handler
+*/
+
+package cache
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateSweepEvery = time.Minute
+
+// RateLimits configure per-client rate limiting; a zero Rate disables it.
+type RateLimits struct {
+	Rate       float64            // requests per second per client
+	Burst      int                // bucket size (default: Rate rounded up)
+	WritesOnly bool               // limit only PUT and DELETE
+	Overrides  map[string]float64 // client identity -> its own rate; 0 exempts it
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will have refilled completely
+}
+
+// allow takes a token from client's bucket, or reports how long until one
+// is available.
+func (l *rateLimiter) allow(client string, rate, burst float64, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	if now.Sub(l.swept) >= rateSweepEvery {
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	return true, 0
+}
+
+// rateLimit rejects /kv requests from clients over their rate.
+func (n *Node) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := &n.RateLimit
+		if !strings.HasPrefix(r.URL.Path, "/kv/") || l.WritesOnly && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := n.clientIdentity(r)
+		rate := l.Rate
+		if v, ok := l.Overrides[client]; ok {
+			rate = v
+		}
+		if rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		burst := float64(l.Burst)
+		if burst <= 0 {
+			burst = math.Ceil(rate)
+		}
+		if ok, wait := n.limiter.allow(client, rate, burst, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
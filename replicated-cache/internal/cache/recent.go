@@ -0,0 +1,136 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the recent-operations ring buffer, for answering "what just overwrote my
+key?". The node keeps the last N mutations it saw, both client PUTs and DELETEs and the sync
+messages peers sent it, with the key, op, version, origin node and outcome: applied, or stale when
+last-writer-wins kept a newer version already in the store. GET /admin/recent lists them, newest
+first, optionally filtered by key; the dashboard shows the latest few.
+
+Functions:
+- (*recentOps) resize(size int)
+- (*recentOps) add(rec OpRecord)
+- (*recentOps) list(key, source string, limit int): []OpRecord
+- (*Node) SetRecentOps(size int)
+- (*Node) RecentOps(key string, limit int): []OpRecord
+- (*Node) recordSync(msg *SyncMsg, outcome string)
+- (*Node) handleRecent(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRecentOps is the ring size NewNode starts with.
+const defaultRecentOps = 1000
+
+const (
+	OutcomeApplied = "applied"
+	OutcomeStale   = "stale" // an equal or newer version was already stored
+	OutcomeError   = "error"
+)
+
+// OpRecord is one mutation the node saw.
+type OpRecord struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"` // "client" or "sync"
+	Op        string    `json:"op"`     // "set", "del" or "evict"
+	Key       string    `json:"key"`
+	Version   int64     `json:"version"`
+	Origin    string    `json:"origin"` // node that made the write
+	Outcome   string    `json:"outcome"`
+	Client    string    `json:"client,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+type recentOps struct {
+	mu  sync.Mutex
+	buf []OpRecord
+	n   int // total added
+}
+
+// resize sets the ring to size entries, keeping the newest; 0 disables it.
+func (o *recentOps) resize(size int) {
+	keep := o.list("", "", size)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf, o.n = make([]OpRecord, max(size, 0)), 0
+	for i := len(keep) - 1; i >= 0; i-- {
+		o.buf[o.n] = keep[i]
+		o.n++
+	}
+}
+
+func (o *recentOps) add(rec OpRecord) {
+	o.mu.Lock()
+	if len(o.buf) > 0 {
+		o.buf[o.n%len(o.buf)] = rec
+		o.n++
+	}
+	o.mu.Unlock()
+}
+
+// list returns up to limit records, newest first, matching key and source
+// when they are non-empty.
+func (o *recentOps) list(key, source string, limit int) []OpRecord {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []OpRecord
+	for i := o.n - 1; i >= 0 && i >= o.n-len(o.buf) && len(out) < limit; i-- {
+		rec := &o.buf[i%len(o.buf)]
+		if (key == "" || rec.Key == key) && (source == "" || rec.Source == source) {
+			out = append(out, *rec)
+		}
+	}
+	return out
+}
+
+// SetRecentOps sets how many recent operations the node keeps (default
+// 1000); 0 turns the buffer off.
+func (n *Node) SetRecentOps(size int) { n.recent.resize(size) }
+
+// RecentOps returns up to limit recent operations on key (all keys when
+// key is ""), newest first.
+func (n *Node) RecentOps(key string, limit int) []OpRecord {
+	return n.recent.list(key, "", limit)
+}
+
+func (n *Node) recordSync(msg *SyncMsg, outcome string) {
+	n.recent.add(OpRecord{
+		Time:      time.Now().UTC(),
+		Source:    "sync",
+		Op:        msg.Op,
+		Key:       msg.Key,
+		Version:   msg.Version,
+		Origin:    msg.Origin,
+		Outcome:   outcome,
+		RequestID: msg.RequestID,
+	})
+}
+
+// handleRecent serves GET /admin/recent?key=K&source=client|sync&n=N.
+func (n *Node) handleRecent(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if s := q.Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			http.Error(w, "n must be a positive integer", 400)
+			return
+		}
+		limit = v
+	}
+	ops := n.recent.list(q.Get("key"), q.Get("source"), limit)
+	if ops == nil {
+		ops = []OpRecord{}
+	}
+	writeEncoded(w, r, http.StatusOK, ops)
+}
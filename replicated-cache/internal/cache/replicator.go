@@ -0,0 +1,175 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the per-peer replication workers. Each peer gets a bounded job queue
+drained by a fixed number of worker goroutines, so a burst of writes turns into at most
+PeerWorkers concurrent (pipelined, keep-alive) requests per peer instead of one goroutine and
+connection per peer per write. When a peer's queue is full the message goes straight to the
+outbox as a hint rather than blocking the writer.
+With a BatchWindow set, a worker that picks up a message keeps collecting messages for the
+same peer for that long (up to maxSyncBatch) and sends them as one batch: a group commit that
+trades a few milliseconds of latency for far fewer requests under sustained load.
+When a peer is dropped its queue is closed: the workers send what is left, which the outbox
+keeps as hints if the peer is still down, and then exit.
+
+Functions:
+- (*Node) enqueueSync(peer string, job syncJob): bool
+- (*Node) worker(peer string): *peerWorker
+- (*Node) stopWorker(peer string)
+- (*Node) runWorker(peer string, w *peerWorker)
+- (*Node) collectBatch(w *peerWorker, batch []syncJob): []syncJob
+- (*Node) queueDepth(peer string): int
+- (*Node) totalQueueDepth(): int
+*/
+
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// maxSyncBatch caps how many messages one group commit may carry.
+const maxSyncBatch = 256
+
+// syncJob is one message bound for one peer. done receives exactly one result.
+type syncJob struct {
+	msg  SyncMsg
+	done chan<- error
+}
+
+type peerWorker struct {
+	jobs chan syncJob
+}
+
+// enqueueSync hands job to peer's workers without blocking; it reports false
+// if the queue is full. It holds workersMu while sending so that stopWorker
+// cannot close the queue in between.
+func (n *Node) enqueueSync(peer string, job syncJob) bool {
+	n.workersMu.Lock()
+	defer n.workersMu.Unlock()
+	select {
+	case n.worker(peer).jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// worker returns peer's worker pool, starting it on first use. Callers hold
+// workersMu.
+func (n *Node) worker(peer string) *peerWorker {
+	if w, ok := n.workers[peer]; ok {
+		return w
+	}
+	w := &peerWorker{jobs: make(chan syncJob, n.PeerQueueSize)}
+	n.workers[peer] = w
+	for i := 0; i < n.PeerWorkers; i++ {
+		go n.runWorker(peer, w)
+	}
+	return w
+}
+
+// stopWorker closes peer's queue, if it has one, so its workers exit once
+// they have sent what is queued.
+func (n *Node) stopWorker(peer string) {
+	n.workersMu.Lock()
+	defer n.workersMu.Unlock()
+	if w, ok := n.workers[peer]; ok {
+		delete(n.workers, peer)
+		close(w.jobs)
+	}
+}
+
+func (n *Node) runWorker(peer string, w *peerWorker) {
+	for job := range w.jobs {
+		batch := n.collectBatch(w, []syncJob{job})
+		msgs := make([]SyncMsg, len(batch))
+		var spans []*Span
+		for i, j := range batch {
+			msgs[i] = j.msg
+			if sc, ok := parseTraceparent(j.msg.Trace); ok {
+				ctx, span := n.startSpan(context.WithValue(context.Background(), spanKey{}, sc), "sync.send")
+				span.SetAttr("peer", peer)
+				span.SetAttr("key", j.msg.Key)
+				if span != nil {
+					msgs[i].Trace = spanFromContext(ctx).String()
+					spans = append(spans, span)
+				}
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), n.peerTimeout(peer))
+		start := time.Now()
+		err := n.sendSyncBatch(ctx, peer, msgs)
+		cancel()
+		d := time.Since(start)
+		if err == nil {
+			n.observeLatency(peer, d)
+		}
+		n.recordSend(peer, msgs, d, err)
+		n.bumpFail(peer, err == nil)
+		if n.log.Enabled(context.Background(), slog.LevelDebug) {
+			for _, m := range msgs {
+				n.log.Debug("sync sent", "component", "sync", "peer", peer, "key", m.Key, "op", m.Op, "request_id", m.RequestID, "err", err)
+			}
+		}
+		for _, span := range spans {
+			if err != nil {
+				span.SetAttr("error", err.Error())
+			}
+			span.End()
+		}
+		for _, j := range batch {
+			if err != nil {
+				n.hint(peer, j.msg)
+			}
+			j.done <- err
+		}
+	}
+}
+
+// collectBatch adds jobs that arrive within BatchWindow to batch.
+func (n *Node) collectBatch(w *peerWorker, batch []syncJob) []syncJob {
+	if n.BatchWindow <= 0 {
+		return batch
+	}
+	timer := time.NewTimer(n.BatchWindow)
+	defer timer.Stop()
+	for len(batch) < maxSyncBatch {
+		select {
+		case job, ok := <-w.jobs:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, job)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// queueDepth returns how many messages are waiting for peer's workers.
+func (n *Node) queueDepth(peer string) int {
+	n.workersMu.Lock()
+	defer n.workersMu.Unlock()
+	if w, ok := n.workers[peer]; ok {
+		return len(w.jobs)
+	}
+	return 0
+}
+
+// totalQueueDepth returns how many messages are waiting across all peers.
+func (n *Node) totalQueueDepth() int {
+	n.workersMu.Lock()
+	defer n.workersMu.Unlock()
+	total := 0
+	for _, w := range n.workers {
+		total += len(w.jobs)
+	}
+	return total
+}
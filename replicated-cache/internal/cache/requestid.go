@@ -0,0 +1,90 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements request IDs for log correlation. Every client request gets an X-Request-ID:
+the caller's, if it sent a sane one, or a freshly generated one. The ID is echoed in the response,
+attached to the access log line, and copied into every SyncMsg the request fans out ("request_id",
+so it survives batching, sync streams and hinted handoff). Peers log it when they apply the
+message, so grepping all node logs for one ID shows where a write went.
+
+Functions:
+- newRequestID(): string
+- validRequestID(id string): bool
+- withRequestID(ctx context.Context, id string): context.Context
+- requestIDFrom(ctx context.Context): string
+- (*Node) requestIDs(next http.Handler): http.Handler
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+	maxRequestID    = 128
+)
+
+type requestIDKey struct{}
+
+func newRequestID() string {
+	var b [8]byte
+	putRandom(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts short printable ASCII IDs, so a client cannot inject
+// line breaks or huge values into every log line and sync message.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDs assigns each request its ID. Reads on a node without an access
+// log have nothing to correlate, so they only echo an ID the client sent and
+// keep the fast GET path allocation-free.
+func (n *Node) requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := r.Header[requestIDHeader]
+		if r.Method == http.MethodGet && !n.AccessLog {
+			if len(in) == 1 && validRequestID(in[0]) {
+				w.Header()[requestIDHeader] = in
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		var id string
+		if len(in) == 1 && validRequestID(in[0]) {
+			id = in[0]
+		} else {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,557 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a listener for the Redis serialization protocol (RESP2), so redis-cli and
+existing Redis client libraries can use the cluster directly. ServeRESP accepts connections and
+answers GET, SET (with EX, PX, NX and XX), DEL, EXISTS, EXPIRE, PEXPIRE, TTL and PTTL on the same
+store as /kv, plus the connection commands clients send on their own (PING, ECHO, AUTH, SELECT 0,
+COMMAND, CLIENT, QUIT). Both multi-bulk and inline commands are read, and replies to pipelined
+commands are flushed together.
+
+PUBLISH, SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE use the cluster's channels (see
+pubsub.go). As in Redis, a connection with subscriptions only takes those commands, PING and QUIT,
+and is sent "message" and "pmessage" pushes as they arrive; it is not closed for being idle, and
+is closed when it falls pubsubBuffer messages behind.
+
+Keyed commands go through the same checks as /kv requests (see wireproto.go), so a RESP client can
+do exactly what the same credentials could over HTTP; SET and EXPIRE count as PUTs and DEL as a
+DELETE. AUTH takes an API key or bearer token, optionally after a user name that is ignored. Writes
+are checked against KeyRules, audited and replicated like HTTP writes. Keys may not contain "/",
+which /kv could not address.
+
+NX and XX are checked against this node's copy, so two nodes can both accept an NX write for the
+same key; last-write-wins then keeps one. Values are bounded by Limits.MaxValueBytes, commands
+sent before AUTH on a node with authentication by wireMaxAnonymous, and idle connections are closed
+after wireIdleTimeout.
+
+Functions:
+- (*Node) ServeRESP(ctx context.Context, ln net.Listener): error
+- (*respConn) serve(ctx context.Context)
+- (*respConn) readCommand(): ([][]byte, error)
+- (*respConn) exec(ctx context.Context, args [][]byte): (any, bool)
+- (*respConn) auth(args [][]byte): any
+- (*respConn) keyed(ctx context.Context, cmd string, args [][]byte): any
+- (*respConn) call(ctx context.Context, method, key string, rc respCall): any
+- (*respConn) reply(v any)
+- (*respConn) pubsub(ctx context.Context, cmd string, args [][]byte): any
+- (*respConn) push(s *subscriber)
+- (*Node) respExec(r *http.Request, key string, rc respCall): any
+- (*Node) respSet(r *http.Request, key string, args [][]byte): any
+- (*Node) respExpire(r *http.Request, key string, d time.Duration): any
+- (*Node) respDel(r *http.Request, key string): any
+- (*Node) respWrite(r *http.Request, key, op string, it Item): any
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const respMaxArgs = 1 << 16
+
+// Reply kinds besides integers (int64), bulk strings ([]byte), nil bulk
+// strings (nil) and arrays ([]any).
+type (
+	respStatus string
+	respError  string
+	respMulti  []any // several replies to one command
+)
+
+// ServeRESP serves RESP clients on ln until ctx is done, then closes ln and
+// every open connection.
+func (n *Node) ServeRESP(ctx context.Context, ln net.Listener) error {
+	return n.serveConns(ctx, ln, "RESP", func(ctx context.Context, c *wireConn) {
+		(&respConn{wireConn: c}).serve(ctx)
+	})
+}
+
+type respConn struct {
+	*wireConn
+	mu  sync.Mutex  // guards w once push is writing too
+	sub *subscriber // while the connection has subscriptions
+}
+
+func (c *respConn) serve(ctx context.Context) {
+	c.n.metrics.respConns.Add(1)
+	defer c.n.metrics.respConns.Add(-1)
+	defer func() {
+		if c.sub != nil {
+			c.n.pubsub.unsubscribe(c.sub)
+		}
+	}()
+	for {
+		if c.sub != nil {
+			c.conn.SetReadDeadline(time.Time{})
+		} else {
+			c.conn.SetDeadline(time.Now().Add(wireIdleTimeout))
+		}
+		args, err := c.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.mu.Lock()
+				c.reply(respError("ERR " + err.Error()))
+				c.w.Flush()
+				c.mu.Unlock()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		c.n.metrics.respCommands.Add(1)
+		v, quit := c.exec(ctx, args)
+		c.mu.Lock()
+		c.reply(v)
+		if quit || c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil || quit {
+				c.mu.Unlock()
+				return
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// readCommand reads one multi-bulk or inline command; an empty one is nil.
+func (c *respConn) readCommand() ([][]byte, error) {
+	line, err := c.readLine()
+	if err != nil || len(line) == 0 {
+		return nil, err
+	}
+	if line[0] != '*' {
+		return bytes.Fields(bytes.Clone(line)), nil
+	}
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > respMaxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	maxBulk := c.n.wireMaxValue()
+	if c.n.Auth != nil && c.token == "" {
+		maxBulk = min(maxBulk, wireMaxAnonymous) // only AUTH can succeed
+	}
+	budget := maxBulk + wireMaxAnonymous // the value plus key and options
+	args := make([][]byte, 0, min(max(count, 0), 16))
+	for range count {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$'", errProtocol)
+		}
+		size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || size < 0 || size > maxBulk || size > budget {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		budget -= size
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+		args = append(args, buf[:size])
+	}
+	return args, nil
+}
+
+func wrongArgs(cmd string) respError {
+	return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
+
+// exec runs one command; the bool asks to close the connection.
+func (c *respConn) exec(ctx context.Context, args [][]byte) (any, bool) {
+	cmd := strings.ToUpper(string(args[0]))
+	if c.sub != nil {
+		switch cmd {
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE", "QUIT":
+		case "PING":
+			if len(args) > 2 {
+				return wrongArgs(cmd), false
+			}
+			msg := []byte{}
+			if len(args) == 2 {
+				msg = args[1]
+			}
+			return []any{[]byte("pong"), msg}, false
+		default:
+			return respError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(cmd))), false
+		}
+	}
+	switch cmd {
+	case "PING":
+		switch len(args) {
+		case 1:
+			return respStatus("PONG"), false
+		case 2:
+			return args[1], false
+		}
+		return wrongArgs(cmd), false
+	case "ECHO":
+		if len(args) != 2 {
+			return wrongArgs(cmd), false
+		}
+		return args[1], false
+	case "QUIT":
+		return respStatus("OK"), true
+	case "AUTH":
+		return c.auth(args), false
+	case "SELECT":
+		if len(args) != 2 {
+			return wrongArgs(cmd), false
+		}
+		if string(args[1]) != "0" {
+			return respError("ERR DB index is out of range"), false
+		}
+		return respStatus("OK"), false
+	case "COMMAND":
+		return []any{}, false // clients probe it for command docs; none are offered
+	case "CLIENT":
+		return respStatus("OK"), false // SETNAME, SETINFO: accepted and ignored
+	case "GET", "SET", "DEL", "EXISTS", "EXPIRE", "PEXPIRE", "TTL", "PTTL":
+		return c.keyed(ctx, cmd, args[1:]), false
+	case "PUBLISH", "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return c.pubsub(ctx, cmd, args[1:]), false
+	}
+	return respError(fmt.Sprintf("ERR unknown command '%s'", args[0])), false
+}
+
+func (c *respConn) auth(args [][]byte) any {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongArgs("auth")
+	}
+	if c.n.Auth == nil {
+		return respError("ERR AUTH called without authentication configured")
+	}
+	if wait, ok := c.login(string(args[len(args)-1])); !ok {
+		if wait > 0 {
+			return respError(fmt.Sprintf("ERR too many failed authentications; retry in %ds", int((wait+time.Second-1)/time.Second)))
+		}
+		return respError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	return respStatus("OK")
+}
+
+// respCall is a keyed command's name and its arguments after the key.
+type respCall struct {
+	cmd  string
+	args [][]byte
+}
+
+// keyed runs a command on one or (DEL, EXISTS) several keys.
+func (c *respConn) keyed(ctx context.Context, cmd string, args [][]byte) any {
+	method, want := http.MethodGet, 1
+	switch cmd {
+	case "SET":
+		method, want = http.MethodPut, -2
+	case "EXPIRE", "PEXPIRE":
+		method, want = http.MethodPut, 2
+	case "DEL":
+		method, want = http.MethodDelete, -1
+	case "EXISTS":
+		want = -1
+	}
+	if want > 0 && len(args) != want || want < 0 && len(args) < -want {
+		return wrongArgs(cmd)
+	}
+	if cmd != "DEL" && cmd != "EXISTS" {
+		return c.call(ctx, method, string(args[0]), respCall{cmd: cmd, args: args[1:]})
+	}
+	var total int64
+	for _, key := range args {
+		v := c.call(ctx, method, string(key), respCall{cmd: cmd})
+		if i, ok := v.(int64); ok {
+			total += i
+			continue
+		}
+		return v
+	}
+	return total
+}
+
+// call runs one key's command through wireChain.
+func (c *respConn) call(ctx context.Context, method, key string, rc respCall) any {
+	if key == "" || strings.Contains(key, "/") {
+		return respError("ERR keys may not be empty or contain '/'")
+	}
+	var result any
+	rej := c.wireConn.call(ctx, method, key, func(r *http.Request) {
+		result = c.n.respExec(r, key, rc)
+	})
+	if rej == nil {
+		return result
+	}
+	switch rej.status {
+	case http.StatusUnauthorized:
+		return respError("NOAUTH Authentication required.")
+	case http.StatusForbidden:
+		return respError("NOPERM " + rej.message())
+	}
+	return respError("ERR " + rej.message())
+}
+
+func (c *respConn) reply(v any) {
+	w := c.w
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case respStatus:
+		w.WriteString("+" + string(v) + "\r\n")
+	case respError:
+		w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(string(v)) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []byte:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n")
+		w.Write(v)
+		w.WriteString("\r\n")
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			c.reply(e)
+		}
+	case respMulti:
+		for _, e := range v {
+			c.reply(e)
+		}
+	}
+}
+
+// pubsub runs PUBLISH and the subscription commands.
+func (c *respConn) pubsub(ctx context.Context, cmd string, args [][]byte) any {
+	switch {
+	case cmd == "PUBLISH" && len(args) != 2, (cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE") && len(args) == 0:
+		return wrongArgs(cmd)
+	}
+	method := http.MethodGet
+	if cmd == "PUBLISH" {
+		method = http.MethodPut
+	}
+	var result any
+	rej := c.wireConn.call(ctx, method, "", func(*http.Request) {
+		if cmd == "PUBLISH" {
+			result = int64(c.n.Publish(string(args[0]), args[1]))
+			return
+		}
+		hub := &c.n.pubsub
+		add, patterns := cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE", cmd == "PSUBSCRIBE" || cmd == "PUNSUBSCRIBE"
+		names := make([]string, len(args))
+		for i, a := range args {
+			names[i] = string(a)
+		}
+		if add && c.sub == nil {
+			c.sub = hub.subscribe()
+			go c.push(c.sub)
+		}
+		if !add && len(names) == 0 && c.sub != nil {
+			// Without arguments, everything of the command's kind.
+			hub.mu.Lock()
+			if patterns {
+				names = slices.Clone(c.sub.patterns)
+			} else {
+				for ch := range c.sub.channels {
+					names = append(names, ch)
+				}
+			}
+			hub.mu.Unlock()
+		}
+		kind := []byte(strings.ToLower(cmd))
+		if len(names) == 0 {
+			result = []any{kind, nil, int64(0)}
+			return
+		}
+		var replies respMulti
+		for _, name := range names {
+			count := 0
+			if c.sub != nil {
+				if patterns {
+					count = hub.update(c.sub, add, nil, []string{name})
+				} else {
+					count = hub.update(c.sub, add, []string{name}, nil)
+				}
+			}
+			replies = append(replies, []any{kind, []byte(name), int64(count)})
+		}
+		if c.sub != nil && !add && hub.update(c.sub, false, nil, nil) == 0 {
+			hub.unsubscribe(c.sub)
+			c.sub = nil
+		}
+		result = replies
+	})
+	if rej == nil {
+		return result
+	}
+	switch rej.status {
+	case http.StatusUnauthorized:
+		return respError("NOAUTH Authentication required.")
+	case http.StatusForbidden:
+		return respError("NOPERM " + rej.message())
+	}
+	return respError("ERR " + rej.message())
+}
+
+// push writes s's messages to the connection until s is unsubscribed, and
+// closes a connection that fell behind.
+func (c *respConn) push(s *subscriber) {
+	for m := range s.msgs {
+		c.mu.Lock()
+		if m.Pattern != "" {
+			c.reply([]any{[]byte("pmessage"), []byte(m.Pattern), []byte(m.Channel), m.Message})
+		} else {
+			c.reply([]any{[]byte("message"), []byte(m.Channel), m.Message})
+		}
+		if len(s.msgs) == 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(wireIdleTimeout))
+			c.w.Flush()
+		}
+		c.mu.Unlock()
+	}
+	if s.lagged {
+		c.conn.Close()
+	}
+}
+
+// respExec runs a keyed command that passed the checks in wireChain.
+func (n *Node) respExec(r *http.Request, key string, rc respCall) any {
+	switch rc.cmd {
+	case "GET":
+		it, ok, err := n.wireGet(r, key)
+		if err != nil {
+			return respError("ERR " + err.Error())
+		}
+		if !ok {
+			return nil
+		}
+		return it.Value
+	case "EXISTS":
+		if _, ok := n.store.GetLive(key, n.now()); ok {
+			return int64(1)
+		}
+		return int64(0)
+	case "TTL", "PTTL":
+		it, ok := n.store.GetLive(key, n.now())
+		switch {
+		case !ok:
+			return int64(-2)
+		case it.ExpiresAt.IsZero():
+			return int64(-1)
+		case rc.cmd == "TTL":
+			return int64((it.ExpiresAt.Sub(n.now()) + time.Second/2) / time.Second)
+		}
+		return int64(it.ExpiresAt.Sub(n.now()) / time.Millisecond)
+	case "SET":
+		return n.respSet(r, key, rc.args)
+	case "EXPIRE", "PEXPIRE":
+		v, err := strconv.ParseInt(string(rc.args[0]), 10, 64)
+		if err != nil {
+			return respError("ERR value is not an integer or out of range")
+		}
+		unit := time.Second
+		if rc.cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		return n.respExpire(r, key, time.Duration(v)*unit)
+	}
+	return n.respDel(r, key) // DEL
+}
+
+// respSet handles SET key value [EX seconds | PX milliseconds] [NX | XX].
+func (n *Node) respSet(r *http.Request, key string, args [][]byte) any {
+	if err := n.checkKey(r, key); err != nil {
+		return respError("ERR " + err.Error())
+	}
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 1; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) || ttl != 0 {
+				return respError("ERR syntax error")
+			}
+			i++
+			v, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || v <= 0 {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(v) * time.Second
+			if opt == "PX" {
+				ttl = time.Duration(v) * time.Millisecond
+			}
+		default:
+			return respError("ERR syntax error")
+		}
+	}
+	if nx && xx {
+		return respError("ERR syntax error")
+	}
+	if nx || xx {
+		if _, exists := n.store.GetLive(key, n.now()); exists != xx {
+			return nil
+		}
+	}
+	if res := n.respWrite(r, key, "set", n.newItem(key, args[0], ttl)); res != nil {
+		return res
+	}
+	return respStatus("OK")
+}
+
+// respExpire rewrites key's expiry as a new version; a non-positive d deletes
+// it, as in Redis.
+func (n *Node) respExpire(r *http.Request, key string, d time.Duration) any {
+	it, ok := n.store.GetLive(key, n.now())
+	if !ok {
+		return int64(0)
+	}
+	if d <= 0 {
+		return n.respDel(r, key)
+	}
+	now := n.now()
+	it.Version, it.Origin, it.ExpiresAt = n.versions.next(now), n.ID, now.Add(d)
+	if res := n.respWrite(r, key, "set", it); res != nil {
+		return res
+	}
+	return int64(1)
+}
+
+func (n *Node) respDel(r *http.Request, key string) any {
+	if _, ok := n.store.GetLive(key, n.now()); !ok {
+		return int64(0)
+	}
+	if res := n.respWrite(r, key, "del", Item{Version: n.versions.next(n.now()), Origin: n.ID, Tombstone: true}); res != nil {
+		return res
+	}
+	return int64(1)
+}
+
+// respWrite makes a client write through wireWrite, returning an error
+// reply or nil.
+func (n *Node) respWrite(r *http.Request, key, op string, it Item) any {
+	_, _, err := n.wireWrite(r, key, op, it, 0, false)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errOverloaded):
+		return respError("BUSY " + err.Error())
+	}
+	return respError("ERR " + err.Error())
+}
@@ -0,0 +1,205 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the Redis protocol (RESP) listener.
+
+List of functions:
+	- startRESP: Serves a node's RESP listener on a loopback port and returns a connected client.
+	- TestRESPCommands: Tests GET, SET options, EXPIRE, TTL, EXISTS and DEL, inline and pipelined commands, and replication of RESP writes.
+	- TestRESPAuth: Tests that AUTH is required when authentication is on, and that roles apply to RESP commands.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startRESP(t *testing.T, n *Node) *respClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- n.ServeRESP(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeRESP: %v", err)
+		}
+	})
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil { t.Fatal(err) }
+	return &respClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes a command as a multi-bulk array.
+func (c *respClient) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil { c.t.Fatal(err) }
+}
+
+// read returns one reply in redis-cli's style: "(nil)", "(integer) 1",
+// "OK", "ERR ..." or the bulk string itself.
+func (c *respClient) read() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil { c.t.Fatal(err) }
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-':
+		return line[1:]
+	case ':':
+		return "(integer) " + line[1:]
+	case '*':
+		return "(array) " + line[1:]
+	case '$':
+		if line == "$-1" {
+			return "(nil)"
+		}
+		var size int
+		fmt.Sscan(line[1:], &size)
+		buf := make([]byte, size+2)
+		if _, err := c.r.Read(buf); err != nil { c.t.Fatal(err) }
+		return string(buf[:size])
+	}
+	c.t.Fatalf("unexpected reply %q", line)
+	return ""
+}
+
+func (c *respClient) do(args ...string) string {
+	c.send(args...)
+	return c.read()
+}
+
+func TestRESPCommands(t *testing.T) {
+	peer := NewNode("N2", ":y", nil)
+	peer.AccessLog = false
+	srv := httptest.NewServer(peer.Routes())
+	defer srv.Close()
+	n := NewNode("N1", ":x", []string{srv.URL})
+	c := startRESP(t, n)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"SELECT", "0"}, "OK"},
+		{[]string{"GET", "k"}, "(nil)"},
+		{[]string{"SET", "k", "v1"}, "OK"},
+		{[]string{"GET", "k"}, "v1"},
+		{[]string{"SET", "k", "v2", "NX"}, "(nil)"},
+		{[]string{"SET", "other", "v", "XX"}, "(nil)"},
+		{[]string{"SET", "k", "v2", "XX", "EX", "100"}, "OK"},
+		{[]string{"GET", "k"}, "v2"},
+		{[]string{"TTL", "k"}, "(integer) 100"},
+		{[]string{"EXPIRE", "k", "50"}, "(integer) 1"},
+		{[]string{"TTL", "k"}, "(integer) 50"},
+		{[]string{"GET", "k"}, "v2"},
+		{[]string{"TTL", "missing"}, "(integer) -2"},
+		{[]string{"SET", "k2", "v"}, "OK"},
+		{[]string{"TTL", "k2"}, "(integer) -1"},
+		{[]string{"EXISTS", "k", "k2", "missing"}, "(integer) 2"},
+		{[]string{"DEL", "k", "missing"}, "(integer) 1"},
+		{[]string{"GET", "k"}, "(nil)"},
+		{[]string{"EXPIRE", "k2", "0"}, "(integer) 1"},
+		{[]string{"EXISTS", "k2"}, "(integer) 0"},
+		{[]string{"SET", "k", "v", "EX", "0"}, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "a/b", "v"}, "ERR keys may not be empty or contain '/'"},
+		{[]string{"GET"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"FLUSHALL"}, "ERR unknown command 'FLUSHALL'"},
+	} {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	// Inline commands, and pipelined ones answered in order.
+	c.conn.Write([]byte("SET inline hello\r\nGET inline\r\n*1\r\n$4\r\nPING\r\n"))
+	for _, want := range []string{"OK", "hello", "PONG"} {
+		if got := c.read(); got != want {
+			t.Fatalf("pipelined reply %q, want %q", got, want)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		it, ok := peer.Store().GetLive("inline", time.Now())
+		if ok && string(it.Value) == "hello" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("RESP write not replicated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if recs := n.auditLog.query(AuditQuery{Key: "k"}); len(recs) != 4 {
+		t.Fatalf("audited %d writes of k, want 4", len(recs))
+	}
+
+	if got := c.do("QUIT"); got != "OK" {
+		t.Fatalf("QUIT = %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Fatal("connection open after QUIT")
+	}
+}
+
+func TestRESPAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("rkey", "reader", RoleRead)
+	keys.Add("wkey", "writer", RoleWrite)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	c := startRESP(t, n)
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"GET", "k"}, "NOAUTH Authentication required."},
+		{[]string{"AUTH", "nope"}, "WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "default", "rkey"}, "OK"},
+		{[]string{"GET", "k"}, "(nil)"},
+		{[]string{"SET", "k", "v"}, "NOPERM reader needs the write role"},
+		{[]string{"AUTH", "wkey"}, "OK"},
+		{[]string{"SET", "k", "v"}, "OK"},
+		{[]string{"GET", "k"}, "v"},
+	} {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Fatalf("%v = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+	if recs := n.auditLog.query(AuditQuery{Key: "k"}); len(recs) != 1 || recs[0].Principal != "writer" {
+		t.Fatalf("audit records: %+v", recs)
+	}
+
+	// Before AUTH, large commands are refused outright.
+	anon := startRESP(t, n)
+	anon.send("SET", "k", strings.Repeat("x", wireMaxAnonymous+1))
+	if got := anon.read(); !strings.HasPrefix(got, "ERR protocol error") {
+		t.Fatalf("oversized anonymous command = %q", got)
+	}
+}
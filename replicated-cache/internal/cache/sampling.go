@@ -0,0 +1,123 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements sampling for traces and access logs, so both can stay on at production
+request rates. A Sampler holds a rate per route (the same route names as the metrics: get, put,
+delete, sync, health, admin, other) and a separate rate for errors (responses with status 500 or
+above), e.g. "get=0.01,*=1,errors=1" keeps 1% of GETs, every other request and every error.
+
+Traces are sampled when the request arrives (head sampling): an unsampled request records no spans
+and sends no trace context to peers, so the whole trace is dropped everywhere. Requests that carry
+a traceparent header are always traced, since the caller already chose to sample them. An
+unsampled request that ends in an error is still reported as a single server span. Access logs are
+sampled when the response is complete, so errors are judged by their actual status.
+
+Functions:
+- ParseSampler(spec string): (*Sampler, error)
+- (*Node) sampleLog(r *http.Request, status int): bool
+- (*Sampler) sample(route int): bool
+- (*Sampler) sampleError(): bool
+- (*Sampler) String(): string
+*/
+
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Sampler decides which requests are kept. A nil *Sampler keeps everything.
+type Sampler struct {
+	routes [numRoutes]float64
+	errors float64
+}
+
+// ParseSampler parses comma-separated route=rate pairs, rates between 0 and
+// 1. "*" sets every route not listed and "errors" the rate for responses
+// with status >= 500; both default to 1.
+func ParseSampler(spec string) (*Sampler, error) {
+	s := &Sampler{errors: 1}
+	set := make(map[int]bool)
+	def := 1.0
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("sampler: %q is not route=rate", part)
+		}
+		rate, err := strconv.ParseFloat(val, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("sampler: rate for %q must be between 0 and 1", name)
+		}
+		switch name {
+		case "*":
+			def = rate
+		case "errors":
+			s.errors = rate
+		default:
+			route := -1
+			for i, rn := range routeNames {
+				if rn == name {
+					route = i
+				}
+			}
+			if route < 0 {
+				return nil, fmt.Errorf("sampler: unknown route %q (want one of %s)", name, strings.Join(routeNames[:], ", "))
+			}
+			s.routes[route], set[route] = rate, true
+		}
+	}
+	for i := range s.routes {
+		if !set[i] {
+			s.routes[i] = def
+		}
+	}
+	return s, nil
+}
+
+func keep(rate float64) bool {
+	return rate >= 1 || rate > 0 && rand.Float64() < rate
+}
+
+// sampleLog reports whether a finished request goes to the access log.
+func (n *Node) sampleLog(r *http.Request, status int) bool {
+	if n.LogSampler == nil {
+		return true
+	}
+	if status >= 500 {
+		return n.LogSampler.sampleError()
+	}
+	return n.LogSampler.sample(routeOf(r))
+}
+
+// sample reports whether a request to route should be kept.
+func (s *Sampler) sample(route int) bool {
+	return s == nil || keep(s.routes[route])
+}
+
+// sampleError reports whether a failed request should be kept.
+func (s *Sampler) sampleError() bool {
+	return s == nil || keep(s.errors)
+}
+
+func (s *Sampler) String() string {
+	if s == nil {
+		return "*=1"
+	}
+	var b strings.Builder
+	for i, r := range s.routes {
+		fmt.Fprintf(&b, "%s=%g,", routeNames[i], r)
+	}
+	fmt.Fprintf(&b, "errors=%g", s.errors)
+	return b.String()
+}
@@ -0,0 +1,36 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file locates secrets (API keys, the replication secret, TLS keys, encryption keys) so that
+none of them has to be passed as a flag value, where it would show up in process listings and
+shell history. Each secret is read from a file named by a flag or, failing that, from an
+environment variable holding the same content. The variable is removed from the environment once
+read, so commands the node runs later (such as -value-keys-cmd) do not inherit it.
+
+Functions:
+- LoadSecret(file, env string): ([]byte, string, error)
+*/
+
+package cache
+
+import "os"
+
+// LoadSecret returns the content of file if set, otherwise of the named
+// environment variable, along with where it came from ("$NAME" for the
+// variable) for error messages. Both unset yields nil and no error.
+func LoadSecret(file, env string) ([]byte, string, error) {
+	if file != "" {
+		b, err := os.ReadFile(file)
+		return b, file, err
+	}
+	if env != "" {
+		if v, ok := os.LookupEnv(env); ok && v != "" {
+			os.Unsetenv(env)
+			return []byte(v), "$" + env, nil
+		}
+	}
+	return nil, "", nil
+}
@@ -0,0 +1,179 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements session tokens for read-your-writes consistency. Replication is asynchronous,
+so a client that writes through one node and reads through another may not see its own write. Every
+successful PUT and DELETE answers with an X-Cache-Session token; a client that sends its latest token
+back on later requests is guaranteed to read its own writes, whichever node it talks to.
+
+The token records, for each node the session has written through, the highest version (the write's
+timestamp, which is what versions are) it received there. A node always holds the writes it accepted,
+so for a read it only has to worry about the session's writes on other nodes, and only those newer
+than its own copy of the key: with last-write-wins, a local copy at least that new already reflects
+them. For the rest it fetches the key from those nodes (GET /sync/item/KEY, a peer path authenticated
+like /sync) and serves the newest copy. A node that cannot reach one of them answers 503 rather than
+a possibly stale value; node IDs are mapped to peer URLs from their heartbeat responses.
+
+Tokens are base64url-encoded JSON, unsigned: a client can only harm itself by editing one, since
+versions more than sessionMaxSkew in the future and tokens naming more than maxSessionNodes nodes are
+refused with 400, which bounds the fan-out a forged token can cause.
+
+Functions:
+- parseSession(token string, now time.Time): (session, error)
+- (session) encode(): string
+- (*Node) issueSession(w http.ResponseWriter, r *http.Request, version int64)
+- (*Node) sessionRead(w http.ResponseWriter, r *http.Request, key, token string, it Item, ok bool): (Item, bool, bool)
+- (*Node) fetchItem(ctx context.Context, peer, key string): (Item, bool, error)
+- (*Node) handleSyncItem(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	sessionHeader   = "X-Cache-Session"
+	nodeIDHeader    = "X-Cache-Node"
+	sessionMaxSkew  = time.Minute
+	maxSessionNodes = 16
+)
+
+// session maps node IDs to the highest version the session wrote there.
+type session map[string]int64
+
+func parseSession(token string, now time.Time) (session, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed session token")
+	}
+	var s session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, errors.New("malformed session token")
+	}
+	if len(s) > maxSessionNodes {
+		return nil, fmt.Errorf("session token names more than %d nodes", maxSessionNodes)
+	}
+	limit := now.Add(sessionMaxSkew).UnixNano()
+	for _, v := range s {
+		if v > limit {
+			return nil, errors.New("session token is from the future")
+		}
+	}
+	return s, nil
+}
+
+func (s session) encode() string {
+	b, _ := json.Marshal(s)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// issueSession adds a write at version to the caller's session and sends
+// the new token. A missing or unusable token starts a new session.
+func (n *Node) issueSession(w http.ResponseWriter, r *http.Request, version int64) {
+	s, err := parseSession(r.Header.Get(sessionHeader), n.now())
+	if err != nil || s == nil || len(s) == maxSessionNodes && s[n.ID] == 0 {
+		s = session{}
+	}
+	s[n.ID] = max(s[n.ID], version)
+	w.Header().Set(sessionHeader, s.encode())
+}
+
+// sessionRead makes sure the item served for key is at least as new as the
+// session's writes: it returns the local it and ok when they are, and
+// otherwise the newest copy held by the nodes the session wrote through. The
+// last result is true when it has answered the request itself.
+func (n *Node) sessionRead(w http.ResponseWriter, r *http.Request, key, token string, it Item, ok bool) (Item, bool, bool) {
+	s, err := parseSession(token, n.now())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return it, ok, true
+	}
+	local, _ := n.store.Get(key) // tombstones count: a delete is a write
+	best, remote := local, false
+	for id, v := range s {
+		if id == n.ID || v <= local.Version {
+			continue
+		}
+		peer, known := n.peerIDs.Load(id)
+		if !known {
+			n.metrics.sessionFailed.Add(1)
+			http.Error(w, fmt.Sprintf("cannot guarantee read-your-writes: node %q is not a known peer", id), http.StatusServiceUnavailable)
+			return it, ok, true
+		}
+		got, exists, err := n.fetchItem(r.Context(), peer.(string), key)
+		if err != nil {
+			n.metrics.sessionFailed.Add(1)
+			n.log.Warn("session read failed", "component", "session", "peer", peer, "key", key, "err", err)
+			http.Error(w, fmt.Sprintf("cannot guarantee read-your-writes: %v", err), http.StatusServiceUnavailable)
+			return it, ok, true
+		}
+		if exists && got.newerThan(best) {
+			best, remote = got, true
+		}
+	}
+	if !remote {
+		return it, ok, false
+	}
+	n.metrics.sessionProxied.Add(1)
+	if best.Tombstone || best.expired(n.now()) {
+		return Item{}, false, false
+	}
+	return best, true, false
+}
+
+// fetchItem asks peer for its copy of key, tombstones included.
+func (n *Node) fetchItem(ctx context.Context, peer, key string) (Item, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, n.peerTimeout(peer))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+"/sync/item/"+url.PathEscape(key), nil)
+	if err != nil {
+		return Item{}, false, err
+	}
+	n.signSync(req)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return Item{}, false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		return Item{}, false, nil
+	default:
+		return Item{}, false, fmt.Errorf("%s: status %d", peer, resp.StatusCode)
+	}
+	var msg SyncMsg
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return Item{}, false, err
+	}
+	return msg.item(), true, nil
+}
+
+// handleSyncItem serves GET /sync/item/KEY: this node's copy of key as a
+// SyncMsg, tombstones included, for peers completing a session read.
+func (n *Node) handleSyncItem(w http.ResponseWriter, r *http.Request) {
+	if err := n.verifySync(r); err != nil {
+		n.rejectSync(w, r, err)
+		return
+	}
+	key := r.PathValue("key")
+	it, ok := n.store.Get(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(syncMsgFor(key, it))
+}
@@ -0,0 +1,117 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /stats, a machine-readable complement to /health's plain "ok": one JSON
+document with the node's build, hit ratio, key and tombstone counts, memory estimate, uptime, Go runtime
+and GC figures, and a replication summary including every peer's PeerHealth.
+
+Functions:
+- (*Node) Stats(): NodeStats
+- (*Node) handleStats(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type NodeStats struct {
+	NodeID        string    `json:"node_id"`
+	Build         BuildInfo `json:"build"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"` // hits / (hits + misses); 0 before the first GET
+	Sets     uint64  `json:"sets"`
+	Deletes  uint64  `json:"deletes"`
+
+	Store       StoreStats       `json:"store"`
+	Runtime     RuntimeStats     `json:"runtime"`
+	Replication ReplicationStats `json:"replication"`
+
+	Janitor    JanitorStats              `json:"janitor"`
+	Namespaces map[string]NamespaceStats `json:"namespaces,omitempty"`
+}
+
+type JanitorStats struct {
+	Runs                 uint64  `json:"runs"`
+	AvgRunSeconds        float64 `json:"avg_run_seconds"`
+	LastTombstonesReaped uint64  `json:"last_tombstones_reaped"`
+	OldestTombstoneAge   float64 `json:"oldest_tombstone_age_seconds"` // 0 if there are none
+}
+
+type RuntimeStats struct {
+	Goroutines     int       `json:"goroutines"`
+	HeapAllocBytes uint64    `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64    `json:"heap_sys_bytes"`
+	NumGC          uint32    `json:"num_gc"`
+	GCPauseTotal   float64   `json:"gc_pause_total_seconds"`
+	LastGC         time.Time `json:"last_gc"`
+}
+
+type ReplicationStats struct {
+	PeersActive  int          `json:"peers_active"`
+	QueueDepth   int          `json:"queue_depth"`
+	HintsPending int          `json:"hints_pending"`
+	Peers        []PeerHealth `json:"peers"`
+}
+
+// Stats gathers a snapshot of the node. It reads runtime.MemStats, which
+// briefly stops the world, so it is meant for polling, not hot paths.
+func (n *Node) Stats() NodeStats {
+	m := &n.metrics
+	st := NodeStats{
+		NodeID:        n.ID,
+		Build:         Build(),
+		UptimeSeconds: time.Since(n.started).Seconds(),
+		Hits:          m.hits.Load(),
+		Misses:        m.misses.Load(),
+		Sets:          m.sets.Load(),
+		Deletes:       m.deletes.Load(),
+		Store:         n.store.Stats(),
+		Replication: ReplicationStats{
+			PeersActive:  len(n.activePeers()),
+			QueueDepth:   n.totalQueueDepth(),
+			HintsPending: n.outbox.Len(),
+			Peers:        n.PeerHealth(),
+		},
+	}
+	st.Namespaces = n.store.NamespaceStats()
+	for i := range m.janitor.counts {
+		st.Janitor.Runs += m.janitor.counts[i].Load()
+	}
+	if st.Janitor.Runs > 0 {
+		st.Janitor.AvgRunSeconds = time.Duration(m.janitor.sumNs.Load()).Seconds() / float64(st.Janitor.Runs)
+	}
+	st.Janitor.LastTombstonesReaped = m.janitorLastReaped.Load()
+	if at, ok := n.store.OldestTombstone(); ok {
+		st.Janitor.OldestTombstoneAge = n.now().Sub(at).Seconds()
+	}
+	if total := st.Hits + st.Misses; total > 0 {
+		st.HitRatio = float64(st.Hits) / float64(total)
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	st.Runtime = RuntimeStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: ms.HeapAlloc,
+		HeapSysBytes:   ms.HeapSys,
+		NumGC:          ms.NumGC,
+		GCPauseTotal:   time.Duration(ms.PauseTotalNs).Seconds(),
+	}
+	if ms.LastGC != 0 {
+		st.Runtime.LastGC = time.Unix(0, int64(ms.LastGC))
+	}
+	return st
+}
+
+func (n *Node) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeEncoded(w, r, http.StatusOK, n.Stats())
+}
@@ -0,0 +1,175 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements pushing metrics to a StatsD or DogStatsD agent over UDP, for monitoring
+stacks that do not scrape /metrics. Every interval the node sends the same figures /metrics
+exposes: counters as deltas since the previous push ("|c"), sizes and backlogs as gauges ("|g"),
+and per-route request counts with their mean latency. DogStatsD additionally gets the configured
+tags plus route/peer tags; plain StatsD has no tags, so per-peer series are only sent to
+DogStatsD. Lines are packed into datagrams below the common 1432-byte safe UDP payload size.
+
+Functions:
+- (*Node) StatsDLoop(ctx context.Context, opts StatsDOptions): error
+- (*statsdPusher) push()
+- (*statsdPusher) counter/gauge/line: metric encoding
+- (*statsdPusher) flush()
+*/
+
+package cache
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const statsdMaxPacket = 1432
+
+type StatsDOptions struct {
+	Addr      string        // host:port of the agent
+	Prefix    string        // prepended to every metric name, e.g. "cache."
+	Tags      []string      // DogStatsD only, e.g. "env:prod"
+	DogStatsD bool          // use the DogStatsD tag extension
+	Interval  time.Duration // default 10s
+}
+
+type statsdPusher struct {
+	n    *Node
+	opts StatsDOptions
+	conn net.Conn
+	tags string // rendered common tags, "" for none
+	buf  []byte
+	prev map[string]float64 // last value of each counter, for deltas
+}
+
+// StatsDLoop pushes metrics every opts.Interval until ctx is done.
+func (n *Node) StatsDLoop(ctx context.Context, opts StatsDOptions) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	conn, err := net.Dial("udp", opts.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	p := &statsdPusher{n: n, opts: opts, conn: conn, prev: make(map[string]float64)}
+	if opts.DogStatsD && len(opts.Tags) > 0 {
+		p.tags = strings.Join(opts.Tags, ",")
+	}
+	t := time.NewTicker(opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			p.push()
+		}
+	}
+}
+
+func (p *statsdPusher) push() {
+	n, m := p.n, &p.n.metrics
+	st := n.store.Stats()
+	p.counter("hits", "", float64(m.hits.Load()))
+	p.counter("misses", "", float64(m.misses.Load()))
+	p.counter("sets", "", float64(m.sets.Load()))
+	p.counter("deletes", "", float64(m.deletes.Load()))
+	p.counter("evictions", "", float64(st.Evictions))
+	p.counter("expirations", "", float64(st.Expirations))
+	p.gauge("keys", "", float64(st.Keys))
+	p.gauge("tombstones", "", float64(st.Tombstones))
+	p.gauge("bytes", "", float64(st.Bytes))
+	p.gauge("replication.queue_depth", "", float64(n.totalQueueDepth()))
+	p.gauge("hints_pending", "", float64(n.outbox.Len()))
+	p.gauge("peers_active", "", float64(len(n.activePeers())))
+
+	for i := range m.http {
+		var count uint64
+		for b := range m.http[i].counts {
+			count += m.http[i].counts[b].Load()
+		}
+		name, tag := "http.requests."+routeNames[i], ""
+		if p.opts.DogStatsD {
+			name, tag = "http.requests", "route:"+routeNames[i]
+		}
+		prevCount, prevSum := p.prev[name+tag], p.prev[name+tag+"/sum"]
+		sum := float64(m.http[i].sumNs.Load())
+		p.counter(name, tag, float64(count))
+		p.prev[name+tag+"/sum"] = sum
+		if dc := float64(count) - prevCount; dc > 0 {
+			p.gauge(strings.Replace(name, "requests", "latency_avg_ms", 1), tag, (sum-prevSum)/dc/1e6)
+		}
+	}
+
+	if p.opts.DogStatsD {
+		for _, h := range n.PeerHealth() {
+			tag := "peer:" + h.Peer
+			p.counter("replication.acks", tag, float64(h.Acks))
+			p.counter("replication.failures", tag, float64(h.Failures))
+			p.counter("replication.bytes", tag, float64(h.BytesReplicated))
+			p.gauge("peer.up", tag, b2f(h.Up))
+			p.gauge("peer.queue_depth", tag, float64(h.QueueDepth))
+			p.gauge("peer.consecutive_failures", tag, float64(h.ConsecutiveFailures))
+			if h.HeartbeatRTTP99 > 0 {
+				p.gauge("peer.heartbeat_rtt_avg_ms", tag, float64(h.HeartbeatRTTAvg)/1e6)
+				p.gauge("peer.heartbeat_rtt_p99_ms", tag, float64(h.HeartbeatRTTP99)/1e6)
+			}
+		}
+	}
+	p.flush()
+}
+
+// counter sends the increase of a cumulative counter since the last push.
+func (p *statsdPusher) counter(name, tag string, total float64) {
+	delta := total - p.prev[name+tag]
+	p.prev[name+tag] = total
+	if delta > 0 {
+		p.line(name, tag, delta, "c")
+	}
+}
+
+func (p *statsdPusher) gauge(name, tag string, v float64) { p.line(name, tag, v, "g") }
+
+func (p *statsdPusher) line(name, tag string, v float64, typ string) {
+	start := len(p.buf)
+	if start > 0 {
+		p.buf = append(p.buf, '\n')
+	}
+	p.buf = append(p.buf, p.opts.Prefix...)
+	p.buf = append(p.buf, name...)
+	p.buf = append(p.buf, ':')
+	p.buf = strconv.AppendFloat(p.buf, v, 'f', -1, 64)
+	p.buf = append(p.buf, '|')
+	p.buf = append(p.buf, typ...)
+	if p.opts.DogStatsD && (p.tags != "" || tag != "") {
+		p.buf = append(p.buf, "|#"...)
+		p.buf = append(p.buf, p.tags...)
+		if p.tags != "" && tag != "" {
+			p.buf = append(p.buf, ',')
+		}
+		p.buf = append(p.buf, tag...)
+	}
+	if len(p.buf) > statsdMaxPacket && start > 0 {
+		// Send what fit and carry this line over to the next datagram.
+		next := append([]byte(nil), p.buf[start+1:]...)
+		p.buf = p.buf[:start]
+		p.flush()
+		p.buf = append(p.buf, next...)
+	}
+}
+
+func (p *statsdPusher) flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+	if _, err := p.conn.Write(p.buf); err != nil {
+		p.n.log.Warn("statsd push failed", "component", "statsd", "err", err)
+	}
+	p.buf = p.buf[:0]
+}
@@ -6,62 +6,390 @@ Date: Aug 10th 2025
 Summary:
 This file implements a concurrent, in-memory Last-Write-Wins (LWW) map for use as a replicated cache store.
 It provides thread-safe methods for storing, retrieving, and expiring cache items, supporting versioning and tombstone-based deletion.
+Items are stored as immutable pointers in a sync.Map, so reads never take a lock and writers resolve
+LWW conflicts with compare-and-swap instead of a map-wide mutex. An expiration index (ttlindex.go)
+lets the janitor remove due entries without scanning the whole map; it is sharded so that
+expiry runs on several cores at once. Key and byte counts are
+tracked on every insert, overwrite and removal so MaxKeys/MaxBytes can be enforced by eviction,
+and optionally per namespace (nsmetrics.go). Expiry is decided against the time callers pass in,
+the node's Clock (clock.go), never the store's own reading of the clock.
 
 Functions:
 - NewStore(): *Store
 - (*Store) Get(key string): (Item, bool)
+- (*Store) SetEviction(name string): error
+- (*Store) SetNamespaceEviction(ns string, p EvictionPolicy)
+- (*Store) policyFor(key string): EvictionPolicy
+- (*Store) GetLive(key string, now time.Time): (Item, bool)
 - (*Store) Put(key string, incoming Item): bool
+- (*Store) put(key string, incoming Item): (bool, []evictedEntry)
 - (*Store) HardDeleteExpired(now time.Time, tombstoneTTL time.Duration)
+- (*Store) ExpireDue(now time.Time, tombstoneTTL, budget time.Duration, onExpire func(string, Item)): int
+- (*storeData) holds(key string, it *Item): bool
+- (*Store) each(fn func(key string, it Item) bool)
+- (*Store) replaceWith(other *Store)
+- (*Store) Stats(): StoreStats
+- (*Store) OldestTombstone(): (time.Time, bool)
 */
 
 package cache
 
 import (
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Store is a concurrent, in-memory LWW map.
+// The map holds *Item values that are never mutated after being stored.
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]Item
+	data atomic.Pointer[storeData]
+
+	// Limits that trigger eviction (see evict.go); zero means unlimited.
+	// MaxKeys counts live keys: tombstones are left to the janitor.
+	MaxKeys  int64
+	MaxBytes int64
+	// OnEvict, if set, is called after an entry is evicted to make room.
+	OnEvict func(key string, it Item)
+	// OnExpire, if set, is called after GetLive removes an expired item. The
+	// janitor's removals are reported through ExpireDue's onExpire instead.
+	OnExpire func(key string, it Item)
+
+	policy     EvictionPolicy            // default; nil samples the whole map
+	nsPolicies map[string]EvictionPolicy // per-namespace overrides, see namespaceOf
+
+	expirations atomic.Uint64
+	evictions   atomic.Uint64
+	tombsReaped atomic.Uint64
+
+	expireFrom atomic.Uint32 // index shard ExpireDue starts at, see there
+
+	ns atomic.Pointer[nsTable] // per-namespace counters; nil unless TrackNamespaces was called
+}
+
+// StoreStats are cumulative counters and current sizes kept by the Store.
+type StoreStats struct {
+	Keys        int64  `json:"keys"`
+	Tombstones  int64  `json:"tombstones"`
+	Bytes       int64  `json:"bytes"`
+	Expirations uint64 `json:"expirations"`
+	Evictions   uint64 `json:"evictions"`
+	// TombstonesReaped counts tombstones dropped after TombstoneTTL.
+	TombstonesReaped uint64 `json:"tombstones_reaped"`
+}
+
+// storeData is swapped as a unit so the map, its expiration index and its
+// size accounting stay in step.
+type storeData struct {
+	m          sync.Map // string -> *Item
+	ttl        shardedTTL
+	keys       atomic.Int64
+	tombstones atomic.Int64 // included in keys
+	bytes      atomic.Int64
 }
 
-func NewStore() *Store { return &Store{data: make(map[string]Item)} }
+// itemOverhead approximates the per-entry cost beyond key and value bytes
+// (the Item struct, map entry and index bookkeeping).
+const itemOverhead = 96
+
+func itemSize(key string, it *Item) int64 {
+	return int64(len(key) + len(it.Value) + itemOverhead)
+}
+
+// holds reports whether key maps to exactly it.
+func (d *storeData) holds(key string, it *Item) bool {
+	v, ok := d.m.Load(key)
+	return ok && v.(*Item) == it
+}
+
+// remove deletes key only if it still maps to v, keeping the accounting and
+// the eviction policy in step.
+func (s *Store) remove(d *storeData, key string, v any) bool {
+	if !d.m.CompareAndDelete(key, v) {
+		return false
+	}
+	d.keys.Add(-1)
+	if v.(*Item).Tombstone {
+		d.tombstones.Add(-1)
+	}
+	d.bytes.Add(-itemSize(key, v.(*Item)))
+	if c := s.nsCounters(key); c != nil {
+		c.keys.Add(-1)
+		c.bytes.Add(-itemSize(key, v.(*Item)))
+	}
+	if p := s.policyFor(key); p != nil {
+		p.OnRemove(key)
+	}
+	return true
+}
+
+func NewStore() *Store {
+	s := &Store{}
+	s.data.Store(new(storeData))
+	return s
+}
 
 func (s *Store) Get(key string) (Item, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	it, ok := s.data[key]
-	return it, ok
+	v, ok := s.data.Load().m.Load(key)
+	if !ok {
+		return Item{}, false
+	}
+	return *v.(*Item), true
+}
+
+// SetEviction selects the default policy by name (see NewEvictionPolicy) for
+// choosing victims when the store is over its limits. Call it after setting
+// MaxKeys and MaxBytes and before the store is in use: without a limit
+// nothing is evicted, so no policy is kept and writes skip its bookkeeping.
+func (s *Store) SetEviction(name string) error {
+	p, err := NewEvictionPolicy(name)
+	if err != nil {
+		return err
+	}
+	if s.MaxKeys > 0 || s.MaxBytes > 0 {
+		s.policy = p
+	}
+	return nil
+}
+
+// SetNamespaceEviction gives keys in namespace ns their own policy. Call it
+// before the store is in use.
+func (s *Store) SetNamespaceEviction(ns string, p EvictionPolicy) {
+	if s.nsPolicies == nil {
+		s.nsPolicies = make(map[string]EvictionPolicy)
+	}
+	s.nsPolicies[ns] = p
+}
+
+// policyFor returns the policy tracking key, or nil for whole-map sampling.
+func (s *Store) policyFor(key string) EvictionPolicy {
+	if s.nsPolicies != nil {
+		if p, ok := s.nsPolicies[namespaceOf(key)]; ok {
+			return p
+		}
+	}
+	return s.policy
+}
+
+// GetLive returns the item only if it is present, not deleted and not expired.
+// An expired item is removed on the spot rather than left for the janitor.
+// Tombstones are kept until TombstoneTTL: dropping one early would let a
+// delayed, older write resurrect the key.
+func (s *Store) GetLive(key string, now time.Time) (Item, bool) {
+	d := s.data.Load()
+	v, ok := d.m.Load(key)
+	if !ok {
+		return Item{}, false
+	}
+	it := v.(*Item)
+	if it.Tombstone {
+		return Item{}, false
+	}
+	if it.expired(now) {
+		if s.remove(d, key, v) {
+			s.expirations.Add(1)
+			if c := s.nsCounters(key); c != nil {
+				c.expirations.Add(1)
+			}
+			if s.OnExpire != nil {
+				s.OnExpire(key, *it)
+			}
+		}
+		return Item{}, false
+	}
+	if p := s.policyFor(key); p != nil {
+		p.OnAccess(key)
+	}
+	return *it, true
 }
 
 // Put applies last-write-wins using Version (then Origin to break ties).
 func (s *Store) Put(key string, incoming Item) (applied bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	cur, exists := s.data[key]
-	if !exists {
-		s.data[key] = incoming
-		return true
+	applied, evicted := s.put(key, incoming)
+	s.notifyEvicted(evicted)
+	return applied
+}
+
+// put is Put without calling OnEvict: it returns what it evicted, so a caller
+// holding locks of its own can report the evictions after releasing them.
+func (s *Store) put(key string, incoming Item) (bool, []evictedEntry) {
+	d := s.data.Load()
+	next := &incoming
+	for {
+		cur, loaded := d.m.LoadOrStore(key, next)
+		if !loaded {
+			d.keys.Add(1)
+			if next.Tombstone {
+				d.tombstones.Add(1)
+			}
+			d.bytes.Add(itemSize(key, next))
+			if c := s.nsCounters(key); c != nil {
+				c.keys.Add(1)
+				c.bytes.Add(itemSize(key, next))
+			}
+			break
+		}
+		if !incoming.newerThan(*cur.(*Item)) {
+			return false, nil
+		}
+		if d.m.CompareAndSwap(key, cur, next) {
+			d.bytes.Add(itemSize(key, next) - itemSize(key, cur.(*Item)))
+			if c := s.nsCounters(key); c != nil {
+				c.bytes.Add(itemSize(key, next) - itemSize(key, cur.(*Item)))
+			}
+			if prev := cur.(*Item).Tombstone; prev != next.Tombstone {
+				if next.Tombstone {
+					d.tombstones.Add(1)
+				} else {
+					d.tombstones.Add(-1)
+				}
+			}
+			break
+		}
+		// Lost a race with another writer; re-check against the new value.
 	}
-	if incoming.Version > cur.Version || (incoming.Version == cur.Version && incoming.Origin > cur.Origin) {
-		s.data[key] = incoming
-		return true
+	d.ttl.shard(key).add(key, next, d.holds)
+	if p := s.policyFor(key); p != nil {
+		// Tombstones are never eviction candidates (see pickVictim).
+		if next.Tombstone {
+			p.OnRemove(key)
+		} else {
+			p.OnInsert(key)
+		}
 	}
-	return false
+	return true, s.evictIfNeeded(d, key)
 }
 
+// HardDeleteExpired sweeps the whole map. The janitor uses ExpireDue instead.
 func (s *Store) HardDeleteExpired(now time.Time, tombstoneTTL time.Duration) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for k, v := range s.data {
-		if v.Tombstone && now.Sub(time.Unix(0, v.Version)) > tombstoneTTL {
-			delete(s.data, k)
-			continue
+	d := s.data.Load()
+	d.m.Range(func(k, v any) bool {
+		if v.(*Item).reapable(now, tombstoneTTL) {
+			s.remove(d, k.(string), v)
 		}
-		if !v.Tombstone && v.expired(now) {
-			delete(s.data, k)
+		return true
+	})
+}
+
+// ExpireDue removes expired items and old tombstones using the expiration
+// index, so the cost is proportional to what is due rather than the key count.
+// Index shards are drained in parallel (up to GOMAXPROCS at a time) against
+// one shared deadline; once budget is spent everyone stops and the rest is
+// picked up next time. Each call starts at the shard after the last one the
+// previous call reached, and removes at least one due entry from every shard
+// it visits, so a backlog in one shard cannot starve the others however small
+// the budget. onExpire, if set, is called (never concurrently) for every entry
+// actually removed.
+func (s *Store) ExpireDue(now time.Time, tombstoneTTL, budget time.Duration, onExpire func(key string, it Item)) int {
+	d := s.data.Load()
+	deadline := time.Now().Add(budget)
+	spent := func() bool { return budget > 0 && !time.Now().Before(deadline) }
+	start := s.expireFrom.Load()
+	var (
+		removed  atomic.Int64
+		expireMu sync.Mutex
+		next     atomic.Uint32
+		visited  atomic.Uint32
+		wg       sync.WaitGroup
+	)
+	drain := func(x *ttlIndex) {
+		for first := true; first || !spent(); first = false {
+			e, ok := x.popDue(now, tombstoneTTL)
+			if !ok {
+				return
+			}
+			// A stale entry (the key was overwritten or already deleted) fails the CAS.
+			if !s.remove(d, e.key, e.it) {
+				continue
+			}
+			removed.Add(1)
+			if !e.it.Tombstone {
+				s.expirations.Add(1)
+				if c := s.nsCounters(e.key); c != nil {
+					c.expirations.Add(1)
+				}
+			} else {
+				s.tombsReaped.Add(1)
+			}
+			if onExpire != nil {
+				expireMu.Lock()
+				onExpire(e.key, *e.it)
+				expireMu.Unlock()
+			}
 		}
 	}
-}
\ No newline at end of file
+	workers := min(runtime.GOMAXPROCS(0), ttlShards)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1) - 1; i < ttlShards; i = next.Add(1) - 1 {
+				drain(&d.ttl[(start+i)%ttlShards])
+				visited.Add(1)
+				if spent() {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	s.expireFrom.Store((start + visited.Load()) % ttlShards)
+	return int(removed.Load())
+}
+
+// each calls fn for every entry, tombstones included, until fn returns false.
+func (s *Store) each(fn func(key string, it Item) bool) {
+	s.data.Load().m.Range(func(k, v any) bool {
+		return fn(k.(string), *v.(*Item))
+	})
+}
+
+// replaceWith swaps in the contents of other, e.g. after a point-in-time restore.
+func (s *Store) replaceWith(other *Store) {
+	old, d := s.data.Load(), other.data.Load()
+	s.data.Store(d)
+	if t := s.ns.Load(); t != nil {
+		t.reset(d)
+	}
+	old.m.Range(func(k, _ any) bool {
+		if p := s.policyFor(k.(string)); p != nil {
+			p.OnRemove(k.(string))
+		}
+		return true
+	})
+	d.m.Range(func(k, v any) bool {
+		if p := s.policyFor(k.(string)); p != nil && !v.(*Item).Tombstone {
+			p.OnInsert(k.(string))
+		}
+		return true
+	})
+}
+
+func (s *Store) Stats() StoreStats {
+	d := s.data.Load()
+	return StoreStats{
+		Keys:        d.keys.Load(),
+		Tombstones:  d.tombstones.Load(),
+		Bytes:       d.bytes.Load(),
+		Expirations: s.expirations.Load(),
+		Evictions:   s.evictions.Load(),
+
+		TombstonesReaped: s.tombsReaped.Load(),
+	}
+}
+
+// OldestTombstone returns the deletion time of the oldest tombstone still
+// held, or false if there are none.
+func (s *Store) OldestTombstone() (time.Time, bool) {
+	d := s.data.Load()
+	live := func(e ttlEntry) bool { return d.holds(e.key, e.it) }
+	var oldest time.Time
+	found := false
+	for i := range d.ttl {
+		if at, ok := d.ttl[i].oldestTomb(live); ok && (!found || at.Before(oldest)) {
+			oldest, found = at, true
+		}
+	}
+	return oldest, found
+}
@@ -11,11 +11,32 @@ Summary:
 List of functions:
 	- TestStoreLWW: Tests LWW semantics, including version comparison and origin-based tie-breaking.
 	- TestStoreTTLAndTombstoneGC: Tests TTL expiration and garbage collection of tombstone entries.
+	- TestStoreConcurrentPut: Tests that concurrent writers and readers converge on the newest version.
+	- TestStoreExpireDue: Tests index-driven expiry, including stale entries for overwritten keys.
+	- TestStoreTTLIndexOverwrite: Tests that rewriting a key keeps one index entry for it.
+	- TestStoreGetLiveRemovesExpired: Tests delete-on-read of expired items.
+	- TestStoreEviction: Tests size accounting and eviction under MaxKeys/MaxBytes.
+	- TestStoreRandomEviction: Tests that random eviction, with and without a policy, spreads over live keys and spares tombstones.
+	- TestStoreEvictionTombstones: Tests that tombstones do not count against MaxKeys and are never evicted.
+	- TestStoreLRUEviction: Tests that the LRU policy evicts the least recently read key.
+	- TestStoreLFUEviction: Tests that the LFU policy admits a new key only once it is used more than the least frequently read key it evicts.
+	- TestStoreLFUAdmission: Tests that a scan of one-off keys does not flush TinyLFU's hot set.
+	- TestStoreNamespaceEviction: Tests that a namespace policy evicts that namespace's keys first.
+	- TestStoreParallelExpire: Tests that expiry across all index shards removes every due entry exactly once.
+	- TestStoreExpireDueFairness: Tests that every index shard makes progress when each run exhausts its budget.
+	- TestHotKeys: Tests that the hot-key tracker ranks heavy hitters above a long tail.
+	- TestStoreNamespaceStats: Tests per-namespace accounting and the cap on tracked namespaces.
+	- TestStoreOldestTombstone: Tests that the oldest live tombstone is found and overwritten ones are skipped.
+	- TestStoreTombstoneCount: Tests that tombstones are counted as they are written, revived and removed.
 */
 
 package cache
 
 import (
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 )
@@ -52,4 +73,396 @@ func TestStoreTTLAndTombstoneGC(t *testing.T) {
 	if _, ok := s.Get("del"); ok {
 		t.Fatal("tombstone should be removed")
 	}
-}
\ No newline at end of file
+}
+
+func TestStoreConcurrentPut(t *testing.T) {
+	s := NewStore()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for v := 1; v <= 500; v++ {
+				s.Put("k", Item{Value: []byte(fmt.Sprint(v)), Version: int64(v), Origin: fmt.Sprint(w)})
+				s.Get("k")
+			}
+		}(w)
+	}
+	wg.Wait()
+	got, _ := s.Get("k")
+	if got.Version != 500 || got.Origin != "7" {
+		t.Fatalf("want version 500 from origin 7, got %d from %q", got.Version, got.Origin)
+	}
+}
+
+func TestStoreExpireDue(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		s.Put(fmt.Sprint("old", i), Item{Value: []byte("v"), Version: 1, ExpiresAt: now.Add(-time.Second)})
+	}
+	s.Put("live", Item{Value: []byte("v"), Version: 1, ExpiresAt: now.Add(time.Hour)})
+	// Overwriting a key leaves a stale index entry that must not delete the new value.
+	s.Put("old0", Item{Value: []byte("new"), Version: 2})
+	s.Put("tomb", Item{Version: now.Add(-time.Hour).UnixNano(), Tombstone: true})
+
+	var expired []string
+	removed := s.ExpireDue(now, time.Minute, 0, func(k string, _ Item) { expired = append(expired, k) })
+	if removed != 100 || len(expired) != 100 {
+		t.Fatalf("want 99 expired + 1 tombstone removed, got %d", removed)
+	}
+	if got, ok := s.Get("old0"); !ok || string(got.Value) != "new" {
+		t.Fatal("overwritten key should survive its stale index entry")
+	}
+	if _, ok := s.Get("live"); !ok {
+		t.Fatal("live key removed")
+	}
+	if _, ok := s.Get("tomb"); ok {
+		t.Fatal("old tombstone should be removed")
+	}
+}
+
+func TestStoreTTLIndexOverwrite(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	index := func() int { return s.data.Load().ttl.len() }
+	for v := int64(1); v <= 1000; v++ {
+		s.Put("k", Item{Value: []byte("v"), Version: v, ExpiresAt: now.Add(time.Hour + time.Duration(v))})
+	}
+	if n := index(); n != 1 {
+		t.Fatalf("%d index entries after rewriting one key, want 1", n)
+	}
+	s.Put("k", Item{Version: 1001, Tombstone: true})
+	if n := index(); n != 1 {
+		t.Fatalf("%d index entries after deleting the key, want 1", n)
+	}
+	s.Put("k", Item{Value: []byte("v"), Version: 1002})
+	if n := index(); n != 0 {
+		t.Fatalf("%d index entries for a key without a TTL, want 0", n)
+	}
+
+	// A key removed and written again at an older version is indexed anew.
+	s.Put("e", Item{Value: []byte("v"), Version: 5, ExpiresAt: now.Add(time.Hour)})
+	if !s.Evict("e", 5, "") {
+		t.Fatal("evict failed")
+	}
+	s.Put("e", Item{Value: []byte("v"), Version: 3, ExpiresAt: now.Add(-time.Second)})
+	if removed := s.ExpireDue(now, time.Minute, 0, nil); removed != 1 {
+		t.Fatalf("ExpireDue removed %d, want the rewritten key", removed)
+	}
+	if n := index(); n != 0 {
+		t.Fatalf("%d index entries left, want 0", n)
+	}
+}
+
+func TestStoreGetLiveRemovesExpired(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	s.Put("k", Item{Value: []byte("v"), Version: 1, ExpiresAt: now.Add(-time.Millisecond)})
+	s.Put("d", Item{Version: 1, Tombstone: true})
+	if _, ok := s.GetLive("k", now); ok {
+		t.Fatal("expired item should not be returned")
+	}
+	if _, ok := s.Get("k"); ok {
+		t.Fatal("expired item should be removed on read")
+	}
+	if s.Stats().Expirations != 1 {
+		t.Fatalf("want 1 expiration, got %d", s.Stats().Expirations)
+	}
+	if _, ok := s.GetLive("d", now); ok {
+		t.Fatal("tombstone should read as missing")
+	}
+	if _, ok := s.Get("d"); !ok {
+		t.Fatal("tombstone must be kept until TombstoneTTL")
+	}
+}
+
+func TestStoreEviction(t *testing.T) {
+	s := NewStore()
+	s.MaxKeys = 10
+	for i := 0; i < 50; i++ {
+		s.Put(fmt.Sprint("k", i), Item{Value: []byte("v"), Version: 1})
+	}
+	st := s.Stats()
+	if st.Keys != 10 || st.Evictions != 40 {
+		t.Fatalf("want 10 keys and 40 evictions, got %+v", st)
+	}
+	if _, ok := s.Get("k49"); !ok {
+		t.Fatal("the key just written must not be evicted")
+	}
+
+	s = NewStore()
+	s.MaxBytes = 10 * (itemOverhead + 3 + 100)
+	for i := 0; i < 20; i++ {
+		s.Put(fmt.Sprintf("k%02d", i), Item{Value: make([]byte, 100), Version: 1})
+	}
+	if st := s.Stats(); st.Bytes > s.MaxBytes {
+		t.Fatalf("store over byte limit: %+v", st)
+	}
+}
+
+func TestStoreRandomEviction(t *testing.T) {
+	for _, policy := range []string{"", "random"} {
+		victims := map[string]int{}
+		for trial := 0; trial < 200; trial++ {
+			s := NewStore()
+			s.MaxKeys = 10
+			if policy != "" {
+				if err := s.SetEviction(policy); err != nil { t.Fatal(err) }
+			}
+			s.OnEvict = func(k string, _ Item) { victims[k]++ }
+			s.Put("gone1", Item{Tombstone: true, Version: 1})
+			s.Put("gone2", Item{Tombstone: true, Version: 1})
+			for i := 0; i < 10; i++ {
+				s.Put(fmt.Sprint("k", i), Item{Value: []byte("v"), Version: 1})
+			}
+			s.Put("new", Item{Value: []byte("v"), Version: 1})
+		}
+		if victims["gone1"]+victims["gone2"] != 0 || victims["new"] != 0 {
+			t.Fatalf("policy %q evicted a tombstone or the new key: %v", policy, victims)
+		}
+		if len(victims) < 8 {
+			t.Fatalf("policy %q: victims not spread over the live keys: %v", policy, victims)
+		}
+	}
+
+	// With only tombstones to spare, nothing is evicted.
+	s := NewStore()
+	s.MaxBytes = 1
+	s.Put("gone", Item{Tombstone: true, Version: 1})
+	s.Put("new", Item{Value: []byte("v"), Version: 1})
+	if st := s.Stats(); st.Evictions != 0 || st.Tombstones != 1 {
+		t.Fatalf("tombstone evicted: %+v", st)
+	}
+}
+
+func TestStoreEvictionTombstones(t *testing.T) {
+	for _, policy := range []string{"", "lru"} {
+		s := NewStore()
+		s.MaxKeys = 10
+		if policy != "" {
+			if err := s.SetEviction(policy); err != nil { t.Fatal(err) }
+		}
+		for i := 0; i < 1000; i++ {
+			s.Put(fmt.Sprint("gone", i), Item{Tombstone: true, Version: 1})
+		}
+		// Tombstones do not use up MaxKeys, so live keys are kept up to it.
+		for i := 0; i < 10; i++ {
+			s.Put(fmt.Sprint("k", i), Item{Value: []byte("v"), Version: 1})
+		}
+		if st := s.Stats(); st.Evictions != 0 || st.Tombstones != 1000 {
+			t.Fatalf("policy %q: %+v", policy, st)
+		}
+		s.Put("k10", Item{Value: []byte("v"), Version: 1})
+		st := s.Stats()
+		if st.Evictions != 1 || st.Tombstones != 1000 || st.Keys != 1010 {
+			t.Fatalf("policy %q after one more key: %+v", policy, st)
+		}
+	}
+}
+
+func TestStoreLRUEviction(t *testing.T) {
+	s := NewStore()
+	s.MaxKeys = 3
+	if err := s.SetEviction("lru"); err != nil { t.Fatal(err) }
+	var evicted []string
+	s.OnEvict = func(k string, _ Item) { evicted = append(evicted, k) }
+	for _, k := range []string{"a", "b", "c"} {
+		s.Put(k, Item{Value: []byte(k), Version: 1})
+	}
+	s.GetLive("a", time.Now())
+	s.Put("d", Item{Value: []byte("d"), Version: 1})
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("want b evicted, got %v", evicted)
+	}
+	// A peer-requested eviction only removes the exact version.
+	if s.Evict("a", 2, "") {
+		t.Fatal("evict with a different version should be ignored")
+	}
+	if !s.Evict("a", 1, "") {
+		t.Fatal("evict with matching version should apply")
+	}
+}
+
+func TestStoreLFUEviction(t *testing.T) {
+	s := NewStore()
+	s.MaxKeys = 3
+	if err := s.SetEviction("lfu"); err != nil { t.Fatal(err) }
+	var evicted []string
+	s.OnEvict = func(k string, _ Item) { evicted = append(evicted, k) }
+	for _, k := range []string{"a", "b", "c"} {
+		s.Put(k, Item{Value: []byte(k), Version: 1})
+	}
+	for i := 0; i < 20; i++ {
+		s.GetLive("a", time.Now())
+		s.GetLive("c", time.Now())
+	}
+	s.GetLive("b", time.Now())
+	// A new key is not admitted until it is used more often than the
+	// victim, which is the least frequently read key.
+	for i := 0; i < 3; i++ {
+		s.Put("d", Item{Value: []byte("d"), Version: 1})
+	}
+	if want := []string{"d", "d", "b"}; !slices.Equal(evicted, want) {
+		t.Fatalf("evicted %v, want %v", evicted, want)
+	}
+	if _, ok := s.GetLive("d", time.Now()); !ok {
+		t.Fatal("d not admitted")
+	}
+}
+
+func TestStoreLFUAdmission(t *testing.T) {
+	s := NewStore()
+	s.MaxKeys = 100
+	if err := s.SetEviction("tinylfu"); err != nil { t.Fatal(err) }
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("hot%d", i)
+		s.Put(k, Item{Value: []byte("v"), Version: 1})
+		for j := 0; j < 3; j++ {
+			s.GetLive(k, time.Now())
+		}
+	}
+	// A scan of one-off keys must not flush the hot set.
+	for i := 0; i < 10000; i++ {
+		s.Put(fmt.Sprintf("scan%d", i), Item{Value: []byte("v"), Version: 1})
+	}
+	hot := 0
+	for i := 0; i < 100; i++ {
+		if _, ok := s.GetLive(fmt.Sprintf("hot%d", i), time.Now()); ok {
+			hot++
+		}
+	}
+	if hot < 95 {
+		t.Fatalf("%d of 100 hot keys left after a scan", hot)
+	}
+}
+
+func TestStoreNamespaceEviction(t *testing.T) {
+	s := NewStore()
+	s.MaxKeys = 4
+	s.SetNamespaceEviction("a", NewLRUPolicy())
+	var evicted []string
+	s.OnEvict = func(k string, _ Item) { evicted = append(evicted, k) }
+	for _, k := range []string{"b:1", "b:2", "a:1", "a:2", "a:3"} {
+		s.Put(k, Item{Value: []byte("v"), Version: 1})
+	}
+	if len(evicted) != 1 || evicted[0] != "a:1" {
+		t.Fatalf("want a:1 evicted from its own namespace, got %v", evicted)
+	}
+}
+
+func TestHotKeys(t *testing.T) {
+	h := newHotKeys(8)
+	for i := 0; i < 1000; i++ {
+		h.record(fmt.Sprintf("tail%d", i))
+		if i%2 == 0 {
+			h.record("hot")
+		}
+		if i%5 == 0 {
+			h.record("warm")
+		}
+	}
+	top := h.top(2)
+	if len(top) != 2 || top[0].Key != "hot" || top[1].Key != "warm" {
+		t.Fatalf("want [hot warm], got %+v", top)
+	}
+}
+
+func TestStoreParallelExpire(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	for i := 0; i < 2000; i++ {
+		s.Put(fmt.Sprintf("k%d", i), Item{Value: []byte("v"), Version: 1, Origin: "A", ExpiresAt: now.Add(-time.Second)})
+	}
+	s.Put("live", Item{Value: []byte("v"), Version: 1, Origin: "A", ExpiresAt: now.Add(time.Hour)})
+	calls := 0
+	removed := s.ExpireDue(now, time.Minute, 0, func(string, Item) { calls++ })
+	if removed != 2000 || calls != 2000 {
+		t.Fatalf("want 2000 removed and callbacks, got %d/%d", removed, calls)
+	}
+	if st := s.Stats(); st.Keys != 1 || st.Expirations != 2000 {
+		t.Fatalf("unexpected stats after expiry: %+v", st)
+	}
+}
+
+func TestStoreExpireDueFairness(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	s := NewStore()
+	now := time.Now()
+	for i := 0; i < 20*ttlShards; i++ {
+		s.Put(fmt.Sprintf("k%d", i), Item{Value: []byte("v"), Version: 1, ExpiresAt: now.Add(-time.Second)})
+	}
+	d := s.data.Load()
+	var before [ttlShards]int
+	for i := range before {
+		before[i] = d.ttl[i].len()
+	}
+	for run := 0; run < ttlShards; run++ {
+		if n := s.ExpireDue(now, time.Minute, time.Nanosecond, nil); n == 0 {
+			t.Fatalf("run %d removed nothing", run)
+		}
+	}
+	for i := range before {
+		if d.ttl[i].len() >= before[i] {
+			t.Fatalf("shard %d made no progress: %d entries, %d before", i, d.ttl[i].len(), before[i])
+		}
+	}
+}
+
+func TestStoreTombstoneCount(t *testing.T) {
+	s := NewStore()
+	s.Put("a", Item{Value: []byte("1"), Version: 1})
+	s.Put("b", Item{Version: 1, Tombstone: true})
+	s.Put("a", Item{Version: 2, Tombstone: true})
+	if st := s.Stats(); st.Keys != 2 || st.Tombstones != 2 {
+		t.Fatalf("stats = %+v, want 2 keys, 2 tombstones", st)
+	}
+	s.Put("a", Item{Value: []byte("3"), Version: 3})
+	s.HardDeleteExpired(time.Now().Add(time.Hour), time.Minute)
+	if st := s.Stats(); st.Keys != 1 || st.Tombstones != 0 {
+		t.Fatalf("stats = %+v, want 1 key, 0 tombstones", st)
+	}
+}
+
+func TestStoreNamespaceStats(t *testing.T) {
+	s := NewStore()
+	s.Put("a:1", Item{Value: []byte("x"), Version: 1})
+	s.TrackNamespaces(2)
+	s.Put("a:2", Item{Value: []byte("x"), Version: 1})
+	s.Put("b:1", Item{Value: []byte("x"), Version: 1, ExpiresAt: time.Now().Add(-time.Second)})
+	s.Put("c:1", Item{Value: []byte("x"), Version: 1}) // a third namespace is pooled
+	s.Put("plain", Item{Value: []byte("x"), Version: 1})
+	s.GetLive("b:1", time.Now())
+
+	ns := s.NamespaceStats()
+	if ns["a"].Keys != 2 || ns["a"].Bytes != 2*itemSize("a:1", &Item{Value: []byte("x")}) {
+		t.Fatalf("a = %+v", ns["a"])
+	}
+	if ns["b"].Keys != 0 || ns["b"].Expirations != 1 {
+		t.Fatalf("b = %+v", ns["b"])
+	}
+	if ns[nsOther].Keys != 2 || len(ns) != 3 {
+		t.Fatalf("namespaces = %+v; want a, b and _other (holding c:1 and plain)", ns)
+	}
+}
+
+func TestStoreOldestTombstone(t *testing.T) {
+	s := NewStore()
+	if _, ok := s.OldestTombstone(); ok {
+		t.Fatal("empty store reported a tombstone")
+	}
+	base := time.Now().Add(-time.Hour)
+	s.Put("old", Item{Version: base.UnixNano(), Tombstone: true})
+	s.Put("mid", Item{Version: base.Add(time.Minute).UnixNano(), Tombstone: true})
+	s.Put("new", Item{Version: base.Add(2 * time.Minute).UnixNano(), Tombstone: true})
+	s.Put("old", Item{Value: []byte("back"), Version: base.Add(3 * time.Minute).UnixNano()}) // revived
+
+	at, ok := s.OldestTombstone()
+	if !ok || !at.Equal(time.Unix(0, base.Add(time.Minute).UnixNano())) {
+		t.Fatalf("oldest tombstone at %v (%v), want the one for mid", at, ok)
+	}
+	s.ExpireDue(time.Now(), 58*time.Minute+30*time.Second, 0, nil)
+	if st := s.Stats(); st.TombstonesReaped != 1 || st.Tombstones != 1 {
+		t.Fatalf("stats = %+v, want mid reaped and new kept", st)
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the optional streaming sync channel. Instead of one HTTP request per
+message, a node keeps one long-lived TCP connection per peer, opened with an HTTP Upgrade on
+the regular port (GET /sync/stream, "Upgrade: rc-sync/1"). After the 101 response both sides
+speak a tiny framed protocol: the sender writes [4-byte big-endian length][msgpack SyncMsg or
+batch] frames and the receiver answers every frame, in order, with a one-byte ack (0 = applied,
+1 = rejected). Frames are pipelined: many writers may have frames in flight and acks are
+matched to them first-in first-out. Peers that refuse the upgrade are sent plain POST /sync.
+
+Functions:
+- (*Node) handleSyncStream(w http.ResponseWriter, r *http.Request)
+- (*Node) serveSyncStream(conn net.Conn, rw *bufio.ReadWriter)
+- (*Node) stream(peer string): (*syncStream, error)
+- (*Node) dialStream(peer string): (*syncStream, error)
+- (*Node) dropStream(peer string, s *syncStream)
+- (*syncStream) send(ctx context.Context, msgs []SyncMsg): error
+- (*syncStream) readAcks()
+- (*syncStream) fail(err error)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	streamProto    = "rc-sync/1"
+	maxStreamFrame = 64 << 20
+
+	streamAckOK  = 0
+	streamAckBad = 1
+)
+
+// errStreamRefused means the peer answered the upgrade with something other
+// than 101, i.e. it does not support streaming and should be sent POST /sync.
+var errStreamRefused = errors.New("peer refused sync stream")
+
+func (n *Node) handleSyncStream(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != streamProto {
+		w.Header().Set("Upgrade", streamProto)
+		http.Error(w, "expected Upgrade: "+streamProto, http.StatusUpgradeRequired)
+		return
+	}
+	if err := n.verifySync(r); err != nil {
+		n.rejectSync(w, r, err)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "streaming not supported", 500)
+		return
+	}
+	conn.SetDeadline(time.Time{}) // the stream outlives any per-request deadline
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + streamProto + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	go n.serveSyncStream(conn, rw)
+}
+
+// serveSyncStream applies frames until the peer hangs up. Acks are buffered
+// and flushed whenever no further frames are already waiting to be read.
+func (n *Node) serveSyncStream(conn net.Conn, rw *bufio.ReadWriter) {
+	defer conn.Close()
+	var hdr [4]byte
+	buf := make([]byte, 0, 4096)
+	for {
+		if _, err := io.ReadFull(rw, hdr[:]); err != nil {
+			if !errors.Is(err, io.EOF) {
+				n.log.Warn("sync stream read failed", "component", "stream", "remote", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		size := binary.BigEndian.Uint32(hdr[:])
+		if size > maxStreamFrame {
+			n.log.Warn("sync stream frame too large", "component", "stream", "remote", conn.RemoteAddr().String(), "bytes", size)
+			return
+		}
+		if cap(buf) < int(size) {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		if _, err := io.ReadFull(rw, buf); err != nil {
+			n.log.Warn("sync stream read failed", "component", "stream", "remote", conn.RemoteAddr().String(), "err", err)
+			return
+		}
+		ack := byte(streamAckOK)
+		msgs, err := decodeSyncBatchMsgpack(buf)
+		if err == nil {
+			err = n.applySync(msgs...)
+		}
+		if err != nil {
+			ack = streamAckBad
+		}
+		rw.WriteByte(ack)
+		if rw.Reader.Buffered() == 0 {
+			if err := rw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// syncStream is the client end of a stream to one peer. pending holds one
+// channel per frame written and not yet acknowledged, oldest first.
+type syncStream struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu      sync.Mutex
+	pending []chan error
+	err     error // set once the stream is dead
+	onDead  func()
+}
+
+// stream returns the open stream to peer, dialing one if needed.
+func (n *Node) stream(peer string) (*syncStream, error) {
+	n.streamsMu.Lock()
+	s, ok := n.streams[peer]
+	n.streamsMu.Unlock()
+	if ok {
+		return s, nil
+	}
+	s, err := n.dialStream(peer)
+	if err != nil {
+		return nil, err
+	}
+	n.streamsMu.Lock()
+	cur, ok := n.streams[peer]
+	if !ok {
+		n.streams[peer] = s
+	}
+	n.streamsMu.Unlock()
+	if ok {
+		// Another worker won the race; keep its stream.
+		s.fail(net.ErrClosed)
+		return cur, nil
+	}
+	return s, nil
+}
+
+func (n *Node) dialStream(peer string) (*syncStream, error) {
+	u, err := url.Parse(peer)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	d := &net.Dialer{Timeout: n.ReqTimeout}
+	if n.peerPolicy != nil {
+		d.Control = n.peerPolicy.control
+	}
+	var conn net.Conn
+	if u.Scheme == "https" {
+		var cfg *tls.Config
+		if t, ok := n.client.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+			cfg = t.TLSClientConfig.Clone()
+		} else {
+			cfg = &tls.Config{}
+		}
+		cfg.ServerName = u.Hostname()
+		cfg.NextProtos = nil // the upgrade needs HTTP/1.1
+		conn, err = (&tls.Dialer{NetDialer: d, Config: cfg}).Dial("tcp", host)
+	} else {
+		conn, err = d.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, peer+"/sync/stream", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", streamProto)
+	n.signSync(req)
+	br := bufio.NewReader(conn)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %d", errStreamRefused, resp.StatusCode)
+	}
+
+	s := &syncStream{conn: conn, r: br}
+	s.onDead = func() { n.dropStream(peer, s) }
+	go s.readAcks()
+	n.log.Info("opened sync stream", "component", "stream", "peer", peer)
+	return s, nil
+}
+
+// dropStream forgets s so that the next send to peer dials a fresh stream.
+func (n *Node) dropStream(peer string, s *syncStream) {
+	n.streamsMu.Lock()
+	defer n.streamsMu.Unlock()
+	if n.streams[peer] == s {
+		delete(n.streams, peer)
+	}
+}
+
+// send writes msgs as one frame and waits for its ack. If ctx ends first the stream
+// is torn down, since the ack order can no longer be trusted by the caller.
+func (s *syncStream) send(ctx context.Context, msgs []SyncMsg) error {
+	buf := getBuf()
+	buf.Write([]byte{0, 0, 0, 0})
+	buf.Write(appendSyncBatchMsgpack(buf.AvailableBuffer(), msgs))
+	frame := buf.Bytes()
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	ack := make(chan error, 1)
+
+	s.mu.Lock()
+	if s.err != nil {
+		err := s.err
+		s.mu.Unlock()
+		putBuf(buf)
+		return err
+	}
+	s.pending = append(s.pending, ack)
+	_, err := s.conn.Write(frame)
+	s.mu.Unlock()
+	putBuf(buf)
+	if err != nil {
+		s.fail(err)
+	}
+
+	select {
+	case err := <-ack:
+		return err
+	case <-ctx.Done():
+		s.fail(ctx.Err())
+		return ctx.Err()
+	}
+}
+
+func (s *syncStream) readAcks() {
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			s.fail(errors.New("unexpected ack on sync stream"))
+			return
+		}
+		ack := s.pending[0]
+		s.pending = s.pending[1:]
+		s.mu.Unlock()
+		if b == streamAckOK {
+			ack <- nil
+		} else {
+			ack <- errors.New("peer rejected sync message")
+		}
+	}
+}
+
+// fail closes the stream and fails every frame still waiting for an ack.
+func (s *syncStream) fail(err error) {
+	s.mu.Lock()
+	if s.err != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.err = err
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	s.conn.Close()
+	for _, ack := range pending {
+		ack <- err
+	}
+	if s.onDead != nil {
+		s.onDead()
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements TLS for the client API and for replication. ServerTLSConfig loads the
+node's certificate and key so it serves HTTPS; peers are then addressed with https:// URLs.
+LoadCertPool reads a PEM bundle of CA certificates, which TransportOptions.TLS (the node's peer
+client) and cachectl use to trust certificates from a private CA instead of the system roots.
+
+With Node.PeerAuth set, the peer-only paths (/sync, /sync/stream and /health, which heartbeats
+use) also require mutual TLS: the caller must present a client certificate that the server's
+ClientCAs verified, and one of its SANs must name an allowed node. A node's identity is its ID,
+carried as a URI SAN "cache://<id>" or a DNS SAN; nodes present their own serving certificate
+when they call peers, so one certificate per node covers both directions. Client API paths are
+unaffected, so orchestrator probes should use /healthz.
+
+Functions:
+- ServerTLSConfig(certFile, keyFile string): (*tls.Config, error)
+- ServerTLSConfigPEM(certPEM, keyPEM []byte): (*tls.Config, error)
+- LoadCertPool(caFile string): (*x509.CertPool, error)
+- CertPoolFromPEM(pem []byte, source string): (*x509.CertPool, error)
+- RequireClientCerts(cfg *tls.Config, cas *x509.CertPool)
+- certIdentities(cert *x509.Certificate): []string
+- (*Node) peerOnly(next http.HandlerFunc): http.HandlerFunc
+*/
+
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// PeerAuth restricts the peer-only paths to callers with a verified client
+// certificate. An empty Allowed accepts any certificate the CA signed.
+type PeerAuth struct {
+	Allowed map[string]bool // node identities, see certIdentities
+}
+
+// ServerTLSConfig returns a TLS 1.2+ server config presenting the given
+// certificate (a PEM chain, leaf first) and key.
+func ServerTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ServerTLSConfigPEM is ServerTLSConfig for a certificate and key already in
+// memory, e.g. from environment variables.
+func ServerTLSConfigPEM(certPEM, keyPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// LoadCertPool reads PEM-encoded CA certificates from caFile.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	return CertPoolFromPEM(pem, caFile)
+}
+
+// CertPoolFromPEM parses PEM-encoded CA certificates; source names them in
+// errors.
+func CertPoolFromPEM(pem []byte, source string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", source)
+	}
+	return pool, nil
+}
+
+// RequireClientCerts makes cfg verify client certificates against cas.
+// Certificates stay optional at the TLS layer so clients of the /kv API need
+// none; peerOnly enforces them where it matters.
+func RequireClientCerts(cfg *tls.Config, cas *x509.CertPool) {
+	cfg.ClientCAs = cas
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+}
+
+// certIdentities returns the node identities a certificate claims: the
+// host of each cache:// URI SAN, then its DNS SANs.
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		if u.Scheme == "cache" && u.Host != "" {
+			ids = append(ids, u.Host)
+		}
+	}
+	return append(ids, cert.DNSNames...)
+}
+
+// peerOnly rejects callers without a verified, allowed client certificate
+// when PeerAuth is set.
+func (n *Node) peerOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n.PeerAuth == nil {
+			next(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "peer certificate required", http.StatusUnauthorized)
+			return
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+		ids := certIdentities(cert)
+		allowed := len(n.PeerAuth.Allowed) == 0 && len(ids) > 0
+		for _, id := range ids {
+			allowed = allowed || n.PeerAuth.Allowed[id]
+		}
+		if !allowed {
+			n.log.Warn("peer certificate rejected", "component", "tls", "remote", remoteIP(r), "subject", cert.Subject.String(), "identities", ids)
+			http.Error(w, "peer not allowed", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for serving and replicating over TLS.
+
+List of functions:
+	- newTestCA / issue / peerClient: Create a throwaway CA, certificates it signed, and peer clients trusting it.
+	- TestTLSReplication: Tests that a node serves HTTPS and replicates to an https peer trusted via a CA file.
+	- TestPeerMTLS: Tests that /sync and /health accept only peers with an allowed client certificate.
+	- TestCertReload: Tests that a replaced certificate is served to new connections and that a broken pair is not.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // ca.pem
+}
+
+// newTestCA creates a throwaway CA and writes its certificate to dir/ca.pem.
+func newTestCA(t *testing.T, dir string) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil { t.Fatal(err) }
+	ca := &testCA{t: t, dir: dir, key: key}
+	ca.cert, _ = x509.ParseCertificate(der)
+	ca.file = ca.write("ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(name, typ string, b []byte) string {
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0o600); err != nil {
+		ca.t.Fatal(err)
+	}
+	return path
+}
+
+// issue writes a certificate and key for cn, valid for 127.0.0.1 and the
+// given URI SANs, signed by the CA.
+func (ca *testCA) issue(cn string, uris ...string) (certFile, keyFile string) {
+	t := ca.t
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	for _, u := range uris {
+		pu, err := url.Parse(u)
+		if err != nil { t.Fatal(err) }
+		tmpl.URIs = append(tmpl.URIs, pu)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil { t.Fatal(err) }
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return ca.write(cn+".pem", "CERTIFICATE", der), ca.write(cn+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// peerClient returns transport options that trust ca and, if certFile is
+// set, present that certificate.
+func (ca *testCA) peerClient(certFile, keyFile string) TransportOptions {
+	pool, err := LoadCertPool(ca.file)
+	if err != nil { ca.t.Fatal(err) }
+	opts := DefaultTransportOptions()
+	opts.TLS = &tls.Config{RootCAs: pool}
+	if certFile != "" {
+		cfg, err := ServerTLSConfig(certFile, keyFile)
+		if err != nil { ca.t.Fatal(err) }
+		opts.TLS.Certificates = cfg.Certificates
+	}
+	return opts
+}
+
+func TestTLSReplication(t *testing.T) {
+	ca := newTestCA(t, t.TempDir())
+	certFile, keyFile := ca.issue("node2")
+	cfg, err := ServerTLSConfig(certFile, keyFile)
+	if err != nil { t.Fatal(err) }
+	n2 := NewNode("N2", ":y", nil)
+	srv2 := httptest.NewUnstartedServer(n2.Routes())
+	srv2.TLS = cfg
+	srv2.StartTLS()
+	defer srv2.Close()
+
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.SetTransport(ca.peerClient("", ""))
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	req, _ := http.NewRequest("PUT", srv1.URL+"/kv/k?full=true", bytes.NewReader([]byte("secret")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 201 || resp.Header.Get("X-Replicated-Acked") != "1" {
+		t.Fatalf("PUT: status %d, acked %s", resp.StatusCode, resp.Header.Get("X-Replicated-Acked"))
+	}
+	if it, ok := n2.Store().Get("k"); !ok || string(it.Value) != "secret" {
+		t.Fatalf("peer over TLS has %q (ok=%v)", it.Value, ok)
+	}
+
+	// Without the CA the peer's certificate is rejected.
+	n3 := NewNode("N3", ":z", []string{srv2.URL})
+	if err := n3.sendSync(context.Background(), srv2.URL, SyncMsg{Op: "set", Key: "x", Version: 1}); err == nil {
+		t.Fatal("sync to an untrusted certificate succeeded")
+	}
+	if _, err := LoadCertPool(keyFile); err == nil {
+		t.Fatal("LoadCertPool accepted a key file")
+	}
+}
+
+func TestPeerMTLS(t *testing.T) {
+	ca := newTestCA(t, t.TempDir())
+	cert2, key2 := ca.issue("node2", "cache://N2")
+	cert1, key1 := ca.issue("node1", "cache://N1")
+	cert3, key3 := ca.issue("node3", "cache://N3")
+	cfg, err := ServerTLSConfig(cert2, key2)
+	if err != nil { t.Fatal(err) }
+	pool, _ := LoadCertPool(ca.file)
+	RequireClientCerts(cfg, pool)
+
+	n2 := NewNode("N2", ":y", nil)
+	n2.PeerAuth = &PeerAuth{Allowed: map[string]bool{"N1": true}}
+	srv2 := httptest.NewUnstartedServer(n2.Routes())
+	srv2.TLS = cfg
+	srv2.StartTLS()
+	defer srv2.Close()
+
+	msg := SyncMsg{Op: "set", Key: "k", Value: []byte("v"), Version: 1, Origin: "N1"}
+	for _, tc := range []struct {
+		name      string
+		cert, key string
+		ok        bool
+	}{
+		{"allowed peer", cert1, key1, true},
+		{"other cluster member", cert3, key3, false},
+		{"no certificate", "", "", false},
+	} {
+		n := NewNode(tc.name, ":x", []string{srv2.URL})
+		n.SetTransport(ca.peerClient(tc.cert, tc.key))
+		err := n.sendSync(context.Background(), srv2.URL, msg)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: sync err = %v", tc.name, err)
+		}
+		if hb := n.heartbeat(context.Background(), srv2.URL); hb != tc.ok {
+			t.Fatalf("%s: heartbeat = %v", tc.name, hb)
+		}
+	}
+	if _, ok := n2.Store().Get("k"); !ok {
+		t.Fatal("allowed peer's write was not applied")
+	}
+
+	// The client API does not need a certificate.
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(srv2.URL + "/kv/k")
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("GET without client certificate: %d", resp.StatusCode)
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	ca := newTestCA(t, t.TempDir())
+	certFile, keyFile := ca.issue("old")
+	certs, err := NewCertReloader(certFile, keyFile)
+	if err != nil { t.Fatal(err) }
+	// Not StartTLS: it would add its own certificate, which wins over GetCertificate.
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.Listener = tls.NewListener(srv.Listener, certs.TLSConfig())
+	srv.Start()
+	defer srv.Close()
+
+	pool, _ := LoadCertPool(ca.file)
+	served := func() string {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{RootCAs: pool})
+		if err != nil { t.Fatal(err) }
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if cn := served(); cn != "old" {
+		t.Fatalf("served %q, want old", cn)
+	}
+
+	// Rotate by replacing the files in place, with a later mtime.
+	replace := func(dst, src string) {
+		b, err := os.ReadFile(src)
+		if err != nil { t.Fatal(err) }
+		if err := os.WriteFile(dst, b, 0o600); err != nil { t.Fatal(err) }
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(dst, later, later)
+	}
+	newCert, newKey := ca.issue("new")
+	replace(certFile, newCert)
+	if !certs.changed() {
+		t.Fatal("changed() missed a replaced certificate")
+	}
+	if err := certs.Reload(); err == nil {
+		t.Fatal("reloaded a certificate with the old key")
+	}
+	if cn := served(); cn != "old" {
+		t.Fatalf("after a failed reload served %q, want old", cn)
+	}
+	replace(keyFile, newKey)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for served() != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
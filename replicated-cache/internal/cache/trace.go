@@ -0,0 +1,221 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements lightweight distributed tracing compatible with W3C Trace Context. When a
+Node has a Tracer, HTTP requests, Replicate fan-out, per-peer sends and store operations are
+recorded as spans. The trace context travels to peers in each SyncMsg ("trace", a traceparent
+string, so it survives batching and sync streams) and in the traceparent header of sync
+requests, so one client write can be followed across every node it touched. Finished spans go
+to a SpanExporter; the bundled JSON exporter writes one line per span, and an adapter for an
+OpenTelemetry SDK only needs to implement ExportSpan. With no Tracer set every call is a no-op
+and nothing is allocated. Node.TraceSampler limits tracing to a fraction of requests (see
+sampling.go).
+
+Functions:
+- NewJSONSpanExporter(w io.Writer): SpanExporter
+- (SpanContext) IsValid/String
+- parseTraceparent(s string): (SpanContext, bool)
+- spanFromContext(ctx context.Context): SpanContext
+- (*Node) startSpan(ctx context.Context, name string): (context.Context, *Span)
+- (*Span) SetAttr(key, value string)
+- (*Span) End()
+- (*Node) traceHTTP(next http.Handler): http.Handler
+- statusOf(w http.ResponseWriter): int
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span in W3C Trace Context terms.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// String returns the traceparent header value for sc.
+func (sc SpanContext) String() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-01"
+}
+
+func parseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(s) != 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil {
+		return sc, false
+	}
+	return sc, sc.IsValid()
+}
+
+// Span is one timed operation. Attrs holds details such as the key or peer.
+type Span struct {
+	Name    string
+	Context SpanContext
+	Parent  SpanContext
+	Node    string
+	Start   time.Time
+	Finish  time.Time
+	Attrs   map[string]string
+
+	exporter SpanExporter
+}
+
+// SpanExporter receives every finished span. It must be safe for concurrent use.
+type SpanExporter interface {
+	ExportSpan(s *Span)
+}
+
+type spanKey struct{}
+
+// unsampledKey marks a context whose request was not sampled; no spans are
+// started under it.
+type unsampledKey struct{}
+
+func spanFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+// startSpan starts a child of the span in ctx, or a new trace if there is none.
+// It returns a nil *Span (whose methods do nothing) when tracing is off.
+func (n *Node) startSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if n.Tracer == nil || ctx.Value(unsampledKey{}) != nil {
+		return ctx, nil
+	}
+	parent := spanFromContext(ctx)
+	s := &Span{Name: name, Parent: parent, Node: n.ID, Start: time.Now(), exporter: n.Tracer}
+	s.Context.TraceID = parent.TraceID
+	if !parent.IsValid() {
+		putRandom(s.Context.TraceID[:])
+	}
+	putRandom(s.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s.Context), s
+}
+
+func putRandom(b []byte) {
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
+
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string, 4)
+	}
+	s.Attrs[key] = value
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.Finish = time.Now()
+	s.exporter.ExportSpan(s)
+}
+
+// traceHTTP starts a server span per request, continuing the caller's trace
+// when a valid traceparent header is present. Other requests are traced as
+// TraceSampler decides; unsampled ones that fail get a lone server span.
+func (n *Node) traceHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		route := routeOf(r)
+		sc, traced := parseTraceparent(r.Header.Get("Traceparent"))
+		if traced {
+			ctx = context.WithValue(ctx, spanKey{}, sc)
+		}
+		if !traced && !n.TraceSampler.sample(route) {
+			start := time.Now()
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, unsampledKey{}, true)))
+			if status := statusOf(w); status >= 500 && n.TraceSampler.sampleError() {
+				_, span := n.startSpan(r.Context(), "http."+routeNames[route])
+				span.Start = start
+				span.SetAttr("http.method", r.Method)
+				span.SetAttr("http.path", r.URL.Path)
+				span.SetAttr("http.status", strconv.Itoa(status))
+				span.SetAttr("sampled", "error")
+				span.End()
+			}
+			return
+		}
+		ctx, span := n.startSpan(ctx, "http."+routeNames[route])
+		span.SetAttr("http.method", r.Method)
+		span.SetAttr("http.path", r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+		if status := statusOf(w); status != 0 {
+			span.SetAttr("http.status", strconv.Itoa(status))
+		}
+		span.End()
+	})
+}
+
+// statusOf returns the status written through the logging middleware's
+// recorder, or 0 when w is not one.
+func statusOf(w http.ResponseWriter) int {
+	if rr, ok := w.(*respRecorder); ok {
+		return rr.status
+	}
+	return 0
+}
+
+type jsonSpanExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSpanExporter writes each finished span to w as one JSON line.
+func NewJSONSpanExporter(w io.Writer) SpanExporter {
+	return &jsonSpanExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonSpanExporter) ExportSpan(s *Span) {
+	rec := struct {
+		Name       string            `json:"name"`
+		TraceID    string            `json:"trace_id"`
+		SpanID     string            `json:"span_id"`
+		ParentID   string            `json:"parent_id,omitempty"`
+		Node       string            `json:"node"`
+		Start      time.Time         `json:"start"`
+		DurationUS int64             `json:"duration_us"`
+		Attrs      map[string]string `json:"attrs,omitempty"`
+	}{
+		Name:       s.Name,
+		TraceID:    hex.EncodeToString(s.Context.TraceID[:]),
+		SpanID:     hex.EncodeToString(s.Context.SpanID[:]),
+		Node:       s.Node,
+		Start:      s.Start,
+		DurationUS: s.Finish.Sub(s.Start).Microseconds(),
+		Attrs:      s.Attrs,
+	}
+	if s.Parent.IsValid() {
+		rec.ParentID = hex.EncodeToString(s.Parent.SpanID[:])
+	}
+	e.mu.Lock()
+	e.enc.Encode(rec)
+	e.mu.Unlock()
+}
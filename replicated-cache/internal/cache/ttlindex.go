@@ -0,0 +1,174 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements the expiration index kept alongside the store's map. Items with a TTL and
+tombstones are pushed onto min-heaps ordered by when they become reapable, so the janitor only
+touches entries that are actually due (O(expired log n)) instead of scanning every key.
+Each key has at most one entry, which an overwrite updates in place, so keys rewritten often
+with a long TTL do not pile up entries until their old deadlines pass. Entries point at the
+exact *Item that was stored; if the key has since been removed, or overwritten without a TTL,
+the entry is stale and is simply dropped when it reaches the top.
+The index is split into ttlShards independently locked shards (by key hash), so writers and
+the janitor's per-shard workers do not contend on a single lock.
+
+Functions:
+- (*ttlIndex) add(key string, it *Item, holds func(key string, it *Item) bool)
+- (*ttlIndex) pop(h *expiryHeap): ttlEntry
+- (*ttlIndex) popDue(now time.Time, tombstoneTTL time.Duration): (ttlEntry, bool)
+- (*ttlIndex) oldestTomb(live func(ttlEntry) bool): (time.Time, bool)
+- (*ttlIndex) len(): int
+- (*shardedTTL) shard(key string): *ttlIndex
+- (*shardedTTL) len(): int
+- (expiryHeap) Len/Less/Swap/Push/Pop: container/heap plumbing
+*/
+
+package cache
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+const ttlShards = 16
+
+var ttlShardSeed = maphash.MakeSeed()
+
+type ttlEntry struct {
+	at    time.Time // ExpiresAt, or the tombstone's version time
+	key   string
+	it    *Item
+	index int // position in its heap
+}
+
+type expiryHeap []*ttlEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *expiryHeap) Push(x any) {
+	e := x.(*ttlEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// ttlIndex keeps expiring items and tombstones in separate heaps because a
+// tombstone's deadline depends on the janitor's TombstoneTTL, not on the item.
+type ttlIndex struct {
+	mu      sync.Mutex
+	expires expiryHeap
+	tombs   expiryHeap
+	keys    map[string]*ttlEntry // each key's entry, in one of the heaps
+}
+
+// add indexes it, the item just stored for key, in place of the key's entry.
+// Writers of one key may call it out of order, so an entry for the item the
+// store holds now (holds reports that) is left alone.
+func (x *ttlIndex) add(key string, it *Item, holds func(key string, it *Item) bool) {
+	at, h := it.ExpiresAt, &x.expires
+	if it.Tombstone {
+		at, h = time.Unix(0, it.Version), &x.tombs
+	}
+	expires := it.Tombstone || !at.IsZero()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e, ok := x.keys[key]
+	switch {
+	case ok && holds(key, e.it):
+		return
+	case !ok && !expires:
+		return
+	case !ok:
+		if x.keys == nil {
+			x.keys = make(map[string]*ttlEntry)
+		}
+		e = &ttlEntry{key: key}
+		x.keys[key] = e
+	case !expires || e.it.Tombstone != it.Tombstone:
+		// Dropping the old deadline, or moving between the heaps.
+		if e.it.Tombstone {
+			heap.Remove(&x.tombs, e.index)
+		} else {
+			heap.Remove(&x.expires, e.index)
+		}
+		if !expires {
+			delete(x.keys, key)
+			return
+		}
+	default:
+		e.at, e.it = at, it
+		heap.Fix(h, e.index)
+		return
+	}
+	e.at, e.it = at, it
+	heap.Push(h, e)
+}
+
+// pop removes the top of h and the key's entry with it.
+func (x *ttlIndex) pop(h *expiryHeap) ttlEntry {
+	e := heap.Pop(h).(*ttlEntry)
+	delete(x.keys, e.key)
+	return *e
+}
+
+// popDue removes and returns the next entry that is due at now, if any.
+func (x *ttlIndex) popDue(now time.Time, tombstoneTTL time.Duration) (ttlEntry, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.expires) > 0 && now.After(x.expires[0].at) {
+		return x.pop(&x.expires), true
+	}
+	if len(x.tombs) > 0 && now.Sub(x.tombs[0].at) > tombstoneTTL {
+		return x.pop(&x.tombs), true
+	}
+	return ttlEntry{}, false
+}
+
+// oldestTomb returns when the oldest tombstone still in the store was
+// written. Stale heads (keys overwritten since) are dropped on the way.
+func (x *ttlIndex) oldestTomb(live func(ttlEntry) bool) (time.Time, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for len(x.tombs) > 0 {
+		if live(*x.tombs[0]) {
+			return x.tombs[0].at, true
+		}
+		x.pop(&x.tombs)
+	}
+	return time.Time{}, false
+}
+
+func (x *ttlIndex) len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.expires) + len(x.tombs)
+}
+
+// shardedTTL spreads the expiration index over ttlShards shards.
+type shardedTTL [ttlShards]ttlIndex
+
+func (x *shardedTTL) shard(key string) *ttlIndex {
+	return &x[maphash.String(ttlShardSeed, key)%ttlShards]
+}
+
+func (x *shardedTTL) len() int {
+	n := 0
+	for i := range x {
+		n += x[i].len()
+	}
+	return n
+}
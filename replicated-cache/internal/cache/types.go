@@ -11,6 +11,10 @@ synchronization messages between nodes.
 
 Functions in this file:
 - (Item) expired(now time.Time) bool
+- (Item) newerThan(cur Item) bool
+- (Item) reapable(now time.Time, tombstoneTTL time.Duration) bool
+- (SyncMsg) item() Item
+- syncMsgFor(key string, it Item) SyncMsg
 */
 
 package cache
@@ -25,17 +29,74 @@ type Item struct {
 	Version   int64     `json:"version"`   // ns since epoch (origin’s clock)
 	Origin    string    `json:"origin"`    // node id
 	Tombstone bool      `json:"tombstone"` // deletion marker
+	// Compressed marks Value as DEFLATE-compressed (see compress.go).
+	Compressed bool `json:"compressed,omitempty"`
+	// Encrypted marks Value as sealed with a value key (see valuecrypt.go).
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Flags are the opaque client flags of memcached writes (see memcache.go).
+	Flags uint32 `json:"flags,omitempty"`
 }
 
 func (it Item) expired(now time.Time) bool {
 	return !it.ExpiresAt.IsZero() && now.After(it.ExpiresAt)
 }
 
+// newerThan reports whether it wins over cur under LWW: higher Version, then higher Origin.
+func (it Item) newerThan(cur Item) bool {
+	return it.Version > cur.Version || (it.Version == cur.Version && it.Origin > cur.Origin)
+}
+
+// reapable reports whether the janitor may drop it: expired, or a tombstone older than tombstoneTTL.
+func (it Item) reapable(now time.Time, tombstoneTTL time.Duration) bool {
+	if it.Tombstone {
+		return now.Sub(time.Unix(0, it.Version)) > tombstoneTTL
+	}
+	return it.expired(now)
+}
+
 type SyncMsg struct {
-	Op        string     `json:"op"` // "set" or "del"
+	Op        string     `json:"op"` // "set", "del", "evict" or "publish" (Key is the channel)
 	Key       string     `json:"key"`
 	Value     []byte     `json:"value,omitempty"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 	Version   int64      `json:"version"`
 	Origin    string     `json:"origin"`
-}
\ No newline at end of file
+	// Compressed marks Value as DEFLATE-compressed.
+	Compressed bool `json:"compressed,omitempty"`
+	// Encrypted marks Value as sealed with a value key.
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Flags are the item's memcached client flags.
+	Flags uint32 `json:"flags,omitempty"`
+	// Trace is the sender's W3C traceparent, when tracing is on (see trace.go).
+	Trace string `json:"trace,omitempty"`
+	// RequestID is the X-Request-ID of the client write that produced the message.
+	RequestID string `json:"request_id,omitempty"`
+	// Signer and Sig are the sending node and its Ed25519 signature (see msgsign.go).
+	Signer string `json:"signer,omitempty"`
+	Sig    []byte `json:"sig,omitempty"`
+}
+
+func (m SyncMsg) item() Item {
+	it := Item{Value: m.Value, Version: m.Version, Origin: m.Origin, Tombstone: m.Op == "del", Compressed: m.Compressed, Encrypted: m.Encrypted, Flags: m.Flags}
+	if m.ExpiresAt != nil {
+		it.ExpiresAt = *m.ExpiresAt
+	}
+	return it
+}
+
+func syncMsgFor(key string, it Item) SyncMsg {
+	if it.Tombstone {
+		return SyncMsg{Op: "del", Key: key, Version: it.Version, Origin: it.Origin}
+	}
+	return SyncMsg{
+		Op:         "set",
+		Key:        key,
+		Value:      it.Value,
+		ExpiresAt:  ptrTimeOrNil(it.ExpiresAt),
+		Version:    it.Version,
+		Origin:     it.Origin,
+		Compressed: it.Compressed,
+		Encrypted:  it.Encrypted,
+		Flags:      it.Flags,
+	}
+}
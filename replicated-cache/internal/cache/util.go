@@ -7,19 +7,23 @@ Summary:
 This file provides utility functions and middleware for the replicated in-memory cache project.
 It includes a helper for safely returning a pointer to a time.Time value, as well as an HTTP middleware
 for logging request details and response status codes. Additionally, it defines a custom response recorder
-to capture HTTP status codes for logging purposes.
+to capture HTTP status codes and response sizes for logging purposes.
 
 List of functions:
 - ptrTimeOrNil(t time.Time) *time.Time
-- logging(next http.Handler) http.Handler
+- (n *Node) logging(next http.Handler) http.Handler
 - (rr *respRecorder) WriteHeader(code int)
+- (rr *respRecorder) Write(b []byte) (int, error)
+- (rr *respRecorder) Unwrap() http.ResponseWriter
+- namespaceOf(key string) string
 */
 
 package cache
 
 import (
-	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,18 +32,46 @@ func ptrTimeOrNil(t time.Time) *time.Time {
 	return &t
 }
 
-func logging(next http.Handler) http.Handler {
+var recorderPool = sync.Pool{New: func() any { return new(respRecorder) }}
+
+// logging records every request's latency and status per route (see
+// metrics.go) and, with AccessLog set, writes the access log line.
+func (n *Node) logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		rr := &respRecorder{ResponseWriter: w, status: 200}
+		rr := recorderPool.Get().(*respRecorder)
+		rr.ResponseWriter, rr.status, rr.bytes = w, 200, 0
 		next.ServeHTTP(rr, r)
 		d := time.Since(start)
-		log.Printf("%s %s -> %d (%s)", r.Method, r.URL.Path, rr.status, d)
+		n.metrics.observeHTTP(routeOf(r), rr.status, d)
+		if n.AccessLog && n.sampleLog(r, rr.status) {
+			n.accessLog(r, rr, start, d)
+		}
+		rr.ResponseWriter = nil
+		recorderPool.Put(rr)
 	})
 }
 
 type respRecorder struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
+}
+func (rr *respRecorder) WriteHeader(code int) { rr.status = code; rr.ResponseWriter.WriteHeader(code) }
+func (rr *respRecorder) Write(b []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. to hijack).
+func (rr *respRecorder) Unwrap() http.ResponseWriter { return rr.ResponseWriter }
+
+// namespaceOf returns the part of key before the first ':' ("tenant:item" -> "tenant"),
+// or "" for keys without a namespace.
+func namespaceOf(key string) string {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		return key[:i]
+	}
+	return ""
 }
-func (rr *respRecorder) WriteHeader(code int) { rr.status = code; rr.ResponseWriter.WriteHeader(code) }
\ No newline at end of file
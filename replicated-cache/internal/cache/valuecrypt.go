@@ -0,0 +1,164 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements optional value encryption, so memory dumps, the WAL, snapshots and sync
+traffic never hold the plaintext of secrets that applications cache. With Node.ValueKeys set, PUT
+and read-through values are sealed with AES-GCM (after compression, see compress.go) and stored,
+logged and replicated in that form (Item.Encrypted / SyncMsg "encrypted"); GET opens them again.
+
+Keys are chosen per namespace (the key prefix before ':', see namespaceOf), with "*" as the key
+for everything else; namespaces without a key, when there is no "*", stay in plaintext. Keys are
+listed one per line as "NAMESPACE KEY_ID BASE64_KEY" (16, 24 or 32 bytes for AES-128/192/256).
+The first key listed for a namespace seals new values; every listed key can open values, which
+carry the ID of the key that sealed them, so keys rotate by adding the new one first and dropping
+the old one once its values have expired or been rewritten. The cache key is bound to each
+sealed value as additional data, so ciphertext cannot be moved to another key. Every node must
+hold the same keys.
+
+Functions:
+- ParseValueKeys(r io.Reader): (*ValueKeys, error)
+- LoadValueKeys(path string): (*ValueKeys, error)
+- (*ValueKeys) seal(key string, plain []byte): ([]byte, bool)
+- (*ValueKeys) open(key string, sealed []byte): ([]byte, error)
+- (*Node) decryptItem(key string, it Item): (Item, error)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const valueKeyDefault = "*"
+
+var errNoValueKey = errors.New("value sealed with an unknown key")
+
+// ValueKeys holds the AES-GCM keys used to encrypt values.
+type ValueKeys struct {
+	sealing map[string]*valueKey // namespace -> key for new values
+	byID    map[string]*valueKey
+}
+
+type valueKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// ParseValueKeys reads keys from r: one "NAMESPACE KEY_ID BASE64_KEY" per
+// line, "#" starting a comment.
+func ParseValueKeys(r io.Reader) (*ValueKeys, error) {
+	k := &ValueKeys{sealing: make(map[string]*valueKey), byID: make(map[string]*valueKey)}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want NAMESPACE KEY_ID BASE64_KEY", line)
+		}
+		ns, id := fields[0], fields[1]
+		if len(id) > 255 {
+			return nil, fmt.Errorf("line %d: key ID too long", line)
+		}
+		if _, dup := k.byID[id]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key ID %q", line, id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key is not base64: %w", line, err)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		aead, _ := cipher.NewGCM(block)
+		vk := &valueKey{id: id, aead: aead}
+		k.byID[id] = vk
+		if _, ok := k.sealing[ns]; !ok {
+			k.sealing[ns] = vk
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(k.byID) == 0 {
+		return nil, errors.New("no value keys")
+	}
+	return k, nil
+}
+
+// LoadValueKeys reads keys from the file at path (see ParseValueKeys).
+func LoadValueKeys(path string) (*ValueKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	k, err := ParseValueKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// seal encrypts plain for key, returning false when key's namespace has no
+// encryption key. The result is: ID length, ID, nonce, ciphertext.
+func (k *ValueKeys) seal(key string, plain []byte) ([]byte, bool) {
+	vk, ok := k.sealing[namespaceOf(key)]
+	if !ok {
+		if vk, ok = k.sealing[valueKeyDefault]; !ok {
+			return nil, false
+		}
+	}
+	ns := vk.aead.NonceSize()
+	out := make([]byte, 1+len(vk.id)+ns, 1+len(vk.id)+ns+len(plain)+vk.aead.Overhead())
+	out[0] = byte(len(vk.id))
+	copy(out[1:], vk.id)
+	nonce := out[1+len(vk.id):]
+	rand.Read(nonce)
+	return vk.aead.Seal(out, nonce, plain, []byte(key)), true
+}
+
+func (k *ValueKeys) open(key string, sealed []byte) ([]byte, error) {
+	if len(sealed) < 1 || len(sealed) < 1+int(sealed[0]) {
+		return nil, errors.New("truncated sealed value")
+	}
+	id := string(sealed[1 : 1+sealed[0]])
+	vk, ok := k.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errNoValueKey, id)
+	}
+	rest := sealed[1+len(id):]
+	ns := vk.aead.NonceSize()
+	if len(rest) < ns {
+		return nil, errors.New("truncated sealed value")
+	}
+	return vk.aead.Open(nil, rest[:ns], rest[ns:], []byte(key))
+}
+
+// decryptItem returns it with its value opened.
+func (n *Node) decryptItem(key string, it Item) (Item, error) {
+	if n.ValueKeys == nil {
+		return it, errNoValueKey
+	}
+	plain, err := n.ValueKeys.open(key, it.Value)
+	if err != nil {
+		return it, err
+	}
+	it.Value, it.Encrypted = plain, false
+	return it, nil
+}
@@ -0,0 +1,127 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for value encryption.
+
+List of functions:
+	- TestParseValueKeys: Tests parsing and validation of the value key list.
+	- TestValueEncryption: Tests that values are stored and replicated encrypted per namespace and served decrypted, across key rotation.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseValueKeys(t *testing.T) {
+	k16 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16))
+	k32 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	k, err := ParseValueKeys(strings.NewReader("# keys\nsec k2 " + k32 + "\nsec k1 " + k16 + "\n* d1 " + k16 + "\n"))
+	if err != nil { t.Fatal(err) }
+	if k.sealing["sec"].id != "k2" || k.sealing["*"].id != "d1" || len(k.byID) != 3 {
+		t.Fatalf("keys = %+v", k)
+	}
+	for _, bad := range []string{
+		"",
+		"sec k1",
+		"sec k1 not-base64!",
+		"sec k1 " + base64.StdEncoding.EncodeToString([]byte("short")),
+		"sec k1 " + k16 + "\nother k1 " + k32,
+	} {
+		if _, err := ParseValueKeys(strings.NewReader(bad)); err == nil {
+			t.Fatalf("accepted %q", bad)
+		}
+	}
+}
+
+func TestValueEncryption(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	keys := func(list string) *ValueKeys {
+		k, err := ParseValueKeys(strings.NewReader(list))
+		if err != nil { t.Fatal(err) }
+		return k
+	}
+	n2 := NewNode("N2", ":y", nil)
+	n2.AccessLog = false
+	n2.ValueKeys = keys("sec old " + oldKey)
+	srv2 := httptest.NewServer(n2.Routes())
+	defer srv2.Close()
+	n1 := NewNode("N1", ":x", []string{srv2.URL})
+	n1.AccessLog = false
+	n1.CompressAbove = 64
+	n1.ValueKeys = n2.ValueKeys
+	srv1 := httptest.NewServer(n1.Routes())
+	defer srv1.Close()
+
+	put := func(srv, key, value string) {
+		req, _ := http.NewRequest("PUT", srv+"/kv/"+key, strings.NewReader(value))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		if resp.StatusCode != 201 {
+			t.Fatalf("PUT %s: status %d", key, resp.StatusCode)
+		}
+	}
+	get := func(srv, key string) (int, string) {
+		resp, err := http.Get(srv + "/kv/" + key)
+		if err != nil { t.Fatal(err) }
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	long := strings.Repeat("top secret ", 100)
+	put(srv1.URL, "sec:small?min=1", "hunter2")
+	put(srv1.URL, "sec:long?min=1", long)
+	put(srv1.URL, "pub:x?min=1", "hello")
+
+	for _, n := range []*Node{n1, n2} {
+		for key, plain := range map[string]string{"sec:small": "hunter2", "sec:long": "top secret"} {
+			it, ok := n.store.GetLive(key, time.Now())
+			if !ok || !it.Encrypted || bytes.Contains(it.Value, []byte(plain)) {
+				t.Fatalf("%s on %s: stored %+v", key, n.ID, it)
+			}
+		}
+		if it, _ := n.store.GetLive("pub:x", time.Now()); it.Encrypted || string(it.Value) != "hello" {
+			t.Fatalf("pub:x on %s: stored %+v", n.ID, it)
+		}
+	}
+	for _, srv := range []string{srv1.URL, srv2.URL} {
+		for key, want := range map[string]string{"sec:small": "hunter2", "sec:long": long, "pub:x": "hello"} {
+			if code, got := get(srv, key); code != 200 || got != want {
+				t.Fatalf("GET %s: %d %.20q", key, code, got)
+			}
+		}
+	}
+
+	// After rotation, old values still open and new ones use the new key.
+	n2.ValueKeys = keys("sec new " + newKey + "\nsec old " + oldKey)
+	put(srv2.URL, "sec:rotated", "v2")
+	if it, _ := n2.store.GetLive("sec:rotated", time.Now()); !bytes.HasPrefix(it.Value, []byte("\x03new")) {
+		t.Fatalf("sealed with the wrong key: %q", it.Value[:4])
+	}
+	if code, got := get(srv2.URL, "sec:small"); code != 200 || got != "hunter2" {
+		t.Fatalf("old value after rotation: %d %q", code, got)
+	}
+
+	// Without the key, or moved to another cache key, a value does not open.
+	n2.ValueKeys = keys("sec new " + newKey)
+	if code, _ := get(srv2.URL, "sec:small"); code != 500 {
+		t.Fatalf("value opened without its key: status %d", code)
+	}
+	it, _ := n1.store.GetLive("sec:small", time.Now())
+	if _, err := n1.ValueKeys.open("sec:other", it.Value); err == nil {
+		t.Fatal("sealed value opened under another key")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements build and version information. The version, git commit and build date are
+set at link time:
+
+	go build -ldflags "-X github.com/you/replicated-cache/internal/cache.version=v1.4.0 \
+	  -X github.com/you/replicated-cache/internal/cache.commit=$(git rev-parse --short HEAD) \
+	  -X github.com/you/replicated-cache/internal/cache.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+
+When they are not, the commit and date fall back to the VCS stamp the Go toolchain embeds in
+binaries built from a git checkout. GET /version returns them for one node; /stats and
+/cluster/stats carry them too, so a cluster running mixed versions during a rolling upgrade is
+easy to spot.
+
+Functions:
+- Build(): BuildInfo
+- (BuildInfo) String(): string
+- (*Node) handleVersion(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags -X; see the file comment.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+var buildOnce = sync.OnceValue(func() BuildInfo {
+	b := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	var dirty bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = s.Value[:min(len(s.Value), 12)]
+			}
+		case "vcs.time":
+			if b.BuildDate == "" {
+				b.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if dirty && commit == "" && b.Commit != "" {
+		b.Commit += "-dirty"
+	}
+	return b
+})
+
+// Build returns this binary's build information.
+func Build() BuildInfo { return buildOnce() }
+
+// String is the version plus commit, e.g. "v1.4.0 (3f2a9c1)".
+func (b BuildInfo) String() string {
+	if b.Commit == "" {
+		return b.Version
+	}
+	return b.Version + " (" + b.Commit + ")"
+}
+
+func (n *Node) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeEncoded(w, r, http.StatusOK, struct {
+		NodeID string `json:"node_id"`
+		BuildInfo
+	}{n.ID, Build()})
+}
@@ -0,0 +1,551 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a simple append-only write-ahead log (WAL) for the cache store.
+Every mutation applied to the store is appended as a length-prefixed, CRC32-checksummed
+JSON SyncMsg, so the
+store can be rebuilt after a restart, or rolled back to a point in time by replaying only
+the records whose version is at or before a given timestamp. When a key is supplied each
+record payload is sealed with AES-GCM so cached values never reach the disk in plaintext.
+Corrupt or torn records are either skipped with a warning or, with FailOnCorrupt, abort the replay.
+A torn tail left by a crash is cut off when the log is opened, before anything is appended to it:
+records written after the garbage would otherwise be read as part of it and lost on the next
+replay.
+
+Without compaction the log would grow forever and every restart would replay its whole history.
+Compact replaces it with a snapshot, one record per live key, followed by the records appended
+while the snapshot was being written; as replay is last-writer-wins by version, the order of the
+two does not matter. Rewrite, used by point-in-time restore, can keep the old log as a backup.
+Both write the new log next to the old one and rename it into place.
+Compaction loses the history a restore replays, so it records how far back the log still reaches in
+a ".compacted" file beside it; restoring to an earlier point is refused.
+
+Functions:
+- OpenWAL(path string, opts WALOptions): (*WAL, error)
+- trimWAL(path string, opts WALOptions): error
+- walEnd(r io.Reader): (int64, int, string, error)
+- (*WAL) Append(msg SyncMsg): error
+- (*WAL) Close(): error
+- (*WAL) Rewrite(keep func(SyncMsg) bool, backup string): error
+- (*WAL) Compact(snapshot func(add func(SyncMsg) error) error): error
+- (*WAL) Size(): (int64, int64)
+- (*WAL) Compacted(): int64
+- (*WAL) saw(version int64)
+- readCompacted(path string): (int64, error)
+- writeCompacted(path string, version int64): error
+- replaceFile(path string, data []byte): error
+- (*WAL) replace(tmp string, out *os.File, bw *bufio.Writer, size int64, backup string): error
+- ReadWAL(path string, opts WALOptions, fn func(SyncMsg) error): error
+- decodeWALRecord(aead cipher.AEAD, buf []byte): (SyncMsg, error)
+- writeWALRecord(w io.Writer, aead cipher.AEAD, msg SyncMsg): (int64, error)
+- walCorrupt(opts WALOptions, path string, rec int, why string): error
+- ParseRestorePoint(s string): (int64, error)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxWALRecord guards against reading a garbage length prefix as a huge allocation.
+const maxWALRecord = 64 << 20
+
+// Each record is framed as: length (4 bytes) | CRC32-C of payload (4 bytes) | payload.
+var walCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrRestoreCompacted is returned for a restore point older than the WAL's
+// last compaction.
+var ErrRestoreCompacted = errors.New("restore point is before the last wal compaction")
+
+// WALOptions control how a log is written and replayed.
+type WALOptions struct {
+	Key           []byte // AES key; nil stores records in plaintext
+	FailOnCorrupt bool   // abort replay on a bad record instead of skipping it
+}
+
+// WAL is an append-only log of applied mutations.
+type WAL struct {
+	mu   sync.Mutex
+	path string
+	opts WALOptions
+	aead cipher.AEAD // nil when the log is not encrypted
+	f    *os.File
+	w    *bufio.Writer
+	size int64 // bytes in the log
+	base int64 // size after the last Compact
+
+	newest    int64 // highest version in the log, as far as it has been read or written
+	compacted int64 // restore points before this version are gone; see Compacted
+
+	// rewriteMu serializes Rewrite and Compact, which both write path.tmp.
+	rewriteMu sync.Mutex
+}
+
+// OpenWAL opens (or creates) the log at path.
+func OpenWAL(path string, opts WALOptions) (*WAL, error) {
+	var aead cipher.AEAD
+	if opts.Key != nil {
+		a, err := newAEAD(opts.Key)
+		if err != nil {
+			return nil, err
+		}
+		aead = a
+	}
+	if err := trimWAL(path, opts); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	compacted, err := readCompacted(path)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &WAL{path: path, opts: opts, aead: aead, f: f, w: bufio.NewWriter(f), size: fi.Size(), compacted: compacted}, nil
+}
+
+// readCompacted returns the version saved by writeCompacted for the log at
+// path, or 0 if it has never been compacted.
+func readCompacted(path string) (int64, error) {
+	b, err := os.ReadFile(path + ".compacted")
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s.compacted: %w", path, err)
+	}
+	return v, nil
+}
+
+// writeCompacted saves version as the oldest restore point of the log at path.
+func writeCompacted(path string, version int64) error {
+	return replaceFile(path+".compacted", []byte(strconv.FormatInt(version, 10)+"\n"))
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// into place, so a crash leaves either the old contents or the new ones.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// trimWAL truncates the log at path after its last whole record, dropping a
+// torn record or a garbage length that ends it. With opts.FailOnCorrupt such a
+// tail is an error instead.
+func trimWAL(path string, opts WALOptions) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	end, rec, why, err := walEnd(f)
+	if err != nil || why == "" {
+		return err
+	}
+	if opts.FailOnCorrupt {
+		return walCorrupt(opts, path, rec, why)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	slog.Warn("truncating wal after its last whole record", "component", "wal", "path", path, "record", rec, "reason", why, "dropped_bytes", fi.Size()-end)
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// walEnd reads the record framing of a log and returns the offset just past
+// its last whole record. When the log does not end there, it also returns the
+// number of the first record it cannot frame and why.
+func walEnd(r io.Reader) (int64, int, string, error) {
+	br := bufio.NewReader(r)
+	var (
+		end int64
+		hdr [8]byte
+	)
+	for rec := 0; ; rec++ {
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			switch err {
+			case io.EOF:
+				return end, rec, "", nil
+			case io.ErrUnexpectedEOF:
+				return end, rec, "torn record header at end of log", nil
+			}
+			return 0, 0, "", err
+		}
+		n := binary.BigEndian.Uint32(hdr[:4])
+		if n > maxWALRecord {
+			return end, rec, fmt.Sprintf("record length %d too large", n), nil
+		}
+		if _, err := br.Discard(int(n)); err != nil {
+			if err == io.EOF {
+				return end, rec, "torn record at end of log", nil
+			}
+			return 0, 0, "", err
+		}
+		end += int64(len(hdr)) + int64(n)
+	}
+}
+
+// Append writes one record and flushes it to the OS.
+func (w *WAL) Append(msg SyncMsg) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := writeWALRecord(w.w, w.aead, msg)
+	w.size += n
+	if err != nil {
+		return err
+	}
+	w.newest = max(w.newest, msg.Version)
+	return w.w.Flush()
+}
+
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Rewrite replaces the log with only the records for which keep returns true.
+// The new log is written next to the old one and renamed into place; when
+// backup is not empty, the old log is kept under that name.
+func (w *WAL) Rewrite(keep func(SyncMsg) bool, backup string) error {
+	w.rewriteMu.Lock()
+	defer w.rewriteMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	tmp := w.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	var size, newest int64
+	err = ReadWAL(w.path, w.opts, func(msg SyncMsg) error {
+		if !keep(msg) {
+			return nil
+		}
+		newest = max(newest, msg.Version)
+		n, err := writeWALRecord(bw, w.aead, msg)
+		size += n
+		return err
+	})
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.replace(tmp, out, bw, size, backup); err != nil {
+		return err
+	}
+	w.newest = newest
+	return nil
+}
+
+// Compact replaces the log with the records snapshot passes to add, followed
+// by whatever was appended while it ran. snapshot runs without the log locked,
+// so appends go on meanwhile.
+//
+// The records dropped, and the earlier versions of the keys in the snapshot,
+// are the history a restore would need to go back before the newest of them,
+// so that version becomes the log's oldest restore point.
+func (w *WAL) Compact(snapshot func(add func(SyncMsg) error) error) error {
+	w.rewriteMu.Lock()
+	defer w.rewriteMu.Unlock()
+	w.mu.Lock()
+	err := w.w.Flush()
+	mark, oldest := w.size, w.newest
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := w.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(out)
+	var size int64
+	err = snapshot(func(msg SyncMsg) error {
+		oldest = max(oldest, msg.Version)
+		n, err := writeWALRecord(bw, w.aead, msg)
+		size += n
+		return err
+	})
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		err = w.w.Flush()
+	}
+	if err == nil {
+		// Copy the records appended since mark.
+		var src *os.File
+		if src, err = os.Open(w.path); err == nil {
+			var n int64
+			if _, err = src.Seek(mark, io.SeekStart); err == nil {
+				n, err = io.Copy(bw, src)
+				size += n
+			}
+			src.Close()
+		}
+	}
+	if err == nil && oldest > w.compacted {
+		// Saved first: if the rename below never happens, restores are only
+		// refused that the old log could still have served.
+		err = writeCompacted(w.path, oldest)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	w.compacted = max(w.compacted, oldest)
+	if err := w.replace(tmp, out, bw, size, ""); err != nil {
+		return err
+	}
+	w.base = size
+	return nil
+}
+
+// Size returns the bytes in the log and its size after the last Compact.
+func (w *WAL) Size() (int64, int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size, w.base
+}
+
+// Compacted returns the oldest version the log can be restored to: history
+// before it was dropped by Compact. It is 0 if the log was never compacted.
+func (w *WAL) Compacted() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.compacted
+}
+
+// saw notes a version read back from the log, so the next Compact knows the
+// newest record it drops.
+func (w *WAL) saw(version int64) {
+	w.mu.Lock()
+	w.newest = max(w.newest, version)
+	w.mu.Unlock()
+}
+
+// replace syncs the new log written to out and renames it over the old one,
+// first linking the old one to backup if that is not empty. w.mu is held.
+func (w *WAL) replace(tmp string, out *os.File, bw *bufio.Writer, size int64, backup string) error {
+	err := bw.Flush()
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && backup != "" {
+		err = os.Link(w.path, backup)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return err
+	}
+
+	w.f.Close()
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.w = bufio.NewWriter(f)
+	w.size = size
+	return nil
+}
+
+// ReadWAL calls fn for every record in the log, in append order.
+// A missing file is treated as an empty log. Records that fail their checksum
+// (or decryption) are skipped with a warning; a torn trailing record, as left by
+// a crash mid-write, ends the replay (and is truncated by the next OpenWAL).
+// With opts.FailOnCorrupt both are errors.
+func ReadWAL(path string, opts WALOptions, fn func(SyncMsg) error) error {
+	var aead cipher.AEAD
+	if opts.Key != nil {
+		a, err := newAEAD(opts.Key)
+		if err != nil {
+			return err
+		}
+		aead = a
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var hdr [8]byte
+	for rec := 0; ; rec++ {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if err != io.ErrUnexpectedEOF {
+				return err
+			}
+			return walCorrupt(opts, path, rec, "torn record header at end of log")
+		}
+		n := binary.BigEndian.Uint32(hdr[:4])
+		sum := binary.BigEndian.Uint32(hdr[4:])
+		if n > maxWALRecord {
+			// The length itself is garbage, so there is no way to find the next record.
+			return walCorrupt(opts, path, rec, fmt.Sprintf("record length %d too large", n))
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if err != io.ErrUnexpectedEOF && err != io.EOF {
+				return err
+			}
+			return walCorrupt(opts, path, rec, "torn record at end of log")
+		}
+		if crc32.Checksum(buf, walCRC) != sum {
+			if err := walCorrupt(opts, path, rec, "checksum mismatch"); err != nil {
+				return err
+			}
+			continue
+		}
+		msg, err := decodeWALRecord(aead, buf)
+		if err != nil {
+			if err := walCorrupt(opts, path, rec, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// walCorrupt reports a bad record: as an error in fail-fast mode, otherwise as a warning.
+func walCorrupt(opts WALOptions, path string, rec int, why string) error {
+	if opts.FailOnCorrupt {
+		return fmt.Errorf("wal %s: record %d: %s", path, rec, why)
+	}
+	slog.Warn("skipping corrupt wal record", "component", "wal", "path", path, "record", rec, "reason", why)
+	return nil
+}
+
+func decodeWALRecord(aead cipher.AEAD, buf []byte) (SyncMsg, error) {
+	var msg SyncMsg
+	if aead != nil {
+		plain, err := decrypt(aead, buf)
+		if err != nil {
+			return msg, fmt.Errorf("cannot decrypt record (wrong key?): %w", err)
+		}
+		buf = plain
+	}
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return msg, fmt.Errorf("bad record: %w", err)
+	}
+	return msg, nil
+}
+
+// writeWALRecord writes one record and returns its size.
+func writeWALRecord(w io.Writer, aead cipher.AEAD, msg SyncMsg) (int64, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	if aead != nil {
+		payload = encrypt(aead, payload)
+	}
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(payload, walCRC))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+	_, err = w.Write(payload)
+	return int64(len(hdr) + len(payload)), err
+}
+
+// ParseRestorePoint accepts either an RFC 3339 timestamp or a version
+// (nanoseconds since epoch) and returns it as a version.
+func ParseRestorePoint(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("bad restore point %q: want RFC 3339 time or version", s)
+	}
+	return t.UnixNano(), nil
+}
@@ -0,0 +1,349 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains unit tests for the write-ahead log and point-in-time restore.
+
+List of functions:
+	- TestWALReplay: Tests that a node rebuilds its store from an existing WAL and follows its versions.
+	- TestRestoreTo: Tests that restoring drops later writes from both the store and the log, keeping the old log.
+	- TestWALCompact: Tests that compaction shrinks the log to the live keys and keeps later appends.
+	- TestWALEncrypted: Tests that an encrypted log hides values and needs the right key.
+	- TestWALCorruption: Tests skip-with-warning and fail-fast handling of damaged records.
+	- TestWALTornTail: Tests that records appended after a torn tail survive the next replay, in WALs and hint files.
+	- TestOutboxAck: Tests that acks are recorded without rewriting the hints file until most of it is delivered, and dropping a queue.
+	- TestRestoreBeforeCompaction: Tests that restore points older than the last compaction are refused, across restarts.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	n := NewNode("A", ":x", nil)
+	if err := n.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	n.apply("k", Item{Value: []byte("v1"), Version: 1, Origin: "A"})
+	n.apply("gone", Item{Value: []byte("x"), Version: 2, Origin: "A"})
+	n.apply("gone", Item{Version: 3, Origin: "A", Tombstone: true})
+	ahead := time.Now().Add(30 * time.Second).UnixNano()
+	n.apply("ahead", Item{Value: []byte("x"), Version: ahead, Origin: "B"})
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+
+	n2 := NewNode("A", ":x", nil)
+	if err := n2.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	defer n2.CloseWAL()
+	got, ok := n2.Store().Get("k")
+	if !ok || string(got.Value) != "v1" {
+		t.Fatalf("want v1 after replay, got %q (ok=%v)", got.Value, ok)
+	}
+	if got, _ := n2.Store().Get("gone"); !got.Tombstone {
+		t.Fatal("delete should replay as tombstone")
+	}
+	// A write after the restart must win over everything replayed.
+	if v := n2.versions.next(time.Now()); v <= ahead {
+		t.Fatalf("version %d after replaying %d", v, ahead)
+	}
+}
+
+func TestRestoreTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	n := NewNode("A", ":x", nil)
+	if err := n.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	n.apply("k", Item{Value: []byte("good"), Version: 10, Origin: "A"})
+	n.apply("k", Item{Value: []byte("bad"), Version: 20, Origin: "A"})
+	n.apply("other", Item{Value: []byte("bad"), Version: 21, Origin: "A"})
+
+	if err := n.RestoreTo(15); err != nil { t.Fatal(err) }
+	if got, _ := n.Store().Get("k"); string(got.Value) != "good" {
+		t.Fatalf("want good, got %q", got.Value)
+	}
+	if _, ok := n.Store().Get("other"); ok {
+		t.Fatal("key written after restore point should be gone")
+	}
+
+	// Writes after the restore land in the rewritten log.
+	n.apply("new", Item{Value: []byte("n"), Version: 30, Origin: "A"})
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+	var versions []int64
+	if err := ReadWAL(path, WALOptions{}, func(m SyncMsg) error { versions = append(versions, m.Version); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0] != 10 || versions[1] != 30 {
+		t.Fatalf("unexpected wal contents after restore: %v", versions)
+	}
+
+	// The log from before the restore is kept.
+	backups, _ := filepath.Glob(path + ".pre-restore.*")
+	if len(backups) != 1 {
+		t.Fatalf("backups %v", backups)
+	}
+	versions = nil
+	if err := ReadWAL(backups[0], WALOptions{}, func(m SyncMsg) error { versions = append(versions, m.Version); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[2] != 21 {
+		t.Fatalf("unexpected backup contents: %v", versions)
+	}
+}
+
+func TestWALCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	n := NewNode("A", ":x", nil)
+	n.WALOpts.Key = bytes.Repeat([]byte{7}, 32)
+	if err := n.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	for v := int64(1); v <= 100; v++ {
+		n.apply(fmt.Sprintf("k%d", v%3), Item{Value: bytes.Repeat([]byte("v"), 100), Version: v, Origin: "A"})
+	}
+	n.apply("gone", Item{Version: 101, Origin: "A", Tombstone: true})
+	n.TombstoneTTL = -time.Second // every tombstone is reapable
+	n.apply("kept", Item{Value: []byte("x"), Version: 104, Origin: "A"})
+	before, _ := n.wal.Size()
+
+	if err := n.CompactWAL(); err != nil { t.Fatal(err) }
+	after, base := n.wal.Size()
+	if after >= before/10 || base != after {
+		t.Fatalf("size %d after compaction (base %d), %d before", after, base, before)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != after {
+		t.Fatalf("file %v, %v; want %d bytes", fi, err, after)
+	}
+	n.apply("k1", Item{Value: []byte("new"), Version: 200, Origin: "A"})
+	// Records appended while the snapshot is written are kept after it.
+	err := n.wal.Compact(func(add func(SyncMsg) error) error {
+		n.apply("during", Item{Value: []byte("d"), Version: 201, Origin: "A"})
+		var err error
+		n.store.each(func(key string, it Item) bool {
+			if key != "during" && !it.Tombstone {
+				err = add(syncMsgFor(key, it))
+			}
+			return err == nil
+		})
+		return err
+	})
+	if err != nil { t.Fatal(err) }
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+
+	n2 := NewNode("A", ":x", nil)
+	n2.WALOpts.Key = n.WALOpts.Key
+	if err := n2.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	defer n2.CloseWAL()
+	for key, want := range map[string]string{"k0": strings.Repeat("v", 100), "k1": "new", "k2": strings.Repeat("v", 100), "kept": "x", "during": "d"} {
+		if got, ok := n2.Store().Get(key); !ok || string(got.Value) != want {
+			t.Fatalf("%s after compaction = %q (ok=%v), want %q", key, got.Value, ok, want)
+		}
+	}
+	if _, ok := n2.Store().Get("gone"); ok {
+		t.Fatal("reapable tombstone survived compaction")
+	}
+}
+
+func TestWALEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	n := NewNode("A", ":x", nil)
+	n.WALOpts.Key = bytes.Repeat([]byte{7}, 32)
+	if err := n.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	n.apply("k", Item{Value: []byte("secret-value"), Version: 1, Origin: "A"})
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+
+	raw, err := os.ReadFile(path)
+	if err != nil { t.Fatal(err) }
+	if bytes.Contains(raw, []byte("secret-value")) || bytes.Contains(raw, []byte(`"key"`)) {
+		t.Fatal("wal contains plaintext")
+	}
+	if err := ReadWAL(path, WALOptions{Key: bytes.Repeat([]byte{8}, 32), FailOnCorrupt: true}, func(SyncMsg) error { return nil }); err == nil {
+		t.Fatal("reading with the wrong key should fail")
+	}
+
+	n2 := NewNode("A", ":x", nil)
+	n2.WALOpts = n.WALOpts
+	if err := n2.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	defer n2.CloseWAL()
+	if got, _ := n2.Store().Get("k"); string(got.Value) != "secret-value" {
+		t.Fatalf("want secret-value after replay, got %q", got.Value)
+	}
+}
+
+func TestWALCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path, WALOptions{})
+	if err != nil { t.Fatal(err) }
+	for i, k := range []string{"a", "b", "c"} {
+		if err := w.Append(SyncMsg{Op: "set", Key: k, Value: []byte("v"), Version: int64(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	raw, _ := os.ReadFile(path)
+	// Flip a byte inside the second record's payload and leave a torn record at the end.
+	i := bytes.Index(raw, []byte(`"b"`))
+	raw[i+1] = 'x'
+	raw = append(raw, 0, 0, 0, 50, 1, 2, 3, 4, '{')
+	os.WriteFile(path, raw, 0o600)
+
+	var keys []string
+	err = ReadWAL(path, WALOptions{}, func(m SyncMsg) error { keys = append(keys, m.Key); return nil })
+	if err != nil { t.Fatal(err) }
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Fatalf("want corrupt record skipped, got %v", keys)
+	}
+	if err := ReadWAL(path, WALOptions{FailOnCorrupt: true}, func(SyncMsg) error { return nil }); err == nil {
+		t.Fatal("fail-fast replay should report the bad record")
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	w, err := OpenWAL(path, WALOptions{})
+	if err != nil { t.Fatal(err) }
+	for i, k := range []string{"a", "b"} {
+		if err := w.Append(SyncMsg{Op: "set", Key: k, Value: []byte("v"), Version: int64(i + 1)}); err != nil { t.Fatal(err) }
+	}
+	w.Close()
+	whole, _ := os.ReadFile(path)
+
+	// A crash mid-append leaves a header promising more bytes than follow.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil { t.Fatal(err) }
+	f.Write([]byte{0, 0, 0, 50, 1, 2, 3, 4, '{'})
+	f.Close()
+
+	if _, err := OpenWAL(path, WALOptions{FailOnCorrupt: true}); err == nil {
+		t.Fatal("fail-fast open should report the torn tail")
+	}
+	w, err = OpenWAL(path, WALOptions{})
+	if err != nil { t.Fatal(err) }
+	if raw, _ := os.ReadFile(path); !bytes.Equal(raw, whole) {
+		t.Fatalf("torn tail not truncated: %d bytes, want %d", len(raw), len(whole))
+	}
+	if err := w.Append(SyncMsg{Op: "set", Key: "c", Value: []byte("v"), Version: 3}); err != nil { t.Fatal(err) }
+	w.Close()
+
+	var keys []string
+	err = ReadWAL(path, WALOptions{FailOnCorrupt: true}, func(m SyncMsg) error { keys = append(keys, m.Key); return nil })
+	if err != nil { t.Fatal(err) }
+	if len(keys) != 3 || keys[2] != "c" {
+		t.Fatalf("replay after the crash = %v, want a b c", keys)
+	}
+
+	// Hint files are WALs too.
+	dir := t.TempDir()
+	o, err := OpenOutbox(dir, WALOptions{})
+	if err != nil { t.Fatal(err) }
+	if err := o.Add("http://p", SyncMsg{Op: "set", Key: "h1", Version: 1}); err != nil { t.Fatal(err) }
+	o.Close()
+	f, err = os.OpenFile(hintFile(dir, "http://p"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil { t.Fatal(err) }
+	f.Write([]byte{0, 0})
+	f.Close()
+	if o, err = OpenOutbox(dir, WALOptions{}); err != nil { t.Fatal(err) }
+	if err := o.Add("http://p", SyncMsg{Op: "set", Key: "h2", Version: 2}); err != nil { t.Fatal(err) }
+	o.Close()
+	if o, err = OpenOutbox(dir, WALOptions{}); err != nil { t.Fatal(err) }
+	defer o.Close()
+	if p := o.Pending("http://p"); len(p) != 2 || p[1].Key != "h2" {
+		t.Fatalf("hints after the crash = %+v", p)
+	}
+}
+
+func TestOutboxAck(t *testing.T) {
+	dir, peer := t.TempDir(), "http://p"
+	o, err := OpenOutbox(dir, WALOptions{})
+	if err != nil { t.Fatal(err) }
+	for i := 0; i < 10; i++ {
+		if err := o.Add(peer, SyncMsg{Op: "set", Key: fmt.Sprint("h", i), Version: int64(i + 1)}); err != nil { t.Fatal(err) }
+	}
+	o.Close()
+	if o, err = OpenOutbox(dir, WALOptions{}); err != nil { t.Fatal(err) }
+	full, _ := os.Stat(hintFile(dir, peer))
+
+	for i := 0; i < 5; i++ {
+		if err := o.Ack(peer, 1); err != nil { t.Fatal(err) }
+	}
+	if fi, _ := os.Stat(hintFile(dir, peer)); fi.Size() != full.Size() {
+		t.Fatalf("hints file rewritten with half still pending: %d bytes, was %d", fi.Size(), full.Size())
+	}
+	if n := readAcked(hintFile(dir, peer) + ackedSuffix); n != 5 {
+		t.Fatalf("acked count = %d, want 5", n)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) != 0 {
+		t.Fatalf("temporary files left behind: %v", tmp)
+	}
+	o.Close()
+	if o, err = OpenOutbox(dir, WALOptions{}); err != nil { t.Fatal(err) }
+	if p := o.Pending(peer); len(p) != 5 || p[0].Key != "h5" {
+		t.Fatalf("pending after restart = %+v", p)
+	}
+
+	// Past half delivered, the file is compacted and the count dropped.
+	if err := o.Ack(peer, 1); err != nil { t.Fatal(err) }
+	if fi, _ := os.Stat(hintFile(dir, peer)); fi.Size() >= full.Size()/2 {
+		t.Fatalf("hints file not compacted: %d bytes, was %d", fi.Size(), full.Size())
+	}
+	if _, err := os.Stat(hintFile(dir, peer) + ackedSuffix); !os.IsNotExist(err) {
+		t.Fatalf("acked file after compaction: %v", err)
+	}
+	if err := o.Add(peer, SyncMsg{Op: "set", Key: "h10", Version: 11}); err != nil { t.Fatal(err) }
+	o.Close()
+	if o, err = OpenOutbox(dir, WALOptions{}); err != nil { t.Fatal(err) }
+	defer o.Close()
+	if p := o.Pending(peer); len(p) != 5 || p[0].Key != "h6" || p[4].Key != "h10" {
+		t.Fatalf("pending after compaction = %+v", p)
+	}
+
+	// Drop removes the queue and both files, so hints queued for the peer
+	// later start from a clean count.
+	if err := o.Ack(peer, 1); err != nil { t.Fatal(err) }
+	if n, err := o.Drop(peer); err != nil || n != 4 {
+		t.Fatalf("Drop = %d, %v; want 4", n, err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Fatalf("files left after Drop: %v", left)
+	}
+	if err := o.Add(peer, SyncMsg{Op: "set", Key: "h11", Version: 12}); err != nil { t.Fatal(err) }
+	if p := o.Pending(peer); len(p) != 1 || p[0].Key != "h11" {
+		t.Fatalf("pending after Drop and Add = %+v", p)
+	}
+}
+
+func TestRestoreBeforeCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.wal")
+	n := NewNode("A", ":x", nil)
+	if err := n.OpenWAL(path, 0); err != nil { t.Fatal(err) }
+	n.apply("k", Item{Value: []byte("old"), Version: 10, Origin: "A"})
+	n.apply("k", Item{Value: []byte("new"), Version: 20, Origin: "A"})
+	if err := n.CompactWAL(); err != nil { t.Fatal(err) }
+	n.apply("k", Item{Value: []byte("newer"), Version: 30, Origin: "A"})
+
+	// Version 10 was compacted away; restoring to 15 would serve "new".
+	if err := n.RestoreTo(15); !errors.Is(err, ErrRestoreCompacted) {
+		t.Fatalf("RestoreTo(15) = %v, want ErrRestoreCompacted", err)
+	}
+	if got, _ := n.Store().Get("k"); string(got.Value) != "newer" {
+		t.Fatalf("refused restore changed the store: %q", got.Value)
+	}
+	if err := n.RestoreTo(25); err != nil { t.Fatal(err) }
+	if got, _ := n.Store().Get("k"); string(got.Value) != "new" {
+		t.Fatalf("after restore to 25: %q", got.Value)
+	}
+	if err := n.CloseWAL(); err != nil { t.Fatal(err) }
+
+	// The limit survives a restart, so -restore-to is refused too.
+	n2 := NewNode("A", ":x", nil)
+	if err := n2.OpenWAL(path, 15); !errors.Is(err, ErrRestoreCompacted) {
+		t.Fatalf("OpenWAL restoring to 15 = %v, want ErrRestoreCompacted", err)
+	}
+	n2.CloseWAL()
+}
@@ -0,0 +1,240 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements change notifications for the gRPC Watch call, the /watch WebSocket (see
+websocket.go) and the /changes feed (see changefeed.go). Every write and delete the node applies, whether made by a client here or
+replicated from a peer, is published as a "set" or "del" event to the watchers whose keys or
+prefixes match, and items that expire here are published as "expire". Evictions are not
+published: they are local decisions, not changes to the data. Expiry is local too, but every node
+expires the same items, so watchers see it wherever they are connected.
+
+Publishing never blocks the write path. Each watcher has a buffer of watchBuffer events; a watcher
+whose buffer is full is dropped and told so, and must resubscribe and re-read the keys it cares
+about, since it has missed changes.
+
+Each event is stamped with an HLC timestamp (see changefeed.go) and, for resuming /changes, kept
+without its value in the hub's feed ring. Stamping and the ring need the hub's lock, so the ring
+only starts with the first /changes stream or follower; until then, with no watchers, publishing
+costs two atomic loads.
+
+Watchers only see keys their caller may read: mayWatch runs the /kv checks for a GET of the key
+with the credentials of the request that opened the watch. changeEventFor builds the JSON sent
+for an event by /watch and /changes.
+
+Functions:
+- (*watchHub) subscribe(keys, prefixes []string): *watcher
+- (*watchHub) update(w *watcher, add bool, keys, prefixes []string, max int): (int, bool)
+- (*watchHub) unsubscribe(w *watcher)
+- (*watchHub) publish(op, key string, it Item)
+- (*watcher) matches(key string): bool
+- (*Node) mayWatch(h http.Handler, r *http.Request, key string): *wireRejection
+- watchFilters(q url.Values): ([]string, []string, error)
+- (*Node) changeEventFor(ev watchEvent, replayed bool): (changeEvent, error)
+*/
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	watchBuffer     = 1024
+	watchMaxFilters = 1024 // keys and prefixes per /watch or /changes client
+)
+
+type watchEvent struct {
+	id  int64  // HLC timestamp
+	op  string // "set", "del" or "expire"
+	key string
+	it  Item
+}
+
+// changeEvent is the JSON form of an event.
+type changeEvent struct {
+	Type      string     `json:"type"`
+	Key       string     `json:"key"`
+	Value     []byte     `json:"value,omitempty"`
+	Version   int64      `json:"version"`
+	Origin    string     `json:"origin"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Flags     uint32     `json:"flags,omitempty"`
+	// Superseded marks a replayed set whose value is no longer stored, having
+	// been overwritten, deleted or expired since; it carries no value.
+	Superseded bool `json:"superseded,omitempty"`
+}
+
+type watcher struct {
+	keys     map[string]struct{}
+	prefixes []string // "" matches every key
+	events   chan watchEvent
+	lagged   bool // set before events is closed for falling behind
+}
+
+type watchHub struct {
+	mu    sync.Mutex
+	subs  map[*watcher]struct{}
+	count atomic.Int64
+	clock hlc
+	feed  feedRing
+}
+
+func (h *watchHub) subscribe(keys, prefixes []string) *watcher {
+	w := &watcher{keys: make(map[string]struct{}), events: make(chan watchEvent, watchBuffer)}
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[*watcher]struct{})
+	}
+	h.subs[w] = struct{}{}
+	h.count.Store(int64(len(h.subs)))
+	h.mu.Unlock()
+	h.update(w, true, keys, prefixes, 0)
+	return w
+}
+
+// update adds keys and prefixes to w, or removes them, and returns how many w
+// then has. An addition that would leave w with more than max (unless max is
+// zero) is not made and reported with false.
+func (h *watchHub) update(w *watcher, add bool, keys, prefixes []string, max int) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !add {
+		for _, k := range keys {
+			delete(w.keys, k)
+		}
+		w.prefixes = slices.DeleteFunc(w.prefixes, func(p string) bool { return slices.Contains(prefixes, p) })
+		return len(w.keys) + len(w.prefixes), true
+	}
+	var newKeys []string
+	for _, k := range keys {
+		if _, ok := w.keys[k]; !ok {
+			w.keys[k] = struct{}{}
+			newKeys = append(newKeys, k)
+		}
+	}
+	before := len(w.prefixes)
+	for _, p := range prefixes {
+		if !slices.Contains(w.prefixes, p) {
+			w.prefixes = append(w.prefixes, p)
+		}
+	}
+	if size := len(w.keys) + len(w.prefixes); max <= 0 || size <= max {
+		return size, true
+	}
+	for _, k := range newKeys {
+		delete(w.keys, k)
+	}
+	w.prefixes = w.prefixes[:before]
+	return len(w.keys) + len(w.prefixes), false
+}
+
+// unsubscribe removes w; it is a no-op for watchers already dropped.
+func (h *watchHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	if _, ok := h.subs[w]; ok {
+		delete(h.subs, w)
+		close(w.events)
+	}
+	h.count.Store(int64(len(h.subs)))
+	h.mu.Unlock()
+}
+
+func (h *watchHub) publish(op, key string, it Item) {
+	if h.count.Load() == 0 && h.feed.size.Load() == 0 {
+		if !h.feed.skipped.Load() {
+			h.feed.skipped.Store(true)
+		}
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ev := watchEvent{h.clock.stamp(it.Version), op, key, it}
+	h.feed.add(ev)
+	for w := range h.subs {
+		if !w.matches(key) {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			w.lagged = true
+			delete(h.subs, w)
+			close(w.events)
+		}
+	}
+	h.count.Store(int64(len(h.subs)))
+}
+
+// matches is called with the hub locked.
+func (w *watcher) matches(key string) bool {
+	if _, ok := w.keys[key]; ok {
+		return true
+	}
+	for _, p := range w.prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayWatch runs r's caller through the checks in h (see wireChain) for a GET
+// of key, returning the rejection if it was refused. With key "", only
+// authentication and the read role are checked.
+func (n *Node) mayWatch(h http.Handler, r *http.Request, key string) *wireRejection {
+	kr := r.Clone(r.Context())
+	kr.Method, kr.URL, kr.RequestURI = http.MethodGet, &url.URL{Path: "/kv/" + key}, ""
+	kr.Body, kr.ContentLength = http.NoBody, 0
+	return checkedCall(h, kr, func(*http.Request) {})
+}
+
+// watchFilters reads the keys and prefixes to watch from key=, prefix= and
+// namespace= parameters.
+func watchFilters(q url.Values) ([]string, []string, error) {
+	keys, prefixes := q["key"], q["prefix"]
+	for _, ns := range q["namespace"] {
+		prefixes = append(prefixes, ns+":")
+	}
+	if len(keys)+len(prefixes) > watchMaxFilters {
+		return nil, nil, fmt.Errorf("at most %d keys and prefixes", watchMaxFilters)
+	}
+	return keys, prefixes, nil
+}
+
+// changeEventFor builds the message for ev. Set events carry the plain value;
+// replayed ones only while it is still the stored version, since the feed ring
+// does not keep values.
+func (n *Node) changeEventFor(ev watchEvent, replayed bool) (changeEvent, error) {
+	msg := changeEvent{Type: ev.op, Key: ev.key, Version: ev.it.Version, Origin: ev.it.Origin, Flags: ev.it.Flags}
+	if ev.op != "set" {
+		return msg, nil
+	}
+	it := ev.it
+	if replayed {
+		cur, ok := n.store.GetLive(ev.key, n.now())
+		if !ok || cur.Version != it.Version || cur.Origin != it.Origin {
+			msg.Superseded = true
+			return msg, nil
+		}
+		it = cur
+	}
+	it, err := n.plainItem(ev.key, it)
+	if err != nil {
+		return msg, err
+	}
+	msg.Value = it.Value
+	if !it.ExpiresAt.IsZero() {
+		msg.ExpiresAt = &it.ExpiresAt
+	}
+	return msg, nil
+}
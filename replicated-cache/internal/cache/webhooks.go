@@ -0,0 +1,299 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements outbound webhooks: URLs the node POSTs to when keys change, so that external
+systems (CDN purgers, search indexers, downstream caches) can react to invalidations. The
+operator lists them in a file, one per line:
+
+	https://hooks.example.com/purge prefix=page: prefix=asset: secret=0123456789abcdef
+	https://indexer.internal/cache
+
+With prefix= only keys under one of the prefixes are reported; without, every key is. Each hook
+gets batches of up to webhookBatch set, del and expire events as JSON, without values:
+
+	{"node":"N1","delivery":"9f2c...","events":[{"id":1760572800000000001,"type":"del","key":"page:/","version":1760572800000000000,"origin":"N1"}]}
+
+A change is reported only by the node that took the write (the event's origin), so a cluster
+calls each hook once per change rather than once per replica. With secret= the request carries
+X-Cache-Signature: t=<unix time>,v1=<hex HMAC-SHA256 of "t.body">, so the receiver can check it
+came from the cache and reject replays outside its own tolerance. A 2xx answer delivers the
+batch; network errors, 408, 429 and 5xx are retried up to webhookAttempts times with doubling
+backoff, under the same X-Cache-Delivery id so receivers can drop duplicates. Other answers, and
+batches that exhaust their attempts, are logged and counted as failed. While a hook is retrying
+its events queue in a watcher; one that falls behind resumes from the changefeed ring (see
+followChanges in changefeed.go), and when the events it missed are no longer retained there the
+gap is counted.
+GET /admin/webhooks reports each hook's counters and last error; secrets are not shown.
+
+Functions:
+- ParseWebhooks(r io.Reader, source string): ([]Webhook, error)
+- (*Node) WebhookLoop(ctx context.Context, hooks []Webhook)
+- (*Node) runWebhook(ctx context.Context, h *webhookState)
+- (*Node) webhookBody(delivery string, batch []watchEvent): ([]byte, error)
+- (*Node) deliverWebhook(ctx context.Context, h *webhookState, delivery string, body []byte, count int)
+- (*webhookState) post(ctx context.Context, body []byte, delivery string): (bool, error)
+- signWebhook(secret []byte, ts string, body []byte): string
+- (*Node) handleWebhooks(w http.ResponseWriter, r *http.Request)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	webhookBatch     = 100
+	webhookAttempts  = 5
+	webhookBackoff   = time.Second
+	webhookTimeout   = 5 * time.Second
+	webhookSigHeader = "X-Cache-Signature"
+	minWebhookSecret = 16
+)
+
+// Webhook is a URL told about changes to keys under Prefixes (all keys when
+// empty), signed with Secret when set.
+type Webhook struct {
+	URL      string
+	Prefixes []string
+	Secret   []byte
+}
+
+type webhookState struct {
+	Webhook
+	client *http.Client
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+	lastOK      time.Time
+	delivered   atomic.Int64 // events
+	failed      atomic.Int64 // events in batches given up on
+	gaps        atomic.Int64 // times events were lost while the hook lagged
+}
+
+// webhookEvent is a changeEvent with the id that orders it.
+type webhookEvent struct {
+	ID int64 `json:"id"`
+	changeEvent
+}
+
+// ParseWebhooks reads webhooks, one per line as "URL [prefix=P]... [secret=S]";
+// blank lines and lines starting with # are skipped. source names r in errors.
+func ParseWebhooks(r io.Reader, source string) ([]Webhook, error) {
+	var hooks []Webhook
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		u, err := url.Parse(fields[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%s:%d: %q is not an http(s) URL", source, line, fields[0])
+		}
+		h := Webhook{URL: fields[0]}
+		for _, f := range fields[1:] {
+			name, value, _ := strings.Cut(f, "=")
+			switch name {
+			case "prefix":
+				if value == "" {
+					return nil, fmt.Errorf("%s:%d: empty prefix", source, line)
+				}
+				h.Prefixes = append(h.Prefixes, value)
+			case "secret":
+				if len(value) < minWebhookSecret {
+					return nil, fmt.Errorf("%s:%d: secret shorter than %d bytes", source, line, minWebhookSecret)
+				}
+				h.Secret = []byte(value)
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown option %q", source, line, f)
+			}
+		}
+		hooks = append(hooks, h)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// WebhookLoop calls hooks about changes made on this node until ctx is done.
+func (n *Node) WebhookLoop(ctx context.Context, hooks []Webhook) {
+	client := &http.Client{
+		Timeout: webhookTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	states := make([]*webhookState, len(hooks))
+	for i, h := range hooks {
+		states[i] = &webhookState{Webhook: h, client: client}
+	}
+	n.webhooks.Store(&states)
+	var wg sync.WaitGroup
+	for _, h := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.runWebhook(ctx, h)
+		}()
+	}
+	wg.Wait()
+}
+
+// runWebhook feeds h batches of its events until ctx is done.
+func (n *Node) runWebhook(ctx context.Context, h *webhookState) {
+	gap := func() {
+		h.gaps.Add(1)
+		n.metrics.webhookGaps.Add(1)
+		n.log.Warn("webhook fell behind; events were dropped", "component", "webhooks", "url", h.URL)
+	}
+	n.followChanges(ctx, h.Prefixes, webhookBatch, gap, func(batch []watchEvent) {
+		var id [12]byte
+		rand.Read(id[:])
+		delivery := hex.EncodeToString(id[:])
+		body, err := n.webhookBody(delivery, batch)
+		if err != nil {
+			n.log.Error("webhook body", "component", "webhooks", "url", h.URL, "err", err)
+			return
+		}
+		n.deliverWebhook(ctx, h, delivery, body, len(batch))
+	})
+}
+
+func (n *Node) webhookBody(delivery string, batch []watchEvent) ([]byte, error) {
+	events := make([]webhookEvent, len(batch))
+	for i, ev := range batch {
+		msg := changeEvent{Type: ev.op, Key: ev.key, Version: ev.it.Version, Origin: ev.it.Origin, Flags: ev.it.Flags}
+		if ev.op == "set" && !ev.it.ExpiresAt.IsZero() {
+			msg.ExpiresAt = &ev.it.ExpiresAt
+		}
+		events[i] = webhookEvent{ev.id, msg}
+	}
+	return json.Marshal(map[string]any{"node": n.ID, "delivery": delivery, "events": events})
+}
+
+// deliverWebhook posts body, holding count events, retrying with backoff.
+func (n *Node) deliverWebhook(ctx context.Context, h *webhookState, delivery string, body []byte, count int) {
+	backoff := webhookBackoff
+	var err error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		var retry bool
+		if retry, err = h.post(ctx, body, delivery); err == nil {
+			h.delivered.Add(int64(count))
+			h.mu.Lock()
+			h.lastOK = time.Now()
+			h.mu.Unlock()
+			n.metrics.webhookDelivered.Add(int64(count))
+			return
+		}
+		if !retry || attempt == webhookAttempts {
+			break
+		}
+		n.log.Debug("webhook failed; retrying", "component", "webhooks", "url", h.URL, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			attempt = webhookAttempts
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+	h.failed.Add(int64(count))
+	h.mu.Lock()
+	h.lastError, h.lastErrorAt = err.Error(), time.Now()
+	h.mu.Unlock()
+	n.metrics.webhookFailed.Add(int64(count))
+	n.log.Warn("webhook delivery failed", "component", "webhooks", "url", h.URL, "delivery", delivery, "events", count, "err", err)
+}
+
+// post sends body once; the bool reports whether a failure is worth retrying.
+func (h *webhookState) post(ctx context.Context, body []byte, delivery string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "replicated-cache-webhook")
+	req.Header.Set("X-Cache-Delivery", delivery)
+	if h.Secret != nil {
+		req.Header.Set(webhookSigHeader, signWebhook(h.Secret, strconv.FormatInt(time.Now().Unix(), 10), body))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return false, nil
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		return true, errors.New(resp.Status)
+	default:
+		return false, errors.New(resp.Status)
+	}
+}
+
+// signWebhook returns the X-Cache-Signature value for body sent at ts.
+func signWebhook(secret []byte, ts string, body []byte) string {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// handleWebhooks serves GET /admin/webhooks; secrets are not shown.
+func (n *Node) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	type status struct {
+		URL         string     `json:"url"`
+		Prefixes    []string   `json:"prefixes,omitempty"`
+		Signed      bool       `json:"signed"`
+		Delivered   int64      `json:"delivered"`
+		Failed      int64      `json:"failed"`
+		Gaps        int64      `json:"gaps"`
+		LastOK      *time.Time `json:"last_ok,omitempty"`
+		LastError   string     `json:"last_error,omitempty"`
+		LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	}
+	out := []status{}
+	if states := n.webhooks.Load(); states != nil {
+		for _, h := range *states {
+			s := status{URL: h.URL, Prefixes: h.Prefixes, Signed: h.Secret != nil,
+				Delivered: h.delivered.Load(), Failed: h.failed.Load(), Gaps: h.gaps.Load()}
+			h.mu.Lock()
+			if !h.lastOK.IsZero() {
+				t := h.lastOK
+				s.LastOK = &t
+			}
+			if h.lastError != "" {
+				t := h.lastErrorAt
+				s.LastError, s.LastErrorAt = h.lastError, &t
+			}
+			h.mu.Unlock()
+			out = append(out, s)
+		}
+	}
+	writeEncoded(w, r, http.StatusOK, out)
+}
@@ -0,0 +1,113 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for outbound webhooks on key changes.
+
+List of functions:
+	- TestParseWebhooks: Tests the webhook file format and its errors.
+	- TestWebhookDelivery: Tests prefix and origin filtering, signing, retries and the admin status.
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	hooks, err := ParseWebhooks(strings.NewReader("# purgers\n\nhttps://a.example/x prefix=page: prefix=asset: secret=0123456789abcdef\nhttp://b.example\n"), "hooks")
+	if err != nil { t.Fatal(err) }
+	if len(hooks) != 2 || len(hooks[0].Prefixes) != 2 || string(hooks[0].Secret) != "0123456789abcdef" || hooks[1].Prefixes != nil {
+		t.Fatalf("hooks = %+v", hooks)
+	}
+	for _, bad := range []string{"ftp://a.example", "https://a.example secret=short", "https://a.example prefix=", "https://a.example retries=3"} {
+		if _, err := ParseWebhooks(strings.NewReader(bad), "hooks"); err == nil {
+			t.Fatalf("%q parsed", bad)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	var mu sync.Mutex
+	var calls int
+	var deliveries []string
+	got := make(chan []webhookEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sig := r.Header.Get(webhookSigHeader)
+		ts, _, _ := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+		if sig != signWebhook(secret, ts, body) {
+			t.Errorf("signature %q", sig)
+		}
+		mu.Lock()
+		calls++
+		first := calls == 1
+		deliveries = append(deliveries, r.Header.Get("X-Cache-Delivery"))
+		mu.Unlock()
+		if first {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		var msg struct {
+			Node   string         `json:"node"`
+			Events []webhookEvent `json:"events"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil || msg.Node != "N" { t.Errorf("body %s", body) }
+		got <- msg.Events
+	}))
+	defer hook.Close()
+
+	n := NewNode("N", ":x", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.WebhookLoop(ctx, []Webhook{{URL: hook.URL, Prefixes: []string{"page:"}, Secret: secret}})
+	for n.watches.count.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	now := time.Now().UnixNano()
+	n.apply("page:/", Item{Value: []byte("x"), Version: now, Origin: "N"})
+	n.apply("other", Item{Value: []byte("x"), Version: now, Origin: "N"})
+	n.apply("page:/peer", Item{Value: []byte("x"), Version: now, Origin: "P"}) // reported by P
+	n.apply("page:/", Item{Version: now + 1, Origin: "N", Tombstone: true})
+	var events []webhookEvent
+	for len(events) < 2 {
+		select {
+		case evs := <-got:
+			events = append(events, evs...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("events so far %+v", events)
+		}
+	}
+	if len(events) != 2 || events[0].Type != "set" || events[0].Key != "page:/" || events[1].Type != "del" || events[0].Value != nil || events[1].ID <= events[0].ID {
+		t.Fatalf("events %+v", events)
+	}
+	mu.Lock()
+	if deliveries[0] == "" || deliveries[1] != deliveries[0] {
+		t.Fatalf("retry sent delivery ids %q", deliveries)
+	}
+	mu.Unlock()
+
+	for n.metrics.webhookDelivered.Load() != 2 {
+		time.Sleep(time.Millisecond) // the hook answers after sending on got
+	}
+	w := httptest.NewRecorder()
+	n.handleWebhooks(w, httptest.NewRequest("GET", "/admin/webhooks", nil))
+	var status []map[string]any
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if len(status) != 1 || status[0]["delivered"] != float64(2) || status[0]["signed"] != true || strings.Contains(w.Body.String(), string(secret)) {
+		t.Fatalf("status %s", w.Body)
+	}
+}
@@ -0,0 +1,405 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements GET /watch, a WebSocket endpoint that pushes key changes to clients such as
+browser dashboards and cache-invalidation workers. A client subscribes to exact keys, key prefixes
+or namespaces (the key prefix before ':', see namespaceOf), either in the URL
+(?key=K&prefix=P&namespace=NS, each repeatable) or later with JSON text messages:
+
+	{"op": "subscribe", "keys": ["user:1"], "prefixes": ["cart:"], "namespaces": ["session"]}
+	{"op": "unsubscribe", "namespaces": ["session"]}
+
+which are answered {"type": "subscribed"|"unsubscribed", "watching": N}, or {"type": "error"}. Every
+matching write, delete and expiry on this node (see watch.go) is sent as one text message:
+
+	{"type": "set", "key": "user:1", "value": "<base64>", "version": 1760..., "origin": "N1", "expires_at": "..."}
+
+"del" and "expire" events carry no value. Events are checked as reads by the caller who opened the
+socket, with the credentials of the upgrade request, so keys it may not read are left out and a
+revoked key or expired token ends the socket with close code 1008. A client that falls more than
+watchBuffer events behind is closed with 1013 and should reconnect and re-read its keys.
+
+The WebSocket protocol (RFC 6455) is implemented here on a hijacked HTTP/1.1 connection, like the
+sync stream, to stay free of dependencies; extensions and binary messages are not supported. With
+Node.CORS set, browsers may only connect from its allowed origins. The server pings every
+wsPingEvery and closes connections that stay silent for twice that.
+
+Functions:
+- (*Node) handleWatch(w http.ResponseWriter, r *http.Request)
+- (*Node) serveWatch(c *wsConn, r *http.Request, events http.Handler, w *watcher)
+- (*wsConn) readLoop(n *Node, w *watcher): error
+- (*wsConn) command(n *Node, w *watcher, msg []byte)
+- (*wsConn) readFrame(): (bool, byte, []byte, error)
+- (*wsConn) writeFrame(op byte, payload []byte): error
+- (*wsConn) writeJSON(v any): error
+- (*wsConn) close(code int, reason string)
+- wsAccept(key string): string
+- headerHasToken(h http.Header, name, token string): bool
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	wsGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxMessage   = wireMaxAnonymous // largest client message
+	wsPingEvery    = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsClosePolicy      = 1008
+	wsCloseTooBig      = 1009
+	wsCloseInternal    = 1011
+	wsCloseTryAgain    = 1013
+)
+
+// wsCloseError is a reason to close the connection with code.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string { return e.reason }
+
+// errWSClosed means the client sent a close frame.
+var errWSClosed = errors.New("websocket closed by client")
+
+type wsConn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	mu      sync.Mutex // serializes writes
+	closing atomic.Bool
+}
+
+// wsCommand is a subscribe or unsubscribe message from the client.
+type wsCommand struct {
+	Op         string   `json:"op"`
+	Keys       []string `json:"keys"`
+	Prefixes   []string `json:"prefixes"`
+	Namespaces []string `json:"namespaces"`
+}
+
+func (n *Node) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "expected a WebSocket upgrade", http.StatusUpgradeRequired)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		http.Error(w, "bad Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && n.CORS != nil && !n.CORS.allowOrigin(origin) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	keys, prefixes, err := watchFilters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// The socket outlives the request, so its checks may not be cancelled
+	// with it.
+	r = r.WithContext(context.WithoutCancel(r.Context()))
+	if rej := n.mayWatch(n.wireChain(true), r, ""); rej != nil {
+		for k, v := range rej.header {
+			w.Header()[k] = v
+		}
+		http.Error(w, rej.message(), rej.status)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket needs HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	conn.SetDeadline(time.Time{}) // the socket outlives any per-request deadline
+	watch := n.watches.subscribe(keys, prefixes)
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		n.watches.unsubscribe(watch)
+		conn.Close()
+		return
+	}
+	go n.serveWatch(&wsConn{conn: conn, rw: rw}, r, n.wireChain(false), watch)
+}
+
+// serveWatch sends w's events until the client leaves or falls behind. The
+// client's messages are handled by readLoop.
+func (n *Node) serveWatch(c *wsConn, r *http.Request, events http.Handler, w *watcher) {
+	n.metrics.wsWatchers.Add(1)
+	defer n.metrics.wsWatchers.Add(-1)
+	defer c.conn.Close()
+	defer n.watches.unsubscribe(w)
+	done := make(chan error, 1)
+	go func() { done <- c.readLoop(n, w) }()
+	ping := time.NewTicker(wsPingEvery)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case err = <-done:
+			var ce *wsCloseError
+			if errors.As(err, &ce) {
+				c.close(ce.code, ce.reason)
+			}
+			return
+		case <-ping.C:
+			err = c.writeFrame(wsPing, nil)
+		case ev, ok := <-w.events:
+			if !ok {
+				err = &wsCloseError{wsCloseTryAgain, "watcher fell behind; reconnect"}
+				break
+			}
+			if rej := n.mayWatch(events, r, ev.key); rej != nil {
+				switch rej.status {
+				case http.StatusForbidden:
+					continue // a key the caller may not read
+				case http.StatusUnauthorized:
+					err = &wsCloseError{wsClosePolicy, rej.message()}
+				default:
+					err = &wsCloseError{wsCloseInternal, rej.message()}
+				}
+				break
+			}
+			msg, merr := n.changeEventFor(ev, false)
+			if merr != nil {
+				err = &wsCloseError{wsCloseInternal, merr.Error()}
+				break
+			}
+			err = c.writeJSON(msg)
+		}
+		if err != nil {
+			var ce *wsCloseError
+			if errors.As(err, &ce) {
+				c.close(ce.code, ce.reason)
+				// Give the client a moment to answer the close.
+				c.conn.SetReadDeadline(time.Now().Add(time.Second))
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// readLoop handles the client's frames until it closes the connection or
+// breaks the protocol, returning the reason.
+func (c *wsConn) readLoop(n *Node, w *watcher) error {
+	var msg []byte
+	var op byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(2 * wsPingEvery))
+		fin, fop, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		switch fop {
+		case wsPing:
+			err = c.writeFrame(wsPong, payload)
+		case wsPong:
+		case wsClose:
+			if !c.closing.Load() {
+				code := wsCloseNormal
+				if len(payload) >= 2 {
+					code = int(binary.BigEndian.Uint16(payload))
+				}
+				c.close(code, "")
+			}
+			return errWSClosed
+		case wsText, wsBinary, wsContinuation:
+			if (fop == wsContinuation) != (op != 0) {
+				return &wsCloseError{wsCloseProtocol, "unexpected continuation frame"}
+			}
+			if fop != wsContinuation {
+				op = fop
+			}
+			if len(msg)+len(payload) > wsMaxMessage {
+				return &wsCloseError{wsCloseTooBig, "message too large"}
+			}
+			msg = append(msg, payload...)
+			if !fin {
+				continue
+			}
+			if op == wsBinary {
+				return &wsCloseError{wsCloseUnsupported, "binary messages are not supported"}
+			}
+			c.command(n, w, msg)
+			msg, op = msg[:0], 0
+		default:
+			return &wsCloseError{wsCloseProtocol, "unknown opcode"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// command applies a subscribe or unsubscribe message and answers it.
+func (c *wsConn) command(n *Node, w *watcher, msg []byte) {
+	var cmd wsCommand
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		c.writeJSON(map[string]string{"type": "error", "error": "bad json: " + err.Error()})
+		return
+	}
+	prefixes := cmd.Prefixes
+	for _, ns := range cmd.Namespaces {
+		prefixes = append(prefixes, ns+":")
+	}
+	var size int
+	switch cmd.Op {
+	case "subscribe":
+		var ok bool
+		if size, ok = n.watches.update(w, true, cmd.Keys, prefixes, watchMaxFilters); !ok {
+			c.writeJSON(map[string]string{"type": "error", "error": fmt.Sprintf("at most %d keys and prefixes", watchMaxFilters)})
+			return
+		}
+	case "unsubscribe":
+		size, _ = n.watches.update(w, false, cmd.Keys, prefixes, 0)
+	default:
+		c.writeJSON(map[string]string{"type": "error", "error": fmt.Sprintf("unknown op %q", cmd.Op)})
+		return
+	}
+	c.writeJSON(map[string]any{"type": cmd.Op + "d", "watching": size})
+}
+
+// readFrame reads one frame from the client, unmasking its payload.
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.rw, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op := hdr[0]&0x80 != 0, hdr[0]&0x0f
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocol, "extensions are not supported"}
+	}
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocol, "client frames must be masked"}
+	}
+	size := uint64(hdr[1] & 0x7f)
+	switch size {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.rw, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.rw, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(b[:])
+	}
+	if op >= wsClose && (!fin || size > 125) {
+		return false, 0, nil, &wsCloseError{wsCloseProtocol, "bad control frame"}
+	}
+	if size > wsMaxMessage {
+		return false, 0, nil, &wsCloseError{wsCloseTooBig, "message too large"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame sends one unfragmented frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hdr := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	c.rw.Write(hdr)
+	c.rw.Write(payload)
+	return c.rw.Flush()
+}
+
+func (c *wsConn) writeJSON(v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, b)
+}
+
+// close sends a close frame; it is sent at most once.
+func (c *wsConn) close(code int, reason string) {
+	if c.closing.Swap(true) {
+		return
+	}
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...))
+}
+
+// wsAccept computes Sec-WebSocket-Accept for a Sec-WebSocket-Key.
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma-separated header name lists token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the /watch WebSocket endpoint and the watch hub behind it.
+
+List of functions:
+	- dialWatch: Opens a WebSocket to a node's /watch endpoint and returns a client for it.
+	- TestWatchWebSocket: Tests key, prefix and namespace subscriptions, set/del/expire events, pings and closing.
+	- TestWatchWebSocketAuth: Tests that /watch needs credentials and only sends events for keys the caller may read.
+	- TestWatchHubLagging: Tests that a watcher that falls behind is dropped without blocking publishers.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWatch opens /watch?query on srv, failing the test unless the upgrade
+// succeeds; status returns the response code of a refused upgrade instead.
+func dialWatch(t *testing.T, srv *httptest.Server, query, token string) (*wsClient, int) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil { t.Fatal(err) }
+	t.Cleanup(func() { conn.Close() })
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req := "GET /watch?" + query + " HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + key + "\r\n"
+	if token != "" {
+		req += "Authorization: Bearer " + token + "\r\n"
+	}
+	io.WriteString(conn, req+"\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil { t.Fatal(err) }
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp.StatusCode
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return &wsClient{t: t, conn: conn, r: r}, resp.StatusCode
+}
+
+// send writes a masked frame.
+func (c *wsClient) send(op byte, payload string) {
+	mask := []byte{1, 2, 3, 4}
+	b := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	if len(payload) > 125 {
+		b[1] = 0x80 | 126
+		b = binary.BigEndian.AppendUint16(b, uint16(len(payload)))
+	}
+	b = append(b, mask...)
+	for i := 0; i < len(payload); i++ {
+		b = append(b, payload[i]^mask[i%4])
+	}
+	if _, err := c.conn.Write(b); err != nil { c.t.Fatal(err) }
+}
+
+// recv reads a frame from the server, which sends small unmasked frames.
+func (c *wsClient) recv() (byte, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil { c.t.Fatal(err) }
+	size := int(hdr[1] & 0x7f)
+	if size == 126 {
+		var b [2]byte
+		io.ReadFull(c.r, b[:])
+		size = int(binary.BigEndian.Uint16(b[:]))
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.r, payload); err != nil { c.t.Fatal(err) }
+	return hdr[0] & 0x0f, payload
+}
+
+// event reads the next text message as an event.
+func (c *wsClient) event() changeEvent {
+	op, payload := c.recv()
+	var ev changeEvent
+	if op != wsText || json.Unmarshal(payload, &ev) != nil {
+		c.t.Fatalf("expected an event, got opcode %d: %s", op, payload)
+	}
+	return ev
+}
+
+func TestWatchWebSocket(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	do := func(method, path, body string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+	}
+
+	c, _ := dialWatch(t, srv, "key=a&namespace=user", "")
+	do("PUT", "/kv/other", "x")
+	do("PUT", "/kv/a", "1")
+	do("PUT", "/kv/user:1", "ann")
+	do("DELETE", "/kv/a", "")
+	do("PUT", "/kv/user:2?ttl=20ms", "tmp")
+	for _, want := range []changeEvent{
+		{Type: "set", Key: "a", Value: []byte("1")},
+		{Type: "set", Key: "user:1", Value: []byte("ann")},
+		{Type: "del", Key: "a"},
+		{Type: "set", Key: "user:2", Value: []byte("tmp")},
+	} {
+		ev := c.event()
+		if ev.Type != want.Type || ev.Key != want.Key || string(ev.Value) != string(want.Value) || ev.Version == 0 || ev.Origin != "N" {
+			t.Fatalf("event %+v, want %+v", ev, want)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	n.runJanitor()
+	if ev := c.event(); ev.Type != "expire" || ev.Key != "user:2" || ev.Value != nil {
+		t.Fatalf("expiry event %+v", ev)
+	}
+
+	c.send(wsText, `{"op":"subscribe","prefixes":["cart:"]}`)
+	if _, msg := c.recv(); string(msg) != `{"type":"subscribed","watching":3}` {
+		t.Fatalf("subscribe reply %s", msg)
+	}
+	c.send(wsText, `{"op":"unsubscribe","keys":["a"],"namespaces":["user"]}`)
+	if _, msg := c.recv(); string(msg) != `{"type":"unsubscribed","watching":1}` {
+		t.Fatalf("unsubscribe reply %s", msg)
+	}
+	c.send(wsText, `{"op":"nope"}`)
+	if _, msg := c.recv(); !strings.Contains(string(msg), `"type":"error"`) {
+		t.Fatalf("unknown op reply %s", msg)
+	}
+	do("PUT", "/kv/user:3", "x")
+	do("PUT", "/kv/cart:1", "x")
+	if ev := c.event(); ev.Key != "cart:1" {
+		t.Fatalf("event after resubscribing %+v", ev)
+	}
+
+	c.send(wsPing, "hi")
+	if op, payload := c.recv(); op != wsPong || string(payload) != "hi" {
+		t.Fatalf("ping answered with opcode %d: %q", op, payload)
+	}
+	c.send(wsClose, "\x03\xe8")
+	if op, payload := c.recv(); op != wsClose || binary.BigEndian.Uint16(payload) != wsCloseNormal {
+		t.Fatalf("close answered with opcode %d: %q", op, payload)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for n.watches.count.Load() != 0 {
+		if time.Now().After(deadline) { t.Fatal("watcher not removed after close") }
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err := http.Get(srv.URL + "/watch")
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("plain GET /watch: %d", resp.StatusCode)
+	}
+}
+
+func TestWatchWebSocketAuth(t *testing.T) {
+	keys := NewAPIKeys()
+	keys.Add("ka", "tenant-a")
+	keys.Add("kr", "root", RoleAdmin)
+	acl := &ACL{}
+	acl.Add("tenant-a", "a:*", RoleRead)
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	n.Auth = keys
+	n.ACL = acl
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+
+	if _, status := dialWatch(t, srv, "prefix=", ""); status != http.StatusUnauthorized {
+		t.Fatalf("anonymous /watch: %d", status)
+	}
+	if _, status := dialWatch(t, srv, "prefix=", "nope"); status != http.StatusUnauthorized {
+		t.Fatalf("/watch with a bad token: %d", status)
+	}
+	c, _ := dialWatch(t, srv, "prefix=", "ka")
+	for _, key := range []string{"b:1", "a:1"} {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key, strings.NewReader("v"))
+		req.Header.Set("Authorization", "Bearer kr")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+	}
+	if ev := c.event(); ev.Key != "a:1" {
+		t.Fatalf("tenant-a got an event for %q", ev.Key)
+	}
+}
+
+func TestWatchHubLagging(t *testing.T) {
+	var h watchHub
+	slow := h.subscribe(nil, []string{""})
+	other := h.subscribe([]string{"k"}, nil)
+	for i := 0; i <= watchBuffer; i++ {
+		h.publish("set", "x", Item{Version: int64(i)})
+	}
+	if !slow.lagged || h.count.Load() != 1 {
+		t.Fatalf("lagged %v, %d watchers", slow.lagged, h.count.Load())
+	}
+	if _, ok := h.update(other, true, []string{"k1", "k2"}, nil, 2); ok {
+		t.Fatal("update went past its limit")
+	}
+	if size, ok := h.update(other, true, []string{"k", "k1"}, nil, 2); !ok || size != 2 {
+		t.Fatalf("update within limit: %d, %v", size, ok)
+	}
+	h.publish("del", "k1", Item{})
+	if ev := <-other.events; ev.op != "del" || ev.key != "k1" {
+		t.Fatalf("event %+v", ev)
+	}
+	h.unsubscribe(slow)
+	h.unsubscribe(other)
+	if h.count.Load() != 0 {
+		t.Fatal("watchers left after unsubscribing")
+	}
+}
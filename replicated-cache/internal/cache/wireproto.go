@@ -0,0 +1,348 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file holds what the Redis (resp.go) and memcached (memcache.go) listeners share: accepting and
+tracking connections, TLS handshakes, logging in with an API key or bearer token, and running keyed
+commands through the /kv checks, which the gRPC API (grpc.go) uses too. A keyed command becomes an in-process request for /kv/KEY (GET for
+reads, PUT for writes, DELETE for deletes) passed through authentication, the caller's role, the
+ACL, the key policy hook and the rate limiter, so a client of either protocol can do exactly what
+the same credentials could over HTTP. The command itself runs at the end of that chain, in
+wireExec; a check that refuses it leaves its status and message in a wireRejection, which each
+protocol turns into its own error reply.
+
+Reads and writes go through wireGet and wireWrite, which mirror the /kv handlers: reads record hot
+keys, use the Loader on a miss and return plain values; writes are refused while the node is
+shedding load, then applied, audited and replicated, waiting for as many acknowledgements as the
+caller asks for (none over RESP and memcached).
+
+Functions:
+- (*Node) serveConns(ctx context.Context, ln net.Listener, proto string, serve func(context.Context, *wireConn)): error
+- (*Node) wireChain(rateLimited bool): http.Handler
+- (*wireConn) handshake(ctx context.Context): bool
+- wireExec(w http.ResponseWriter, r *http.Request)
+- checkedCall(h http.Handler, r *http.Request, run func(r *http.Request)): *wireRejection
+- (*wireConn) call(ctx context.Context, method, key string, run func(r *http.Request)): *wireRejection
+- (*wireConn) login(token string): (time.Duration, bool)
+- (*Node) wireMaxValue(): int64
+- (*wireConn) readLine(): ([]byte, error)
+- (*Node) wireGet(r *http.Request, key string): (Item, bool, error)
+- (*Node) plainItem(key string, it Item): (Item, error)
+- (*Node) wireWrite(r *http.Request, key, op string, it Item, min int, full bool): (int, int, error)
+*/
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	wireIdleTimeout     = 10 * time.Minute
+	wireDefaultMaxValue = 512 << 20 // Redis's own limit, used when Limits.MaxValueBytes is 0
+	// wireMaxAnonymous bounds commands before logging in, and the rest of a
+	// command beside its value.
+	wireMaxAnonymous = 64 << 10
+)
+
+var (
+	errProtocol   = errors.New("protocol error")
+	errOverloaded = errors.New("overloaded")
+	errWriteLost  = errors.New("write lost to newer version")
+)
+
+// wireConn is one client connection of a RESP or memcached listener.
+type wireConn struct {
+	n     *Node
+	h     http.Handler // wireChain
+	proto string       // Proto of the requests built for keyed commands
+	conn  net.Conn
+	tls   *tls.ConnectionState
+	r     *bufio.Reader
+	w     *bufio.Writer
+	token string // credentials the client logged in with
+}
+
+// serveConns accepts connections on ln and runs serve on each until ctx is
+// done, then closes ln and every open connection.
+func (n *Node) serveConns(ctx context.Context, ln net.Listener, proto string, serve func(context.Context, *wireConn)) error {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+		mu.Lock()
+		for c := range conns {
+			c.Close()
+		}
+		mu.Unlock()
+	})
+	defer stop()
+	h := n.wireChain(true)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				wg.Wait()
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := &wireConn{n: n, h: h, proto: proto, conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+			if c.handshake(ctx) {
+				serve(ctx, c)
+			}
+			conn.Close()
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+// wireChain returns the /kv checks that keyed commands pass through, ending
+// in wireExec; rate limiting is left out for checks that are not requests,
+// such as those of events sent to a watcher.
+func (n *Node) wireChain(rateLimited bool) http.Handler {
+	var h http.Handler = http.HandlerFunc(wireExec)
+	if n.KeyPolicy != nil {
+		h = n.checkPolicy(h)
+	}
+	if rateLimited && (n.RateLimit.Rate > 0 || len(n.RateLimit.Overrides) > 0) {
+		h = n.rateLimit(h)
+	}
+	if n.Auth != nil {
+		h = n.authenticate(h)
+	}
+	return h
+}
+
+// handshake completes the TLS handshake on TLS connections, reporting whether
+// the connection can be served.
+func (c *wireConn) handshake(ctx context.Context) bool {
+	tc, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return true
+	}
+	c.conn.SetDeadline(time.Now().Add(c.n.ReqTimeout))
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return false
+	}
+	st := tc.ConnectionState()
+	c.tls = &st
+	return true
+}
+
+// wireCall carries a keyed command through wireChain to wireExec.
+type wireCall struct {
+	run  func(r *http.Request)
+	done bool
+}
+
+type wireCallKey struct{}
+
+// wireExec runs a keyed command that passed the checks in wireChain.
+func wireExec(_ http.ResponseWriter, r *http.Request) {
+	wc := r.Context().Value(wireCallKey{}).(*wireCall)
+	wc.done = true
+	wc.run(r)
+}
+
+// call passes a command on key through wireChain, returning nil once run has
+// executed it or the answer of the check that refused it.
+func (c *wireConn) call(ctx context.Context, method, key string, run func(r *http.Request)) *wireRejection {
+	r := &http.Request{
+		Method: method, URL: &url.URL{Path: "/kv/" + key}, Proto: c.proto, Header: http.Header{},
+		Body: http.NoBody, Host: c.conn.LocalAddr().String(), RemoteAddr: c.conn.RemoteAddr().String(), TLS: c.tls,
+	}
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if t := c.n.Limits.Timeout; t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+	return checkedCall(c.h, r.WithContext(ctx), run)
+}
+
+// checkedCall passes r through the checks in h, a wireChain, returning nil
+// once run has executed it or the answer of the check that refused it.
+func checkedCall(h http.Handler, r *http.Request, run func(r *http.Request)) *wireRejection {
+	wc := &wireCall{run: run}
+	rw := &wireRejection{header: http.Header{}}
+	h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), wireCallKey{}, wc)))
+	if wc.done {
+		return nil
+	}
+	return rw
+}
+
+// wireRejection captures the answer of a check that refused a command.
+type wireRejection struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *wireRejection) Header() http.Header { return w.header }
+
+func (w *wireRejection) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *wireRejection) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *wireRejection) message() string {
+	return string(bytes.TrimSpace(w.body.Bytes()))
+}
+
+// login checks token as an API key or bearer token and, if it is valid, uses
+// it for the connection's later commands. Failures count towards
+// AuthThrottle like failed HTTP logins; while the client's address is held
+// back, login returns how long it must wait.
+func (c *wireConn) login(token string) (time.Duration, bool) {
+	n := c.n
+	ip, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	t := n.AuthThrottle
+	if t != nil {
+		if wait := n.authFails.check(ip, time.Now()); wait > 0 {
+			n.metrics.authThrottled.Add(1)
+			return wait, false
+		}
+	}
+	r := &http.Request{Header: http.Header{"Authorization": {"Bearer " + token}}, URL: &url.URL{}, RemoteAddr: c.conn.RemoteAddr().String(), TLS: c.tls}
+	if _, err := n.Auth.Authenticate(r); err != nil {
+		if t != nil {
+			n.authFailed(t, ip)
+		}
+		return 0, false
+	}
+	if t != nil {
+		n.authFails.succeed(ip)
+	}
+	c.token = token
+	return 0, true
+}
+
+// wireMaxValue is the largest value a client may send.
+func (n *Node) wireMaxValue() int64 {
+	if n.Limits.MaxValueBytes > 0 {
+		return n.Limits.MaxValueBytes
+	}
+	return wireDefaultMaxValue
+}
+
+// readLine returns the next line without its CRLF. It is only valid until
+// the next read.
+func (c *wireConn) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+// wireGet returns key's live item with its plain value, loading it on a miss
+// when there is a Loader.
+func (n *Node) wireGet(r *http.Request, key string) (Item, bool, error) {
+	n.hot.record(key)
+	it, ok := n.store.GetLive(key, n.now())
+	if !ok && n.Loader != nil {
+		var err error
+		it, err = n.load(r.Context(), key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return Item{}, false, fmt.Errorf("load failed: %v", err)
+		default:
+			ok = true
+		}
+	}
+	if !ok {
+		n.metrics.misses.Add(1)
+		if c := n.store.nsCounters(key); c != nil {
+			c.misses.Add(1)
+		}
+		return Item{}, false, nil
+	}
+	it, err := n.plainItem(key, it)
+	if err != nil {
+		return Item{}, false, err
+	}
+	n.metrics.hits.Add(1)
+	if c := n.store.nsCounters(key); c != nil {
+		c.hits.Add(1)
+	}
+	return it, true, nil
+}
+
+// plainItem returns it with its value decrypted and decompressed.
+func (n *Node) plainItem(key string, it Item) (Item, error) {
+	var err error
+	if it.Encrypted {
+		if it, err = n.decryptItem(key, it); err != nil {
+			n.log.Error("cannot decrypt value", "component", "crypto", "key", key, "err", err)
+			return Item{}, errors.New("cannot decrypt value")
+		}
+	}
+	if it.Value, err = it.plainValue(); err != nil {
+		return Item{}, errors.New("corrupt compressed value")
+	}
+	it.Compressed = false
+	return it, nil
+}
+
+// wireWrite applies, audits and replicates a client write, waiting for min
+// acknowledgements (or all, with full) like PUT /kv/KEY?min=N&full=true.
+func (n *Node) wireWrite(r *http.Request, key, op string, it Item, min int, full bool) (int, int, error) {
+	if reason := n.overload(); reason != "" {
+		return 0, 0, fmt.Errorf("%w: %s", errOverloaded, reason)
+	}
+	if !n.apply(key, it) {
+		return 0, 0, errWriteLost
+	}
+	if op == "del" {
+		n.metrics.deletes.Add(1)
+	} else {
+		n.metrics.sets.Add(1)
+	}
+	n.audit(r, op, key, it.Version)
+	acked, total, err := n.Replicate(r.Context(), syncMsgFor(key, it), min, full)
+	if err != nil {
+		return acked, total, fmt.Errorf("replication error: %v (acked %d/%d)", err, acked, total)
+	}
+	return acked, total, nil
+}
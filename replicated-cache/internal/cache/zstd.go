@@ -0,0 +1,860 @@
+/*
+Author: phyu lwin
+Project: replicated-in-memory-cache-golang
+Date: Oct 16th 2026
+
+Summary:
+This file implements a Zstandard decoder (RFC 8878) for PUT bodies sent with
+Content-Encoding: zstd, as the standard library has none. It decodes frames block by block as
+the caller reads, keeping each frame's output as the match window, which is bounded because
+callers read request bodies through readLimited. Raw, RLE and compressed blocks are supported,
+with Huffman-coded literals and FSE-coded sequences, as are skippable frames, several frames
+in a row and the optional content checksum (XXH64). Frames that need a dictionary are refused.
+
+Functions:
+- newZstdReader(r io.Reader): *zstdReader
+- (*zstdReader) Read(p []byte): (int, error)
+- (*zstdReader) next(): error
+- (*zstdReader) frameHeader(): error
+- (*zstdReader) endFrame(): error
+- (*zstdReader) block(b []byte): error
+- (*zstdReader) literals(b []byte): ([]byte, int, error)
+- (*zstdReader) sequences(b []byte, lits []byte): error
+- (*zstdReader) seqTable(t **fseTable, mode byte, b []byte, kind int): (int, error)
+- readHuffman(b []byte): (*huffTable, int, error)
+- (*huffTable) decode(dst []byte, b []byte, n int): ([]byte, error)
+- readFSECounts(b []byte, maxSymbol int, maxLog uint8): ([]int16, uint8, int, error)
+- buildFSE(norm []int16, log uint8): *fseTable
+- newRevBits(b []byte): (*revBits, error)
+- (*revBits) read(n uint8): uint64
+- xxh64(b []byte): uint64
+*/
+
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	zstdMagic      = 0xFD2FB528
+	zstdMaxBlock   = 128 << 10
+	zstdMaxHuffLog = 11
+)
+
+var errZstd = errors.New("zstd: corrupt input")
+
+// zstdReader decompresses a stream of Zstandard frames.
+type zstdReader struct {
+	r          *bufio.Reader
+	out        []byte // the current frame's output, which is also its window
+	pos        int    // bytes of out already returned
+	err        error
+	frames     int
+	inFrame    bool
+	last       bool  // the frame's last block has been decoded
+	checksum   bool  // the frame ends with a content checksum
+	size       int64 // the frame's declared content size, or -1
+	huff       *huffTable
+	ll, of, ml *fseTable
+	rep        [3]int
+	buf        []byte
+}
+
+func newZstdReader(r io.Reader) *zstdReader {
+	return &zstdReader{r: bufio.NewReader(r)}
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	for z.pos == len(z.out) && z.err == nil {
+		z.err = z.next()
+	}
+	if z.pos < len(z.out) {
+		n := copy(p, z.out[z.pos:])
+		z.pos += n
+		return n, nil
+	}
+	return 0, z.err
+}
+
+// next decodes the next block, starting or finishing frames as needed.
+func (z *zstdReader) next() error {
+	if z.inFrame && !z.last {
+		var h [3]byte
+		if _, err := io.ReadFull(z.r, h[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		v := int(h[0]) | int(h[1])<<8 | int(h[2])<<16
+		z.last = v&1 != 0
+		size := v >> 3
+		switch (v >> 1) & 3 {
+		case 0: // raw
+			if size > zstdMaxBlock {
+				return errZstd
+			}
+			n := len(z.out)
+			z.out = append(z.out, make([]byte, size)...)
+			if _, err := io.ReadFull(z.r, z.out[n:]); err != nil {
+				return unexpectedEOF(err)
+			}
+		case 1: // RLE
+			if size > zstdMaxBlock {
+				return errZstd
+			}
+			c, err := z.r.ReadByte()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			for range size {
+				z.out = append(z.out, c)
+			}
+		case 2:
+			if size > zstdMaxBlock {
+				return errZstd
+			}
+			if cap(z.buf) < size {
+				z.buf = make([]byte, size)
+			}
+			b := z.buf[:size]
+			if _, err := io.ReadFull(z.r, b); err != nil {
+				return unexpectedEOF(err)
+			}
+			if err := z.block(b); err != nil {
+				return err
+			}
+		default:
+			return errZstd
+		}
+		return nil
+	}
+	if z.inFrame {
+		return z.endFrame()
+	}
+	var m [4]byte
+	if _, err := io.ReadFull(z.r, m[:]); err != nil {
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		return unexpectedEOF(err)
+	}
+	magic := binary.LittleEndian.Uint32(m[:])
+	if magic&0xFFFFFFF0 == 0x184D2A50 {
+		if _, err := io.ReadFull(z.r, m[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if _, err := z.r.Discard(int(binary.LittleEndian.Uint32(m[:]))); err != nil {
+			return unexpectedEOF(err)
+		}
+		z.frames++
+		return nil
+	}
+	if magic != zstdMagic {
+		return errors.New("zstd: not a zstd stream")
+	}
+	return z.frameHeader()
+}
+
+func (z *zstdReader) frameHeader() error {
+	desc, err := z.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if desc&0x08 != 0 {
+		return errZstd
+	}
+	single := desc&0x20 != 0
+	if !single {
+		if _, err := z.r.ReadByte(); err != nil { // window descriptor; the whole frame is kept
+			return unexpectedEOF(err)
+		}
+	}
+	dictLen := [4]int{0, 1, 2, 4}[desc&3]
+	sizeLen := [4]int{0, 2, 4, 8}[desc>>6]
+	if single && desc>>6 == 0 {
+		sizeLen = 1
+	}
+	var b [12]byte
+	if _, err := io.ReadFull(z.r, b[:dictLen+sizeLen]); err != nil {
+		return unexpectedEOF(err)
+	}
+	for _, c := range b[:dictLen] {
+		if c != 0 {
+			return errors.New("zstd: dictionaries are not supported")
+		}
+	}
+	z.size = -1
+	if sizeLen > 0 {
+		var v [8]byte
+		copy(v[:], b[dictLen:dictLen+sizeLen])
+		z.size = int64(binary.LittleEndian.Uint64(v[:]))
+		if sizeLen == 2 {
+			z.size += 256
+		}
+	}
+	// A new frame starts a new window; bytes already returned are dropped.
+	z.out, z.pos = z.out[:0], 0
+	z.inFrame, z.last, z.checksum = true, false, desc&0x04 != 0
+	z.huff, z.ll, z.of, z.ml = nil, nil, nil, nil
+	z.rep = [3]int{1, 4, 8}
+	z.frames++
+	return nil
+}
+
+func (z *zstdReader) endFrame() error {
+	z.inFrame = false
+	if z.size >= 0 && int64(len(z.out)) != z.size {
+		return errors.New("zstd: frame content size mismatch")
+	}
+	if z.checksum {
+		var c [4]byte
+		if _, err := io.ReadFull(z.r, c[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if binary.LittleEndian.Uint32(c[:]) != uint32(xxh64(z.out)) {
+			return errors.New("zstd: checksum mismatch")
+		}
+	}
+	z.out, z.pos = z.out[:0], 0
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// block decodes a compressed block: literals, then the sequences that
+// interleave them with matches.
+func (z *zstdReader) block(b []byte) error {
+	lits, n, err := z.literals(b)
+	if err != nil {
+		return err
+	}
+	return z.sequences(b[n:], lits)
+}
+
+// literals decodes the literals section at the start of b, returning the
+// literals and the section's length.
+func (z *zstdReader) literals(b []byte) ([]byte, int, error) {
+	if len(b) == 0 {
+		return nil, 0, errZstd
+	}
+	typ, format := b[0]&3, (b[0]>>2)&3
+	if typ < 2 { // raw or RLE
+		var size, hdr int
+		switch format {
+		case 0, 2:
+			size, hdr = int(b[0]>>3), 1
+		case 1:
+			if len(b) < 2 {
+				return nil, 0, errZstd
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4, 2
+		case 3:
+			if len(b) < 3 {
+				return nil, 0, errZstd
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4|int(b[2])<<12, 3
+		}
+		if size > zstdMaxBlock {
+			return nil, 0, errZstd
+		}
+		if typ == 0 {
+			if len(b) < hdr+size {
+				return nil, 0, errZstd
+			}
+			return b[hdr : hdr+size], hdr + size, nil
+		}
+		if len(b) < hdr+1 {
+			return nil, 0, errZstd
+		}
+		lits := make([]byte, size)
+		for i := range lits {
+			lits[i] = b[hdr]
+		}
+		return lits, hdr + 1, nil
+	}
+
+	hdr, sizeBits, streams := [4]int{3, 3, 4, 5}[format], [4]uint{10, 10, 14, 18}[format], 4
+	if format == 0 {
+		streams = 1
+	}
+	if len(b) < hdr {
+		return nil, 0, errZstd
+	}
+	var v uint64
+	for i := hdr - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	mask := uint64(1)<<sizeBits - 1
+	size, csize := int((v>>4)&mask), int((v>>(4+sizeBits))&mask)
+	if size > zstdMaxBlock || len(b) < hdr+csize {
+		return nil, 0, errZstd
+	}
+	data := b[hdr : hdr+csize]
+	if typ == 2 {
+		h, n, err := readHuffman(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.huff, data = h, data[n:]
+	} else if z.huff == nil {
+		return nil, 0, errZstd
+	}
+	lits := make([]byte, 0, size)
+	var err error
+	if streams == 1 {
+		if lits, err = z.huff.decode(lits, data, size); err != nil {
+			return nil, 0, err
+		}
+		return lits, hdr + csize, nil
+	}
+	if len(data) < 6 {
+		return nil, 0, errZstd
+	}
+	per := (size + 3) / 4
+	sizes := [4]int{int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), int(binary.LittleEndian.Uint16(data[4:]))}
+	sizes[3] = len(data) - 6 - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 || size < 3*per {
+		return nil, 0, errZstd
+	}
+	data = data[6:]
+	for i, s := range sizes {
+		count := per
+		if i == 3 {
+			count = size - 3*per
+		}
+		if lits, err = z.huff.decode(lits, data[:s], count); err != nil {
+			return nil, 0, err
+		}
+		data = data[s:]
+	}
+	return lits, hdr + csize, nil
+}
+
+// Literal length and match length codes above the directly coded ones: base
+// value and extra bits.
+var (
+	llBase = [36]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	llBits = [36]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	mlBase = [53]uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26,
+		27, 28, 29, 30, 31, 32, 33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	mlBits = [53]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+)
+
+// Predefined distributions for sequences, used by mode 0.
+var (
+	llDefault = buildFSE([]int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1}, 6)
+	mlDefault = buildFSE([]int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}, 6)
+	ofDefault = buildFSE([]int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+const (
+	kindLL = iota
+	kindOF
+	kindML
+)
+
+// sequences decodes the sequences section b and executes it, appending the
+// literals and matches to the frame's output.
+func (z *zstdReader) sequences(b []byte, lits []byte) error {
+	if len(b) == 0 {
+		return errZstd
+	}
+	var nseq, n int
+	switch c := int(b[0]); {
+	case c == 0:
+		if len(b) != 1 {
+			return errZstd
+		}
+		z.out = append(z.out, lits...)
+		return nil
+	case c < 128:
+		nseq, n = c, 1
+	case c < 255:
+		if len(b) < 2 {
+			return errZstd
+		}
+		nseq, n = (c-128)<<8|int(b[1]), 2
+	default:
+		if len(b) < 3 {
+			return errZstd
+		}
+		nseq, n = int(b[1])|int(b[2])<<8+0x7F00, 3
+	}
+	if len(b) < n+1 {
+		return errZstd
+	}
+	modes := b[n]
+	if modes&3 != 0 {
+		return errZstd
+	}
+	b = b[n+1:]
+	for _, t := range [...]struct {
+		table **fseTable
+		mode  byte
+		kind  int
+	}{{&z.ll, modes >> 6, kindLL}, {&z.of, (modes >> 4) & 3, kindOF}, {&z.ml, (modes >> 2) & 3, kindML}} {
+		used, err := z.seqTable(t.table, t.mode, b, t.kind)
+		if err != nil {
+			return err
+		}
+		b = b[used:]
+	}
+
+	br, err := newRevBits(b)
+	if err != nil {
+		return err
+	}
+	llState, ofState, mlState := int(br.read(z.ll.log)), int(br.read(z.of.log)), int(br.read(z.ml.log))
+	for i := range nseq {
+		ofCode, llCode, mlCode := z.of.entries[ofState].symbol, z.ll.entries[llState].symbol, z.ml.entries[mlState].symbol
+		if ofCode > 31 || llCode > 35 || mlCode > 52 {
+			return errZstd
+		}
+		ov := int(1)<<ofCode + int(br.read(ofCode))
+		ml := int(mlBase[mlCode]) + int(br.read(mlBits[mlCode]))
+		ll := int(llBase[llCode]) + int(br.read(llBits[llCode]))
+
+		var off int
+		if ov > 3 {
+			off = ov - 3
+			z.rep = [3]int{off, z.rep[0], z.rep[1]}
+		} else {
+			idx := ov - 1
+			if ll == 0 {
+				idx++
+			}
+			switch idx {
+			case 0:
+				off = z.rep[0]
+			case 1:
+				off = z.rep[1]
+				z.rep = [3]int{off, z.rep[0], z.rep[2]}
+			case 2:
+				off = z.rep[2]
+				z.rep = [3]int{off, z.rep[0], z.rep[1]}
+			default:
+				off = z.rep[0] - 1
+				z.rep = [3]int{off, z.rep[0], z.rep[1]}
+			}
+		}
+
+		if ll > len(lits) {
+			return errZstd
+		}
+		z.out = append(z.out, lits[:ll]...)
+		lits = lits[ll:]
+		if off <= 0 || off > len(z.out) {
+			return errZstd
+		}
+		start := len(z.out) - off
+		for j := range ml {
+			z.out = append(z.out, z.out[start+j])
+		}
+
+		if i < nseq-1 {
+			e := z.ll.entries[llState]
+			llState = int(e.base) + int(br.read(e.bits))
+			e = z.ml.entries[mlState]
+			mlState = int(e.base) + int(br.read(e.bits))
+			e = z.of.entries[ofState]
+			ofState = int(e.base) + int(br.read(e.bits))
+		}
+	}
+	if br.pos != 0 {
+		return errZstd
+	}
+	z.out = append(z.out, lits...)
+	return nil
+}
+
+// seqTable sets *t for one kind of sequence code from its compression mode,
+// returning how many bytes of b its description took.
+func (z *zstdReader) seqTable(t **fseTable, mode byte, b []byte, kind int) (int, error) {
+	switch mode {
+	case 0:
+		*t = [...]*fseTable{llDefault, ofDefault, mlDefault}[kind]
+		return 0, nil
+	case 1:
+		if len(b) == 0 {
+			return 0, errZstd
+		}
+		*t = &fseTable{entries: []fseEntry{{symbol: b[0]}}}
+		return 1, nil
+	case 2:
+		maxSym, maxLog := [...]int{35, 31, 52}[kind], [...]uint8{9, 8, 9}[kind]
+		norm, log, n, err := readFSECounts(b, maxSym, maxLog)
+		if err != nil {
+			return 0, err
+		}
+		*t = buildFSE(norm, log)
+		return n, nil
+	default:
+		if *t == nil {
+			return 0, errZstd
+		}
+		return 0, nil
+	}
+}
+
+// huffTable decodes Huffman-coded literals by looking up log bits at a time.
+type huffTable struct {
+	log     uint8
+	entries []huffEntry
+}
+
+type huffEntry struct {
+	symbol byte
+	bits   uint8
+}
+
+// readHuffman reads a Huffman tree description, returning the table and the
+// description's length.
+func readHuffman(b []byte) (*huffTable, int, error) {
+	if len(b) == 0 {
+		return nil, 0, errZstd
+	}
+	var weights []uint8
+	hdr := int(b[0])
+	n := 1
+	if hdr >= 128 {
+		count := hdr - 127
+		n += (count + 1) / 2
+		if len(b) < n {
+			return nil, 0, errZstd
+		}
+		for i := range count {
+			w := b[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights = append(weights, w&15)
+		}
+	} else {
+		n += hdr
+		if len(b) < n {
+			return nil, 0, errZstd
+		}
+		data := b[1:n]
+		norm, log, used, err := readFSECounts(data, 255, 6)
+		if err != nil {
+			return nil, 0, err
+		}
+		t := buildFSE(norm, log)
+		br, err := newRevBits(data[used:])
+		if err != nil {
+			return nil, 0, err
+		}
+		// Two states share the stream, taking turns, until it runs out.
+		s1, s2 := int(br.read(log)), int(br.read(log))
+		for len(weights) < 255 {
+			e := t.entries[s1]
+			weights = append(weights, e.symbol)
+			s1 = int(e.base) + int(br.read(e.bits))
+			if br.pos < 0 {
+				weights = append(weights, t.entries[s2].symbol)
+				break
+			}
+			e = t.entries[s2]
+			weights = append(weights, e.symbol)
+			s2 = int(e.base) + int(br.read(e.bits))
+			if br.pos < 0 {
+				weights = append(weights, t.entries[s1].symbol)
+				break
+			}
+		}
+		if br.pos >= 0 || len(weights) > 255 {
+			return nil, 0, errZstd
+		}
+	}
+
+	// The last symbol's weight is implied: it brings the total to a power of two.
+	var total uint32
+	for _, w := range weights {
+		if w > zstdMaxHuffLog {
+			return nil, 0, errZstd
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, errZstd
+	}
+	log := uint8(bits.Len32(total))
+	if log > zstdMaxHuffLog {
+		return nil, 0, errZstd
+	}
+	rest := uint32(1)<<log - total
+	if rest&(rest-1) != 0 {
+		return nil, 0, errZstd
+	}
+	weights = append(weights, uint8(bits.Len32(rest)))
+
+	// Symbols take 2^(weight-1) consecutive entries, lightest weights first.
+	var start [zstdMaxHuffLog + 2]int
+	for _, w := range weights {
+		if w > 0 {
+			start[w] += 1 << (w - 1)
+		}
+	}
+	next := 0
+	for w := 1; w <= int(log); w++ {
+		next, start[w] = next+start[w], next
+	}
+	t := &huffTable{log: log, entries: make([]huffEntry, 1<<log)}
+	for sym, w := range weights {
+		if w == 0 {
+			continue
+		}
+		e := huffEntry{symbol: byte(sym), bits: log + 1 - w}
+		for i := range 1 << (w - 1) {
+			t.entries[start[w]+i] = e
+		}
+		start[w] += 1 << (w - 1)
+	}
+	return t, n, nil
+}
+
+// decode appends the n symbols coded in the stream b to dst.
+func (h *huffTable) decode(dst []byte, b []byte, n int) ([]byte, error) {
+	br, err := newRevBits(b)
+	if err != nil {
+		return nil, err
+	}
+	for range n {
+		e := h.entries[br.peek(h.log)]
+		dst = append(dst, e.symbol)
+		br.pos -= int(e.bits)
+	}
+	if br.pos != 0 {
+		return nil, errZstd
+	}
+	return dst, nil
+}
+
+// fseTable decodes finite state entropy codes: each state yields a symbol,
+// and the next state is base plus the next bits of the stream.
+type fseTable struct {
+	log     uint8
+	entries []fseEntry
+}
+
+type fseEntry struct {
+	symbol byte
+	bits   uint8
+	base   uint16
+}
+
+// readFSECounts reads an FSE table description from the start of b,
+// returning the normalized counts (-1 for "less than one"), the table's
+// accuracy log and the description's length.
+func readFSECounts(b []byte, maxSymbol int, maxLog uint8) ([]int16, uint8, int, error) {
+	var pos uint // bit position in b
+	read := func(n uint) uint32 {
+		var v uint32
+		for i := uint(0); i < n; i++ {
+			p := pos + i
+			if p/8 < uint(len(b)) && b[p/8]>>(p%8)&1 != 0 {
+				v |= 1 << i
+			}
+		}
+		return v
+	}
+	log := uint8(read(4)) + 5
+	pos = 4
+	if log > maxLog {
+		return nil, 0, 0, errZstd
+	}
+	remaining := int32(1)<<log + 1
+	threshold := int32(1) << log
+	nbits := uint(log) + 1
+	var norm []int16
+	prev0 := false
+	for remaining > 1 && len(norm) <= maxSymbol {
+		if prev0 {
+			for {
+				rep := read(2)
+				pos += 2
+				for range rep {
+					norm = append(norm, 0)
+				}
+				if rep != 3 {
+					break
+				}
+			}
+			if len(norm) > maxSymbol {
+				return nil, 0, 0, errZstd
+			}
+		}
+		max := 2*threshold - 1 - remaining
+		v := int32(read(nbits))
+		var count int32
+		if low := v & (threshold - 1); low < max {
+			count = low
+			pos += nbits - 1
+		} else {
+			count = v & (2*threshold - 1)
+			if count >= threshold {
+				count -= max
+			}
+			pos += nbits
+		}
+		count--
+		if count < 0 {
+			remaining--
+		} else {
+			remaining -= count
+		}
+		norm = append(norm, int16(count))
+		prev0 = count == 0
+		for remaining < threshold && threshold > 1 {
+			nbits--
+			threshold >>= 1
+		}
+	}
+	used := int((pos + 7) / 8)
+	if remaining != 1 || used > len(b) || len(norm) > maxSymbol+1 {
+		return nil, 0, 0, errZstd
+	}
+	return norm, log, used, nil
+}
+
+// buildFSE builds the decoding table for normalized counts summing to 2^log.
+func buildFSE(norm []int16, log uint8) *fseTable {
+	size := 1 << log
+	t := &fseTable{log: log, entries: make([]fseEntry, size)}
+	next := make([]int, len(norm))
+	high := size - 1
+	for s, c := range norm {
+		if c == -1 {
+			t.entries[high].symbol = byte(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(c)
+		}
+	}
+	pos, step, mask := 0, size>>1+size>>3+3, size-1
+	for s, c := range norm {
+		for range max(int(c), 0) {
+			t.entries[pos].symbol = byte(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	for i := range t.entries {
+		e := &t.entries[i]
+		state := next[e.symbol]
+		next[e.symbol]++
+		e.bits = log - uint8(bits.Len(uint(state))-1)
+		e.base = uint16(state<<e.bits - size)
+	}
+	return t
+}
+
+// revBits reads a zstd bitstream backwards, from its last byte's highest set
+// bit (the end marker) toward the start. Reading past the start yields zeros
+// and leaves pos negative.
+type revBits struct {
+	b   []byte
+	pos int // bits left to read
+}
+
+func newRevBits(b []byte) (*revBits, error) {
+	if len(b) == 0 || b[len(b)-1] == 0 {
+		return nil, errZstd
+	}
+	return &revBits{b: b, pos: len(b)*8 - 1 - bits.LeadingZeros8(b[len(b)-1])}, nil
+}
+
+func (br *revBits) read(n uint8) uint64 {
+	v := br.peek(n)
+	br.pos -= int(n)
+	return v
+}
+
+// peek returns the next n bits without consuming them.
+func (br *revBits) peek(n uint8) uint64 {
+	var v uint64
+	start := br.pos - int(n)
+	for i := 0; i < int(n); {
+		p := start + i
+		if p < 0 {
+			i++
+			continue
+		}
+		take := min(8-p%8, int(n)-i)
+		v |= uint64(br.b[p/8]>>(p%8)&(1<<take-1)) << i
+		i += take
+	}
+	return v
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64 is XXH64 with seed 0, whose low 32 bits are a frame's checksum.
+func xxh64(b []byte) uint64 {
+	round := func(acc, in uint64) uint64 {
+		return bits.RotateLeft64(acc+in*xxPrime2, 31) * xxPrime1
+	}
+	n := uint64(len(b))
+	var h uint64
+	if len(b) >= 32 {
+		var seed uint64
+		v1, v2, v3, v4 := seed+xxPrime1+xxPrime2, seed+xxPrime2, seed, seed-xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = round(v1, binary.LittleEndian.Uint64(b))
+			v2 = round(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = round(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = round(v4, binary.LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		for _, v := range [...]uint64{v1, v2, v3, v4} {
+			h = (h^round(0, v))*xxPrime1 + xxPrime4
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += n
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
@@ -0,0 +1,138 @@
+/*
+Author: Phyu Lwin
+Project: Replicated In-Memory Cache Golang
+Date: Oct 16th, 2026
+
+Summary:
+	This file contains tests for the Zstandard decoder and compressed PUT bodies.
+
+List of functions:
+	- zstdSample: Returns the text compressed in zstdSampleFrame.
+	- TestZstdReader: Tests decoding frames made by the zstd tool, with skippable frames and checksums.
+	- TestXXH64: Tests XXH64 against known values.
+	- TestCompressedPut: Tests PUT bodies sent with Content-Encoding zstd, deflate and unsupported encodings.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// zstdSampleFrame is zstdSample compressed by `zstd -19`: Huffman-coded
+// literals and FSE-coded sequences with their own tables.
+var zstdSampleFrame, _ = hex.DecodeString(
+	"28b52ffd64dc04250a00f2841011907d849276416969dc4d64eadb3433a301628464c448c3a0414e28d3e1dbce125bc7" +
+	"f55547239a4fd0d3ef2fe9b759f51e2806236d0bfa31c50085ffee80eda6018086a8416b52c8ce9e01101cc5a4ba0d12" +
+	"8830aa0644804a63c1b09214a6ed26c4d89036ee4cdb3623aaea95a92a827b6124b88c1460538995720267b26e20c160" +
+	"bbfa0ae830f48d9de435d82b794093a50cd634229b64ed798ae96f796349a4b35a59df86bf18c95496879fbb2b2df6eb" +
+	"f42b2b2b82e14bf34411bc20ed8e351540c0c454b07aeaa11b638f073cbcbcf4c6a6be272031add47a4f488ec820ad13" +
+	"6b69a51ecf781487c0782c7556847def4012bf2a77935551cd018a73888172c650fa66f3e17d4b3b9aa2a578fb30005e" +
+	"193c88d61ba6d6a84a42521a0d3215d3b23fab41741d6c019cd06a1a05c9a01f956632e70e3096c701423d42a50a48f9" +
+	"648e")
+
+// zstdABC is "abc" as one raw block, with a checksum.
+var zstdABC, _ = hex.DecodeString("28b52ffd0458190000616263990977ad")
+
+func zstdSample() []byte {
+	words := []string{"cache ", "node ", "replica ", "version ", "tombstone ", "peer ", "gossip ", "quorum ", "lease ", "shard "}
+	var b bytes.Buffer
+	x := uint32(2463534242)
+	for b.Len() < 1500 {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		b.WriteString(words[x%uint32(len(words))])
+		if x%7 == 0 {
+			b.WriteByte(byte('0' + x%10))
+		}
+	}
+	return b.Bytes()
+}
+
+func TestZstdReader(t *testing.T) {
+	decode := func(in []byte) ([]byte, error) { return io.ReadAll(newZstdReader(bytes.NewReader(in))) }
+
+	got, err := decode(zstdSampleFrame)
+	if err != nil { t.Fatal(err) }
+	if !bytes.Equal(got, zstdSample()) {
+		t.Fatalf("sample: got %q", got)
+	}
+
+	// Frames may follow one another, with skippable frames in between.
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'x', 'y'}
+	var in []byte
+	in = append(in, zstdABC...)
+	in = append(in, skippable...)
+	in = append(in, zstdSampleFrame...)
+	in = append(in, zstdABC...)
+	got, err = decode(in)
+	if err != nil { t.Fatal(err) }
+	if want := "abc" + string(zstdSample()) + "abc"; string(got) != want {
+		t.Fatalf("concatenated frames: got %d bytes, want %d", len(got), len(want))
+	}
+
+	bad := bytes.Clone(zstdABC)
+	bad[len(bad)-1] ^= 1
+	if _, err := decode(bad); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("bad checksum: %v", err)
+	}
+	bad = bytes.Clone(zstdSampleFrame)
+	bad[40] ^= 0x10
+	if _, err := decode(bad); err == nil {
+		t.Fatal("corrupt frame decoded without error")
+	}
+	for _, in := range [][]byte{nil, zstdSampleFrame[:len(zstdSampleFrame)/2], []byte("plain text")} {
+		if _, err := decode(in); err == nil {
+			t.Fatalf("%q decoded without error", in)
+		}
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	for in, want := range map[string]uint64{"": 0xEF46DB3751D8E999, "abc": 0x44BC2CF5AD770999} {
+		if got := xxh64([]byte(in)); got != want {
+			t.Errorf("xxh64(%q) = %x, want %x", in, got, want)
+		}
+	}
+}
+
+func TestCompressedPut(t *testing.T) {
+	n := NewNode("N", ":x", nil)
+	n.AccessLog = false
+	srv := httptest.NewServer(n.Routes())
+	defer srv.Close()
+	put := func(key, encoding string, body []byte) int {
+		req, _ := http.NewRequest("PUT", srv.URL+"/kv/"+key, bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", encoding)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil { t.Fatal(err) }
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := put("z", "zstd", zstdSampleFrame); code != 201 { t.Fatalf("zstd PUT: %d", code) }
+	var zl bytes.Buffer
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte("deflated value"))
+	zw.Close()
+	if code := put("d", "deflate", zl.Bytes()); code != 201 { t.Fatalf("deflate PUT: %d", code) }
+	if it, _ := n.store.Get("z"); !bytes.Equal(it.Value, zstdSample()) {
+		t.Fatalf("zstd value stored as %d bytes", len(it.Value))
+	}
+	if it, _ := n.store.Get("d"); string(it.Value) != "deflated value" {
+		t.Fatalf("deflate value stored as %q", it.Value)
+	}
+
+	if code := put("x", "zstd", zstdSampleFrame[:100]); code != 400 { t.Fatalf("truncated zstd PUT: %d", code) }
+	if code := put("x", "br", []byte("x")); code != http.StatusUnsupportedMediaType { t.Fatalf("br PUT: %d", code) }
+	n.Limits.MaxValueBytes = 1000
+	if code := put("x", "zstd", zstdSampleFrame); code != http.StatusRequestEntityTooLarge { t.Fatalf("oversized zstd PUT: %d", code) }
+}